@@ -2,10 +2,7 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261#section-20.7
@@ -295,21 +292,21 @@ type Authorization struct {
 	realm      string      // realm = "realm" EQUAL realm-value,realm-value = quoted-string
 	nonce      string      // nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
 	uri        *RequestUri // digest-uri = "uri" EQUAL LDQUOT digest-uri-value RDQUOT,digest-uri-value = rquest-uri ; Equal to request-uri as specified by HTTP/1.1
+	uriValue   string      // the digest-uri-value as received,the A2 of the request-digest is over it
 	response   string      // dresponse = "response" EQUAL request-digest, request-digest = LDQUOT 32LHEX RDQUOT
 	algorithm  string      // algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
 	cnonce     string      // cnonce = "cnonce" EQUAL cnonce-value,cnonce-value = nonce-value
 	opaque     string      // opaque =  "opaque" EQUAL quoted-string
 	qop        string      // message-qop = "qop" EQUAL qop-value,qop-value = "auth" / "auth-int" / token
 	nc         string      // nonce-count = "nc" EQUAL nc-value,nc-value = 8LHEX
-	authParam  sync.Map    // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-	isOrder    bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order      chan string // It is convenient to record the order of the original parameter fields when parsing
+	authParam  *Params     // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
+	order      []string    // parameter names in the parsed order,the typed parameters included
 	source     string      // source string
 }
 
 // "Authorization"
 func (au *Authorization) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(authorization)$`).MatchString(field) {
+	if scanFieldIs(field, "authorization") {
 		au.field = strings.Title(field)
 	} else {
 		au.field = strings.Title("Authorization")
@@ -321,7 +318,7 @@ func (au *Authorization) GetField() string {
 
 // auth-schema: Basic / Digest
 func (au *Authorization) SetAuthSchema(authSchema string) {
-	if regexp.MustCompile(`(?i)(basic|digest)`).MatchString(authSchema) {
+	if scanFieldIs(authSchema, "basic", "digest") {
 		au.authSchema = strings.Title(authSchema)
 	}
 	au.authSchema = "Digest"
@@ -357,11 +354,22 @@ func (au *Authorization) GetNonce() string {
 // digest-uri = "uri" EQUAL LDQUOT digest-uri-value RDQUOT,digest-uri-value = rquest-uri ; Equal to request-uri as specified by HTTP/1.1
 func (au *Authorization) SetUri(uri *RequestUri) {
 	au.uri = uri
+	au.uriValue = ""
 }
 func (au *Authorization) GetUri() *RequestUri {
 	return au.uri
 }
 
+// GetUriValue returns the digest-uri-value as received,example: "sip:Example.COM;transport=TCP",
+// the Raw of the uri when it was set
+func (au *Authorization) GetUriValue() string {
+	if len(au.uriValue) == 0 && au.uri != nil {
+		uri := au.uri.Raw()
+		return uri.String()
+	}
+	return au.uriValue
+}
+
 // dresponse = "response" EQUAL request-digest, request-digest = LDQUOT 32LHEX RDQUOT
 func (au *Authorization) SetResponse(response string) {
 	au.response = response
@@ -411,10 +419,10 @@ func (au *Authorization) GetNc() string {
 }
 
 // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-func (au *Authorization) SetAuthParam(authParam sync.Map) {
+func (au *Authorization) SetAuthParam(authParam *Params) {
 	au.authParam = authParam
 }
-func (au *Authorization) GetAuthParam() sync.Map {
+func (au *Authorization) GetAuthParam() *Params {
 	return au.authParam
 }
 
@@ -422,7 +430,7 @@ func (au *Authorization) GetAuthParam() sync.Map {
 func (au *Authorization) GetSource() string {
 	return au.source
 }
-func NewAuthorization(username string, realm string, nonce string, uri *RequestUri, response string, algorithm string, cnonce string, opaque string, qop string, nc string, authParam sync.Map) *Authorization {
+func NewAuthorization(username string, realm string, nonce string, uri *RequestUri, response string, algorithm string, cnonce string, opaque string, qop string, nc string, authParam *Params) *Authorization {
 	return &Authorization{
 		field:      "Authorization",
 		authSchema: "Digest",
@@ -437,321 +445,137 @@ func NewAuthorization(username string, realm string, nonce string, uri *RequestU
 		qop:        qop,
 		nc:         nc,
 		authParam:  authParam,
-		isOrder:    false,
 	}
 }
 func (au *Authorization) Raw() (result strings.Builder) {
 
 	// "Authorization"
-	if len(strings.TrimSpace(au.field)) == 0 {
-		au.field = "Authorization"
-		result.WriteString(fmt.Sprintf("%s:", strings.Title(au.field)))
+	field := au.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Authorization"
+		result.WriteString(fmt.Sprintf("%s:", strings.Title(field)))
 	} else {
-		result.WriteString(fmt.Sprintf("%s:", au.field))
+		result.WriteString(fmt.Sprintf("%s:", field))
 	}
 	// auth-schema: Basic / Digest
-	if len(strings.TrimSpace(au.authSchema)) == 0 {
-		au.authSchema = "Digest"
-		result.WriteString(fmt.Sprintf(" %s", strings.Title(au.authSchema)))
+	authSchema := au.authSchema
+	if len(strings.TrimSpace(authSchema)) == 0 {
+		authSchema = "Digest"
+		result.WriteString(fmt.Sprintf(" %s", strings.Title(authSchema)))
 	} else {
-		result.WriteString(fmt.Sprintf(" %s", au.authSchema))
+		result.WriteString(fmt.Sprintf(" %s", authSchema))
 	}
 
-	if au.isOrder {
-		au.isOrder = false
-		for orders := range au.order {
-			if regexp.MustCompile(`((?i)(username))( )*=`).MatchString(orders) {
-				// username = "username" EQUAL username-value,username-value = quoted-string
-				if len(strings.TrimSpace(au.username)) > 0 {
-					result.WriteString(fmt.Sprintf(" username=\"%s\",", au.username))
-					continue
-				}
-			}
-			if regexp.MustCompile(`((?i)(realm))( )*=`).MatchString(orders) {
-				// realm = "realm" EQUAL realm-value,realm-value = quoted-string
-				if len(strings.TrimSpace(au.realm)) > 0 {
-					result.WriteString(fmt.Sprintf(" realm=\"%s\",", au.realm))
-					continue
-				}
-			}
-			if regexp.MustCompile(`((?i)(nonce))( )*=`).MatchString(orders) {
-				// nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-				if len(strings.TrimSpace(au.nonce)) > 0 {
-					result.WriteString(fmt.Sprintf(" nonce=\"%s\",", au.nonce))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(uri))( )*=`).MatchString(orders) {
-				// digest-uri = "uri" EQUAL LDQUOT digest-uri-value RDQUOT,digest-uri-value = rquest-uri ; Equal to request-uri as specified by HTTP/1.1
-				if au.uri != nil {
-					uri := au.uri.Raw()
-					result.WriteString(fmt.Sprintf(" uri=\"%s\",", uri.String()))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(response))( )*=`).MatchString(orders) {
-				// dresponse = "response" EQUAL request-digest, request-digest = LDQUOT 32LHEX RDQUOT
-				if len(strings.TrimSpace(au.response)) > 0 {
-					result.WriteString(fmt.Sprintf(" response=\"%s\",", au.response))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(algorithm))( )*=`).MatchString(orders) {
-				// algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-				if len(strings.TrimSpace(au.algorithm)) > 0 {
-					result.WriteString(fmt.Sprintf(" algorithm=%s,", au.algorithm))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(cnonce))( )*=`).MatchString(orders) {
-				// cnonce = "cnonce" EQUAL cnonce-value,cnonce-value = nonce-value
-				if len(strings.TrimSpace(au.cnonce)) > 0 {
-					result.WriteString(fmt.Sprintf(" cnonce=\"%s\",", au.cnonce))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(opaque))( )*=`).MatchString(orders) {
-				// opaque =  "opaque" EQUAL quoted-string
-				if len(strings.TrimSpace(au.opaque)) > 0 {
-					result.WriteString(fmt.Sprintf(" opaque=\"%s\",", au.opaque))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(qop))( )*=`).MatchString(orders) {
-				// message-qop = "qop" EQUAL qop-value,qop-value = "auth" / "auth-int" / token
-				if len(strings.TrimSpace(au.qop)) > 0 {
-					result.WriteString(fmt.Sprintf(" qop=%s,", au.qop))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(nc))( )*=`).MatchString(orders) {
-				// nonce-count = "nc" EQUAL nc-value,nc-value = 8LHEX
-				if len(strings.TrimSpace(au.nc)) > 0 {
-					result.WriteString(fmt.Sprintf(" nc=%s,", au.nc))
-				}
-				continue
-			}
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := au.authParam.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf("  %v=\"%v\",", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := au.authParam.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(" %v=\"%v\",", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-					}
-
-				} else {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", ordersSlice[1]))) > 0 {
-						result.WriteString(fmt.Sprintf("  %v=\"%v\",", ordersSlice[0], ordersSlice[1]))
-					} else {
-						result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-					}
-				}
-			}
-		}
-	} else {
-		// username = "username" EQUAL username-value,username-value = quoted-string
-		if len(strings.TrimSpace(au.username)) > 0 {
-			result.WriteString(fmt.Sprintf(" username=\"%s\",", au.username))
-		}
-		// realm = "realm" EQUAL realm-value,realm-value = quoted-string
-		if len(strings.TrimSpace(au.realm)) > 0 {
-			result.WriteString(fmt.Sprintf(" realm=\"%s\",", au.realm))
-		}
-		// nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-		if len(strings.TrimSpace(au.nonce)) > 0 {
-			result.WriteString(fmt.Sprintf(" nonce=\"%s\",", au.nonce))
-		}
-		// digest-uri = "uri" EQUAL LDQUOT digest-uri-value RDQUOT,digest-uri-value = rquest-uri ; Equal to request-uri as specified by HTTP/1.1
-		if au.uri != nil {
-			uri := au.uri.Raw()
-			result.WriteString(fmt.Sprintf(" uri=\"%s\",", uri.String()))
-		}
-		// dresponse = "response" EQUAL request-digest, request-digest = LDQUOT 32LHEX RDQUOT
-		if len(strings.TrimSpace(au.response)) > 0 {
-			result.WriteString(fmt.Sprintf(" response=\"%s\",", au.response))
-		}
-		// algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-		if len(strings.TrimSpace(au.algorithm)) > 0 {
-			result.WriteString(fmt.Sprintf(" algorithm=%s,", au.algorithm))
-		}
-		// cnonce = "cnonce" EQUAL cnonce-value,cnonce-value = nonce-value
-		if len(strings.TrimSpace(au.cnonce)) > 0 {
-			result.WriteString(fmt.Sprintf(" cnonce=\"%s\",", au.cnonce))
-		}
-		// opaque =  "opaque" EQUAL quoted-string
-		if len(strings.TrimSpace(au.opaque)) > 0 {
-			result.WriteString(fmt.Sprintf(" opaque=\"%s\",", au.opaque))
-		}
-		// message-qop = "qop" EQUAL qop-value,qop-value = "auth" / "auth-int" / token
-		if len(strings.TrimSpace(au.qop)) > 0 {
-			result.WriteString(fmt.Sprintf(" qop=%s,", au.qop))
-		}
-		// nonce-count = "nc" EQUAL nc-value,nc-value = 8LHEX
-		if len(strings.TrimSpace(au.nc)) > 0 {
-			result.WriteString(fmt.Sprintf(" nc=%s,", au.nc))
-		}
+	typed := NewParams()
+	// username = "username" EQUAL username-value,username-value = quoted-string
+	if len(strings.TrimSpace(au.username)) > 0 {
+		typed.SetQuoted("username", au.username)
+	}
+	// realm = "realm" EQUAL realm-value,realm-value = quoted-string
+	if len(strings.TrimSpace(au.realm)) > 0 {
+		typed.SetQuoted("realm", au.realm)
+	}
+	// nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
+	if len(strings.TrimSpace(au.nonce)) > 0 {
+		typed.SetQuoted("nonce", au.nonce)
+	}
+	// digest-uri = "uri" EQUAL LDQUOT digest-uri-value RDQUOT,digest-uri-value = rquest-uri ; Equal to request-uri as specified by HTTP/1.1
+	if au.uri != nil {
+		uri := au.uri.Raw()
+		typed.SetQuoted("uri", uri.String())
+	}
+	// dresponse = "response" EQUAL request-digest, request-digest = LDQUOT 32LHEX RDQUOT
+	if len(strings.TrimSpace(au.response)) > 0 {
+		typed.SetQuoted("response", au.response)
+	}
+	// algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
+	if len(strings.TrimSpace(au.algorithm)) > 0 {
+		typed.Set("algorithm", au.algorithm)
+	}
+	// cnonce = "cnonce" EQUAL cnonce-value,cnonce-value = nonce-value
+	if len(strings.TrimSpace(au.cnonce)) > 0 {
+		typed.SetQuoted("cnonce", au.cnonce)
+	}
+	// opaque =  "opaque" EQUAL quoted-string
+	if len(strings.TrimSpace(au.opaque)) > 0 {
+		typed.SetQuoted("opaque", au.opaque)
+	}
+	// message-qop = "qop" EQUAL qop-value,qop-value = "auth" / "auth-int" / token
+	if len(strings.TrimSpace(au.qop)) > 0 {
+		typed.Set("qop", au.qop)
+	}
+	// nonce-count = "nc" EQUAL nc-value,nc-value = 8LHEX
+	if len(strings.TrimSpace(au.nc)) > 0 {
+		typed.Set("nc", au.nc)
 	}
-
 	// auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-	au.authParam.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(" %v,", key))
-				return true
-			}
-			result.WriteString(fmt.Sprintf(" %v=\"%v\",", key, value))
-			return true
-		}
-		result.WriteString(fmt.Sprintf(" %v,", key))
-		return true
-	})
-	temp := result.String()
-	temp = strings.TrimSuffix(temp, ",")
-	result.Reset()
-	result.WriteString(temp)
+	result.WriteString(paramsMerge(au.order, typed, au.authParam).raw(" ", ", ", true))
 	result.WriteString("\r\n")
 	return
 }
-func (au *Authorization) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (au *Authorization) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Authorization", raw, 0, `Authorization  =  "Authorization" HCOLON credentials`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`((?i)(?:^authorization))( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "authorization")
+	if !ok {
+		return NewParseError("Authorization", raw, 0, `Authorization  =  "Authorization" HCOLON credentials`)
 	}
 	au.source = raw
 	au.uri = new(RequestUri)
-	au.authParam = sync.Map{}
-
-	field := fieldRegexp.FindString(raw)
-	field = regexp.MustCompile(`:`).ReplaceAllString(field, "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	au.field = field
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// auth-schema regexp
-	authschemaRegexp := regexp.MustCompile(`(?i)(basic|digest)`)
-	if authschemaRegexp.MatchString(raw) {
-		authschema := authschemaRegexp.FindString(raw)
-		au.authSchema = authschema
-		raw = authschemaRegexp.ReplaceAllString(raw, "")
+	au.uriValue = ""
+	au.authParam = NewParams()
+	au.order = nil
+
+	au.field = stringTrimPrefixAndTrimSuffix(field, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// auth-schema
+	if authSchema := scanUntil(raw, " "); scanFieldIs(authSchema, "basic", "digest") {
+		au.authSchema = authSchema
+		raw = raw[len(authSchema):]
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	raw = stringTrimPrefixAndTrimSuffix(raw, ",")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Authorization", au.source, len(au.source), `credentials  =  ("Digest" LWS digest-response) / other-response`)
 	}
 
-	// authorization order
-	au.authorizationOrder(raw)
-
-	// username regexp : username = "username" EQUAL username-value,username-value = quoted-string
-	usernameRegexp := regexp.MustCompile(`((?i)(?:^username))( )*=`)
-	// realm regexp : realm = "realm" EQUAL realm-value,realm-value = quoted-string
-	realmRegexp := regexp.MustCompile(`((?i)(?:^realm))( )*=`)
-	// nonce regexp : nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-	nonceRegexp := regexp.MustCompile(`((?i)(?:^nonce))( )*=`)
-	// uri regexp : digest-uri = "uri" EQUAL LDQUOT digest-uri-value RDQUOT,digest-uri-value = rquest-uri ; Equal to request-uri as specified by HTTP/1.1
-	uriRegexp := regexp.MustCompile(`((?i)(?:^uri))( )*=`)
-	// response regexp : dresponse = "response" EQUAL request-digest, request-digest = LDQUOT 32LHEX RDQUOT
-	responseRegexp := regexp.MustCompile(`((?i)(?:^response))( )*=`)
-	// algorithm regexp algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-	algorithmRegexp := regexp.MustCompile(`((?i)(?:^algorithm))( )*=`)
-	// cnonce regexp : cnonce = "cnonce" EQUAL cnonce-value,cnonce-value = nonce-value
-	cnonceRegexp := regexp.MustCompile(`((?i)(?:^cnonce))( )*=`)
-	// opaque     regexp opaque =  "opaque" EQUAL quoted-string
-	opaqueRegexp := regexp.MustCompile(`((?i)(?:^opaque))( )*=`)
-	// qop        regexp message-qop = "qop" EQUAL qop-value,qop-value = "auth" / "auth-int" / token
-	qopRegexp := regexp.MustCompile(`((?i)(?:^qop))( )*=`)
-	// nc         regexp nonce-count = "nc" EQUAL nc-value,nc-value = 8LHEX
-	ncRegexp := regexp.MustCompile(`((?i)(?:^nc))( )*=`)
-	rawSlice := strings.Split(raw, ",")
-	for _, raws := range rawSlice {
-		raws = stringTrimPrefixAndTrimSuffix(raws, " ")
-		switch {
-		case usernameRegexp.MatchString(raws):
-			username := usernameRegexp.ReplaceAllString(raws, "")
-			username = regexp.MustCompile(`"`).ReplaceAllString(username, "")
-			au.username = username
-		case realmRegexp.MatchString(raws):
-			realm := realmRegexp.ReplaceAllString(raws, "")
-			realm = regexp.MustCompile(`"`).ReplaceAllString(realm, "")
-			au.realm = realm
-		case nonceRegexp.MatchString(raws):
-			nonce := nonceRegexp.ReplaceAllString(raws, "")
-			nonce = regexp.MustCompile(`"`).ReplaceAllString(nonce, "")
-			au.nonce = nonce
-		case uriRegexp.MatchString(raws):
-			uri := uriRegexp.ReplaceAllString(raws, "")
-			uri = regexp.MustCompile(`"`).ReplaceAllString(uri, "")
-			au.uri.Parse(uri)
-		case responseRegexp.MatchString(raws):
-			response := responseRegexp.ReplaceAllString(raws, "")
-			response = regexp.MustCompile(`"`).ReplaceAllString(response, "")
-			au.response = response
-		case algorithmRegexp.MatchString(raws):
-			algorithm := algorithmRegexp.ReplaceAllString(raws, "")
-			algorithm = regexp.MustCompile(`"`).ReplaceAllString(algorithm, "")
-			au.algorithm = algorithm
-		case cnonceRegexp.MatchString(raws):
-			cnonce := cnonceRegexp.ReplaceAllString(raws, "")
-			cnonce = regexp.MustCompile(`"`).ReplaceAllString(cnonce, "")
-			au.cnonce = cnonce
-		case opaqueRegexp.MatchString(raws):
-			opaque := opaqueRegexp.ReplaceAllString(raws, "")
-			opaque = regexp.MustCompile(`"`).ReplaceAllString(opaque, "")
-			au.opaque = opaque
-		case qopRegexp.MatchString(raws):
-			qop := qopRegexp.ReplaceAllString(raws, "")
-			qop = regexp.MustCompile(`"`).ReplaceAllString(qop, "")
-			au.qop = qop
-		case ncRegexp.MatchString(raws):
-			nc := ncRegexp.ReplaceAllString(raws, "")
-			nc = regexp.MustCompile(`"`).ReplaceAllString(nc, "")
-			au.nc = nc
-		default:
-			// authParam  sync.Map    // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-			kvs := strings.Split(raws, "=")
-			if len(kvs) == 1 {
-				au.authParam.Store(kvs[0], "")
-			} else {
-				au.authParam.Store(kvs[0], kvs[1])
+	// dig-resp  =  username / realm / nonce / digest-uri / dresponse / algorithm / cnonce / opaque / message-qop / nonce-count / auth-param
+	parameter := NewParams()
+	if err := parameter.parse(raw, ','); err != nil {
+		return parseErrorWrap(err, au.source, raw)
+	}
+	for _, p := range parameter.list() {
+		au.order = append(au.order, p.name)
+		switch strings.ToLower(p.name) {
+		case "username":
+			au.username = p.value
+		case "realm":
+			au.realm = p.value
+		case "nonce":
+			au.nonce = p.value
+		case "uri":
+			if err := au.uri.Parse(p.value); err != nil {
+				return parseErrorWrap(err, au.source, p.value)
 			}
+			au.uriValue = p.value
+		case "response":
+			au.response = p.value
+		case "algorithm":
+			au.algorithm = p.value
+		case "cnonce":
+			au.cnonce = p.value
+		case "opaque":
+			au.opaque = p.value
+		case "qop":
+			au.qop = p.value
+		case "nc":
+			au.nc = p.value
+		default:
+			au.authParam.set(p)
 		}
 	}
-
-}
-func (au *Authorization) authorizationOrder(raw string) {
-	au.isOrder = true
-	au.order = make(chan string, 1024)
-	defer close(au.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ",")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, ",")
-	for _, raws := range rawSlice {
-		au.order <- raws
-	}
+	return nil
 }
@@ -3,7 +3,6 @@ package sip
 import (
 	"fmt"
 	"net"
-	"sync"
 	"testing"
 )
 
@@ -21,25 +20,25 @@ func TestAuthorization_Raw(t *testing.T) {
 		NewAuthorization("34020000001320000001",
 			"3402000000", "",
 			NewRequestUri(NewSipUri(NewUserInfo("34020000001320000001", "", ""),
-				NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), nil, sync.Map{})),
+				NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), nil, nil)),
 			"6629fae49393a05397450978507c4ef1",
 			"MD5",
 			"0a4f113b",
 			"5ccc069c403ebaf9f0171e9517f40e41",
 			"auth",
 			"00000001",
-			sync.Map{}),
+			nil),
 		NewAuthorization("bob",
 			"biloxi.com", "",
 			NewRequestUri(NewSipUri(NewUserInfo("bob", "", ""),
-				NewHostPort("biloxi.com", nil, nil, 0), nil, sync.Map{})),
+				NewHostPort("biloxi.com", nil, nil, 0), nil, nil)),
 			"6629fae49393a05397450978507c4ef1",
 			"MD5",
 			"0a4f113b",
 			"5ccc069c403ebaf9f0171e9517f40e41",
 			"auth",
 			"00000001",
-			sync.Map{}),
+			nil),
 	}
 	for _, authorization := range authorizations {
 		result := authorization.Raw()
@@ -71,11 +70,11 @@ func TestAuthorization_Parse(t *testing.T) {
 			fmt.Println(index, "nc:", authorization.GetNc())
 			fmt.Println(index, "uri->request-uri->sip-uri/sips-uri->schema:", authorization.GetUri().GetSipUri().GetSchema())
 			fmt.Println(index, "uri->request-uri->sip-uri/sips-uri->userinfo->username:", authorization.GetUri().GetSipUri().GetUserInfo().GetUser())
-			authorization.authParam.Range(func(key, value interface{}) bool {
+			for _, key := range authorization.authParam.Names() {
+				value, _ := authorization.authParam.Get(key)
 				fmt.Println(index, "auth-param:", key, "=", value)
-				return true
-			})
-			authorization.authParam.Store("hello", "www.baidu.com")
+			}
+			authorization.authParam.Set("hello", "www.baidu.com")
 			result := authorization.Raw()
 			fmt.Print(result.String())
 		}
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -83,7 +82,7 @@ type CallID struct {
 }
 
 func (i *CallID) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(call-id|i)$`).MatchString(field) {
+	if scanFieldIs(field, "call-id", "i") {
 		i.field = field
 	} else {
 		i.field = "Call-ID"
@@ -117,10 +116,11 @@ func NewCallID(localId string, host string) *CallID {
 	}
 }
 func (i *CallID) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(i.field)) == 0 {
-		i.field = "Call-ID"
+	field := i.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Call-ID"
 	}
-	result.WriteString(fmt.Sprintf("%s:", i.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 	if len(strings.TrimSpace(i.localId)) > 0 {
 		result.WriteString(fmt.Sprintf(" %s", i.localId))
 	}
@@ -134,36 +134,29 @@ func (i *CallID) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return result
 }
-func (i *CallID) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (i *CallID) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Call-ID", raw, 0, `Call-ID  =  ( "Call-ID" / "i" ) HCOLON callid`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(call-id|i)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "call-id", "i")
+	if !ok {
+		return NewParseError("Call-ID", raw, 0, `Call-ID  =  ( "Call-ID" / "i" ) HCOLON callid`)
 	}
 	i.source = raw
-	field := fieldRegexp.FindString(raw)
-	field = regexp.MustCompile(`:`).ReplaceAllString(field, "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	i.field = field
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// host regexp
-	hostRegexp := regexp.MustCompile(`@.*`)
-	if hostRegexp.MatchString(raw) {
-		host := hostRegexp.FindString(raw)
-		raw = strings.TrimSuffix(raw, host)
-		host = regexp.MustCompile(`@`).ReplaceAllString(host, "")
-		host = stringTrimPrefixAndTrimSuffix(host, " ")
-		i.host = host
+	i.field = stringTrimPrefixAndTrimSuffix(field, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// host
+	if index := strings.IndexByte(raw, '@'); index >= 0 {
+		i.host = stringTrimPrefixAndTrimSuffix(raw[index+1:], " ")
+		raw = raw[:index]
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	if len(strings.TrimSpace(raw)) > 0 {
 		i.localId = raw
 	}
+	if len(i.localId) == 0 {
+		return NewParseError("Call-ID", i.source, len(i.source), `callid  =  word [ "@" word ]`)
+	}
+	return nil
 }
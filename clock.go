@@ -0,0 +1,114 @@
+package sip
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the timers of the transactions,
+// SystemClock runs them in real time and ManualClock lets a test move time forward at once
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f on its own goroutine after d,the Timer returned stops it
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by Clock.AfterFunc
+type Timer interface {
+	// Stop prevents the timer from firing,it reports whether the timer was stopped before it fired
+	Stop() bool
+}
+
+// SystemClock is the Clock of the time package
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+func (SystemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// ManualClock is a Clock whose time only moves with Advance,the timers due are fired by Advance in the order of their time
+type ManualClock struct {
+	now    time.Time
+	timers []*manualTimer
+	mutex  sync.Mutex
+}
+
+// manualTimer is a timer of a ManualClock
+type manualTimer struct {
+	clock *ManualClock
+	when  time.Time
+	f     func()
+}
+
+// NewManualClock returns a ManualClock at now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now: now,
+	}
+}
+
+func (mc *ManualClock) Now() time.Time {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return mc.now
+}
+func (mc *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	timer := &manualTimer{
+		clock: mc,
+		when:  mc.now.Add(d),
+		f:     f,
+	}
+	mc.timers = append(mc.timers, timer)
+	return timer
+}
+
+// Len returns the number of timers that have not fired or been stopped
+func (mc *ManualClock) Len() int {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return len(mc.timers)
+}
+
+// Advance moves the time d forward and fires the timers due on the calling goroutine one by one,
+// a timer started by a timer that fires is fired too when it is due
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mutex.Lock()
+	end := mc.now.Add(d)
+	for {
+		sort.SliceStable(mc.timers, func(i, j int) bool {
+			return mc.timers[i].when.Before(mc.timers[j].when)
+		})
+		if len(mc.timers) == 0 || mc.timers[0].when.After(end) {
+			break
+		}
+		timer := mc.timers[0]
+		mc.timers = mc.timers[1:]
+		if timer.when.After(mc.now) {
+			mc.now = timer.when
+		}
+		mc.mutex.Unlock()
+		timer.f()
+		mc.mutex.Lock()
+	}
+	mc.now = end
+	mc.mutex.Unlock()
+}
+
+func (mt *manualTimer) Stop() bool {
+	mc := mt.clock
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	for index, timer := range mc.timers {
+		if timer == mt {
+			mc.timers = append(mc.timers[:index], mc.timers[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
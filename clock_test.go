@@ -0,0 +1,38 @@
+package sip
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestManualClock_Advance(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewManualClock(start)
+	var fired []time.Duration
+	record := func() {
+		fired = append(fired, clock.Now().Sub(start))
+	}
+	clock.AfterFunc(3*time.Second, record)
+	clock.AfterFunc(time.Second, func() {
+		record()
+		// a timer started by a timer fires within the same Advance
+		clock.AfterFunc(time.Second, record)
+	})
+	stopped := clock.AfterFunc(2500*time.Millisecond, record)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop mismatch")
+	}
+	clock.Advance(500 * time.Millisecond)
+	if len(fired) != 0 || clock.Len() != 2 {
+		t.Error("timer fired early", fired)
+	}
+	clock.Advance(4 * time.Second)
+	fmt.Println(fired)
+	if len(fired) != 3 || fired[0] != time.Second || fired[1] != 2*time.Second || fired[2] != 3*time.Second {
+		t.Error("fired mismatch", fired)
+	}
+	if clock.Len() != 0 || clock.Now().Sub(start) != 4500*time.Millisecond {
+		t.Error("clock mismatch", clock.Len(), clock.Now())
+	}
+}
@@ -2,11 +2,8 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261.html#section-8.1.1.8
@@ -92,23 +89,25 @@ import (
 
 type Contact struct {
 	field     string      // "Contact" / "m"
+	star      bool        // STAR,the special value "*" of a REGISTER removing all the bindings
 	name      string      // display-name
 	spec      string      // named spec of URI,recommend set be uri spec <uri>,example: <sip:xxx>/"sip:xxx"/sip:xxx
 	schema    string      // sip,sips,tel etc.
 	user      string      // user part
 	host      string      // host part
 	port      uint16      // port part
+	uriParams *Parameters // uri-parameters of a SIP URI,example: <sip:xxx;transport=tcp>
+	headers   *Params     // headers of a SIP URI,headers  =  "?" header *( "&" header )
 	q         string      // c-p-q  =  "q" EQUAL qvalue,qvalue = ( "0" [ "." 0*3DIGIT ] )/ ( "1" [ "." 0*3("0") ] )
 	expires   int         // c-p-expires =  "expires" EQUAL delta-seconds,delta-seconds = 1*DIGIT
-	parameter sync.Map    // generic-param,contact-extension = generic-param,generic-param =  token [ EQUAL gen-value ]
-	isOrder   bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order     chan string // It is convenient to record the order of the original parameter fields when parsing
+	parameter *Params     // generic-param,contact-extension = generic-param,generic-param =  token [ EQUAL gen-value ]
+	order     []string    // parameter names in the parsed order,q and expires included
 	source    string      // source string
 }
 
 func (m *Contact) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(contact|m)$`).MatchString(field) {
-		m.field = strings.Title(field)
+	if scanFieldIs(field, "contact", "m") {
+		m.field = headerFieldTitle(field)
 	} else {
 		m.field = "Contact"
 	}
@@ -116,6 +115,12 @@ func (m *Contact) SetField(field string) {
 func (m *Contact) GetField() string {
 	return m.field
 }
+func (m *Contact) SetStar(star bool) {
+	m.star = star
+}
+func (m *Contact) GetStar() bool {
+	return m.star
+}
 func (m *Contact) SetName(name string) {
 	m.name = name
 }
@@ -152,6 +157,18 @@ func (m *Contact) SetPort(port uint16) {
 func (m *Contact) GetPort() uint16 {
 	return m.port
 }
+func (m *Contact) SetUriParams(uriParams *Parameters) {
+	m.uriParams = uriParams
+}
+func (m *Contact) GetUriParams() *Parameters {
+	return m.uriParams
+}
+func (m *Contact) SetHeaders(headers *Params) {
+	m.headers = headers
+}
+func (m *Contact) GetHeaders() *Params {
+	return m.headers
+}
 func (m *Contact) SetQ(qValue string) {
 	m.q = qValue
 }
@@ -164,17 +181,17 @@ func (m *Contact) SetExpires(expires int) {
 func (m *Contact) GetExpires() int {
 	return m.expires
 }
-func (m *Contact) SetParameter(parameter sync.Map) {
+func (m *Contact) SetParameter(parameter *Params) {
 	m.parameter = parameter
 }
-func (m *Contact) GetParameter() sync.Map {
+func (m *Contact) GetParameter() *Params {
 	return m.parameter
 }
 func (m *Contact) GetSource() string {
 	return m.source
 }
 
-func NewContact(name, spec, schema, user, host string, port uint16, q string, expires int, parameter sync.Map) *Contact {
+func NewContact(name, spec, schema, user, host string, port uint16, q string, expires int, parameter *Params) *Contact {
 	return &Contact{
 		field:     "Contact",
 		name:      name,
@@ -186,15 +203,20 @@ func NewContact(name, spec, schema, user, host string, port uint16, q string, ex
 		q:         q,
 		expires:   expires,
 		parameter: parameter,
-		isOrder:   false,
 	}
 }
 func (m *Contact) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(m.field)) == 0 {
-		m.field = "Contact"
-		result.WriteString(fmt.Sprintf("%s:", strings.Title(m.field)))
+	field := m.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Contact"
+		result.WriteString(fmt.Sprintf("%s:", strings.Title(field)))
 	} else {
-		result.WriteString(fmt.Sprintf("%s:", m.field))
+		result.WriteString(fmt.Sprintf("%s:", field))
+	}
+	// STAR has neither a URI nor contact-params
+	if m.star {
+		result.WriteString(" *\r\n")
+		return
 	}
 
 	if len(strings.TrimSpace(m.name)) > 0 {
@@ -211,12 +233,21 @@ func (m *Contact) Raw() (result strings.Builder) {
 	if len(strings.TrimSpace(m.user)) > 0 {
 		uri += m.user
 	}
+	// the "@" is only written after a user,example: "sip:192.168.0.108:5060"
 	if len(strings.TrimSpace(m.host)) > 0 {
-		uri += fmt.Sprintf("@%s", m.host)
+		if len(strings.TrimSpace(m.user)) > 0 {
+			uri += "@"
+		}
+		uri += m.host
 	}
 	if m.port > 0 {
 		uri += fmt.Sprintf(":%v", m.port)
 	}
+	if m.uriParams != nil {
+		uriParams := m.uriParams.Raw()
+		uri += uriParams.String()
+	}
+	uri += m.headers.raw("?", "&", false)
 	if len(uri) > 0 {
 		switch strings.TrimSpace(m.spec) {
 		case "\"":
@@ -229,227 +260,100 @@ func (m *Contact) Raw() (result strings.Builder) {
 			result.WriteString(fmt.Sprintf(" %s", uri))
 		}
 	}
-	if m.isOrder {
-		m.isOrder = false
-		for orders := range m.order {
-			if regexp.MustCompile(`(?i)(q)( )*=`).MatchString(orders) {
-				if len(strings.TrimSpace(m.q)) > 0 {
-					result.WriteString(fmt.Sprintf(";q=%s", m.q))
-					continue
-				}
-			}
-			if regexp.MustCompile(`(?i)(expires)( )*=`).MatchString(orders) {
-				if m.expires >= 0 {
-					result.WriteString(fmt.Sprintf(";expires=%d", m.expires))
-					m.expires = -1
-					continue
-				}
-			}
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := m.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-
-				} else {
-					result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := m.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], ordersSlice[1]))
-				}
-			}
-		}
-	} else {
-		if len(strings.TrimSpace(m.q)) > 0 {
-			result.WriteString(fmt.Sprintf(";q=%s", m.q))
-		}
-		if m.expires >= 0 {
-			result.WriteString(fmt.Sprintf(";expires=%d", m.expires))
-		}
+	// contact-params  =  c-p-q / c-p-expires / contact-extension
+	typed := NewParams()
+	if len(strings.TrimSpace(m.q)) > 0 {
+		typed.Set("q", m.q)
 	}
-
-	m.parameter.Range(func(key, value interface{}) bool {
-		fmt.Println(key, value)
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(";%v", key))
-				return true
-			}
-			result.WriteString(fmt.Sprintf(";%v=\"%v\"", key, value))
-			return true
-		}
-		result.WriteString(fmt.Sprintf(";%v", key))
-		return true
-	})
+	if m.expires >= 0 {
+		typed.Set("expires", strconv.Itoa(m.expires))
+	}
+	parameter := paramsMerge(m.order, typed, m.parameter).Raw()
+	result.WriteString(parameter.String())
 	result.WriteString("\r\n")
 	return
 }
 
-func (m *Contact) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (m *Contact) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Contact", raw, 0, `Contact  =  ("Contact" / "m" ) HCOLON ( STAR / (contact-param *(COMMA contact-param)))`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(contact|m)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "contact", "m")
+	if !ok {
+		return NewParseError("Contact", raw, 0, `Contact  =  ("Contact" / "m" ) HCOLON ( STAR / (contact-param *(COMMA contact-param)))`)
 	}
 	m.source = raw
-	m.parameter = sync.Map{}
+	m.parameter = NewParams()
+	m.uriParams = nil
+	m.headers = nil
+	m.order = nil
 	m.expires = -1
+	m.star = false
 
-	m.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-
-	// schema regexp
-	schemasRegexpStr := `(?i)(`
-	for _, v := range schemas {
-		schemasRegexpStr += v + "|"
+	m.field = field
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// STAR
+	if raw == "*" {
+		m.star = true
+		m.name, m.spec, m.schema, m.user, m.host, m.port, m.q = "", "", "", "", "", 0, ""
+		return nil
 	}
-	schemasRegexpStr = strings.TrimSuffix(schemasRegexpStr, "|")
-	schemasRegexpStr += ")( )?:"
 
-	// display-name regexp
-	nameRegexp := regexp.MustCompile(`.*` + schemasRegexpStr)
-	if nameRegexp.MatchString(raw) {
-		name := nameRegexp.FindString(raw)
-		name = regexp.MustCompile(schemasRegexpStr+`$`).ReplaceAllString(name, "")
-		name = regexp.MustCompile(`<$`).ReplaceAllString(name, "")
-		name = stringTrimPrefixAndTrimSuffix(name, " ")
-		if len(name) > 0 {
-			m.name = name
-			raw = regexp.MustCompile(`.*`+name).ReplaceAllString(raw, "")
-			raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-		}
-	}
-	//uri spec  regexp: named spec of URI
-	switch {
-	case regexp.MustCompile(`'.*?` + schemasRegexpStr).MatchString(raw):
-		m.spec = "'"
-		raw = regexp.MustCompile(`.*'`).ReplaceAllString(raw, "")
-	case regexp.MustCompile(`".*?` + schemasRegexpStr).MatchString(raw):
-		m.spec = "\""
-		raw = regexp.MustCompile(`.*"`).ReplaceAllString(raw, "")
-	case regexp.MustCompile(`<.*?` + schemasRegexpStr).MatchString(raw):
-		m.spec = "<"
-		raw = regexp.MustCompile(`.*<`).ReplaceAllString(raw, "")
-	default:
-		m.spec = ""
-	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(schemasRegexpStr)
-	if schemaRegexp.MatchString(raw) {
-		schema := schemaRegexp.FindString(raw)
-		schema = regexp.MustCompile(`:`).ReplaceAllString(schema, "")
-		schema = stringTrimPrefixAndTrimSuffix(schema, " ")
-		m.schema = schema
+	// ( name-addr / addr-spec )
+	addr, ok := scanAddress(raw)
+	m.name, m.spec, m.schema = addr.name, addr.spec, addr.schema
+	m.user, m.host, m.port = addr.user, addr.host, addr.port
+	raw = addr.rest
+	if !ok {
+		return NewParseError("Contact", m.source, parseErrorOffset(m.source, raw), `contact-param  =  (name-addr / addr-spec) *(SEMI contact-params)`)
 	}
-	// user regexp
-	userRegexp := regexp.MustCompile(schemasRegexpStr + `.*@`)
-	if userRegexp.MatchString(raw) {
-		user := userRegexp.FindString(raw)
-		user = regexp.MustCompile(schemasRegexpStr).ReplaceAllString(user, "")
-		user = regexp.MustCompile(`@`).ReplaceAllString(user, "")
-		user = stringTrimPrefixAndTrimSuffix(user, " ")
-		if len(user) > 0 {
-			m.user = user
-			raw = regexp.MustCompile(`.*`+user).ReplaceAllString(raw, "")
+	// uri-parameters and headers,a remote target keeps them
+	if params := addr.params; len(params) > 0 {
+		if index := strings.IndexByte(params, '?'); index >= 0 {
+			m.headers = NewParams()
+			if err := m.headers.parse(params[index+1:], '&'); err != nil {
+				return parseErrorWrap(err, m.source, params[index+1:])
+			}
+			params = params[:index]
 		}
-	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// host regexp
-	hostRegexp := regexp.MustCompile(`@.*`)
-	if hostRegexp.MatchString(raw) {
-		host := hostRegexp.FindString(raw)
-		host = regexp.MustCompile(`;.*`).ReplaceAllString(host, "")
-		host = regexp.MustCompile(`:.*`).ReplaceAllString(host, "")
-		host = regexp.MustCompile(`@`).ReplaceAllString(host, "")
-		host = stringTrimPrefixAndTrimSuffix(host, " ")
-		if len(host) > 0 {
-			m.host = host
-			raw = regexp.MustCompile(`.*`+host).ReplaceAllString(raw, "")
+		if len(params) > 0 {
+			m.uriParams = new(Parameters)
+			if err := m.uriParams.Parse(params); err != nil {
+				return parseErrorWrap(err, m.source, params)
+			}
 		}
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// port regexp
-	portRegexp := regexp.MustCompile(`.*?:\d+`)
-	if portRegexp.MatchString(raw) {
-		ports := portRegexp.FindString(raw)
-		ports = regexp.MustCompile(`.*:`).ReplaceAllString(ports, "")
-		ports = stringTrimPrefixAndTrimSuffix(ports, " ")
-		if len(ports) > 0 {
-			port, _ := strconv.Atoi(ports)
-			m.port = uint16(port)
-			raw = regexp.MustCompile(`.*`+ports).ReplaceAllString(raw, "")
-		}
+	// contact-params
+	if index := strings.Index(raw, ">"); index >= 0 && m.spec == "<" {
+		raw = raw[index+1:]
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	raw = stringTrimPrefixAndTrimSuffix(raw, ">")
-	raw = stringTrimPrefixAndTrimSuffix(raw, "<")
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	if len(strings.TrimSpace(raw)) == 0 {
-		return
+	if index := strings.Index(raw, ";"); index >= 0 {
+		raw = raw[index:]
+	} else {
+		raw = ""
 	}
-	// contact order
-	m.contactOrder(raw)
-	// q regexp
-	qRegexp := regexp.MustCompile(`((?i)(?:^q))( )*=`)
-	// expires regexp
-	expiresRegexp := regexp.MustCompile(`((?i)(?:^expires))( )*=`)
-
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		raws = stringTrimPrefixAndTrimSuffix(raws, " ")
-		switch {
-		case qRegexp.MatchString(raws):
-			q := qRegexp.ReplaceAllString(raws, "")
-			q = regexp.MustCompile(`"`).ReplaceAllString(q, "")
-			if len(q) > 0 {
-				m.q = q
-			}
-		case expiresRegexp.MatchString(raws):
-			expires := expiresRegexp.ReplaceAllString(raws, "")
-			expires = regexp.MustCompile(`"`).ReplaceAllString(expires, "")
-			if len(expires) > 0 {
-				expire, _ := strconv.Atoi(expires)
-				m.expires = expire
+	parameter := NewParams()
+	if err := parameter.Parse(raw); err != nil {
+		return parseErrorWrap(err, m.source, raw)
+	}
+	for _, p := range parameter.list() {
+		m.order = append(m.order, p.name)
+		switch strings.ToLower(p.name) {
+		case "q":
+			// c-p-q  =  "q" EQUAL qvalue
+			m.q = p.value
+		case "expires":
+			// c-p-expires  =  "expires" EQUAL delta-seconds
+			expires, err := strconv.ParseUint(p.value, 10, 32)
+			if !scanIsDigits(p.value) || err != nil {
+				return NewParseError("Contact", m.source, parseErrorOffset(m.source, p.source), `c-p-expires  =  "expires" EQUAL delta-seconds`)
 			}
+			m.expires = int(expires)
 		default:
-			// generic parameter regexp
-			kvs := strings.Split(raws, "=")
-			if len(kvs) == 1 {
-				m.parameter.Store(kvs[0], "")
-			} else {
-				m.parameter.Store(kvs[0], kvs[1])
-			}
+			m.parameter.set(p)
 		}
 	}
-
-}
-func (m *Contact) contactOrder(raw string) {
-	m.isOrder = true
-	m.order = make(chan string, 1024)
-	defer close(m.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		m.order <- raws
-	}
+	return nil
 }
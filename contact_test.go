@@ -2,16 +2,15 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestContact_Raw(t *testing.T) {
 	ms := []*Contact{
-		NewContact("", "<", "sip", "34020000001320000001", "192.168.0.1", 5060, "0.7", 3600, sync.Map{}),
-		NewContact("", "", "tel", "34020000001320000001", "192.168.0.1", 5060, "0.7", 3600, sync.Map{}),
-		NewContact("display name", "", "sips", "34020000001320000001", "192.168.0.1", 5060, "", 0, sync.Map{}),
-		NewContact("display name", "", "sips", "34020000001320000001", "192.168.0.1", 5060, "", -1, sync.Map{}),
+		NewContact("", "<", "sip", "34020000001320000001", "192.168.0.1", 5060, "0.7", 3600, nil),
+		NewContact("", "", "tel", "34020000001320000001", "192.168.0.1", 5060, "0.7", 3600, nil),
+		NewContact("display name", "", "sips", "34020000001320000001", "192.168.0.1", 5060, "", 0, nil),
+		NewContact("display name", "", "sips", "34020000001320000001", "192.168.0.1", 5060, "", -1, nil),
 	}
 	for _, m := range ms {
 		result := m.Raw()
@@ -36,3 +35,30 @@ func TestContact_Parse(t *testing.T) {
 		}
 	}
 }
+
+func TestContact_ParseUriParams(t *testing.T) {
+	// the uri-parameters and headers inside the angle brackets are kept,a quoted header parameter may hold a "<"
+	raws := []string{
+		"Contact: <sip:Bob@5.6.7.8:5070;transport=tcp;ob>;expires=60;+sip.instance=\"<urn:uuid:00000000-0000-1000-8000-000A95A0E128>\"\r\n",
+		"m: <sips:bob@[::1]:5071;maddr=1.2.3.4?X=y>\r\n",
+		"Contact: sip:bob@5.6.7.8;transport=tcp\r\n",
+	}
+	for _, raw := range raws {
+		m := new(Contact)
+		if err := m.Parse(raw); err != nil {
+			t.Error(err)
+			continue
+		}
+		if result := m.Raw(); result.String() != raw {
+			t.Error("raw mismatch", result.String())
+		}
+	}
+	m := new(Contact)
+	if err := m.Parse(raws[0]); err != nil || m.GetUriParams().GetTransport() != "tcp" || !m.GetParameter().Has("+sip.instance") {
+		t.Error("uri-parameters mismatch", err)
+	}
+	// an addr-spec has no uri-parameters,its parameters are header parameters
+	if err := m.Parse(raws[2]); err != nil || m.GetUriParams() != nil || !m.GetParameter().Has("transport") {
+		t.Error("header parameters mismatch", err)
+	}
+}
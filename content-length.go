@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -45,7 +44,7 @@ type ContentLength struct {
 
 //"Content-Length" / "l"
 func (l *ContentLength) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(content-length|l)$`).MatchString(field) {
+	if scanFieldIs(field, "content-length", "l") {
 		l.field = field
 	} else {
 		l.field = "Content-Length"
@@ -73,36 +72,32 @@ func NewContentLength(length uint) *ContentLength {
 }
 func (l *ContentLength) Raw() (result strings.Builder) {
 	// "Content-Length"
-	if len(strings.TrimSpace(l.field)) == 0 {
-		l.field = "Content-Length"
+	field := l.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Content-Length"
 	}
-	result.WriteString(fmt.Sprintf("%s:", l.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 	result.WriteString(fmt.Sprintf(" %d", l.length))
 	result.WriteString("\r\n")
 	return
 }
-func (l *ContentLength) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (l *ContentLength) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Content-Length", raw, 0, `Content-Length  =  ( "Content-Length" / "l" ) HCOLON 1*DIGIT`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(content-length|l)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "content-length", "l")
+	if !ok {
+		return NewParseError("Content-Length", raw, 0, `Content-Length  =  ( "Content-Length" / "l" ) HCOLON 1*DIGIT`)
 	}
 	l.source = raw
-	field := fieldRegexp.FindString(raw)
-	field = regexp.MustCompile(`:`).ReplaceAllString(field, "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	l.field = field
-	// length regexp
-	lengthRegexp := regexp.MustCompile(`\d+`)
-	if lengthRegexp.MatchString(raw) {
-		lengths := lengthRegexp.FindString(raw)
-		length, _ := strconv.Atoi(lengths)
-		l.length = uint(length)
+	l.field = stringTrimPrefixAndTrimSuffix(field, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// length
+	if !scanIsDigits(raw) {
+		return NewParseError("Content-Length", l.source, parseErrorOffset(l.source, raw), `Content-Length  =  ( "Content-Length" / "l" ) HCOLON 1*DIGIT`)
 	}
+	length, _ := strconv.Atoi(raw)
+	l.length = uint(length)
+	return nil
 }
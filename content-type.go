@@ -2,10 +2,7 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 )
 
 //https://www.rfc-editor.org/rfc/rfc3261.html#section-20.15
@@ -50,17 +47,15 @@ import (
 // SLASH   =  SWS "/" SWS ; slash
 //
 type ContentType struct {
-	field     string      //"Content-Type" / "c"
-	mType     string      // media-type =  m-type SLASH m-subtype *(SEMI m-parameter),m-type = discrete-type / composite-type,discrete-type =  "text" / "image" / "audio" / "video"/ "application" / extension-token,composite-type =  "message" / "multipart" / extension-token
-	mSubType  string      // m-subtype =  extension-token / iana-token
-	parameter sync.Map    //m-parameter =  m-attribute EQUAL m-value, m-attribute =  token,m-value =  token / quoted-string
-	isOrder   bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order     chan string // It is convenient to record the order of the original parameter fields when parsing
-	source    string      // source string
+	field     string  //"Content-Type" / "c"
+	mType     string  // media-type =  m-type SLASH m-subtype *(SEMI m-parameter),m-type = discrete-type / composite-type,discrete-type =  "text" / "image" / "audio" / "video"/ "application" / extension-token,composite-type =  "message" / "multipart" / extension-token
+	mSubType  string  // m-subtype =  extension-token / iana-token
+	parameter *Params //m-parameter =  m-attribute EQUAL m-value, m-attribute =  token,m-value =  token / quoted-string
+	source    string  // source string
 }
 
 func (c *ContentType) SetField(field string) {
-	if regexp.MustCompile(`(?i)(?:^content-type|c)$`).MatchString(field) {
+	if scanFieldIs(field, "content-type", "c") {
 		c.field = field
 	} else {
 		c.field = "Content-Type"
@@ -81,30 +76,30 @@ func (c *ContentType) SetMSubType(mSubType string) {
 func (c *ContentType) GetMSubType() string {
 	return c.mSubType
 }
-func (c *ContentType) SetParameter(parameter sync.Map) {
+func (c *ContentType) SetParameter(parameter *Params) {
 	c.parameter = parameter
 }
-func (c *ContentType) GetParameter() sync.Map {
+func (c *ContentType) GetParameter() *Params {
 	return c.parameter
 }
 func (c *ContentType) GetSource() string {
 	return c.source
 }
-func NewContentType(mType string, mSubType string, parameter sync.Map) *ContentType {
+func NewContentType(mType string, mSubType string, parameter *Params) *ContentType {
 	return &ContentType{
 		field:     "Content-Type",
 		mType:     mType,
 		mSubType:  mSubType,
 		parameter: parameter,
-		isOrder:   false,
 	}
 }
 func (c *ContentType) Raw() (result strings.Builder) {
 
-	if len(strings.TrimSpace(c.field)) == 0 {
-		c.field = "Content-Type"
+	field := c.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Content-Type"
 	}
-	result.WriteString(fmt.Sprintf("%s:", c.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 
 	if len(strings.TrimSpace(c.mType)) > 0 {
 		result.WriteString(fmt.Sprintf(" %s", c.mType))
@@ -116,122 +111,42 @@ func (c *ContentType) Raw() (result strings.Builder) {
 			result.WriteString(fmt.Sprintf(" %s", c.mSubType))
 		}
 	}
-	if c.isOrder {
-		c.isOrder = false
-		for orders := range c.order {
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := c.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if strings.Contains(fmt.Sprintf("%v", val), "/") {
-						result.WriteString(fmt.Sprintf(";%v=\"%v\"", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := c.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if strings.Contains(fmt.Sprintf("%v", val), "/") {
-						result.WriteString(fmt.Sprintf(";%v=\"%v\"", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], ordersSlice[1]))
-				}
-			}
-		}
-	}
-	c.parameter.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(";%v", key))
-				return true
-			}
-			if strings.Contains(fmt.Sprintf("%v", value), "/") {
-				result.WriteString(fmt.Sprintf(";%v=\"%v\"", key, value))
-			} else {
-				result.WriteString(fmt.Sprintf(";%v=%v", key, value))
-			}
-			return true
-		}
-		result.WriteString(fmt.Sprintf(";%v", key))
-		return true
-	})
+	// m-parameter  =  m-attribute EQUAL m-value
+	parameter := c.parameter.Raw()
+	result.WriteString(parameter.String())
 	result.WriteString("\r\n")
 	return
 }
-func (c *ContentType) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (c *ContentType) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Content-Type", raw, 0, `Content-Type  =  ( "Content-Type" / "c" ) HCOLON media-type`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(content-type|c)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "content-type", "c")
+	if !ok {
+		return NewParseError("Content-Type", raw, 0, `Content-Type  =  ( "Content-Type" / "c" ) HCOLON media-type`)
 	}
 	c.source = raw
-	c.parameter = sync.Map{}
-
-	field := fieldRegexp.FindString(raw)
-	field = regexp.MustCompile(`:`).ReplaceAllString(field, "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	c.field = field
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	c.parameter = NewParams()
+	c.field = stringTrimPrefixAndTrimSuffix(field, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
 	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// parameter regexp
-	parameterRegexp := regexp.MustCompile(`;.*`)
-	if parameterRegexp.MatchString(raw) {
-		// content-type order
-		c.contenttypeOrder(parameterRegexp.FindString(raw))
-		rawSlice := strings.Split(parameterRegexp.FindString(raw), ";")
-		for _, raws := range rawSlice {
-			raws = stringTrimPrefixAndTrimSuffix(raws, " ")
-			if len(strings.TrimSpace(raws)) == 0 {
-				continue
-			}
-			kvs := strings.Split(raws, "=")
-			if len(kvs) == 1 {
-				c.parameter.Store(kvs[0], "")
-			} else {
-				c.parameter.Store(kvs[0], kvs[1])
-			}
-		}
-		raw = parameterRegexp.ReplaceAllString(raw, "")
-		raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-		mAndSubTypes := strings.Split(raw, "/")
-		if len(mAndSubTypes) == 1 {
-			c.mType = raw
-		} else {
-			c.mType = mAndSubTypes[0]
-			c.mSubType = mAndSubTypes[1]
-		}
-
-	} else {
-		mAndSubTypes := strings.Split(raw, "/")
-		if len(mAndSubTypes) == 1 {
-			c.mType = raw
-		} else {
-			c.mType = mAndSubTypes[0]
-			c.mSubType = mAndSubTypes[1]
+	// parameter
+	if index := strings.IndexByte(raw, ';'); index >= 0 {
+		parameter := raw[index:]
+		if err := c.parameter.Parse(parameter); err != nil {
+			return parseErrorWrap(err, c.source, parameter)
 		}
+		raw = stringTrimPrefixAndTrimSuffix(raw[:index], " ")
 	}
-}
-
-func (c *ContentType) contenttypeOrder(raw string) {
-	c.isOrder = true
-	c.order = make(chan string, 1024)
-	defer close(c.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		c.order <- raws
+	c.mType = raw
+	if index := strings.IndexByte(raw, '/'); index >= 0 {
+		c.mType = raw[:index]
+		c.mSubType = scanUntil(raw[index+1:], "/")
+	}
+	if len(c.mType) == 0 || len(c.mSubType) == 0 {
+		return NewParseError("Content-Type", c.source, parseErrorOffset(c.source, raw), `media-type  =  m-type SLASH m-subtype *(SEMI m-parameter)`)
 	}
+	return nil
 }
@@ -2,15 +2,14 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestContentType_Raw(t *testing.T) {
-	var parameter sync.Map
-	parameter.Store("protocol", "application/pkcs7-signature")
-	parameter.Store("micalg", "sha1")
-	parameter.Store("boundary", "boundary42")
+	parameter := NewParams()
+	parameter.Set("protocol", "application/pkcs7-signature")
+	parameter.Set("micalg", "sha1")
+	parameter.Set("boundary", "boundary42")
 	c := NewContentType("multipart", "signed", parameter)
 	result := c.Raw()
 	fmt.Println(result.String())
@@ -28,13 +27,13 @@ func TestContentType_Parse(t *testing.T) {
 		if len(c.GetSource()) > 0 {
 			fmt.Print("index: ", index, ",field: ", c.GetField(), ",m-type: ", c.GetMType(), ",m-subtype: ", c.GetMSubType())
 			p := c.GetParameter()
-			p.Range(func(key, value interface{}) bool {
+			for _, key := range p.Names() {
+				value, _ := p.Get(key)
 				fmt.Print(" ;", key, "=", value)
-				return true
-			})
+			}
 			fmt.Println()
-			p.Store("protocol", "hello/world")
-			p.Store("haha", nil)
+			p.Set("protocol", "hello/world")
+			p.SetFlag("haha")
 			c.SetParameter(p)
 			result := c.Raw()
 			fmt.Println(index, result.String())
@@ -0,0 +1,82 @@
+package sip
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sync"
+)
+
+// https://www.rfc-editor.org/rfc/rfc2617.html#section-4.13
+//
+// 4.13 Storing passwords
+//
+// Digest authentication requires that the authenticating agent (usually
+// the server) store some data derived from the user's name and password
+// in a "password file" associated with a given realm. Normally this
+// might contain pairs consisting of username and H(A1), where H(A1) is
+// the digested value of the username, realm, and password as described
+// above.
+
+// Credential is the password of a user in a realm,or the HA1 digested from it when the password is not kept
+type Credential struct {
+	password string
+	ha1      string // hex of MD5(username:realm:password)
+}
+
+func (c *Credential) SetPassword(password string) {
+	c.password = password
+}
+func (c *Credential) GetPassword() string {
+	return c.password
+}
+func (c *Credential) SetHA1(ha1 string) {
+	c.ha1 = ha1
+}
+func (c *Credential) GetHA1() string {
+	return c.ha1
+}
+func NewCredential(password string, ha1 string) *Credential {
+	return &Credential{
+		password: password,
+		ha1:      ha1,
+	}
+}
+
+// GenHA1 returns the hex of MD5(username:realm:password) kept by a Credential instead of the password
+func GenHA1(username string, realm string, password string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(username+":"+realm+":"+password)))
+}
+
+// CredentialStore keeps the credentials of the users of a DigestVerifier
+type CredentialStore interface {
+	// Get returns the credential of username in realm,nil when the user is unknown
+	Get(username string, realm string) (*Credential, error)
+}
+
+// MemoryCredentialStore is a CredentialStore in memory
+type MemoryCredentialStore struct {
+	credentials map[string]*Credential
+	mutex       sync.Mutex
+}
+
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{
+		credentials: make(map[string]*Credential),
+	}
+}
+func (ms *MemoryCredentialStore) Get(username string, realm string) (*Credential, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.credentials[realm+":"+username], nil
+}
+
+// Put replaces the credential of username in realm,a nil credential removes the user
+func (ms *MemoryCredentialStore) Put(username string, realm string, credential *Credential) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if credential == nil {
+		delete(ms.credentials, realm+":"+username)
+		return
+	}
+	ms.credentials[realm+":"+username] = credential
+}
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -53,7 +52,7 @@ type CSeq struct {
 }
 
 func (cSeq *CSeq) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(cseq)$`).MatchString(field) {
+	if scanFieldIs(field, "cseq") {
 		cSeq.field = strings.Title(field)
 	} else {
 		cSeq.field = "CSeq"
@@ -86,10 +85,11 @@ func NewCSeq(number uint32, method string) *CSeq {
 }
 
 func (cSeq *CSeq) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(cSeq.field)) == 0 {
-		cSeq.field = "CSeq"
+	field := cSeq.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "CSeq"
 	}
-	result.WriteString(fmt.Sprintf("%s:", cSeq.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 	result.WriteString(fmt.Sprintf(" %d", cSeq.number))
 	if len(strings.TrimSpace(cSeq.method)) > 0 {
 		result.WriteString(fmt.Sprintf(" %s", strings.ToUpper(cSeq.method)))
@@ -98,47 +98,35 @@ func (cSeq *CSeq) Raw() (result strings.Builder) {
 	return
 }
 
-func (cSeq *CSeq) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (cSeq *CSeq) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("CSeq", raw, 0, `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(cseq)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "cseq")
+	if !ok {
+		return NewParseError("CSeq", raw, 0, `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`)
 	}
-	cSeq.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	cSeq.field = field
 	cSeq.source = raw
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// sequence number regexp
-	numberRegexp := regexp.MustCompile(`\d+`)
-	if numberRegexp.MatchString(raw) {
-		numbers := numberRegexp.FindString(raw)
-		if len(numbers) > 0 {
-			number, _ := strconv.Atoi(numbers)
-			cSeq.number = uint32(number)
-			raw = regexp.MustCompile(`.*`+numbers).ReplaceAllString(raw, "")
-			raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-		}
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// sequence number
+	digits := scanDigits(raw)
+	if digits == 0 {
+		return NewParseError("CSeq", cSeq.source, parseErrorOffset(cSeq.source, raw), `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`)
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// method regexp string
-	methodsRegexpStr := `^(?i)(`
-	for _, v := range methods {
-		methodsRegexpStr += v + "|"
+	// the sequence number MUST be less than 2**31 by RFC 3261 8.1.1.5
+	number, err := strconv.ParseUint(raw[:digits], 10, 31)
+	if err != nil {
+		return NewParseError("CSeq", cSeq.source, parseErrorOffset(cSeq.source, raw), `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`)
 	}
-	methodsRegexpStr = strings.TrimSuffix(methodsRegexpStr, "|")
-	methodsRegexpStr += ")( )?"
-	// method regexp
-	methodRegexp := regexp.MustCompile(methodsRegexpStr)
-	// method regexp
-	if len(raw) > 0 {
-		if methodRegexp.MatchString(raw) {
-			cSeq.method = methodRegexp.FindString(raw)
-		}
+	cSeq.number = uint32(number)
+	raw = stringTrimPrefixAndTrimSuffix(raw[digits:], " ")
+	// Method  =  INVITEm / ACKm / OPTIONSm / BYEm / CANCELm / REGISTERm / extension-method
+	// extension-method  =  token
+	if !scanIsToken(raw) {
+		return NewParseError("CSeq", cSeq.source, parseErrorOffset(cSeq.source, raw), `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`)
 	}
+	cSeq.method = raw
+	return nil
 }
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -46,7 +45,7 @@ type Date struct {
 }
 
 func (date *Date) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(date)$`).MatchString(field) {
+	if scanFieldIs(field, "date") {
 		date.field = strings.Title(field)
 	} else {
 		date.field = "Date"
@@ -79,36 +78,31 @@ func NewDate(timeFormat string, sipDate time.Time) *Date {
 	}
 }
 func (date *Date) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(date.field)) == 0 {
-		date.field = "Date"
+	field := date.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Date"
 	}
-	result.WriteString(fmt.Sprintf("%s:", strings.Title(date.field)))
-	if len(strings.TrimSpace(date.timeFormat)) == 0 {
-		date.timeFormat = "2006-01-02T15:04:05.000"
+	result.WriteString(fmt.Sprintf("%s:", strings.Title(field)))
+	timeFormat := date.timeFormat
+	if len(strings.TrimSpace(timeFormat)) == 0 {
+		timeFormat = "2006-01-02T15:04:05.000"
 	}
-	result.WriteString(fmt.Sprintf(" %s", date.sipDate.Format(date.timeFormat)))
+	result.WriteString(fmt.Sprintf(" %s", date.sipDate.Format(timeFormat)))
 	result.WriteString("\r\n")
 	return
 }
-func (date *Date) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (date *Date) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Date", raw, 0, `Date  =  "Date" HCOLON SIP-date`)
 	}
-	// date field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(date)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "date")
+	if !ok {
+		return NewParseError("Date", raw, 0, `Date  =  "Date" HCOLON SIP-date`)
 	}
 	date.source = raw
-	field := fieldRegexp.FindString(raw)
-	raw = strings.TrimPrefix(raw, field)
-	field = strings.ReplaceAll(field, ":", "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	date.field = field
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
+	date.field = stringTrimPrefixAndTrimSuffix(field, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, ";")
 	raw = stringTrimPrefixAndTrimSuffix(raw, ":")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	if len(strings.TrimSpace(raw)) > 0 {
@@ -163,6 +157,8 @@ func (date *Date) Parse(raw string) {
 		} else {
 			// date.sipDate = time.Now()
 			date.timeFormat = "unknown"
+			return NewParseError("Date", date.source, parseErrorOffset(date.source, raw), `SIP-date  =  rfc1123-date`)
 		}
 	}
+	return nil
 }
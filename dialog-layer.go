@@ -0,0 +1,296 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-13.2.2.4
+//
+// 13.2.2.4 2xx Responses
+//
+// Multiple 2xx responses may arrive at the UAC for a single INVITE
+// request due to a forking proxy.  Each response is distinguished by
+// the tag parameter in the To header field, and each represents a
+// distinct dialog, with a distinct dialog identifier.
+//
+// If the dialog identifier in the 2xx response matches the dialog
+// identifier of an existing dialog, the dialog MUST be transitioned to
+// the "confirmed" state, and the route set for the dialog MUST be
+// recomputed based on the 2xx response using the procedures of Section
+// 12.2.1.2.  Otherwise, a new dialog in the "confirmed" state MUST be
+// constructed using the procedures of Section 12.1.2.
+//
+// The UAC core MUST generate an ACK request for each 2xx received from
+// the transaction layer.  The header fields of the ACK are constructed
+// in the same way as for any request sent within a dialog (see Section
+// 12) with the exception of the CSeq and the header fields related to
+// authentication.  The sequence number of the CSeq header field MUST be
+// the same as the INVITE being acknowledged, but the CSeq method MUST
+// be ACK.  The ACK MUST contain the same credentials as the INVITE.
+//
+// If, after acknowledging any 2xx response to an INVITE, the UAC does
+// not want to continue with that dialog, then the UAC MUST terminate
+// the dialog by sending a BYE request as described in Section 15.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-13.2.2.3
+//
+// 13.2.2.3 4xx, 5xx and 6xx Responses
+//
+// A single non-2xx final response may be received for the INVITE.  4xx,
+// 5xx and 6xx responses may contain a Contact header field value
+// indicating the location where additional information about the error
+// can be found.  Subsequent final responses (which would only arrive
+// under error conditions) MUST be ignored.
+//
+// All early dialogs are considered terminated upon reception of the
+// non-2xx final response.
+
+// InviteHandler is called by the DialogLayer for each response to an INVITE it passes to the TU,
+// d is the early dialog of a 1xx with a To tag or the dialog of the first 2xx,nil otherwise
+type InviteHandler func(sm *SipMsg, d *Dialog)
+
+// DialogLayer keeps the dialogs of a UA by dialog ID. The responses to a forked INVITE create one early dialog per To tag,
+// the first 2xx is passed to the TU and any other 2xx is acknowledged and ended by a BYE.
+type DialogLayer struct {
+	transactions *TransactionLayer
+	locator      *Locator // locates the next hop of the ACK and BYE requests sent by the layer
+	dialogs      map[string]*Dialog
+	mutex        sync.Mutex
+}
+
+func (dl *DialogLayer) GetTransactions() *TransactionLayer {
+	return dl.transactions
+}
+func (dl *DialogLayer) GetLocator() *Locator {
+	return dl.locator
+}
+
+// NewDialogLayer returns a DialogLayer sending in transactions,locator finds the next hop of a request within a dialog
+func NewDialogLayer(transactions *TransactionLayer, locator *Locator) *DialogLayer {
+	return &DialogLayer{
+		transactions: transactions,
+		locator:      locator,
+		dialogs:      make(map[string]*Dialog),
+	}
+}
+
+// Len returns the number of dialogs in the layer
+func (dl *DialogLayer) Len() int {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+	return len(dl.dialogs)
+}
+
+// Get returns the dialog of id,nil when there is none
+func (dl *DialogLayer) Get(id string) *Dialog {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+	return dl.dialogs[id]
+}
+
+// Match returns the dialog a received message belongs to,nil when there is none
+func (dl *DialogLayer) Match(sm *SipMsg) *Dialog {
+	return dl.Get(DialogIDOf(sm))
+}
+
+// Add adds d to the layer,example: the dialog a UAS creates with NewUASDialog
+func (dl *DialogLayer) Add(d *Dialog) {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+	dl.dialogs[d.GetID()] = d
+}
+
+// Remove terminates d and takes it out of the layer
+func (dl *DialogLayer) Remove(d *Dialog) {
+	d.Terminate()
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+	if dl.dialogs[d.GetID()] == d {
+		delete(dl.dialogs, d.GetID())
+	}
+}
+
+// Invite sends the INVITE sm in a new client transaction to target and passes its responses to handler,
+// the layer acknowledges each 2xx and its retransmissions
+func (dl *DialogLayer) Invite(ctx context.Context, sm *SipMsg, target *Target, handler InviteHandler) (*ClientTransaction, error) {
+	if sm.GetRequestLine() == nil || !strings.EqualFold(sm.GetRequestLine().GetMethod(), "INVITE") {
+		raw := sm.GetSource()
+		return nil, NewParseError("Request-Line", raw, 0, "an INVITE creates the dialogs")
+	}
+	di := &dialogInvite{
+		layer:   dl,
+		handler: handler,
+		dialogs: make(map[string]*Dialog),
+		acks:    make(map[string]*SipMsg),
+	}
+	return dl.transactions.Request(ctx, sm, target, di.receive)
+}
+
+// send sends a request outside of a transaction to its next hop,example: the ACK of a 2xx
+func (dl *DialogLayer) send(ctx context.Context, sm *SipMsg) error {
+	target, err := dl.locate(ctx, sm)
+	if err != nil {
+		return err
+	}
+	return dl.transactions.GetTransport().Send(ctx, sm, target)
+}
+
+// request sends a request in a new client transaction to its next hop
+func (dl *DialogLayer) request(ctx context.Context, sm *SipMsg, handler ResponseHandler) error {
+	target, err := dl.locate(ctx, sm)
+	if err != nil {
+		return err
+	}
+	_, err = dl.transactions.Request(ctx, sm, target, handler)
+	return err
+}
+
+// locate returns the first target of the next hop of sm,the first Route or the Request-URI
+func (dl *DialogLayer) locate(ctx context.Context, sm *SipMsg) (*Target, error) {
+	var uri *SipUri
+	if route := sm.GetRoute(); route != nil && len(route.GetNameAddrs()) > 0 {
+		if requestUri := new(RequestUri); sipMsgCopy(route.GetNameAddrs()[0], requestUri) {
+			uri = requestUri.GetSipUri()
+		}
+	} else if requestUri := sm.GetRequestLine().GetUri(); requestUri != nil {
+		uri = requestUri.GetSipUri()
+	}
+	targets, err := dl.locator.Locate(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		raw := sm.GetSource()
+		return nil, &net.AddrError{Err: "no target", Addr: raw}
+	}
+	return targets[0], nil
+}
+
+// dialogInvite is the UAC core of one INVITE,it keeps the dialogs its responses create
+type dialogInvite struct {
+	layer     *DialogLayer
+	handler   InviteHandler
+	dialogs   map[string]*Dialog // the dialogs of the INVITE by remote tag
+	acks      map[string]*SipMsg // the ACK of the 2xx of each remote tag,sent again for each retransmission
+	confirmed *Dialog            // the dialog of the first 2xx,the one passed to the TU
+	mutex     sync.Mutex
+}
+
+// receive is the ResponseHandler of the client transaction of the INVITE
+func (di *dialogInvite) receive(sm *SipMsg, ct *ClientTransaction) {
+	code := sm.GetStatusLine().GetStatusCode()
+	tag := ""
+	if to := sm.GetTo(); to != nil {
+		tag = to.GetTag()
+	}
+	switch {
+	case code >= 300:
+		di.terminate()
+		di.pass(sm, nil)
+	case code < 200 && (code == 100 || len(strings.TrimSpace(tag)) == 0):
+		di.pass(sm, nil)
+	case code < 200:
+		di.pass(sm, di.dialog(ct.GetRequest(), sm))
+	default:
+		di.accept(ct.GetRequest(), sm)
+	}
+}
+
+// dialog returns the dialog of the To tag of response,it is created by the first response of the tag
+func (di *dialogInvite) dialog(request *SipMsg, response *SipMsg) *Dialog {
+	tag := response.GetTo().GetTag()
+	di.mutex.Lock()
+	defer di.mutex.Unlock()
+	if d, ok := di.dialogs[tag]; ok {
+		d.Update(response)
+		return d
+	}
+	d, err := NewUACDialog(request, response)
+	if err != nil {
+		return nil
+	}
+	di.dialogs[tag] = d
+	di.layer.Add(d)
+	return d
+}
+
+// accept acknowledges a 2xx,the first 2xx is passed to the TU and the dialog of any other 2xx is ended by a BYE
+func (di *dialogInvite) accept(request *SipMsg, response *SipMsg) {
+	d := di.dialog(request, response)
+	if d == nil {
+		return
+	}
+	tag := response.GetTo().GetTag()
+	transactions := di.layer.transactions
+	di.mutex.Lock()
+	ack, retransmission := di.acks[tag]
+	if !retransmission {
+		ack = dialogACK(request, d)
+		di.acks[tag] = ack
+	}
+	if di.confirmed == nil {
+		di.confirmed = d
+		// the early dialogs left end with the 2xx retransmissions
+		transactions.GetClock().AfterFunc(64*transactions.GetT1(), di.terminate)
+	}
+	extra := di.confirmed != d
+	di.mutex.Unlock()
+	ctx := context.Background()
+	di.layer.send(ctx, ack)
+	switch {
+	case retransmission:
+	case extra:
+		bye := d.NewRequest("BYE")
+		bye.SetVia(dialogVia(request))
+		di.layer.request(ctx, bye, nil)
+		di.layer.Remove(d)
+	default:
+		di.pass(response, d)
+	}
+}
+
+// terminate ends the early dialogs of the INVITE,on a non-2xx final response or when the 2xx retransmissions stop
+func (di *dialogInvite) terminate() {
+	di.mutex.Lock()
+	early := make([]*Dialog, 0, len(di.dialogs))
+	for _, d := range di.dialogs {
+		if d.GetState() == DialogEarly {
+			early = append(early, d)
+		}
+	}
+	di.mutex.Unlock()
+	for _, d := range early {
+		di.layer.Remove(d)
+	}
+}
+
+// pass hands a response to the TU
+func (di *dialogInvite) pass(sm *SipMsg, d *Dialog) {
+	if di.handler != nil {
+		di.handler(sm, d)
+	}
+}
+
+// dialogACK returns the ACK of a 2xx to request in d,with the CSeq number and the credentials of the INVITE
+func dialogACK(request *SipMsg, d *Dialog) *SipMsg {
+	ack := d.NewRequest("ACK")
+	ack.SetVia(dialogVia(request))
+	ack.SetCSeq(NewCSeq(request.GetCSeq().GetNumber(), "ACK"))
+	if authorization := request.GetAuthorization(); authorization != nil {
+		ack.SetAuthorization(authorization)
+	}
+	return ack
+}
+
+// dialogVia returns a copy of the top Via of request with a new branch
+func dialogVia(request *SipMsg) *Via {
+	via := new(Via)
+	if request.GetVia() == nil || !sipMsgCopy(request.GetVia(), via) {
+		return nil
+	}
+	via.SetBranch(GenUnixNanoBranch())
+	return via
+}
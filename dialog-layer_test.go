@@ -0,0 +1,102 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// dialogFork returns the response of the fork at host to invite,tag is the To tag of the fork
+func dialogFork(invite *SipMsg, statusCode uint, tag string, host string) *SipMsg {
+	response := NewResponse(invite, statusCode, "")
+	if len(tag) > 0 {
+		response.GetTo().SetTag(tag)
+		response.SetContact(NewContact("", "<", "sip", "34020000001320000001", host, 5060, "", -1, nil))
+	}
+	return response
+}
+
+// dialogInviteTest sends transactionInvite through a DialogLayer,the responses passed to the TU are recorded in passed
+func dialogInviteTest(t *testing.T, passed *[]string) (*DialogLayer, *SipMsg, *transactionTransport, *ManualClock) {
+	tl, tt, clock := transactionTest("UDP")
+	dl := NewDialogLayer(tl, NewLocator(nil))
+	handler := func(sm *SipMsg, d *Dialog) {
+		tag := ""
+		if d != nil {
+			tag = d.GetRemoteTag()
+		}
+		*passed = append(*passed, fmt.Sprintf("%d %s", sm.GetStatusLine().GetStatusCode(), tag))
+	}
+	invite := transactionParse(t, transactionInvite)
+	if _, err := dl.Invite(context.Background(), invite, NewTarget("UDP", "", net.IPv4(192, 168, 0, 1), 5060), handler); err != nil {
+		t.Fatal(err)
+	}
+	tt.take()
+	return dl, invite, tt, clock
+}
+
+func TestDialogLayer_Fork(t *testing.T) {
+	var passed []string
+	dl, invite, tt, clock := dialogInviteTest(t, &passed)
+	tl := dl.GetTransactions()
+	tl.Handle(dialogFork(invite, 100, "", ""), nil)
+	tl.Handle(dialogFork(invite, 180, "a", "192.168.0.26"), nil)
+	tl.Handle(dialogFork(invite, 180, "b", "192.168.0.27"), nil)
+	tl.Handle(dialogFork(invite, 180, "c", "192.168.0.28"), nil)
+	if dl.Len() != 3 {
+		t.Error("early dialogs mismatch", dl.Len())
+	}
+	// the first 2xx is passed to the TU,the dialog of another 2xx is acknowledged and ended
+	tl.Handle(dialogFork(invite, 200, "b", "192.168.0.27"), nil)
+	tl.Handle(dialogFork(invite, 200, "a", "192.168.0.26"), nil)
+	tl.Handle(dialogFork(invite, 200, "b", "192.168.0.27"), nil)
+	sent := tt.take()
+	var lines []string
+	for _, raw := range sent {
+		sm := transactionParse(t, raw)
+		lines = append(lines, sm.GetRequestLine().GetMethod()+" "+sm.GetTo().GetTag())
+	}
+	fmt.Println(passed, lines)
+	expected := []string{"ACK b", "ACK a", "BYE a", "ACK b"}
+	if fmt.Sprint(lines) != fmt.Sprint(expected) || sent[0] != sent[3] {
+		t.Error("ACK and BYE mismatch", lines)
+	}
+	if fmt.Sprint(passed) != fmt.Sprint([]string{"100 ", "180 a", "180 b", "180 c", "200 b"}) {
+		t.Error("responses mismatch", passed)
+	}
+	ack := transactionParse(t, sent[0])
+	if ack.GetCSeq().GetNumber() != 1 || ack.GetVia().GetBranch() == invite.GetVia().GetBranch() {
+		t.Error("ACK of 2xx mismatch")
+	}
+	d := dl.Match(dialogFork(invite, 200, "b", "192.168.0.27"))
+	if d == nil || d.GetState() != DialogConfirmed || dl.Len() != 2 {
+		t.Fatal("confirmed dialog mismatch", dl.Len())
+	}
+	// the early dialog left ends with the 2xx retransmissions
+	clock.Advance(64 * T1)
+	if dl.Len() != 1 || dl.Match(dialogFork(invite, 180, "c", "192.168.0.28")) != nil || d.GetState() != DialogConfirmed {
+		t.Error("early dialog not terminated", dl.Len())
+	}
+}
+
+func TestDialogLayer_Failure(t *testing.T) {
+	var passed []string
+	dl, invite, _, _ := dialogInviteTest(t, &passed)
+	tl := dl.GetTransactions()
+	tl.Handle(dialogFork(invite, 180, "a", "192.168.0.26"), nil)
+	tl.Handle(dialogFork(invite, 183, "b", "192.168.0.27"), nil)
+	a := dl.Match(dialogFork(invite, 180, "a", "192.168.0.26"))
+	// a non-2xx final response ends all early dialogs
+	tl.Handle(dialogFork(invite, 486, "x", "192.168.0.29"), nil)
+	fmt.Println(passed)
+	if dl.Len() != 0 || a == nil || a.GetState() != DialogTerminated {
+		t.Error("early dialogs not terminated", dl.Len())
+	}
+	if fmt.Sprint(passed) != fmt.Sprint([]string{"180 a", "183 b", "486 "}) {
+		t.Error("responses mismatch", passed)
+	}
+	if _, err := dl.Invite(context.Background(), transactionParse(t, sipMsgMessage), NewTarget("UDP", "", net.IPv4(192, 168, 0, 1), 5060), nil); err == nil {
+		t.Error("MESSAGE accepted as an INVITE")
+	}
+}
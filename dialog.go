@@ -0,0 +1,563 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12
+//
+// 12 Dialogs
+//
+// A key concept for a user agent is that of a dialog.  A dialog
+// represents a peer-to-peer SIP relationship between two user agents
+// that persists for some time.  The dialog facilitates sequencing of
+// messages between the user agents and proper routing of requests
+// between both of them.  The dialog represents a context in which to
+// interpret SIP messages.
+//
+// A dialog is identified at each UA with a dialog ID, which consists of
+// a Call-ID value, a local tag and a remote tag.  The dialog ID at each
+// UA involved in the dialog is not the same.  Specifically, the local
+// tag at one UA is identical to the remote tag at the peer UA.  The
+// tags are opaque tokens that facilitate the generation of unique
+// dialog IDs.
+//
+// A dialog contains certain pieces of state needed for further message
+// transmissions within the dialog.  This state consists of the dialog
+// ID, a local sequence number (used to order requests from the UA to
+// its peer), a remote sequence number (used to order requests from its
+// peer to the UA), a local URI, a remote URI, remote target, a boolean
+// flag called "secure", and a route set, which is an ordered list of
+// URIs.  The route set is the list of servers that need to be traversed
+// to send a request to the peer.  A dialog can also be in the "early"
+// state, which occurs when it is created with a provisional response,
+// and then transition to the "confirmed" state when a 2xx final
+// response arrives.  For other responses, or if no response arrives at
+// all on that dialog, the early dialog terminates.
+
+// DialogState is the state of a dialog
+type DialogState int
+
+const (
+	DialogEarly      DialogState = iota // created by a provisional response with a To tag
+	DialogConfirmed                     // created or confirmed by a 2xx response
+	DialogTerminated                    // ended by a BYE,a non-2xx final response or a 481/408 to a request within it
+)
+
+func (ds DialogState) String() string {
+	switch ds {
+	case DialogEarly:
+		return "Early"
+	case DialogConfirmed:
+		return "Confirmed"
+	case DialogTerminated:
+		return "Terminated"
+	}
+	return fmt.Sprintf("DialogState(%d)", int(ds))
+}
+
+// Dialog is the state of a dialog at one UA,it orders the requests within the dialog and builds them
+type Dialog struct {
+	callId    *CallID
+	local     *From       // the local URI with the local tag,the From of the requests sent within the dialog
+	remote    *To         // the remote URI with the remote tag,the To of the requests sent within the dialog
+	localSeq  uint32      // 0 when empty
+	remoteSeq uint32      // 0 when empty
+	target    *RequestUri // the remote target,the Contact of the peer
+	routes    []*NameAddr // the route set
+	secure    bool        // the dialog is set up with a SIPS Request-URI
+	state     DialogState
+	mutex     sync.Mutex
+}
+
+// GetID returns the dialog ID,the Call-ID,the local tag and the remote tag separated by a space
+func (d *Dialog) GetID() string {
+	return dialogID(d.callId, d.local.GetTag(), d.remote.GetTag())
+}
+func (d *Dialog) GetCallID() *CallID {
+	return d.callId
+}
+func (d *Dialog) GetLocalTag() string {
+	return d.local.GetTag()
+}
+func (d *Dialog) GetRemoteTag() string {
+	return d.remote.GetTag()
+}
+func (d *Dialog) GetLocal() *From {
+	return d.local
+}
+func (d *Dialog) GetRemote() *To {
+	return d.remote
+}
+func (d *Dialog) GetLocalSeq() uint32 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.localSeq
+}
+func (d *Dialog) GetRemoteSeq() uint32 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.remoteSeq
+}
+func (d *Dialog) GetRemoteTarget() *RequestUri {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.target
+}
+func (d *Dialog) GetRouteSet() []*NameAddr {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.routes
+}
+func (d *Dialog) GetSecure() bool {
+	return d.secure
+}
+func (d *Dialog) GetState() DialogState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.state
+}
+
+// Terminate ends the dialog,example: on a BYE sent or received
+func (d *Dialog) Terminate() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.state = DialogTerminated
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12.1.2
+//
+// 12.1.2 UAC Behavior
+//
+// When a UAC receives a response that establishes a dialog, it
+// constructs the state of the dialog.  This state MUST be maintained
+// for the duration of the dialog.
+//
+// If the request was sent over TLS, and the Request-URI contained a
+// SIPS URI, the "secure" flag is set to TRUE.
+//
+// The route set MUST be set to the list of URIs in the Record-Route
+// header field from the response, taken in reverse order and preserving
+// all URI parameters.  If no Record-Route header field is present in
+// the response, the route set MUST be set to the empty set.  This route
+// set, even if empty, overrides any pre-existing route set for future
+// requests in this dialog.  The remote target MUST be set to the URI
+// from the Contact header field of the response.
+//
+// The local sequence number MUST be set to the value of the sequence
+// number in the CSeq header field of the request.  The remote sequence
+// number MUST be empty (it is established when the remote UA sends a
+// request within the dialog).  The call identifier component of the
+// dialog ID MUST be set to the value of the Call-ID in the request.
+// The local tag component of the dialog ID MUST be set to the tag in
+// the From field in the request, and the remote tag component of the
+// dialog ID MUST be set to the tag in the To field of the response.  A
+// UAC MUST be prepared to receive a response without a tag in the To
+// field, in which case the tag is considered to have a value of null.
+//
+//    This is to maintain backwards compatibility with RFC 2543, which
+//    did not mandate To tags.
+//
+// The remote URI MUST be set to the URI in the To field, and the local
+// URI MUST be set to the URI in the From field.
+
+// NewUACDialog returns the dialog the response to request creates at the UAC,
+// response is a 101-199 response with a To tag or a 2xx response
+func NewUACDialog(request *SipMsg, response *SipMsg) (*Dialog, error) {
+	raw := response.GetSource()
+	statusLine, to := response.GetStatusLine(), response.GetTo()
+	switch {
+	case statusLine == nil || statusLine.GetStatusCode() <= 100 || statusLine.GetStatusCode() >= 300:
+		return nil, NewParseError("Status-Line", raw, 0, "a dialog is created by a 101-299 response")
+	case to == nil:
+		return nil, NewParseError("To", raw, len(raw), "missing To header field")
+	case statusLine.GetStatusCode() < 200 && len(strings.TrimSpace(to.GetTag())) == 0:
+		return nil, NewParseError("To", raw, strings.Index(raw, to.GetSource()), "an early dialog needs a To tag")
+	}
+	d, err := newDialog(request)
+	if err != nil {
+		return nil, err
+	}
+	d.local = dialogFrom(request.GetFrom())
+	d.remote = dialogTo(request.GetTo())
+	d.remote.SetTag(to.GetTag())
+	d.localSeq = request.GetCSeq().GetNumber()
+	d.routes = dialogRouteSet(response.GetRecordRoutes(), true)
+	d.target = dialogTarget(response.GetContact())
+	if statusLine.GetStatusCode() < 200 {
+		d.state = DialogEarly
+	}
+	return d, nil
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12.1.1
+//
+// 12.1.1 UAS behavior
+//
+// If the request arrived over TLS, and the Request-URI contained a SIPS
+// URI, the "secure" flag is set to TRUE.
+//
+// The route set MUST be set to the list of URIs in the Record-Route
+// header field from the request, taken in order and preserving all URI
+// parameters.  If no Record-Route header field is present in the
+// request, the route set MUST be set to the empty set.  This route set,
+// even if empty, overrides any pre-existing route set for future
+// requests in this dialog.  The remote target MUST be set to the URI
+// from the Contact header field of the request.
+//
+// The remote sequence number MUST be set to the value of the sequence
+// number in the CSeq header field of the request.  The local sequence
+// number MUST be empty.  The call identifier component of the dialog ID
+// MUST be set to the value of the Call-ID in the request.  The local
+// tag component of the dialog ID MUST be set to the tag in the To field
+// in the response to the request (which always includes a tag), and
+// the remote tag component of the dialog ID MUST be set to the tag from
+// the From field in the request.  A UAS MUST be prepared to receive a
+// request without a tag in the From field, in which case the tag is
+// considered to have a value of null.
+//
+// The remote URI MUST be set to the URI in the From field, and the
+// local URI MUST be set to the URI in the To field.
+
+// NewUASDialog returns the dialog the response to request creates at the UAS,
+// response is a 101-299 response with the To tag of the UAS
+func NewUASDialog(request *SipMsg, response *SipMsg) (*Dialog, error) {
+	raw := response.GetSource()
+	statusLine, to := response.GetStatusLine(), response.GetTo()
+	switch {
+	case statusLine == nil || statusLine.GetStatusCode() <= 100 || statusLine.GetStatusCode() >= 300:
+		return nil, NewParseError("Status-Line", raw, 0, "a dialog is created by a 101-299 response")
+	case to == nil || len(strings.TrimSpace(to.GetTag())) == 0:
+		return nil, NewParseError("To", raw, 0, "the response of a UAS needs a To tag")
+	}
+	d, err := newDialog(request)
+	if err != nil {
+		return nil, err
+	}
+	from := request.GetFrom()
+	d.local = NewFrom(to.GetName(), to.GetSpec(), to.GetSchema(), to.GetUser(), to.GetHost(), to.GetPort(), to.GetTag(), to.GetParameter().Clone())
+	d.remote = NewTo(from.GetName(), from.GetSpec(), from.GetSchema(), from.GetUser(), from.GetHost(), from.GetPort(), from.GetTag(), from.GetParameter().Clone())
+	d.remoteSeq = request.GetCSeq().GetNumber()
+	d.routes = dialogRouteSet(request.GetRecordRoutes(), false)
+	d.target = dialogTarget(request.GetContact())
+	if statusLine.GetStatusCode() < 200 {
+		d.state = DialogEarly
+	}
+	return d, nil
+}
+
+// newDialog returns a confirmed dialog with the Call-ID and secure flag of request
+func newDialog(request *SipMsg) (*Dialog, error) {
+	raw := request.GetSource()
+	callId := new(CallID)
+	switch {
+	case request.GetRequestLine() == nil:
+		return nil, NewParseError("Request-Line", raw, 0, "a dialog is created by a request")
+	case request.GetCallID() == nil || !sipMsgCopy(request.GetCallID(), callId):
+		return nil, NewParseError("Call-ID", raw, len(raw), "missing Call-ID header field")
+	case request.GetFrom() == nil:
+		return nil, NewParseError("From", raw, len(raw), "missing From header field")
+	case request.GetTo() == nil:
+		return nil, NewParseError("To", raw, len(raw), "missing To header field")
+	case request.GetCSeq() == nil:
+		return nil, NewParseError("CSeq", raw, len(raw), "missing CSeq header field")
+	}
+	secure := false
+	if uri := request.GetRequestLine().GetUri(); uri != nil && uri.GetSipUri() != nil {
+		secure = strings.EqualFold(uri.GetSipUri().GetSchema(), "sips")
+	}
+	return &Dialog{
+		callId: callId,
+		secure: secure,
+		state:  DialogConfirmed,
+	}, nil
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12.2.1.2
+//
+// 12.2.1.2 Processing the Responses
+//
+// If the response for a request within a dialog is a 481
+// (Call/Transaction Does Not Exist) or a 408 (Request Timeout), the UAC
+// SHOULD terminate the dialog.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-13.2.2.4
+//
+// 13.2.2.4 2xx Responses
+//
+// If the dialog identifier in the 2xx response matches the dialog
+// identifier of an existing dialog, the dialog MUST be transitioned to
+// the "confirmed" state, and the route set for the dialog MUST be
+// recomputed based on the 2xx response using the procedures of Section
+// 12.2.1.2.
+
+// Update updates the dialog at the UAC on a response within it: a 2xx confirms an early dialog and recomputes its route set,
+// the Contact of the response to a target refresh request replaces the remote target,
+// a non-2xx final response to the INVITE ends an early dialog and a 481 or 408 ends the dialog.
+func (d *Dialog) Update(response *SipMsg) {
+	statusLine, cseq := response.GetStatusLine(), response.GetCSeq()
+	if statusLine == nil || cseq == nil {
+		return
+	}
+	code := statusLine.GetStatusCode()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	switch {
+	case d.state == DialogTerminated || code <= 100:
+		return
+	case code >= 200 && code < 300:
+		if d.state == DialogEarly {
+			d.routes = dialogRouteSet(response.GetRecordRoutes(), true)
+			d.state = DialogConfirmed
+		}
+	case code == 481 || code == 408:
+		d.state = DialogTerminated
+		return
+	case code >= 300:
+		if d.state == DialogEarly && strings.EqualFold(cseq.GetMethod(), "INVITE") {
+			d.state = DialogTerminated
+		}
+		return
+	}
+	if target := dialogTarget(response.GetContact()); target != nil && dialogTargetRefresh(cseq.GetMethod()) {
+		d.target = target
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12.2.2
+//
+// 12.2.2 UAS Behavior
+//
+// If the remote sequence number is empty, it MUST be set to the value
+// of the sequence number in the CSeq header field value in the request.
+// If the remote sequence number was not empty, but the sequence number
+// of the request is lower than the remote sequence number, the request
+// is out of order and MUST be rejected with a 500 (Server Internal
+// Error) response.  If the remote sequence number was not empty, and
+// the sequence number of the request is greater than the remote
+// sequence number, the request is in order.
+//
+// When a UAS receives a target refresh request, it MUST replace the
+// dialog's remote target URI with the URI from the Contact header field
+// in that request, if present.
+
+// Receive updates the dialog at the UAS on a request within it,
+// a StatusError 500 is returned for a request out of order
+func (d *Dialog) Receive(request *SipMsg) error {
+	requestLine, cseq := request.GetRequestLine(), request.GetCSeq()
+	if requestLine == nil || cseq == nil {
+		raw := request.GetSource()
+		return NewParseError("CSeq", raw, len(raw), "missing CSeq header field")
+	}
+	method := strings.ToUpper(requestLine.GetMethod())
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	// the ACK and CANCEL carry the sequence number of the INVITE
+	if method != "ACK" && method != "CANCEL" {
+		if d.remoteSeq != 0 && cseq.GetNumber() < d.remoteSeq {
+			return NewStatusError(500, "CSeq out of order")
+		}
+		d.remoteSeq = cseq.GetNumber()
+	}
+	if target := dialogTarget(request.GetContact()); target != nil && dialogTargetRefresh(method) {
+		d.target = target
+	}
+	return nil
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12.2.1.1
+//
+// 12.2.1.1 Generating the Request
+//
+// The URI in the To field of the request MUST be set to the remote URI
+// from the dialog state.  The tag in the To header field of the request
+// MUST be set to the remote tag of the dialog ID.  The From URI of the
+// request MUST be set to the local URI from the dialog state.  The tag
+// in the From header field of the request MUST be set to the local tag
+// of the dialog ID.  If the value of the remote or local tags is null,
+// the tag parameter MUST be omitted from the To or From header fields,
+// respectively.
+//
+// The Call-ID of the request MUST be set to the Call-ID of the dialog.
+// Requests within a dialog MUST contain strictly monotonically
+// increasing and contiguous CSeq sequence numbers (increasing-by-one)
+// in each direction (excepting ACK and CANCEL of course, whose numbers
+// equal the requests being acknowledged or cancelled).  Therefore, if
+// the local sequence number is not empty, the value of the local
+// sequence number MUST be incremented by one, and this value MUST be
+// placed into the CSeq header field.  If the local sequence number is
+// empty, an initial value MUST be chosen using the guidelines of
+// Section 8.1.1.5.  The method field in the CSeq header field value
+// MUST match the method of the request.
+//
+// The UAC uses the remote target and route set to build the Request-URI
+// and Route header field of the request.
+//
+// If the route set is empty, the UAC MUST place the remote target URI
+// into the Request-URI.  The UAC MUST NOT add a Route header field to
+// the request.
+//
+// If the route set is not empty, and the first URI in the route set
+// contains the lr parameter (see Section 19.1.1), the UAC MUST place
+// the remote target URI into the Request-URI and MUST include a Route
+// header field containing the route set values in order, including all
+// parameters.
+//
+// If the route set is not empty, and its first URI does not contain the
+// lr parameter, the UAC MUST place the first URI from the route set
+// into the Request-URI, stripping any parameters that are not allowed
+// in a Request-URI.  The UAC MUST add a Route header field containing
+// the remainder of the route set values in order, including all
+// parameters.  The UAC MUST then place the remote target URI into the
+// Route header field as the last value.
+
+// NewRequest returns a request of method within the dialog with its Request-URI,Route,Max-Forwards,From,To,Call-ID,CSeq
+// and Content-Length header fields,the caller adds the Via,the Contact and the body.
+// An ACK takes the sequence number of the INVITE,any other method takes the next one,the first is 1.
+func (d *Dialog) NewRequest(method string) *SipMsg {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !strings.EqualFold(method, "ACK") {
+		d.localSeq++
+	}
+	routes := make([]*NameAddr, 0, len(d.routes)+1)
+	for _, route := range d.routes {
+		if clone := new(NameAddr); sipMsgCopy(route, clone) {
+			routes = append(routes, clone)
+		}
+	}
+	requestUri := new(RequestUri)
+	if d.target != nil {
+		sipMsgCopy(d.target, requestUri)
+	}
+	if len(routes) > 0 && !routes[0].GetParameter().Has("lr") {
+		// a strict router takes the Request-URI
+		target := new(NameAddr)
+		if sipMsgCopy(requestUri, target) {
+			routes = append(routes, target)
+		}
+		requestUri = new(RequestUri)
+		sipMsgCopy(routes[0], requestUri)
+		if parameters := requestUri.GetSipUri().GetParameters(); parameters != nil {
+			parameters.SetMethod("")
+		}
+		requestUri.GetSipUri().SetHeaders(nil)
+		routes = routes[1:]
+	}
+	sm := new(SipMsg)
+	sm.SetRequestLine(NewRequestLine(strings.ToUpper(method), requestUri, "SIP", 2.0))
+	if len(routes) > 0 {
+		sm.SetRoute(NewRoute(routes...))
+	}
+	sm.SetMaxForwards(NewMaxForwards(70))
+	if from := new(From); sipMsgCopy(d.local, from) {
+		sm.SetFrom(from)
+	}
+	if to := new(To); sipMsgCopy(d.remote, to) {
+		sm.SetTo(to)
+	}
+	if callId := new(CallID); sipMsgCopy(d.callId, callId) {
+		sm.SetCallID(callId)
+	}
+	sm.SetCSeq(NewCSeq(d.localSeq, strings.ToUpper(method)))
+	sm.SetContentLength(NewContentLength(0))
+	return sm
+}
+
+// DialogIDOf returns the ID of the dialog a received message belongs to,
+// the local tag is the To tag of a request and the From tag of a response
+func DialogIDOf(sm *SipMsg) string {
+	from, to := sm.GetFrom(), sm.GetTo()
+	if from == nil || to == nil {
+		return ""
+	}
+	if sm.GetStatusLine() != nil {
+		return dialogID(sm.GetCallID(), from.GetTag(), to.GetTag())
+	}
+	return dialogID(sm.GetCallID(), to.GetTag(), from.GetTag())
+}
+
+// dialogID returns the dialog ID of a Call-ID and the tags
+func dialogID(callId *CallID, localTag string, remoteTag string) string {
+	value := ""
+	if callId != nil {
+		value = callId.GetLocalId()
+		if len(strings.TrimSpace(callId.GetHost())) > 0 {
+			value += "@" + callId.GetHost()
+		}
+	}
+	return fmt.Sprintf("%s %s %s", value, localTag, remoteTag)
+}
+
+// dialogFrom returns a copy of from
+func dialogFrom(from *From) *From {
+	clone := new(From)
+	sipMsgCopy(from, clone)
+	return clone
+}
+
+// dialogTo returns a copy of to
+func dialogTo(to *To) *To {
+	clone := new(To)
+	sipMsgCopy(to, clone)
+	return clone
+}
+
+// dialogRouteSet returns the URIs of the Record-Route header fields,reversed for the UAC
+func dialogRouteSet(recordRoutes []*RecordRoute, reverse bool) []*NameAddr {
+	routes := make([]*NameAddr, 0)
+	for _, recordRoute := range recordRoutes {
+		for _, nameAddr := range recordRoute.GetNameAddrs() {
+			if clone := new(NameAddr); sipMsgCopy(nameAddr, clone) {
+				routes = append(routes, clone)
+			}
+		}
+	}
+	if reverse {
+		for i, j := 0, len(routes)-1; i < j; i, j = i+1, j-1 {
+			routes[i], routes[j] = routes[j], routes[i]
+		}
+	}
+	return routes
+}
+
+// dialogTarget returns a copy of the URI of contact with its uri-parameters,nil when there is none,
+// the headers of the URI are not allowed in a Request-URI by RFC 3261 19.1.1
+func dialogTarget(contact *Contact) *RequestUri {
+	if contact == nil || len(strings.TrimSpace(contact.GetHost())) == 0 {
+		return nil
+	}
+	schema := contact.GetSchema()
+	if len(strings.TrimSpace(schema)) == 0 {
+		schema = "sip"
+	}
+	uri := strings.ToLower(schema) + ":"
+	if len(strings.TrimSpace(contact.GetUser())) > 0 {
+		uri += contact.GetUser() + "@"
+	}
+	uri += contact.GetHost()
+	if contact.GetPort() > 0 {
+		uri += fmt.Sprintf(":%d", contact.GetPort())
+	}
+	if contact.GetUriParams() != nil {
+		uriParams := contact.GetUriParams().Raw()
+		uri += uriParams.String()
+	}
+	target := new(RequestUri)
+	if err := target.Parse(uri); err != nil {
+		return nil
+	}
+	return target
+}
+
+// dialogTargetRefresh reports whether method refreshes the remote target,
+// INVITE by RFC 3261,UPDATE by RFC 3311 and SUBSCRIBE/NOTIFY by RFC 6665
+func dialogTargetRefresh(method string) bool {
+	switch strings.ToUpper(method) {
+	case "INVITE", "UPDATE", "SUBSCRIBE", "NOTIFY":
+		return true
+	}
+	return false
+}
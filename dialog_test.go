@@ -0,0 +1,156 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dialogOK is the 200 a camera answers transactionInvite with through the proxies p1 and p2
+const dialogOK = "SIP/2.0 200 OK\r\n" +
+	"Via: SIP/2.0/UDP 192.168.0.108:5060;rport=5060;branch=z9hG4bK1371463275\r\n" +
+	"Record-Route: <sip:p2.example.com;lr>\r\n" +
+	"Record-Route: <sip:p1.example.com;lr>\r\n" +
+	"From: <sip:34020000002000000001@3402000000>;tag=2043466183\r\n" +
+	"To: <sip:34020000001320000001@3402000000>;tag=776\r\n" +
+	"Call-ID: 1011047671@192.168.0.108\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+func TestDialog_UAC(t *testing.T) {
+	invite := transactionParse(t, transactionInvite)
+	ok := transactionParse(t, dialogOK)
+	d, err := NewUACDialog(invite, ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(d.GetID())
+	if d.GetID() != DialogIDOf(ok) || d.GetState() != DialogConfirmed || d.GetLocalSeq() != 1 || d.GetRemoteSeq() != 0 || d.GetSecure() {
+		t.Error("dialog state mismatch")
+	}
+	ack := d.NewRequest("ACK")
+	bye := d.NewRequest("BYE")
+	result := bye.Raw()
+	fmt.Print(result.String())
+	expected := "BYE sip:34020000001320000001@192.168.0.26:5060 SIP/2.0\r\n" +
+		"Route: <sip:p1.example.com;lr>, <sip:p2.example.com;lr>\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"From: <sip:34020000002000000001@3402000000>;tag=2043466183\r\n" +
+		"To: <sip:34020000001320000001@3402000000>;tag=776\r\n" +
+		"Call-ID: 1011047671@192.168.0.108\r\n" +
+		"CSeq: 2 BYE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	if result.String() != expected {
+		t.Error("BYE mismatch")
+	}
+	if ack.GetCSeq().GetNumber() != 1 || ack.GetCSeq().GetMethod() != "ACK" {
+		t.Error("ACK CSeq mismatch")
+	}
+	// the BYE matches the dialog at the UAS
+	if DialogIDOf(bye) != "1011047671@192.168.0.108 776 2043466183" {
+		t.Error("dialog ID mismatch", DialogIDOf(bye))
+	}
+	d.Update(NewResponse(bye, 481, ""))
+	if d.GetState() != DialogTerminated {
+		t.Error("481 did not terminate the dialog")
+	}
+	// the remote target keeps the uri-parameters of the Contact but not its headers
+	ok = transactionParse(t, strings.Replace(dialogOK, "192.168.0.26:5060>", "192.168.0.26:5060;transport=tcp;ob?X=y>", 1))
+	if d, err = NewUACDialog(invite, ok); err != nil {
+		t.Fatal(err)
+	}
+	if target := d.GetRemoteTarget().Raw(); target.String() != "sip:34020000001320000001@192.168.0.26:5060;transport=tcp;ob" {
+		t.Error("remote target mismatch", target.String())
+	}
+}
+
+func TestDialog_StrictRouting(t *testing.T) {
+	invite := transactionParse(t, transactionInvite)
+	ok := transactionParse(t, strings.Replace(strings.Replace(dialogOK, "<sip:p1.example.com;lr>", "<sip:p1.example.com>", 1),
+		"Record-Route: <sip:p2.example.com;lr>\r\n", "", 1))
+	d, err := NewUACDialog(invite, ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := d.NewRequest("INFO")
+	requestUri, route := info.GetRequestLine().GetUri().Raw(), info.GetRoute().Raw()
+	fmt.Print(requestUri.String(), "\r\n", route.String())
+	if requestUri.String() != "sip:p1.example.com" || route.String() != "Route: <sip:34020000001320000001@192.168.0.26:5060>\r\n" {
+		t.Error("strict routing mismatch")
+	}
+}
+
+func TestDialog_Early(t *testing.T) {
+	invite := transactionParse(t, transactionInvite)
+	ringing := NewResponse(invite, 180, "")
+	if _, err := NewUACDialog(invite, ringing); err == nil {
+		t.Error("early dialog without To tag")
+	}
+	ringing.GetTo().SetTag("776")
+	ringing.SetContact(NewContact("", "<", "sip", "34020000001320000001", "192.168.0.26", 5070, "", -1, nil))
+	d, err := NewUACDialog(invite, ringing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.GetState() != DialogEarly || len(d.GetRouteSet()) != 0 {
+		t.Error("early dialog mismatch", d.GetState())
+	}
+	// the 2xx confirms the dialog,its route set and remote target replace those of the 180
+	d.Update(transactionParse(t, dialogOK))
+	target := d.GetRemoteTarget().Raw()
+	if d.GetState() != DialogConfirmed || len(d.GetRouteSet()) != 2 || target.String() != "sip:34020000001320000001@192.168.0.26:5060" {
+		t.Error("confirmed dialog mismatch", d.GetState(), target.String())
+	}
+	// a non-2xx final response ends an early dialog
+	d, _ = NewUACDialog(invite, ringing)
+	d.Update(NewResponse(invite, 486, ""))
+	if d.GetState() != DialogTerminated {
+		t.Error("486 did not terminate the early dialog")
+	}
+}
+
+func TestDialog_UAS(t *testing.T) {
+	invite := transactionParse(t, strings.Replace(transactionInvite, "To: ",
+		"Record-Route: <sip:p2.example.com;lr>\r\nRecord-Route: <sip:p1.example.com;lr>\r\nTo: ", 1))
+	ok := transactionParse(t, dialogOK)
+	d, err := NewUASDialog(invite, ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(d.GetID())
+	if d.GetID() != DialogIDOf(transactionParse(t, strings.Replace(transactionInvite, "To: <sip:34020000001320000001@3402000000>", "To: <sip:34020000001320000001@3402000000>;tag=776", 1))) {
+		t.Error("dialog ID mismatch")
+	}
+	bye := d.NewRequest("BYE")
+	result := bye.Raw()
+	fmt.Print(result.String())
+	expected := "BYE sip:34020000002000000001@192.168.0.108:5060 SIP/2.0\r\n" +
+		"Route: <sip:p2.example.com;lr>, <sip:p1.example.com;lr>\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=776\r\n" +
+		"To: <sip:34020000002000000001@3402000000>;tag=2043466183\r\n" +
+		"Call-ID: 1011047671@192.168.0.108\r\n" +
+		"CSeq: 1 BYE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	if result.String() != expected {
+		t.Error("BYE mismatch")
+	}
+	// the requests of the UAC are ordered by CSeq,a re-INVITE refreshes the remote target
+	info := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "3 INFO", 1))
+	info.GetRequestLine().SetMethod("INFO")
+	if err := d.Receive(info); err != nil || d.GetRemoteSeq() != 3 {
+		t.Error(err, d.GetRemoteSeq())
+	}
+	info.GetCSeq().SetNumber(2)
+	if err, ok := d.Receive(info).(*StatusError); !ok || err.GetStatusCode() != 500 {
+		t.Error("request out of order accepted")
+	}
+	reinvite := transactionParse(t, strings.Replace(strings.Replace(transactionInvite, "1 INVITE", "4 INVITE", 1), "192.168.0.108:5060>", "192.168.0.109:5060>", 1))
+	if err := d.Receive(reinvite); err != nil {
+		t.Error(err)
+	}
+	if target := d.GetRemoteTarget().Raw(); target.String() != "sip:34020000002000000001@192.168.0.109:5060" {
+		t.Error("remote target not refreshed", target.String())
+	}
+}
@@ -0,0 +1,337 @@
+package sip
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc2617.html#section-3.2.1
+//
+// 3.2.1 The WWW-Authenticate Response Header
+//
+// nonce
+//    A server-specified data string which should be uniquely generated
+//    each time a 401 response is made. It is recommended that this
+//    string be base64 or hexadecimal data. Specifically, since the
+//    string is passed in the header lines as a quoted string, the
+//    double-quote character is not allowed.
+//
+//    The contents of the nonce are implementation dependent. The quality
+//    of the implementation depends on a good choice. A nonce might, for
+//    example, be constructed as the base 64 encoding of
+//
+//        time-stamp H(time-stamp ":" ETag ":" private-key)
+//
+//    where time-stamp is a server-generated time or other non-repeating
+//    value, ETag is the value of the HTTP ETag header associated with
+//    the requested entity, and private-key is data known only to the
+//    server.  With a nonce of this form a server would recalculate the
+//    hash portion after receiving the client authentication header and
+//    reject the request if it did not match the nonce from that header
+//    or if the time-stamp value is not recent enough. In this way the
+//    server can limit the time of the nonce's validity.
+//
+// stale
+//    A flag, indicating that the previous request from the client was
+//    rejected because the nonce value was stale. If stale is TRUE
+//    (case-insensitive), the client may wish to simply retry the request
+//    with a new encrypted response, without reprompting the user for a
+//    new username and password. The server should only set stale to TRUE
+//    if it receives a request for which the nonce is invalid but with a
+//    valid digest for that nonce (indicating that the client knows the
+//    correct username/password). If stale is FALSE, or anything other
+//    than TRUE, or the stale directive is not present, the username
+//    and/or password are invalid, and new values must be obtained.
+
+// https://www.rfc-editor.org/rfc/rfc2617.html#section-3.2.2
+//
+// 3.2.2 The Authorization Request Header
+//
+// nonce-count
+//    This MUST be specified if a qop directive is sent (see above), and
+//    MUST NOT be specified if the server did not send a qop directive in
+//    the WWW-Authenticate header field.  The nc-value is the hexadecimal
+//    count of the number of requests (including the current request)
+//    that the client has sent with the nonce value in this request.  For
+//    example, in the first request sent in response to a given nonce
+//    value, the client sends "nc=00000001".  The purpose of this
+//    directive is to allow the server to detect request replays by
+//    maintaining its own copy of this count - if the same nc-value is
+//    seen twice, then the request is a replay.
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-22.3
+//
+// 22.3 Proxy-to-User Authentication
+//
+// When a UAC sends a request to a proxy server, the proxy server MAY
+// authenticate the originator before the request is processed.  If no
+// credentials (in the Proxy-Authorization header field) are provided in
+// the request, the proxy can challenge the originator to provide
+// credentials by rejecting the request with a 407 (Proxy Authentication
+// Required) status code.  The proxy MUST populate the 407 (Proxy
+// Authentication Required) message with a Proxy-Authenticate header
+// field value applicable to the proxy for the requested resource.
+
+const digestNonceLifetime = 5 * time.Minute // a nonce older is stale
+
+// DigestVerifier issues the Digest challenges of a UAS or of a proxy in a realm,
+// and verifies the credentials answering them with the passwords of a CredentialStore
+type DigestVerifier struct {
+	store     CredentialStore
+	realm     string
+	clock     Clock
+	algorithm string        // MD5 or MD5-sess
+	qop       string        // the qop-options of the challenges,"" for the RFC 2069 clients
+	lifetime  time.Duration // a nonce older is stale
+	proxy     bool          // challenged with 407 and Proxy-Authenticate instead of 401 and WWW-Authenticate
+	nonces    map[string]*digestNonce
+	mutex     sync.Mutex
+}
+
+// digestNonce is a nonce issued by a DigestVerifier
+type digestNonce struct {
+	expires time.Time
+	nc      uint32 // the highest nonce-count accepted
+}
+
+func (dv *DigestVerifier) GetStore() CredentialStore {
+	return dv.store
+}
+func (dv *DigestVerifier) GetRealm() string {
+	return dv.realm
+}
+func (dv *DigestVerifier) SetClock(clock Clock) {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	dv.clock = clock
+}
+func (dv *DigestVerifier) GetClock() Clock {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	return dv.clock
+}
+func (dv *DigestVerifier) SetAlgorithm(algorithm string) {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	dv.algorithm = algorithm
+}
+func (dv *DigestVerifier) GetAlgorithm() string {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	return dv.algorithm
+}
+func (dv *DigestVerifier) SetQop(qop string) {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	dv.qop = qop
+}
+func (dv *DigestVerifier) GetQop() string {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	return dv.qop
+}
+func (dv *DigestVerifier) SetLifetime(lifetime time.Duration) {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	dv.lifetime = lifetime
+}
+func (dv *DigestVerifier) GetLifetime() time.Duration {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	return dv.lifetime
+}
+func (dv *DigestVerifier) SetProxy(proxy bool) {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	dv.proxy = proxy
+}
+func (dv *DigestVerifier) GetProxy() bool {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	return dv.proxy
+}
+
+// Len returns the number of the nonces issued,expired ones are forgotten by the next challenge
+func (dv *DigestVerifier) Len() int {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	return len(dv.nonces)
+}
+
+// NewDigestVerifier returns a DigestVerifier of realm challenging with MD5 and qop auth,
+// servers MUST always send a qop parameter by RFC 3261 22.4
+func NewDigestVerifier(realm string, store CredentialStore) *DigestVerifier {
+	return &DigestVerifier{
+		store:     store,
+		realm:     realm,
+		clock:     SystemClock{},
+		algorithm: "MD5",
+		qop:       "auth",
+		lifetime:  digestNonceLifetime,
+		nonces:    make(map[string]*digestNonce),
+	}
+}
+
+// Challenge returns a challenge of a new nonce,stale when the credentials of the last request were valid but not their nonce,
+// a proxy sends its value in a Proxy-Authenticate header field
+func (dv *DigestVerifier) Challenge(stale bool) *WWWAuthenticate {
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	now := dv.clock.Now()
+	dv.prune(now)
+	nonce := genRandomHex(16)
+	dv.nonces[nonce] = &digestNonce{expires: now.Add(dv.lifetime)}
+	return NewWWWAuthenticate(dv.realm, "", nonce, "", stale, dv.algorithm, dv.qop, nil)
+}
+
+// Authenticate returns the username of the valid credentials of a request and no response,
+// otherwise the response to send: a 401 or a 407 with a new challenge,400 for malformed credentials
+func (dv *DigestVerifier) Authenticate(sm *SipMsg) (string, *SipMsg) {
+	username, stale, err := dv.verify(sm)
+	if err == nil {
+		return username, nil
+	}
+	statusError, ok := err.(*StatusError)
+	if !ok {
+		statusError = NewStatusError(500, "")
+	}
+	response := proxyResponse(sm, statusError.GetStatusCode(), statusError.GetReasonPhrase())
+	switch statusError.GetStatusCode() {
+	case 401:
+		response.SetWWWAuthenticate(dv.Challenge(stale))
+	case 407:
+		raw := dv.Challenge(stale).Raw()
+		response.GetGenericHeaders().Add("Proxy-Authenticate", strings.TrimSpace(strings.TrimPrefix(raw.String(), "WWW-Authenticate:")))
+	}
+	return "", response
+}
+
+// verify returns the username of the valid credentials of a request,
+// stale when the digest is valid but its nonce was not issued or has expired
+func (dv *DigestVerifier) verify(sm *SipMsg) (string, bool, error) {
+	algorithm, qop, proxy := dv.GetAlgorithm(), dv.GetQop(), dv.GetProxy()
+	challenged := NewStatusError(401, "")
+	if proxy {
+		challenged = NewStatusError(407, "")
+	}
+	// the credentials of other realms are for other servers
+	var authorization *Authorization
+	for _, credentials := range digestCredentials(sm, proxy) {
+		if credentials.GetRealm() == dv.realm && strings.EqualFold(credentials.GetAuthSchema(), "Digest") {
+			authorization = credentials
+			break
+		}
+	}
+	if authorization == nil || sm.GetRequestLine() == nil {
+		return "", false, challenged
+	}
+	username, nonce, response := authorization.GetUsername(), authorization.GetNonce(), authorization.GetResponse()
+	if len(username) == 0 || len(nonce) == 0 || len(response) == 0 || authorization.GetUri() == nil {
+		return "", false, NewStatusError(400, "")
+	}
+	// an algorithm other than the challenged one,a qop not offered,or MD5-sess without the cnonce of a qop
+	responded := authorization.GetAlgorithm()
+	if len(strings.TrimSpace(responded)) == 0 {
+		responded = "MD5"
+	}
+	if !strings.EqualFold(responded, algorithm) {
+		return "", false, NewStatusError(400, "")
+	}
+	var nc uint64
+	if len(authorization.GetQop()) > 0 {
+		if !digestQop(qop, authorization.GetQop()) || len(authorization.GetCNonce()) == 0 {
+			return "", false, NewStatusError(400, "")
+		}
+		count, err := strconv.ParseUint(authorization.GetNc(), 16, 32)
+		if err != nil {
+			return "", false, NewStatusError(400, "")
+		}
+		nc = count
+	} else if strings.EqualFold(algorithm, "MD5-sess") || len(strings.TrimSpace(qop)) > 0 {
+		// without the qop offered there is no nonce-count,a response could be replayed by RFC 3261 22.4 item 8
+		return "", false, NewStatusError(400, "")
+	}
+	credential, err := dv.store.Get(username, dv.realm)
+	if err != nil {
+		return "", false, err
+	}
+	if credential == nil {
+		return "", false, challenged
+	}
+	dp := &DigestParams{
+		Digest: Digest{
+			Realm:    dv.realm,
+			UserName: username,
+			Password: credential.GetPassword(),
+		},
+		HA1:        credential.GetHA1(),
+		Qop:        authorization.GetQop(),
+		Algorithm:  algorithm,
+		Method:     strings.ToUpper(sm.GetRequestLine().GetMethod()), // the method as the Request-Line is sent
+		URI:        authorization.GetUriValue(),                      // hashed as received,not as the URI is written again
+		Nonce:      nonce,
+		Cnonce:     authorization.GetCNonce(),
+		Nc:         uint32(nc),
+		EntityBody: string(sm.GetBody()),
+	}
+	// compared in constant time,the time taken tells nothing of the expected response
+	if subtle.ConstantTimeCompare([]byte(GenDigestResponse(dp)), []byte(strings.ToLower(response))) != 1 {
+		return "", false, challenged
+	}
+	// the digest is valid,the nonce is checked last to tell a stale one
+	dv.mutex.Lock()
+	defer dv.mutex.Unlock()
+	dv.prune(dv.clock.Now())
+	issued, ok := dv.nonces[nonce]
+	if !ok {
+		return "", true, challenged
+	}
+	// a nonce-count seen before is a replay,the RFC 2069 clients without qop have no nonce-count
+	if len(authorization.GetQop()) > 0 {
+		if uint32(nc) <= issued.nc {
+			return "", false, challenged
+		}
+		issued.nc = uint32(nc)
+	}
+	return username, false, nil
+}
+
+// prune forgets the nonces expired at now,the caller holds the mutex
+func (dv *DigestVerifier) prune(now time.Time) {
+	for nonce, issued := range dv.nonces {
+		if !now.Before(issued.expires) {
+			delete(dv.nonces, nonce)
+		}
+	}
+}
+
+// digestCredentials returns the Authorization of a request,or its Proxy-Authorization values for a proxy
+func digestCredentials(sm *SipMsg, proxy bool) []*Authorization {
+	if !proxy {
+		if sm.GetAuthorization() == nil {
+			return nil
+		}
+		return []*Authorization{sm.GetAuthorization()}
+	}
+	var credentials []*Authorization
+	for _, value := range sm.GetGenericHeaders().Values("Proxy-Authorization") {
+		authorization := new(Authorization)
+		if err := authorization.Parse("Authorization: " + value); err == nil {
+			credentials = append(credentials, authorization)
+		}
+	}
+	return credentials
+}
+
+// digestQop reports whether qop is one of the qop-options of a challenge
+func digestQop(options string, qop string) bool {
+	for _, option := range strings.Split(options, ",") {
+		if strings.EqualFold(strings.TrimSpace(option), qop) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package sip
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// digestVerifierTest returns a DigestVerifier of the realm 3402000000 knowing the camera of sipMsgRegister,and its ManualClock
+func digestVerifierTest() (*DigestVerifier, *ManualClock) {
+	store := NewMemoryCredentialStore()
+	store.Put("34020000001320000001", "3402000000", NewCredential("12345678", ""))
+	clock := NewManualClock(time.Unix(0, 0))
+	verifier := NewDigestVerifier("3402000000", store)
+	verifier.SetClock(clock)
+	return verifier, clock
+}
+
+// digestVerifierAuthorize returns sipMsgRegister with the credentials of password answering challenge with the nonce-count nc
+func digestVerifierAuthorize(t *testing.T, challenge *WWWAuthenticate, password string, nc uint32) *SipMsg {
+	sm := transactionParse(t, sipMsgRegister)
+	uri := sm.GetRequestLine().GetUri()
+	uriRaw := uri.Raw()
+	dp := &DigestParams{
+		Digest:    Digest{Realm: challenge.GetRealm(), UserName: "34020000001320000001", Password: password},
+		Qop:       challenge.GetQop(),
+		Algorithm: challenge.GetAlgorithm(),
+		Method:    "REGISTER",
+		URI:       uriRaw.String(),
+		Nonce:     challenge.GetNonce(),
+		Cnonce:    "0a4f113b",
+		Nc:        nc,
+	}
+	sm.SetAuthorization(NewAuthorization("34020000001320000001", challenge.GetRealm(), challenge.GetNonce(), uri, GenDigestResponse(dp),
+		challenge.GetAlgorithm(), dp.Cnonce, "", dp.Qop, fmt.Sprintf("%08x", nc), nil))
+	return sm
+}
+
+func TestGenDigestResponse(t *testing.T) {
+	// the example of RFC 2617 3.5
+	dp := &DigestParams{
+		Digest: Digest{Realm: "testrealm@host.com", UserName: "Mufasa", Password: "Circle Of Life"},
+		Qop:    "auth",
+		Method: "GET",
+		URI:    "/dir/index.html",
+		Nonce:  "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		Cnonce: "0a4f113b",
+		Nc:     1,
+	}
+	if response := GenDigestResponse(dp); response != "6629fae49393a05397450978507c4ef1" {
+		t.Error("response mismatch", response)
+	}
+	// the HA1 kept instead of the password
+	dp.Digest.Password = ""
+	dp.HA1 = GenHA1("Mufasa", "testrealm@host.com", "Circle Of Life")
+	if response := GenDigestResponse(dp); response != "6629fae49393a05397450978507c4ef1" {
+		t.Error("HA1 response mismatch", response)
+	}
+	// MD5-sess hashes the hex of the HA1 with the nonce and the cnonce by RFC 2617 3.2.2.2,the algorithm is case-insensitive
+	dp.Algorithm = "md5-SESS"
+	if response := GenDigestResponse(dp); response != "8e3825c57e897f5a0dec6c2d4e5059d0" {
+		t.Error("MD5-sess response mismatch", response)
+	}
+}
+
+func TestDigestVerifier_Authenticate(t *testing.T) {
+	verifier, clock := digestVerifierTest()
+	_, response := verifier.Authenticate(transactionParse(t, sipMsgRegister))
+	result := response.Raw()
+	fmt.Print(result.String())
+	challenge := response.GetWWWAuthenticate()
+	if response.GetStatusLine().GetStatusCode() != 401 || challenge == nil || challenge.GetQop() != "auth" || challenge.GetStale() || verifier.Len() != 1 {
+		t.Fatal("401 mismatch")
+	}
+	if username, response := verifier.Authenticate(digestVerifierAuthorize(t, challenge, "12345678", 1)); username != "34020000001320000001" || response != nil {
+		t.Fatal("credentials not accepted")
+	}
+	// a nonce-count seen before is a replay
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, challenge, "12345678", 1)); response == nil || response.GetWWWAuthenticate().GetStale() {
+		t.Error("replay accepted")
+	}
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, challenge, "12345678", 2)); response != nil {
+		t.Error("next nonce-count not accepted")
+	}
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, challenge, "87654321", 3)); response == nil || response.GetStatusLine().GetStatusCode() != 401 || response.GetWWWAuthenticate().GetStale() {
+		t.Error("wrong password accepted")
+	}
+	// a valid digest of an expired nonce is stale
+	clock.Advance(digestNonceLifetime)
+	_, response = verifier.Authenticate(digestVerifierAuthorize(t, challenge, "12345678", 3))
+	if response == nil || !response.GetWWWAuthenticate().GetStale() {
+		t.Fatal("expired nonce not stale")
+	}
+	challenge = response.GetWWWAuthenticate()
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, challenge, "12345678", 1)); response != nil || verifier.Len() != 1 {
+		t.Error("credentials of the new nonce not accepted")
+	}
+	// a qop not offered is malformed
+	challenge.SetQop("auth-int")
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, challenge, "12345678", 2)); response == nil || response.GetStatusLine().GetStatusCode() != 400 {
+		t.Error("qop not offered accepted")
+	}
+}
+
+func TestDigestVerifier_Qop(t *testing.T) {
+	verifier, clock := digestVerifierTest()
+	first := verifier.Challenge(false)
+	// credentials without the qop offered have no nonce-count and could be replayed
+	withoutQop := NewWWWAuthenticate(first.GetRealm(), "", first.GetNonce(), "", false, first.GetAlgorithm(), "", nil)
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, withoutQop, "12345678", 1)); response == nil || response.GetStatusLine().GetStatusCode() != 400 {
+		t.Error("credentials without qop accepted")
+	}
+	// the digest-uri-value is hashed as received
+	uri := "sip:Example.COM;transport=TCP"
+	dp := &DigestParams{
+		Digest:    Digest{Realm: "3402000000", UserName: "34020000001320000001", Password: "12345678"},
+		Qop:       "auth",
+		Algorithm: "MD5",
+		Method:    "REGISTER",
+		URI:       uri,
+		Nonce:     first.GetNonce(),
+		Cnonce:    "0a4f113b",
+		Nc:        1,
+	}
+	authorization := new(Authorization)
+	if err := authorization.Parse(fmt.Sprintf(`Authorization: Digest username="34020000001320000001", realm="3402000000", nonce="%s", uri="%s", `+
+		`response="%s", algorithm=MD5, cnonce="0a4f113b", qop=auth, nc=00000001`, first.GetNonce(), uri, GenDigestResponse(dp))); err != nil {
+		t.Fatal(err)
+	}
+	if written := authorization.GetUri().Raw(); written.String() == uri || authorization.GetUriValue() != uri {
+		t.Error("digest-uri-value mismatch", written.String())
+	}
+	register := transactionParse(t, sipMsgRegister)
+	register.SetAuthorization(authorization)
+	if username, response := verifier.Authenticate(register); username != "34020000001320000001" || response != nil {
+		t.Error("credentials of the received uri not accepted")
+	}
+	// the expired nonces are forgotten as credentials are verified
+	clock.Advance(digestNonceLifetime / 2)
+	second := verifier.Challenge(false)
+	clock.Advance(digestNonceLifetime / 2)
+	if _, response := verifier.Authenticate(digestVerifierAuthorize(t, second, "12345678", 1)); response != nil || verifier.Len() != 1 {
+		t.Error("expired nonce kept", verifier.Len())
+	}
+}
+
+func TestDigestVerifier_Proxy(t *testing.T) {
+	verifier, _ := digestVerifierTest()
+	verifier.GetStore().(*MemoryCredentialStore).Put("34020000001320000001", "3402000000", NewCredential("", GenHA1("34020000001320000001", "3402000000", "12345678")))
+	verifier.SetAlgorithm("MD5-sess")
+	verifier.SetQop("auth,auth-int")
+	verifier.SetProxy(true)
+	_, response := verifier.Authenticate(transactionParse(t, sipMsgMessage))
+	values := response.GetGenericHeaders().Values("Proxy-Authenticate")
+	if response.GetStatusLine().GetStatusCode() != 407 || len(values) != 1 || response.GetWWWAuthenticate() != nil {
+		t.Fatal("407 mismatch")
+	}
+	// credentials of a nonce the verifier issued,the response is MD5 of
+	// MD5(MD5("34020000001320000001:3402000000:12345678") ":" nonce ":" cnonce) ":" nonce ":00000001:" cnonce ":auth-int:"
+	// MD5("MESSAGE:sip:34020000002000000001@3402000000:" MD5(body)),each hash written in hex
+	verifier.nonces["dcd98b7102dd2f0e8b11d0f600bfb0c093"] = &digestNonce{expires: time.Unix(0, 0).Add(digestNonceLifetime)}
+	message := transactionParse(t, sipMsgMessage)
+	message.GetGenericHeaders().Add("Proxy-Authorization", `Digest username="34020000001320000001", realm="3402000000", `+
+		`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="sip:34020000002000000001@3402000000", response="ed5e0c38825509b2c0687ae6eb8897e2", `+
+		`algorithm=MD5-sess, cnonce="0a4f113b", qop=auth-int, nc=00000001`)
+	// a changed body fails the integrity check
+	changed, err := message.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed.SetBody([]byte("<?xml version=\"1.0\"?>\r\n"))
+	if _, response := verifier.Authenticate(changed); response == nil || response.GetStatusLine().GetStatusCode() != 407 {
+		t.Error("changed body accepted")
+	}
+	if username, response := verifier.Authenticate(message); username != "34020000001320000001" || response != nil {
+		t.Fatal("proxy credentials not accepted")
+	}
+}
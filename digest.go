@@ -2,8 +2,9 @@ package sip
 
 import (
 	"crypto/md5"
+	"encoding/hex"
 	"fmt"
-	"regexp"
+	"strings"
 	"time"
 )
 
@@ -96,6 +97,7 @@ type Digest struct {
 }
 type DigestParams struct {
 	Digest
+	HA1        string // hex of MD5(username:realm:password),used instead of the Password when not empty
 	Qop        string
 	Qops       []string
 	Algorithm  string
@@ -111,21 +113,25 @@ type DigestParams struct {
 // if the algorithm directive's value is "MD5" or unspecified ,then HA1 is : HA1=MD5(username:realm:password)
 // if the algorithm directive's value is "MD5-sess" , then HA1 is : HA1=MD5(MD5(username:realm:password):nonce:cnonce)
 // if the qop directive's  value is "auth" or unspecified, then HA2 is : HA2=MD5(method:digest-uri)
-// if the qop directive's value is "auth-int" , them HA2 is : HA2=MD5(method:digest-uri:MD5(entity-body)
+// if the qop directive's value is "auth-int" , them HA2 is : HA2=MD5(method:digest-uri:MD5(entity-body))
 // if the qop directive's value is "auth" or "auth-int" , then compute the response is : response=MD5(HA1:nonce:nonce-count:cnonce:qop:HA2)
 // if the qop directive is unspecified , then compute the response  is : response=MD5(HA1:nonce:HA2)
 // The above shows that when qop is not specified , the simpler RFC 2069 standard is followed
 
 func GenDigestResponse(p *DigestParams) string {
 	bytes := md5.Sum([]byte(p.Digest.UserName + ":" + p.Digest.Realm + ":" + p.Digest.Password))
-	if p.Algorithm == "MD5-sess" {
-		b := append(bytes[:], []byte(":"+p.Nonce+":"+p.Cnonce)...)
-		bytes = md5.Sum(b)
+	if ha1, err := hex.DecodeString(p.HA1); err == nil && len(ha1) == len(bytes) {
+		copy(bytes[:], ha1)
 	}
 	ha1 := fmt.Sprintf("%x", bytes)
+	// RFC 2617 3.2.2.2,A1 = H( unq(username-value) ":" unq(realm-value) ":" passwd ) ":" unq(nonce-value) ":" unq(cnonce-value),
+	// the hash of the password is written in hex
+	if strings.EqualFold(p.Algorithm, "MD5-sess") {
+		ha1 = fmt.Sprintf("%x", md5.Sum([]byte(ha1+":"+p.Nonce+":"+p.Cnonce)))
+	}
 
 	if p.Qop == "auth-int" {
-		bytes = md5.Sum([]byte(fmt.Sprintf("%s:%s%s", p.Method, p.URI, p.EntityBody)))
+		bytes = md5.Sum([]byte(fmt.Sprintf("%s:%s:%x", p.Method, p.URI, md5.Sum([]byte(p.EntityBody)))))
 	} else {
 		bytes = md5.Sum([]byte(fmt.Sprintf("%s:%s", p.Method, p.URI)))
 	}
@@ -139,15 +145,26 @@ func GenDigestResponse(p *DigestParams) string {
 	return p.Response
 }
 
+// DigestCalculatorResponse returns the responses of the realm and uri guesses of a REGISTER without qop.
+//
+// Deprecated: use DigestVerifier,which checks the credentials against the challenges it issued
 func DigestCalculatorResponse(username, realm, password, nonce, uri string) []string {
 	responses := make([]string, 0)
 	response1 := getDigestResponse(username, realm, password, nonce, uri)
 	response2 := getDigestResponse(username, username[:10], password, nonce, uri)
-	response3 := getDigestResponse(username, username[:10], password, nonce, regexp.MustCompile("@.*").ReplaceAllString(uri, "@"+realm))
-	response4 := getDigestResponse(username, realm, password, nonce, regexp.MustCompile("@.*").ReplaceAllString(uri, "@"+realm))
+	response3 := getDigestResponse(username, username[:10], password, nonce, digestUriHost(uri, realm))
+	response4 := getDigestResponse(username, realm, password, nonce, digestUriHost(uri, realm))
 	responses = append(responses, response1, response2, response3, response4)
 	return responses
 }
+
+// digestUriHost replaces the text after the "@" of uri with host
+func digestUriHost(uri string, host string) string {
+	if index := strings.Index(uri, "@"); index >= 0 {
+		return uri[:index+1] + host
+	}
+	return uri
+}
 func getDigestResponse(username, realm, password, nonce, uri string) string {
 	dp := &DigestParams{
 		Digest: Digest{
@@ -0,0 +1,521 @@
+package sip
+
+import (
+	"bufio"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc1035.html#section-4.1
+//
+// 4.1. Format
+//
+// All communications inside of the domain protocol are carried in a single
+// format called a message.  The top level format of message is divided
+// into 5 sections (some of which are empty in certain cases) shown below:
+//
+//     +---------------------+
+//     |        Header       |
+//     +---------------------+
+//     |       Question      | the question for the name server
+//     +---------------------+
+//     |        Answer       | RRs answering the question
+//     +---------------------+
+//     |      Authority      | RRs pointing toward an authority
+//     +---------------------+
+//     |      Additional     | RRs holding additional information
+//     +---------------------+
+//
+// https://www.rfc-editor.org/rfc/rfc3403.html#section-4.1
+//
+// NAPTR RDATA  =  ORDER PREFERENCE FLAGS SERVICES REGEXP REPLACEMENT
+//
+// https://www.rfc-editor.org/rfc/rfc2782.html
+//
+// SRV RDATA  =  Priority Weight Port Target
+
+const (
+	dnsTypeA     uint16 = 1
+	dnsTypeCNAME uint16 = 5
+	dnsTypeAAAA  uint16 = 28
+	dnsTypeSRV   uint16 = 33
+	dnsTypeNAPTR uint16 = 35
+
+	dnsClassINET uint16 = 1
+
+	dnsFlagResponse  uint16 = 1 << 15
+	dnsFlagTruncated uint16 = 1 << 9
+	dnsFlagRecursion uint16 = 1 << 8
+	dnsRcodeMask     uint16 = 0x000f
+	dnsRcodeNXDomain uint16 = 3
+
+	dnsMaxUDPSize = 4096
+)
+
+// DNSClient looks up the records used by RFC 3263 to locate a SIP server
+type DNSClient interface {
+	Resolver
+	LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error)
+	LookupSRV(ctx context.Context, name string) ([]*net.SRV, error)
+}
+
+// NAPTR is a naming authority pointer record,example: 10 50 "s" "SIP+D2U" "" _sip._udp.example.com.
+type NAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// NetDNSClient is a DNSClient that sends its queries over UDP to the name servers in turn,
+// a truncated answer is asked again over TCP
+type NetDNSClient struct {
+	servers []string      // name server addresses,example: "192.168.0.1:53"
+	timeout time.Duration // timeout of one query to one name server
+}
+
+func (nc *NetDNSClient) SetServers(servers []string) {
+	nc.servers = servers
+}
+func (nc *NetDNSClient) GetServers() []string {
+	return nc.servers
+}
+func (nc *NetDNSClient) SetTimeout(timeout time.Duration) {
+	nc.timeout = timeout
+}
+func (nc *NetDNSClient) GetTimeout() time.Duration {
+	return nc.timeout
+}
+
+// NewNetDNSClient returns a NetDNSClient asking servers,the port defaults to 53
+// and the name servers of /etc/resolv.conf are used when there is no server
+func NewNetDNSClient(servers ...string) *NetDNSClient {
+	if len(servers) == 0 {
+		servers = dnsConfigServers("/etc/resolv.conf")
+	}
+	addresses := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(server, "["), "]"), "53")
+		}
+		addresses = append(addresses, server)
+	}
+	return &NetDNSClient{
+		servers: addresses,
+		timeout: 5 * time.Second,
+	}
+}
+
+// LookupNAPTR returns the NAPTR records of name in the order they were answered
+func (nc *NetDNSClient) LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	answers, err := nc.lookup(ctx, name, dnsTypeNAPTR)
+	if err != nil {
+		return nil, err
+	}
+	naptrs := make([]*NAPTR, 0, len(answers))
+	for _, answer := range answers {
+		naptrs = append(naptrs, answer.naptr)
+	}
+	return naptrs, nil
+}
+
+// LookupSRV returns the SRV records of name,example: "_sip._udp.example.com",in the order they were answered
+func (nc *NetDNSClient) LookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	answers, err := nc.lookup(ctx, name, dnsTypeSRV)
+	if err != nil {
+		return nil, err
+	}
+	srvs := make([]*net.SRV, 0, len(answers))
+	for _, answer := range answers {
+		srvs = append(srvs, answer.srv)
+	}
+	return srvs, nil
+}
+
+// LookupIP returns the IPv4 addresses and then the IPv6 addresses of host
+func (nc *NetDNSClient) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ips := make([]net.IP, 0)
+	var lastErr error
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		answers, err := nc.lookup(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, answer := range answers {
+			ips = append(ips, answer.ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, lastErr
+	}
+	return ips, nil
+}
+
+// lookup returns the answers of type qtype,a *net.DNSError that is not found when there is none
+func (nc *NetDNSClient) lookup(ctx context.Context, name string, qtype uint16) ([]dnsRecord, error) {
+	// the query id is not predictable so that a forged response is not taken
+	id := make([]byte, 2)
+	if _, err := cryptorand.Read(id); err != nil {
+		return nil, err
+	}
+	query := &dnsMessage{
+		id:        binary.BigEndian.Uint16(id),
+		flags:     dnsFlagRecursion,
+		questions: []dnsQuestion{{name: name, qtype: qtype}},
+	}
+	response, err := nc.exchange(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if response.flags&dnsRcodeMask == dnsRcodeNXDomain {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	if response.flags&dnsRcodeMask != 0 {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+	answers := make([]dnsRecord, 0, len(response.answers))
+	for _, answer := range response.answers {
+		if answer.rtype == qtype {
+			answers = append(answers, answer)
+		}
+	}
+	if len(answers) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return answers, nil
+}
+
+// exchange sends query to the name servers in turn until one of them answers
+func (nc *NetDNSClient) exchange(ctx context.Context, query *dnsMessage) (*dnsMessage, error) {
+	data, err := query.pack()
+	if err != nil {
+		return nil, err
+	}
+	lastErr := error(&net.DNSError{Err: "no name server", Name: query.questions[0].name})
+	for _, server := range nc.servers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		response, err := nc.exchangeServer(ctx, server, "udp", query.id, data)
+		if err == nil && response.flags&dnsFlagTruncated != 0 {
+			response, err = nc.exchangeServer(ctx, server, "tcp", query.id, data)
+		}
+		if err == nil {
+			return response, nil
+		}
+		lastErr = &net.DNSError{Err: err.Error(), Name: query.questions[0].name, Server: server, IsTimeout: dnsIsTimeout(err), IsTemporary: true}
+	}
+	return nil, lastErr
+}
+
+// exchangeServer sends data to one name server and reads the response with the same id,
+// a stream message is preceded by its length in two bytes
+func (nc *NetDNSClient) exchangeServer(ctx context.Context, server string, network string, id uint16, data []byte) (*dnsMessage, error) {
+	if nc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nc.timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if network == "tcp" {
+		data = append([]byte{byte(len(data) >> 8), byte(len(data))}, data...)
+	}
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+	for {
+		var buffer []byte
+		if network == "tcp" {
+			length := make([]byte, 2)
+			if _, err := io.ReadFull(conn, length); err != nil {
+				return nil, err
+			}
+			buffer = make([]byte, binary.BigEndian.Uint16(length))
+			if _, err := io.ReadFull(conn, buffer); err != nil {
+				return nil, err
+			}
+		} else {
+			buffer = make([]byte, dnsMaxUDPSize)
+			n, err := conn.Read(buffer)
+			if err != nil {
+				return nil, err
+			}
+			buffer = buffer[:n]
+		}
+		response := new(dnsMessage)
+		// a datagram that is not the response to the query is ignored
+		if err := response.unpack(buffer); err != nil || response.id != id || response.flags&dnsFlagResponse == 0 {
+			if network == "tcp" && err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return response, nil
+	}
+}
+
+// dnsIsTimeout reports whether err is a timeout of the network
+func dnsIsTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// dnsConfigServers returns the nameserver lines of a resolv.conf file,"127.0.0.1:53" when there is none
+func dnsConfigServers(path string) []string {
+	servers := make([]string, 0)
+	file, err := os.Open(path)
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				servers = append(servers, fields[1])
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = append(servers, "127.0.0.1:53")
+	}
+	return servers
+}
+
+// dnsMessage is the header,question and answer sections of a DNS message,
+// the authority and additional sections are not kept
+type dnsMessage struct {
+	id        uint16
+	flags     uint16 // QR,Opcode,AA,TC,RD,RA,Z and RCODE
+	questions []dnsQuestion
+	answers   []dnsRecord
+}
+
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+}
+
+// dnsRecord is a resource record of the class IN,the field of its type holds the RDATA
+type dnsRecord struct {
+	name   string
+	rtype  uint16
+	ttl    uint32
+	ip     net.IP   // A and AAAA
+	target string   // CNAME
+	srv    *net.SRV // SRV
+	naptr  *NAPTR   // NAPTR
+}
+
+// pack writes the message without name compression
+func (dm *dnsMessage) pack() ([]byte, error) {
+	data := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(data[0:], dm.id)
+	binary.BigEndian.PutUint16(data[2:], dm.flags)
+	binary.BigEndian.PutUint16(data[4:], uint16(len(dm.questions)))
+	binary.BigEndian.PutUint16(data[6:], uint16(len(dm.answers)))
+	var err error
+	for _, question := range dm.questions {
+		if data, err = dnsPackName(data, question.name); err != nil {
+			return nil, err
+		}
+		data = dnsPackUint16(data, question.qtype)
+		data = dnsPackUint16(data, dnsClassINET)
+	}
+	for _, answer := range dm.answers {
+		if data, err = dnsPackName(data, answer.name); err != nil {
+			return nil, err
+		}
+		data = dnsPackUint16(data, answer.rtype)
+		data = dnsPackUint16(data, dnsClassINET)
+		data = append(data, byte(answer.ttl>>24), byte(answer.ttl>>16), byte(answer.ttl>>8), byte(answer.ttl))
+		rdata := make([]byte, 0, 64)
+		switch answer.rtype {
+		case dnsTypeA:
+			rdata = append(rdata, answer.ip.To4()...)
+		case dnsTypeAAAA:
+			rdata = append(rdata, answer.ip.To16()...)
+		case dnsTypeCNAME:
+			rdata, err = dnsPackName(rdata, answer.target)
+		case dnsTypeSRV:
+			rdata = dnsPackUint16(rdata, answer.srv.Priority)
+			rdata = dnsPackUint16(rdata, answer.srv.Weight)
+			rdata = dnsPackUint16(rdata, answer.srv.Port)
+			rdata, err = dnsPackName(rdata, answer.srv.Target)
+		case dnsTypeNAPTR:
+			rdata = dnsPackUint16(rdata, answer.naptr.Order)
+			rdata = dnsPackUint16(rdata, answer.naptr.Preference)
+			for _, text := range []string{answer.naptr.Flags, answer.naptr.Service, answer.naptr.Regexp} {
+				if len(text) > 255 {
+					return nil, &net.DNSError{Err: "character-string too long", Name: answer.name}
+				}
+				rdata = append(append(rdata, byte(len(text))), text...)
+			}
+			rdata, err = dnsPackName(rdata, answer.naptr.Replacement)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = dnsPackUint16(data, uint16(len(rdata)))
+		data = append(data, rdata...)
+	}
+	return data, nil
+}
+
+// unpack reads a message,the records of other types than A,AAAA,CNAME,SRV and NAPTR are skipped
+func (dm *dnsMessage) unpack(data []byte) error {
+	errShort := &net.DNSError{Err: "short DNS message"}
+	if len(data) < 12 {
+		return errShort
+	}
+	dm.id = binary.BigEndian.Uint16(data[0:])
+	dm.flags = binary.BigEndian.Uint16(data[2:])
+	qdcount := int(binary.BigEndian.Uint16(data[4:]))
+	ancount := int(binary.BigEndian.Uint16(data[6:]))
+	dm.questions, dm.answers = nil, nil
+	offset := 12
+	for index := 0; index < qdcount; index++ {
+		name, next, err := dnsUnpackName(data, offset)
+		if err != nil {
+			return err
+		}
+		if next+4 > len(data) {
+			return errShort
+		}
+		dm.questions = append(dm.questions, dnsQuestion{name: name, qtype: binary.BigEndian.Uint16(data[next:])})
+		offset = next + 4
+	}
+	for index := 0; index < ancount; index++ {
+		name, next, err := dnsUnpackName(data, offset)
+		if err != nil {
+			return err
+		}
+		if next+10 > len(data) {
+			return errShort
+		}
+		record := dnsRecord{
+			name:  name,
+			rtype: binary.BigEndian.Uint16(data[next:]),
+			ttl:   binary.BigEndian.Uint32(data[next+4:]),
+		}
+		start := next + 10
+		end := start + int(binary.BigEndian.Uint16(data[next+8:]))
+		if end > len(data) {
+			return errShort
+		}
+		offset = end
+		rdata := data[start:end]
+		switch {
+		case record.rtype == dnsTypeA && len(rdata) == net.IPv4len:
+			record.ip = net.IPv4(rdata[0], rdata[1], rdata[2], rdata[3]).To4()
+		case record.rtype == dnsTypeAAAA && len(rdata) == net.IPv6len:
+			record.ip = append(net.IP(nil), rdata...)
+		case record.rtype == dnsTypeCNAME:
+			if record.target, _, err = dnsUnpackName(data, start); err != nil {
+				return err
+			}
+		case record.rtype == dnsTypeSRV && len(rdata) > 6:
+			record.srv = &net.SRV{
+				Priority: binary.BigEndian.Uint16(rdata[0:]),
+				Weight:   binary.BigEndian.Uint16(rdata[2:]),
+				Port:     binary.BigEndian.Uint16(rdata[4:]),
+			}
+			if record.srv.Target, _, err = dnsUnpackName(data, start+6); err != nil {
+				return err
+			}
+		case record.rtype == dnsTypeNAPTR && len(rdata) > 4:
+			record.naptr = &NAPTR{
+				Order:      binary.BigEndian.Uint16(rdata[0:]),
+				Preference: binary.BigEndian.Uint16(rdata[2:]),
+			}
+			position := start + 4
+			texts := make([]string, 0, 3)
+			for len(texts) < 3 {
+				if position >= end || position+1+int(data[position]) > end {
+					return errShort
+				}
+				texts = append(texts, string(data[position+1:position+1+int(data[position])]))
+				position += 1 + int(data[position])
+			}
+			record.naptr.Flags, record.naptr.Service, record.naptr.Regexp = texts[0], texts[1], texts[2]
+			if record.naptr.Replacement, _, err = dnsUnpackName(data, position); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		dm.answers = append(dm.answers, record)
+	}
+	return nil
+}
+
+// dnsPackName appends name as a sequence of labels,the root is "." or ""
+func dnsPackName(data []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 0 {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, &net.DNSError{Err: "invalid domain name", Name: name}
+			}
+			data = append(append(data, byte(len(label))), label...)
+		}
+	}
+	return append(data, 0), nil
+}
+
+// dnsUnpackName reads the name at offset following compression pointers,
+// next is the offset after the name where it was written
+func dnsUnpackName(data []byte, offset int) (name string, next int, err error) {
+	labels := make([]string, 0, 4)
+	next = -1
+	for jumps := 0; ; {
+		if offset >= len(data) {
+			return "", 0, &net.DNSError{Err: "short DNS message"}
+		}
+		length := int(data[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(data) || jumps > 16 {
+				return "", 0, &net.DNSError{Err: "invalid compression pointer"}
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(data[offset:]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(data) {
+				return "", 0, &net.DNSError{Err: "short DNS message"}
+			}
+			labels = append(labels, string(data[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+func dnsPackUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value>>8), byte(value))
+}
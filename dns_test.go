@@ -0,0 +1,224 @@
+package sip
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsFakeServer is an in-process name server answering from records over UDP and TCP on the same port
+type dnsFakeServer struct {
+	conn     net.PacketConn
+	listener net.Listener
+	records  []dnsRecord
+	truncate bool // the UDP answers only have the TC flag,the client has to ask again over TCP
+}
+
+func newDNSFakeServer(t *testing.T, truncate bool, records ...dnsRecord) *dnsFakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		t.Fatal(err)
+	}
+	fs := &dnsFakeServer{conn: conn, listener: listener, records: records, truncate: truncate}
+	t.Cleanup(func() {
+		conn.Close()
+		listener.Close()
+	})
+	go func() {
+		buffer := make([]byte, dnsMaxUDPSize)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if response := fs.answer(buffer[:n], true); response != nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			stream, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer stream.Close()
+				length := make([]byte, 2)
+				if _, err := io.ReadFull(stream, length); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length))
+				if _, err := io.ReadFull(stream, query); err != nil {
+					return
+				}
+				if response := fs.answer(query, false); response != nil {
+					stream.Write(append([]byte{byte(len(response) >> 8), byte(len(response))}, response...))
+				}
+			}()
+		}
+	}()
+	return fs
+}
+
+func (fs *dnsFakeServer) Addr() string {
+	return fs.conn.LocalAddr().String()
+}
+
+// answer returns the records of the name and type asked,NXDOMAIN when the name has no record of any type
+func (fs *dnsFakeServer) answer(data []byte, datagram bool) []byte {
+	query := new(dnsMessage)
+	if err := query.unpack(data); err != nil || len(query.questions) != 1 {
+		return nil
+	}
+	response := &dnsMessage{id: query.id, flags: dnsFlagResponse | query.flags&dnsFlagRecursion, questions: query.questions}
+	known := false
+	for _, record := range fs.records {
+		if !strings.EqualFold(strings.TrimSuffix(record.name, "."), strings.TrimSuffix(query.questions[0].name, ".")) {
+			continue
+		}
+		known = true
+		if record.rtype == query.questions[0].qtype {
+			response.answers = append(response.answers, record)
+		}
+	}
+	switch {
+	case !known:
+		response.flags |= dnsRcodeNXDomain
+	case datagram && fs.truncate:
+		response.flags |= dnsFlagTruncated
+		response.answers = nil
+	}
+	packed, _ := response.pack()
+	return packed
+}
+
+func dnsA(name string, ip string) dnsRecord {
+	rtype := dnsTypeA
+	if net.ParseIP(ip).To4() == nil {
+		rtype = dnsTypeAAAA
+	}
+	return dnsRecord{name: name, rtype: rtype, ttl: 60, ip: net.ParseIP(ip)}
+}
+
+func dnsSRV(name string, priority uint16, weight uint16, port uint16, target string) dnsRecord {
+	return dnsRecord{name: name, rtype: dnsTypeSRV, ttl: 60, srv: &net.SRV{Target: target, Port: port, Priority: priority, Weight: weight}}
+}
+
+func dnsNAPTR(name string, order uint16, preference uint16, service string, replacement string) dnsRecord {
+	return dnsRecord{name: name, rtype: dnsTypeNAPTR, ttl: 60, naptr: &NAPTR{Order: order, Preference: preference, Flags: "s", Service: service, Replacement: replacement}}
+}
+
+func TestDNSMessage_Pack(t *testing.T) {
+	message := &dnsMessage{
+		id:        0x1234,
+		flags:     dnsFlagResponse,
+		questions: []dnsQuestion{{name: "example.com", qtype: dnsTypeNAPTR}},
+		answers: []dnsRecord{
+			dnsNAPTR("example.com.", 10, 50, "SIP+D2U", "_sip._udp.example.com."),
+			dnsSRV("_sip._udp.example.com.", 0, 5, 5060, "sip1.example.com."),
+			dnsA("sip1.example.com.", "192.168.0.1"),
+			dnsA("sip1.example.com.", "2001:db8::1"),
+			{name: "www.example.com.", rtype: dnsTypeCNAME, target: "example.com."},
+		},
+	}
+	data, err := message.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpacked := new(dnsMessage)
+	if err := unpacked.unpack(data); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(unpacked.questions, len(unpacked.answers))
+	if unpacked.id != 0x1234 || len(unpacked.answers) != 5 || *unpacked.answers[0].naptr != *message.answers[0].naptr ||
+		*unpacked.answers[1].srv != *message.answers[1].srv || !unpacked.answers[3].ip.Equal(net.ParseIP("2001:db8::1")) ||
+		unpacked.answers[4].target != "example.com." {
+		t.Error("dns message round trip mismatch")
+	}
+	// the name of the answer points back to the question,c00c
+	compressed := append(append([]byte{}, data[:12+len("example.com")+2+4]...), 0xc0, 0x0c)
+	compressed = append(compressed, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 168, 0, 2)
+	binary.BigEndian.PutUint16(compressed[6:], 1)
+	if err := unpacked.unpack(compressed); err != nil || unpacked.answers[0].name != "example.com." || !unpacked.answers[0].ip.Equal(net.IPv4(192, 168, 0, 2)) {
+		t.Error("dns compression pointer mismatch", err)
+	}
+	for _, short := range [][]byte{data[:11], data[:len(data)-3], append(compressed[:len(compressed)-16:len(compressed)-16], 0xc0)} {
+		if err := new(dnsMessage).unpack(short); err == nil {
+			t.Error("expected a short message error")
+		}
+	}
+}
+
+func TestNetDNSClient_Lookup(t *testing.T) {
+	fs := newDNSFakeServer(t, false,
+		dnsNAPTR("example.com", 10, 50, "SIP+D2U", "_sip._udp.example.com"),
+		dnsSRV("_sip._udp.example.com", 0, 5, 5060, "sip1.example.com"),
+		dnsA("sip1.example.com", "192.168.0.1"),
+		dnsA("sip1.example.com", "2001:db8::1"),
+	)
+	client := NewNetDNSClient(fs.Addr())
+	naptrs, err := client.LookupNAPTR(context.Background(), "example.com")
+	if err != nil || len(naptrs) != 1 || naptrs[0].Service != "SIP+D2U" || naptrs[0].Replacement != "_sip._udp.example.com." {
+		t.Error("naptr lookup mismatch", naptrs, err)
+	}
+	srvs, err := client.LookupSRV(context.Background(), "_sip._udp.example.com")
+	if err != nil || len(srvs) != 1 || srvs[0].Port != 5060 || srvs[0].Target != "sip1.example.com." {
+		t.Error("srv lookup mismatch", srvs, err)
+	}
+	ips, err := client.LookupIP(context.Background(), "sip1.example.com")
+	fmt.Println(naptrs[0], srvs[0], ips)
+	if err != nil || len(ips) != 2 || !ips[0].Equal(net.IPv4(192, 168, 0, 1)) || !ips[1].Equal(net.ParseIP("2001:db8::1")) {
+		t.Error("ip lookup mismatch", ips, err)
+	}
+	var dnsErr *net.DNSError
+	if _, err := client.LookupSRV(context.Background(), "_sip._tcp.example.com"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Error("expected a not found error", err)
+	}
+	// a truncated answer is asked again over TCP
+	fs = newDNSFakeServer(t, true, dnsA("sip1.example.com", "192.168.0.1"), dnsA("sip1.example.com", "2001:db8::1"))
+	client = NewNetDNSClient(fs.Addr())
+	if ips, err := client.LookupIP(context.Background(), "sip1.example.com"); err != nil || len(ips) != 2 {
+		t.Error("tcp fallback mismatch", ips, err)
+	}
+}
+
+func TestNetDNSClient_Failover(t *testing.T) {
+	fs := newDNSFakeServer(t, false, dnsA("sip1.example.com", "192.168.0.1"))
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Close()
+	client := NewNetDNSClient(dead.LocalAddr().String(), fs.Addr())
+	client.SetTimeout(500 * time.Millisecond)
+	if ips, err := client.LookupIP(context.Background(), "sip1.example.com"); err != nil || len(ips) != 1 {
+		t.Error("name server failover mismatch", ips, err)
+	}
+	client.SetServers(client.GetServers()[:1])
+	if _, err := client.LookupIP(context.Background(), "sip1.example.com"); err == nil {
+		t.Error("expected an error without a name server answering")
+	}
+}
+
+func TestNewNetDNSClient(t *testing.T) {
+	client := NewNetDNSClient("192.168.0.1", "[2001:db8::1]", "192.168.0.2:5353")
+	fmt.Println(client.GetServers())
+	if strings.Join(client.GetServers(), ",") != "192.168.0.1:53,[2001:db8::1]:53,192.168.0.2:5353" {
+		t.Error("name server address mismatch")
+	}
+	if len(NewNetDNSClient().GetServers()) == 0 {
+		t.Error("expected a default name server")
+	}
+}
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -36,7 +35,7 @@ type Expires struct {
 }
 
 func (expires *Expires) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(expires)$`).MatchString(field) {
+	if scanFieldIs(field, "expires") {
 		expires.field = strings.Title(field)
 	} else {
 		expires.field = "Expires"
@@ -69,29 +68,24 @@ func (expires *Expires) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return result
 }
-func (expires *Expires) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (expires *Expires) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Expires", raw, 0, `Expires  =  "Expires" HCOLON delta-seconds`)
 	}
-	// expires field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(expires)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "expires")
+	if !ok {
+		return NewParseError("Expires", raw, 0, `Expires  =  "Expires" HCOLON delta-seconds`)
 	}
-	expires.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	expires.field = field
 	expires.source = raw
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// delta-seconds regexp
-	deltaSecondsRegexp := regexp.MustCompile(`\d+`)
-	if deltaSecondsRegexp.MatchString(raw) {
-		seconds := deltaSecondsRegexp.FindString(raw)
-		if len(seconds) > 0 {
-			second, _ := strconv.Atoi(seconds)
-			expires.expire = uint32(second)
-		}
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// delta-seconds
+	// the value is kept in a uint32,a larger one does not fit
+	second, err := strconv.ParseUint(raw, 10, 32)
+	if !scanIsDigits(raw) || err != nil {
+		return NewParseError("Expires", expires.source, parseErrorOffset(expires.source, raw), `Expires  =  "Expires" HCOLON delta-seconds`)
 	}
+	expires.expire = uint32(second)
+	return nil
 }
@@ -0,0 +1,168 @@
+package sip
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.3
+//
+// 18.3 Framing
+//
+// In the case of message-oriented transports (such as UDP), if the
+// message has a Content-Length header field, the message body is
+// assumed to contain that many bytes.  Any additional bytes in the
+// transport packet beyond the end of the body MUST be discarded.
+//
+// In the case of stream-oriented transports such as TCP, the Content-
+// Length header field indicates the size of the body.  The Content-
+// Length header field MUST be used with stream oriented transports.
+//
+// https://www.rfc-editor.org/rfc/rfc5626.html#section-4.4.1
+//
+// 4.4.1 CRLF Keep-Alive Technique
+//
+// This approach can only be used with connection-oriented transports
+// such as TCP or SCTP.  The client periodically sends a double-CRLF
+// (the "ping") then waits to receive a single CRLF (the "pong").  If
+// the client does not receive a "pong" within an appropriate amount of
+// time, it considers the flow failed.
+
+const (
+	framerMaxHeaderSize = 64 * 1024 // default limit of the start-line and header fields
+	framerMaxBodySize   = 1024 * 1024
+)
+
+// Framer splits SIP messages out of a byte stream,example: a TCP or TLS net.Conn.
+// After an error other than a *ParseError the stream can not be resynchronized and the connection should be closed.
+type Framer struct {
+	reader        *bufio.Reader
+	maxHeaderSize int    // limit of the start-line and header fields in bytes,513 Message Too Large when exceeded
+	maxBodySize   int    // limit of the message-body in bytes,413 Request Entity Too Large when exceeded
+	ping          func() // called when a double-CRLF keep-alive ping has been read
+}
+
+func (fr *Framer) SetMaxHeaderSize(maxHeaderSize int) {
+	fr.maxHeaderSize = maxHeaderSize
+}
+func (fr *Framer) GetMaxHeaderSize() int {
+	return fr.maxHeaderSize
+}
+func (fr *Framer) SetMaxBodySize(maxBodySize int) {
+	fr.maxBodySize = maxBodySize
+}
+func (fr *Framer) GetMaxBodySize() int {
+	return fr.maxBodySize
+}
+
+// SetPing sets the function called when a double-CRLF keep-alive ping has been read,
+// a server answers it with a single CRLF pong
+func (fr *Framer) SetPing(ping func()) {
+	fr.ping = ping
+}
+func NewFramer(reader io.Reader) *Framer {
+	return &Framer{
+		reader:        bufio.NewReader(reader),
+		maxHeaderSize: framerMaxHeaderSize,
+		maxBodySize:   framerMaxBodySize,
+	}
+}
+
+// ReadRaw reads the next complete SIP message from the stream,CRLF keep-alives before the start-line are skipped
+func (fr *Framer) ReadRaw() (raw string, err error) {
+	// keep-alive
+	newlines := 0
+	for {
+		c, err := fr.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c != '\r' && c != '\n' {
+			fr.reader.UnreadByte()
+			break
+		}
+		if c == '\n' {
+			newlines++
+			if newlines == 2 {
+				newlines = 0
+				if fr.ping != nil {
+					fr.ping()
+				}
+			}
+		}
+	}
+	// start-line and message-header up to the empty line
+	var header bytes.Buffer
+	partial := false
+	for {
+		line, err := fr.reader.ReadSlice('\n')
+		header.Write(line)
+		if header.Len() > fr.maxHeaderSize {
+			return "", NewStatusError(513, "")
+		}
+		if err == bufio.ErrBufferFull {
+			partial = true
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		if !partial && (len(line) == 1 || (len(line) == 2 && line[0] == '\r')) {
+			break
+		}
+		partial = false
+	}
+	// message-body
+	lengths, ok := framerContentLength(header.String())
+	if !ok {
+		return "", NewStatusError(400, "Missing Content-Length header field")
+	}
+	length, err := strconv.Atoi(lengths)
+	if err != nil || length > fr.maxBodySize {
+		return "", NewStatusError(413, "")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(fr.reader, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	header.Write(body)
+	return header.String(), nil
+}
+
+// framerContentLength returns the value of the Content-Length header field,compact form included
+func framerContentLength(header string) (string, bool) {
+	for len(header) > 0 {
+		line := scanUntil(header, "\n")
+		header = header[len(line):]
+		header = strings.TrimPrefix(header, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if _, value, ok := scanField(line, "content-length", "l"); ok {
+			if length := strings.Trim(value, " \t"); scanIsDigits(length) {
+				return length, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ReadSipMsg reads and parses the next complete SIP message from the stream
+func (fr *Framer) ReadSipMsg() (*SipMsg, error) {
+	raw, err := fr.ReadRaw()
+	if err != nil {
+		return nil, err
+	}
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
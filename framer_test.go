@@ -0,0 +1,96 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const framerRegister = "REGISTER sip:34020000002000000001@192.168.0.108:5060 SIP/2.0\r\n" +
+	"Via: SIP/2.0/TCP 192.168.0.26:5060;branch=z9hG4bK1371463273\r\n" +
+	"From: <sip:34020000001320000001@192.168.0.26:5060>;tag=2043466181\r\n" +
+	"To: <sip:34020000001320000001@192.168.0.26:5060>\r\n" +
+	"Call-ID: 1011047669@192.168.0.26\r\n" +
+	"CSeq: 1 REGISTER\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+const framerMessage = "MESSAGE sip:34020000002000000001@3402000000 SIP/2.0\r\n" +
+	"Via: SIP/2.0/TCP 192.168.0.26:5060;branch=z9hG4bK1371463274\r\n" +
+	"From: <sip:34020000001320000001@3402000000>;tag=2043466182\r\n" +
+	"To: <sip:34020000002000000001@3402000000>\r\n" +
+	"Call-ID: 1011047670@192.168.0.26\r\n" +
+	"CSeq: 20 MESSAGE\r\n" +
+	"Content-Type: Application/MANSCDP+xml\r\n" +
+	"l: 21\r\n\r\n" +
+	"<?xml version=\"1.0\"?>"
+
+func TestFramer_ReadSipMsg(t *testing.T) {
+	// pipelined messages and keep-alives read one byte at a time
+	stream := "\r\n\r\n" + framerRegister + framerMessage + "\r\n\r\n" + framerRegister
+	pings := 0
+	framer := NewFramer(iotest.OneByteReader(strings.NewReader(stream)))
+	framer.SetPing(func() {
+		pings++
+	})
+	methods := make([]string, 0)
+	for {
+		sm, err := framer.ReadSipMsg()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := sm.Raw()
+		fmt.Print(result.String())
+		methods = append(methods, sm.GetRequestLine().GetMethod())
+	}
+	if strings.Join(methods, ",") != "REGISTER,MESSAGE,REGISTER" {
+		t.Error("messages mismatch:", methods)
+	}
+	if pings != 2 {
+		t.Error("pings mismatch:", pings)
+	}
+}
+
+func TestFramer_ReadRaw(t *testing.T) {
+	noContentLength := strings.Replace(framerRegister, "Content-Length: 0\r\n", "", 1)
+	// a header line longer than the buffer of the reader
+	longSubject := strings.Replace(framerRegister, "Max-Forwards: 70\r\n", "Subject: "+strings.Repeat("x", 5000)+"\r\n", 1)
+	tests := []struct {
+		stream        string
+		maxHeaderSize int
+		maxBodySize   int
+		statusCode    uint
+		err           error
+	}{
+		{noContentLength, framerMaxHeaderSize, framerMaxBodySize, 400, nil},
+		{framerRegister, 100, framerMaxBodySize, 513, nil},
+		{framerMessage, framerMaxHeaderSize, 20, 413, nil},
+		{framerMessage[:len(framerMessage)-5], framerMaxHeaderSize, framerMaxBodySize, 0, io.ErrUnexpectedEOF},
+		{framerRegister[:40], framerMaxHeaderSize, framerMaxBodySize, 0, io.ErrUnexpectedEOF},
+		{"\r\n", framerMaxHeaderSize, framerMaxBodySize, 0, io.EOF},
+		{longSubject, framerMaxHeaderSize, framerMaxBodySize, 0, nil},
+	}
+	for index, test := range tests {
+		framer := NewFramer(bytes.NewBufferString(test.stream))
+		framer.SetMaxHeaderSize(test.maxHeaderSize)
+		framer.SetMaxBodySize(test.maxBodySize)
+		_, err := framer.ReadRaw()
+		fmt.Println(index, err)
+		if test.statusCode > 0 {
+			se, ok := err.(*StatusError)
+			if !ok || se.GetStatusCode() != test.statusCode {
+				t.Errorf("%d: expected status %d,got %v", index, test.statusCode, err)
+			}
+			continue
+		}
+		if err != test.err {
+			t.Errorf("%d: expected %v,got %v", index, test.err, err)
+		}
+	}
+}
@@ -2,11 +2,7 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
-	"strconv"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261.html#section-8.1.1.3
@@ -86,23 +82,22 @@ import (
 // tag-param   =  "tag" EQUAL token
 
 type From struct {
-	field     string      //"From" / "f"
-	name      string      // display-name
-	spec      string      // named spec of URI,recommend set be uri spec <uri>,example: <sip:xxx>/"sip:xxx"/sip:xxx
-	schema    string      // sip,sips,tel etc.
-	user      string      // user part
-	host      string      // host part
-	port      uint16      // port part
-	tag       string      // tag
-	parameter sync.Map    // parameter-param
-	isOrder   bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order     chan string // It is convenient to record the order of the original parameter fields when parsing
-	source    string      // source string
+	field     string   //"From" / "f"
+	name      string   // display-name
+	spec      string   // named spec of URI,recommend set be uri spec <uri>,example: <sip:xxx>/"sip:xxx"/sip:xxx
+	schema    string   // sip,sips,tel etc.
+	user      string   // user part
+	host      string   // host part
+	port      uint16   // port part
+	tag       string   // tag
+	parameter *Params  // generic-param
+	order     []string // parameter names in the parsed order,tag included
+	source    string   // source string
 }
 
 func (f *From) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(from|f)$`).MatchString(field) {
-		f.field = strings.Title(field)
+	if scanFieldIs(field, "from", "f") {
+		f.field = headerFieldTitle(field)
 	} else {
 		f.field = "From"
 	}
@@ -152,17 +147,17 @@ func (f *From) SetTag(tag string) {
 func (f *From) GetTag() string {
 	return f.tag
 }
-func (f *From) SetParameter(parameter sync.Map) {
+func (f *From) SetParameter(parameter *Params) {
 	f.parameter = parameter
 }
-func (f *From) GetParameter() sync.Map {
+func (f *From) GetParameter() *Params {
 	return f.parameter
 }
 func (f *From) GetSource() string {
 	return f.source
 }
 
-func NewFrom(name, spec, schema, user, host string, port uint16, tag string, parameter sync.Map) *From {
+func NewFrom(name, spec, schema, user, host string, port uint16, tag string, parameter *Params) *From {
 	return &From{
 		name:      name,
 		spec:      spec,
@@ -172,7 +167,6 @@ func NewFrom(name, spec, schema, user, host string, port uint16, tag string, par
 		port:      port,
 		tag:       tag,
 		parameter: parameter,
-		isOrder:   false,
 	}
 }
 
@@ -196,8 +190,12 @@ func (f *From) Raw() (result strings.Builder) {
 	if len(strings.TrimSpace(f.user)) > 0 {
 		uri += f.user
 	}
+	// the "@" is only written after a user,example: "sip:192.168.0.108:5060"
 	if len(strings.TrimSpace(f.host)) > 0 {
-		uri += fmt.Sprintf("@%s", f.host)
+		if len(strings.TrimSpace(f.user)) > 0 {
+			uri += "@"
+		}
+		uri += f.host
 	}
 	if f.port > 0 {
 		uri += fmt.Sprintf(":%d", f.port)
@@ -215,220 +213,63 @@ func (f *From) Raw() (result strings.Builder) {
 		}
 
 	}
+	// from-param  =  tag-param / generic-param
+	typed := NewParams()
 	if len(strings.TrimSpace(f.tag)) > 0 {
-		result.WriteString(fmt.Sprintf(";tag=%s", f.tag))
-	}
-	if f.isOrder {
-		f.isOrder = false
-		for orders := range f.order {
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := f.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						if strings.Contains(fmt.Sprintf("%v", val), "/") {
-							result.WriteString(fmt.Sprintf(";%v=\"%v\"", ordersSlice[0], val))
-						} else {
-							result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-						}
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-
-				} else {
-					result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := f.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						if strings.Contains(fmt.Sprintf("%v", val), "/") {
-							result.WriteString(fmt.Sprintf(";%v=\"%v\"", ordersSlice[0], val))
-						} else {
-							result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-						}
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-
-				} else {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", ordersSlice[1]))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], ordersSlice[1]))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				}
-			}
-		}
+		typed.Set("tag", f.tag)
 	}
-	f.parameter.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(";%v", key))
-				return true
-			}
-			if strings.Contains(fmt.Sprintf("%v", value), "/") {
-				result.WriteString(fmt.Sprintf(";%v=\"%v\"", key, value))
-			} else {
-				result.WriteString(fmt.Sprintf(";%v=%v", key, value))
-			}
-			return true
-		}
-		result.WriteString(fmt.Sprintf(";%v", key))
-		return true
-	})
+	parameter := paramsMerge(f.order, typed, f.parameter).Raw()
+	result.WriteString(parameter.String())
 	result.WriteString("\r\n")
 	return
 }
 
-func (f *From) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (f *From) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("From", raw, 0, `From  =  ( "From" / "f" ) HCOLON from-spec`)
 	}
-	// from field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(from|f)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "from", "f")
+	if !ok {
+		return NewParseError("From", raw, 0, `From  =  ( "From" / "f" ) HCOLON from-spec`)
 	}
-	f.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	f.field = field
 	f.source = raw
-	f.parameter = sync.Map{}
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	f.parameter = NewParams()
+	f.order = nil
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
 
-	// schema regexp
-	schemasRegexpStr := `(?i)(`
-	for _, v := range schemas {
-		schemasRegexpStr += v + "|"
-	}
-	schemasRegexpStr = strings.TrimSuffix(schemasRegexpStr, "|")
-	schemasRegexpStr += ")( )?:"
-
-	// display-name regexp
-	nameRegexp := regexp.MustCompile(`.*` + schemasRegexpStr)
-	if nameRegexp.MatchString(raw) {
-		name := nameRegexp.FindString(raw)
-		name = regexp.MustCompile(schemasRegexpStr+`$`).ReplaceAllString(name, "")
-		name = regexp.MustCompile(`<$`).ReplaceAllString(name, "")
-		name = stringTrimPrefixAndTrimSuffix(name, " ")
-		if len(name) > 0 {
-			f.name = name
-			raw = regexp.MustCompile(`.*`+name).ReplaceAllString(raw, "")
-			raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-		}
-	}
-	//uri spec  regexp: named spec of URI
-	switch {
-	case regexp.MustCompile(`'.*?` + schemasRegexpStr).MatchString(raw):
-		f.spec = "'"
-		raw = regexp.MustCompile(`.*'`).ReplaceAllString(raw, "")
-	case regexp.MustCompile(`".*?` + schemasRegexpStr).MatchString(raw):
-		f.spec = "\""
-		raw = regexp.MustCompile(`.*"`).ReplaceAllString(raw, "")
-	case regexp.MustCompile(`<.*?` + schemasRegexpStr).MatchString(raw):
-		f.spec = "<"
-		raw = regexp.MustCompile(`.*<`).ReplaceAllString(raw, "")
-	default:
-		f.spec = ""
+	// ( name-addr / addr-spec )
+	addr, ok := scanAddress(raw)
+	f.name, f.spec, f.schema = addr.name, addr.spec, addr.schema
+	f.user, f.host, f.port = addr.user, addr.host, addr.port
+	raw = addr.rest
+	if !ok {
+		return NewParseError("From", f.source, parseErrorOffset(f.source, raw), `from-spec  =  ( name-addr / addr-spec ) *( SEMI from-param )`)
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(schemasRegexpStr)
-	if schemaRegexp.MatchString(raw) {
-		schema := schemaRegexp.FindString(raw)
-		schema = regexp.MustCompile(`:`).ReplaceAllString(schema, "")
-		schema = stringTrimPrefixAndTrimSuffix(schema, " ")
-		f.schema = schema
-	}
-
-	// user regexp
-	userRegexp := regexp.MustCompile(schemasRegexpStr + `.*@`)
-	if userRegexp.MatchString(raw) {
-		user := userRegexp.FindString(raw)
-		user = regexp.MustCompile(schemasRegexpStr).ReplaceAllString(user, "")
-		user = regexp.MustCompile(`@`).ReplaceAllString(user, "")
-		user = stringTrimPrefixAndTrimSuffix(user, " ")
-		if len(user) > 0 {
-			f.user = user
-			raw = regexp.MustCompile(`.*`+user).ReplaceAllString(raw, "")
-		}
-
+	// from-param
+	if index := strings.Index(raw, ">"); index >= 0 && f.spec == "<" {
+		raw = raw[index+1:]
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// host regexp
-	hostRegexp := regexp.MustCompile(`@.*`)
-	if hostRegexp.MatchString(raw) {
-		host := hostRegexp.FindString(raw)
-		host = regexp.MustCompile(`;.*`).ReplaceAllString(host, "")
-		host = regexp.MustCompile(`:.*`).ReplaceAllString(host, "")
-		host = regexp.MustCompile(`@`).ReplaceAllString(host, "")
-		host = stringTrimPrefixAndTrimSuffix(host, " ")
-		if len(host) > 0 {
-			f.host = host
-			raw = regexp.MustCompile(`.*`+host).ReplaceAllString(raw, "")
-		}
-	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// port regexp
-	portRegexp := regexp.MustCompile(`.*?:\d+`)
-	if portRegexp.MatchString(raw) {
-		ports := portRegexp.FindString(raw)
-		ports = regexp.MustCompile(`.*:`).ReplaceAllString(ports, "")
-		ports = stringTrimPrefixAndTrimSuffix(ports, " ")
-		if len(ports) > 0 {
-			port, _ := strconv.Atoi(ports)
-			f.port = uint16(port)
-			raw = regexp.MustCompile(`.*`+ports).ReplaceAllString(raw, "")
-		}
+	if index := strings.Index(raw, ";"); index >= 0 {
+		raw = raw[index:]
+	} else {
+		raw = ""
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// tag regexp
-	tagRegexp := regexp.MustCompile(`(?i)(tag)( )?=.*`)
-	if tagRegexp.MatchString(raw) {
-		tag := tagRegexp.FindString(raw)
-		tag = regexp.MustCompile(`(?i)tag( )?=`).ReplaceAllString(tag, "")
-		tag = regexp.MustCompile(`;.*`).ReplaceAllString(tag, "")
-		tag = stringTrimPrefixAndTrimSuffix(tag, " ")
-		if len(tag) > 0 {
-			f.tag = tag
-			raw = regexp.MustCompile(`.*`+tag).ReplaceAllString(raw, "")
-		}
+	parameter := NewParams()
+	if err := parameter.Parse(raw); err != nil {
+		return parseErrorWrap(err, f.source, raw)
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	f.parameterOrder(raw)
-	// parameter regexp
-	if len(raw) > 0 {
-		rawSlice := strings.Split(raw, ";")
-		if len(rawSlice) == 1 {
-			kvs := strings.Split(rawSlice[0], "=")
-			if len(kvs) == 1 {
-				f.parameter.Store(kvs[0], "")
-			} else {
-				f.parameter.Store(kvs[0], kvs[1])
-			}
-		} else {
-			for _, raws := range rawSlice {
-				kvs := strings.Split(raws, "=")
-				if len(kvs) == 1 {
-					f.parameter.Store(kvs[0], "")
-				} else {
-					f.parameter.Store(kvs[0], kvs[1])
-				}
-			}
+	for _, p := range parameter.list() {
+		f.order = append(f.order, p.name)
+		switch strings.ToLower(p.name) {
+		case "tag":
+			// tag-param  =  "tag" EQUAL token
+			f.tag = p.value
+		default:
+			f.parameter.set(p)
 		}
 	}
-}
-func (f *From) parameterOrder(raw string) {
-	f.isOrder = true
-	f.order = make(chan string, 1024)
-	defer close(f.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		f.order <- raws
-	}
+	return nil
 }
@@ -2,18 +2,17 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestFrom_Raw(t *testing.T) {
-	p := sync.Map{}
-	p.Store("hei", "hei")
-	p.Store("ha", nil)
+	p := NewParams()
+	p.Set("hei", "hei")
+	p.SetFlag("ha")
 	fs := []*From{
-		NewFrom("", "<", "sip", "34020000001320000001", "192.168.0.1", 5060, "tag123", sync.Map{}),
-		NewFrom("34020000001320000001", "'", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", sync.Map{}),
-		NewFrom("tom", "\"", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", sync.Map{}),
+		NewFrom("", "<", "sip", "34020000001320000001", "192.168.0.1", 5060, "tag123", nil),
+		NewFrom("34020000001320000001", "'", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", nil),
+		NewFrom("tom", "\"", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", nil),
 		NewFrom("alisa", "", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", p),
 	}
 	for _, f := range fs {
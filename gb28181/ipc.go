@@ -1,17 +1,19 @@
 package gb28181
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"net"
-	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/kokutas/sip"
 )
 
+// ipcUnregisterTimeout 是Stop时等待注销响应的最长时间
+const ipcUnregisterTimeout = 2 * time.Second
+
 // GB/T 28181-2016 IPC
 type IPC struct {
 	id         string
@@ -31,12 +33,20 @@ type IPC struct {
 	fromTag   string // from tag 值
 	toTag     string // to tag 值
 	userAgent []string
-	realm     string // Digest realm
-	nonce     string // Digest nonce
+	password  string // Digest认证的密码
+	tp        sip.Transport
+	ua        *sip.UA                 // 构造请求和响应的UA
+	handler   sip.RegistrationHandler // 注册状态变化的回调
+	// 注册的client transaction和刷新，Start时创建
+	transactions *sip.TransactionLayer
+	registration *sip.Registration
 }
 
 func (ipc *IPC) SetExpires(expires uint32) {
 	ipc.expires = expires
+	if ipc.registration != nil {
+		ipc.registration.SetExpires(expires)
+	}
 }
 func (ipc *IPC) SetRegisterSN(sn uint32) {
 	ipc.registerSN = sn
@@ -55,15 +65,32 @@ func (ipc *IPC) SetToTag(toTag string) {
 }
 func (ipc *IPC) SetUserAgent(userAgent ...string) {
 	ipc.userAgent = userAgent
+	ipc.ua.SetUserAgent(userAgent...)
 }
-func (ipc *IPC) SetRealm(realm string) {
-	ipc.realm = realm
+
+// SetPassword 设置应答401/407鉴权挑战的密码，用户名为设备id
+func (ipc *IPC) SetPassword(password string) {
+	ipc.password = password
+	if ipc.registration != nil {
+		ipc.registration.SetCredentials(ipc.id, password)
+	}
 }
-func (ipc *IPC) SetNonce(nonce string) {
-	ipc.nonce = nonce
+
+// SetRegistrationHandler 设置注册状态变化的回调
+func (ipc *IPC) SetRegistrationHandler(handler sip.RegistrationHandler) {
+	ipc.handler = handler
+	if ipc.registration != nil {
+		ipc.registration.SetHandler(handler)
+	}
+}
+
+// GetRegistration 返回IPC的注册，Start之前为nil
+func (ipc *IPC) GetRegistration() *sip.Registration {
+	return ipc.registration
 }
 
 func NewIPC(id string, ip net.IP, port uint16, sid string, sip net.IP, sport uint16, transport string, expires uint32) *IPC {
+	ua := newUA(id, id[:10], ip, port, transport, "SIP", "UAC-IPC", "com.kokutas", "V1.0.0")
 	return &IPC{
 		id:         id,
 		ip:         ip,
@@ -77,6 +104,7 @@ func NewIPC(id string, ip net.IP, port uint16, sid string, sip net.IP, sport uin
 		expires:    expires,
 		registerSN: 1,
 		userAgent:  []string{"SIP", "UAC-IPC", "com.kokutas", "V1.0.0"},
+		ua:         ua,
 	}
 }
 func (ipc *IPC) Request(method string, sm *sip.SipMsg) (result strings.Builder) {
@@ -86,18 +114,18 @@ func (ipc *IPC) Request(method string, sm *sip.SipMsg) (result strings.Builder)
 			sip.NewUserInfo(ipc.id, "", ""),
 			sip.NewHostPort("", ipc.sip, nil, ipc.sport),
 			nil,
-			sync.Map{}))
+			nil))
 	reqLine := sip.NewRequestLine(method, reqUri, ipc.schema, ipc.version)
 	// from tag
 	if len(strings.TrimSpace(ipc.fromTag)) == 0 {
 		ipc.fromTag = fmt.Sprintf("%v", time.Now().UnixNano())
 	}
-	from := sip.NewFrom("", "<", ipc.schema, ipc.id, ipc.ip.String(), ipc.port, ipc.fromTag, sync.Map{})
-	to := sip.NewTo("", "<", ipc.schema, ipc.sid, ipc.sip.String(), ipc.sport, ipc.toTag, sync.Map{})
-	if regexp.MustCompile(`(?i)(register)`).MatchString(method) {
-		to = sip.NewTo("", "<", ipc.schema, ipc.id, ipc.ip.String(), ipc.port, "", sync.Map{})
+	from := sip.NewFrom("", "<", ipc.schema, ipc.id, ipc.ip.String(), ipc.port, ipc.fromTag, nil)
+	to := sip.NewTo("", "<", ipc.schema, ipc.sid, ipc.sip.String(), ipc.sport, ipc.toTag, nil)
+	if strings.EqualFold(method, "REGISTER") {
+		to = sip.NewTo("", "<", ipc.schema, ipc.id, ipc.ip.String(), ipc.port, "", nil)
 	}
-	contact := sip.NewContact("", "<", ipc.schema, ipc.id, ipc.ip.String(), ipc.port, "", -1, sync.Map{})
+	contact := sip.NewContact("", "<", ipc.schema, ipc.id, ipc.ip.String(), ipc.port, "", -1, nil)
 	// localId
 	if len(strings.TrimSpace(ipc.localId)) == 0 {
 		ipc.localId = fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%v", time.Now().UnixNano()))))
@@ -108,18 +136,17 @@ func (ipc *IPC) Request(method string, sm *sip.SipMsg) (result strings.Builder)
 		fromRaw := from.Raw()
 		toRaw := to.Raw()
 		callIdRaw := callId.Raw()
-		fromVal := regexp.MustCompile(`(?i)(from|f)( ):`).ReplaceAllString(fromRaw.String(), "")
-		toVal := regexp.MustCompile(`(?i)(to|t)( ):`).ReplaceAllString(toRaw.String(), "")
-		callIdVal := regexp.MustCompile(`(?i)(call-id)( ):`).ReplaceAllString(callIdRaw.String(), "")
+		fromVal := strings.TrimPrefix(fromRaw.String(), "From: ")
+		toVal := strings.TrimPrefix(toRaw.String(), "To: ")
+		callIdVal := strings.TrimPrefix(callIdRaw.String(), "Call-ID: ")
 		reqUriVal := reqUri.Raw()
 		ipc.branch = sip.GenBranch(fromVal, toVal, callIdVal, reqUriVal.String())
 	}
-	// via
-	via := sip.NewVia(ipc.schema, ipc.version, ipc.transport, ipc.sip.String(), ipc.sport, 0, "", "", ipc.branch, 1, "", sync.Map{})
+	// via,sent-by是IPC自己的地址
+	via := sip.NewVia(ipc.schema, ipc.version, ipc.transport, ipc.ip.String(), ipc.port, 0, "", "", ipc.branch, 1, "", nil)
 	expires := sip.NewExpires(ipc.expires)
 	cSeq := sip.NewCSeq(ipc.registerSN, method)
 	maxForwards := sip.NewMaxForwards(70)
-	contentLength := sip.NewContentLength(0)
 	userAgent := sip.NewUserAgent(ipc.userAgent...)
 	sm.SetRequestLine(reqLine)
 	sm.SetFrom(from)
@@ -131,34 +158,67 @@ func (ipc *IPC) Request(method string, sm *sip.SipMsg) (result strings.Builder)
 	sm.SetCSeq(cSeq)
 	sm.SetUserAgent(userAgent)
 	sm.SetMaxForwards(maxForwards)
-	sm.SetContentLength(contentLength)
-	if len(strings.TrimSpace(ipc.nonce)) > 0 {
-		realm := ipc.realm
-		if len(strings.TrimSpace(realm)) == 0 {
-			realm = ipc.sid[:10]
-		}
-		reqUriRaw := reqUri.Raw()
-		dp := &sip.DigestParams{
-			Algorithm: "MD5",
-			Method:    method,
-			URI:       reqUriRaw.String(),
-			Nonce:     ipc.nonce,
-		}
-		response := sip.GenDigestResponse(dp)
-		authorization := sip.NewAuthorization(ipc.id, realm, ipc.nonce, reqUri, response, "MD5", "", "", "", "", sync.Map{})
-		sm.SetAuthorization(authorization)
-	}
 	res := sm.Raw()
 	result.WriteString(res.String())
 	return
 }
 
+// Response 构造请求sm的响应，sm不做修改
 func (ipc *IPC) Response(code uint, reason string, sm *sip.SipMsg) (result strings.Builder) {
-	sm.SetStatusLine(sip.NewStatusLine(sm.GetRequestLine().GetSchema(), sm.GetRequestLine().GetVersion(), code, reason))
-	res := sm.Raw()
+	res := ipc.ua.NewResponse(sm, code, reason).Raw()
 	result.WriteString(res.String())
-	sm.SetRequestLine(nil) // 最后做，发送前/返回信息前
 	return
 }
 
-func (ipc *IPC) Start() {}
+// Start 监听IPC的地址并在后台接收响应，端口为0时监听后改为实际端口
+func (ipc *IPC) Start() error {
+	tp, port, err := listen(ipc.transport, ipc.ip, ipc.port, ipc.handle)
+	if err != nil {
+		return err
+	}
+	ipc.tp = tp
+	ipc.port = port
+	ipc.ua.SetPort(port)
+	ipc.transactions = sip.NewTransactionLayer(sip.NewTransportLayer(tp), nil)
+	// REGISTER的request-uri为server的地址
+	registrar := sip.NewRequestUri(
+		sip.NewSipUri(
+			sip.NewUserInfo(ipc.sid, "", ""),
+			sip.NewHostPort("", ipc.sip, nil, ipc.sport),
+			nil,
+			nil))
+	ipc.registration = sip.NewRegistration(ipc.transactions, ipc.ua, registrar, sip.NewTarget(tp.GetTransport(), "", ipc.sip, ipc.sport))
+	ipc.registration.SetCredentials(ipc.id, ipc.password)
+	ipc.registration.SetExpires(ipc.expires)
+	ipc.registration.SetHandler(ipc.handler)
+	go tp.Serve()
+	return nil
+}
+
+// Stop 注销后关闭监听，注销最多等待ipcUnregisterTimeout
+func (ipc *IPC) Stop() error {
+	if ipc.tp == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ipcUnregisterTimeout)
+	defer cancel()
+	ipc.registration.Unregister(ctx)
+	return ipc.tp.Close()
+}
+
+func (ipc *IPC) GetPort() uint16 {
+	return ipc.port
+}
+
+// Register 向server发送REGISTER，需要先Start。401/407鉴权挑战、423和过期前的刷新由注册自动处理，结果通过回调通知
+func (ipc *IPC) Register() error {
+	if ipc.tp == nil {
+		return &net.AddrError{Err: "ipc not started", Addr: ipc.ip.String()}
+	}
+	return ipc.registration.Register(context.Background())
+}
+
+// handle 将传输层收到的消息交给transaction层
+func (ipc *IPC) handle(sm *sip.SipMsg, source *sip.Source) {
+	ipc.transactions.Handle(sm, source)
+}
@@ -14,10 +14,4 @@ func TestIPC_Request(t *testing.T) {
 	fmt.Println("----------------------------REGISTER REQUEST----------------------------")
 	result := ipc.Request("register", new(sip.SipMsg))
 	fmt.Print(result.String())
-	// register response 401
-	fmt.Println("----------------------------REGISTER REQUEST WITH AUTHORIZATION----------------------------")
-	ipc.SetNonce(sip.GenNonce(net.IPv4(192, 168, 0, 108).String(), "123"))
-	result = ipc.Request("register", new(sip.SipMsg))
-	fmt.Print(result.String())
-
 }
@@ -1,12 +1,10 @@
 package gb28181
 
 import (
-	"fmt"
+	"context"
 	"net"
-	"regexp"
+	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/kokutas/sip"
 )
@@ -17,60 +15,136 @@ type Server struct {
 	ip        net.IP
 	port      uint16
 	transport string
-	// conn net.Conn 改成发送和接收分离
+	tp        sip.Transport
+	ua        *sip.UA             // 构造响应的UAS
+	registrar *sip.Registrar      // 处理REGISTER，保存设备的contact绑定
+	verifier  *sip.DigestVerifier // 校验REGISTER的Digest鉴权
+	// SetPassword设置的设备密码，SetVerifier替换verifier后不再使用
+	credentials *sip.MemoryCredentialStore
 }
 
 func NewServer(id string, realm string, ip net.IP, port uint16, transport string) *Server {
+	ua := newUA(id, realm, ip, port, transport, "SIP", "UAS", "com.kokutas", "V1.0.0")
+	credentials := sip.NewMemoryCredentialStore()
+	verifier := sip.NewDigestVerifier(realm, credentials)
+	// GB/T 28181的鉴权挑战不携带qop，兼容只支持RFC 2069的设备
+	verifier.SetQop("")
 	return &Server{
-		id:        id,
-		realm:     realm,
-		ip:        ip,
-		port:      port,
-		transport: transport,
+		id:          id,
+		realm:       realm,
+		ip:          ip,
+		port:        port,
+		transport:   transport,
+		ua:          ua,
+		registrar:   sip.NewRegistrar(sip.NewMemoryLocationStore()),
+		verifier:    verifier,
+		credentials: credentials,
 	}
 }
 
-// 暂时返回strings.Builder，后续直接发送出去
-func (s *Server) Response(sm *sip.SipMsg) (result strings.Builder) {
-	switch {
-	case regexp.MustCompile(`(?i)(register)`).MatchString(sm.GetRequestLine().GetMethod()):
+// SetPassword 设置设备id的注册密码
+func (s *Server) SetPassword(id string, password string) {
+	s.credentials.Put(id, s.realm, sip.NewCredential(password, ""))
+}
 
-		// 判断是否能认证通过
-		// 发起鉴权挑战
-		{
-			sm.SetStatusLine(sip.NewStatusLine("sip", 2.0, 401, sip.ClientError[401]))
-			// nonce需要添加到数据库
-			clientIP := net.IPv4(192, 168, 0, 108)
-			nonce := sip.GenNonce(clientIP.String(), fmt.Sprintf("%v", time.Now().UnixNano()))
-			sm.SetWWWAuthenticate(sip.NewWWWAuthenticate(s.realm, "", nonce, "", false, "MD5", "", sync.Map{}))
-			// NOTICE : register的from 和to的uri部分不做修改，需要处理的是to tag
-			sm.GetTo().SetTag(fmt.Sprintf("%v", time.Now().UnixNano()))
-			// 修改User-Agent
-			if sm.GetUserAgent() != nil {
-				sm.GetUserAgent().SetServer("SIP", "UAS", "com.kokutas", "V1.0.0")
-			}
-			// 修改via
-			if sm.GetVia() != nil {
-				if sm.GetVia().GetRport() != 0 {
-					// TODO : 从 conn 中获取
-					sm.GetVia().SetRport(8899)
-					sm.GetVia().SetReceived(net.IPv4(192, 168, 0, 255).String())
-				}
-			}
-		}
+// SetVerifier 替换校验REGISTER鉴权的verifier，例如从数据库查询密码的sip.CredentialStore
+func (s *Server) SetVerifier(verifier *sip.DigestVerifier) {
+	s.verifier = verifier
+}
+func (s *Server) GetVerifier() *sip.DigestVerifier {
+	return s.verifier
+}
 
-		// Digest鉴权挑战n次（第一次不算）失败，判断branch是否一样（403），判断response计算不一致（403）--冻结
-		// sm.SetStatusLine(sip.NewStatusLine("sip", 2.0, 403, sip.ClientError[403]))
-		// Digest鉴权认证通过
-		// sm.SetStatusLine(sip.NewStatusLine("sip", 2.0, 200, sip.Success[200]))
-	}
-	sm.SetRequestLine(nil)
-	res := sm.Raw()
+// SetRegistrar 替换处理REGISTER的registrar，例如使用文件保存绑定的sip.NewFileLocationStore
+func (s *Server) SetRegistrar(registrar *sip.Registrar) {
+	s.registrar = registrar
+}
+func (s *Server) GetRegistrar() *sip.Registrar {
+	return s.registrar
+}
+
+// 暂时返回strings.Builder，后续直接发送出去
+func (s *Server) Response(sm *sip.SipMsg) (result strings.Builder) {
+	res := s.response(sm).Raw()
 	result.WriteString(res.String())
 	return
 }
 
-func (s *Server) Start() {
+// response 构造请求sm的响应，To tag由UAS添加，via的received和rport由传输层收到请求时填写
+func (s *Server) response(sm *sip.SipMsg) *sip.SipMsg {
+	if !strings.EqualFold(sm.GetRequestLine().GetMethod(), "REGISTER") {
+		return s.ua.NewResponse(sm, 501, "")
+	}
+	// 未携带认证信息、密码错误或nonce过期时发起新的鉴权挑战，nonce过期时stale=true
+	_, response := s.verifier.Authenticate(sm)
+	if response == nil {
+		// 鉴权通过的REGISTER交给registrar处理绑定的添加、刷新和删除
+		response = s.registrar.Register(sm)
+	}
+	if userAgent := s.ua.GetUserAgent(); len(userAgent) > 0 {
+		response.SetUserAgent(sip.NewUserAgent(userAgent...))
+	}
+	return response
+}
+
+// newUA 返回设备id的UA，from为sip:id@domain，via和contact为ip:port
+func newUA(id string, domain string, ip net.IP, port uint16, transport string, userAgent ...string) *sip.UA {
+	ua := sip.NewUA(sip.NewFrom("", "<", "sip", id, domain, 0, "", nil), transport, ip.String(), port)
+	ua.SetUserAgent(userAgent...)
+	return ua
+}
+
+// Start 监听server的地址并在后台接收请求，端口为0时监听后改为实际端口
+func (s *Server) Start() error {
 	// 所有非200类的消息都要回复告知对方已经收到，不要重发（除了catalog的xml连续结构的）
 	// sm.SetStatusLine(sip.NewStatusLine("sip", 2.0, 100, sip.Informational[100]))
+	tp, port, err := listen(s.transport, s.ip, s.port, s.handle)
+	if err != nil {
+		return err
+	}
+	s.tp = tp
+	s.port = port
+	s.ua.SetPort(port)
+	go tp.Serve()
+	return nil
+}
+
+// listen 按照transport(udp/tcp)监听ip:port，返回传输层和实际端口
+func listen(transport string, ip net.IP, port uint16, handler sip.Handler) (sip.Transport, uint16, error) {
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+	switch strings.ToLower(transport) {
+	case "udp":
+		udp, err := sip.ListenUDP(address, handler)
+		if err != nil {
+			return nil, 0, err
+		}
+		return udp, uint16(udp.LocalAddr().(*net.UDPAddr).Port), nil
+	case "tcp":
+		tcp, err := sip.ListenTCP(address, handler)
+		if err != nil {
+			return nil, 0, err
+		}
+		return tcp, uint16(tcp.LocalAddr().(*net.TCPAddr).Port), nil
+	}
+	return nil, 0, &net.AddrError{Err: "unsupported transport", Addr: transport}
+}
+
+// Stop 关闭监听
+func (s *Server) Stop() error {
+	if s.tp == nil {
+		return nil
+	}
+	return s.tp.Close()
+}
+
+func (s *Server) GetPort() uint16 {
+	return s.port
+}
+
+// handle 处理传输层收到的请求，响应按照top via发回，tcp时从请求的连接发回
+func (s *Server) handle(sm *sip.SipMsg, source *sip.Source) {
+	if sm.GetRequestLine() == nil || !strings.EqualFold(sm.GetRequestLine().GetMethod(), "REGISTER") {
+		return
+	}
+	s.tp.Respond(context.Background(), s.response(sm), source)
 }
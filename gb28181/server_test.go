@@ -3,8 +3,9 @@ package gb28181
 import (
 	"fmt"
 	"net"
-	"sync"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kokutas/sip"
 )
@@ -28,13 +29,13 @@ func TestServer_Response(t *testing.T) {
 			sip.NewUserInfo(uasId, "", ""),
 			sip.NewHostPort("", uasIp, nil, uasPort),
 			nil,
-			sync.Map{}))
+			nil))
 	reqLine := sip.NewRequestLine(method, reqUri, schema, version)
-	from := sip.NewFrom("", "<", schema, uacId, uacIp.String(), uacPort, "123", sync.Map{})
-	to := sip.NewTo("", "<", schema, uacId, uacIp.String(), uacPort, "", sync.Map{})
-	contact := sip.NewContact("", "<", schema, uasId, uasIp.String(), uasPort, "", -1, sync.Map{})
+	from := sip.NewFrom("", "<", schema, uacId, uacIp.String(), uacPort, "123", nil)
+	to := sip.NewTo("", "<", schema, uacId, uacIp.String(), uacPort, "", nil)
+	contact := sip.NewContact("", "<", schema, uasId, uasIp.String(), uasPort, "", -1, nil)
 	callId := sip.NewCallID("abcdefg", uacIp.String())
-	via := sip.NewVia(schema, 2.0, transport, uasIp.String(), uasPort, 0, "", "", "xxxxx", 1, "", sync.Map{})
+	via := sip.NewVia(schema, 2.0, transport, uasIp.String(), uasPort, 0, "", "", "xxxxx", 1, "", nil)
 	expires := sip.NewExpires(expire)
 	maxForwards := sip.NewMaxForwards(70)
 	contentLength := sip.NewContentLength(0)
@@ -53,9 +54,95 @@ func TestServer_Response(t *testing.T) {
 	result := sm.Raw()
 	fmt.Print(result.String())
 	server := NewServer(uasId, uasId[:10], uasIp, 5060, "udp")
+	server.SetPassword(uacId, "12345678")
 
 	// 401 challenge
 	fmt.Println("----------------------------401 Unauthorized RESPONSE----------------------------")
 	result = server.Response(sm)
 	fmt.Print(result.String())
+	if !strings.HasPrefix(result.String(), "SIP/2.0 401 Unauthorized\r\n") || strings.Contains(result.String(), "REGISTER sip:") || !strings.Contains(result.String(), "To: <sip:34020000001320000001@129.168.0.26:5060>;tag=") {
+		t.Error("401 response mismatch")
+	}
+
+	// 密码错误时重新发起鉴权挑战
+	challenge := server.response(sm).GetWWWAuthenticate()
+	reqUriRaw := reqUri.Raw()
+	dp := &sip.DigestParams{
+		Digest:    sip.Digest{Realm: challenge.GetRealm(), UserName: uacId, Password: "87654321"},
+		Algorithm: "MD5",
+		Method:    "REGISTER",
+		URI:       reqUriRaw.String(),
+		Nonce:     challenge.GetNonce(),
+	}
+	sm.SetCSeq(sip.NewCSeq(1, "REGISTER"))
+	sm.SetAuthorization(sip.NewAuthorization(uacId, challenge.GetRealm(), challenge.GetNonce(), reqUri, sip.GenDigestResponse(dp), "MD5", "", "", "", "", nil))
+	result = server.Response(sm)
+	if !strings.HasPrefix(result.String(), "SIP/2.0 401 Unauthorized\r\n") {
+		t.Error("wrong password accepted")
+	}
+
+	// 鉴权通过的REGISTER由registrar保存绑定
+	fmt.Println("----------------------------200 OK RESPONSE----------------------------")
+	dp.Digest.Password = "12345678"
+	sm.SetCSeq(sip.NewCSeq(2, "REGISTER"))
+	sm.SetAuthorization(sip.NewAuthorization(uacId, challenge.GetRealm(), challenge.GetNonce(), reqUri, sip.GenDigestResponse(dp), "MD5", "", "", "", "", nil))
+	result = server.Response(sm)
+	fmt.Print(result.String())
+	if !strings.HasPrefix(result.String(), "SIP/2.0 200 OK\r\n") || !strings.Contains(result.String(), ";expires=3600\r\n") {
+		t.Error("200 response mismatch")
+	}
+	if contacts, err := server.GetRegistrar().Lookup("sip:34020000001320000001@129.168.0.26"); err != nil || len(contacts) != 1 {
+		t.Error("binding not saved", err)
+	}
+}
+
+func TestServer_Start(t *testing.T) {
+	for _, transport := range []string{"udp", "tcp"} {
+		testServerStart(t, transport)
+	}
+	if err := NewServer("34020000002000000001", "3402000000", net.IPv4(127, 0, 0, 1), 0, "sctp").Start(); err == nil {
+		t.Error("expected an unsupported transport error")
+	}
+}
+
+func testServerStart(t *testing.T, transport string) {
+	var (
+		uasId = "34020000002000000001"
+		uacId = "34020000001320000001"
+		ip    = net.IPv4(127, 0, 0, 1)
+	)
+	server := NewServer(uasId, uasId[:10], ip, 0, transport)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	server.SetPassword(uacId, "12345678")
+	ipc := NewIPC(uacId, ip, 0, uasId, ip, server.GetPort(), transport, 3600)
+	ipc.SetPassword("12345678")
+	if err := ipc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 401 challenge后携带Authorization重新注册
+	if err := ipc.Register(); err != nil {
+		t.Fatal(err)
+	}
+	registration := ipc.GetRegistration()
+	for deadline := time.Now().Add(2 * time.Second); registration.GetState() != sip.RegistrationRegistered && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Println(transport, "state:", registration.GetState(), ",granted:", registration.GetGranted())
+	if registration.GetState() != sip.RegistrationRegistered || registration.GetGranted() != 3600 {
+		t.Fatal(transport, "not registered")
+	}
+	aor := "sip:" + uacId + "@" + uacId[:10]
+	if contacts, _ := server.GetRegistrar().Lookup(aor); len(contacts) != 1 {
+		t.Error(transport, "binding not saved")
+	}
+	// Stop时注销
+	if err := ipc.Stop(); err != nil {
+		t.Error(err)
+	}
+	if contacts, _ := server.GetRegistrar().Lookup(aor); registration.GetState() != sip.RegistrationUnregistered || len(contacts) != 0 {
+		t.Error(transport, "binding not removed")
+	}
 }
@@ -0,0 +1,148 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7.3
+//
+// 7.3 Header Fields
+//
+// SIP header fields are similar to HTTP header fields in both syntax and
+// semantics.  In particular, SIP header fields follow the [H4.2]
+// definitions of syntax for the message-header and the rules for
+// extending header fields over multiple lines.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-8.2.2
+//
+// If a UAS does not understand a header field in a request (that is,
+// the header field is not defined in this specification or in any
+// supported extension), the server MUST ignore that header field and
+// continue processing the message.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-25.1
+//
+// extension-header  =  header-name HCOLON header-value
+// header-name       =  token
+// header-value      =  *(TEXT-UTF8char / UTF8-CONT / LWS)
+
+// GenericHeader is a header field without a typed struct in the package,
+// example: "Allow","Supported" or the "X-" headers of GB28181 devices
+type GenericHeader struct {
+	field  string // header-name as it appears in the message
+	value  string // header-value
+	source string // source string
+}
+
+func (gh *GenericHeader) SetField(field string) {
+	gh.field = field
+}
+func (gh *GenericHeader) GetField() string {
+	return gh.field
+}
+func (gh *GenericHeader) SetValue(value string) {
+	gh.value = value
+}
+func (gh *GenericHeader) GetValue() string {
+	return gh.value
+}
+func (gh *GenericHeader) GetSource() string {
+	return gh.source
+}
+func NewGenericHeader(field string, value string) *GenericHeader {
+	return &GenericHeader{
+		field: field,
+		value: value,
+	}
+}
+func (gh *GenericHeader) Raw() (result strings.Builder) {
+	result.WriteString(fmt.Sprintf("%s:", gh.field))
+	if len(strings.TrimSpace(gh.value)) > 0 {
+		result.WriteString(fmt.Sprintf(" %s", gh.value))
+	}
+	result.WriteString("\r\n")
+	return
+}
+func (gh *GenericHeader) Parse(raw string) error {
+	raw = scanLine(raw)
+	if len(strings.TrimSpace(raw)) == 0 {
+		return NewParseError("extension-header", raw, 0, `extension-header  =  header-name HCOLON header-value`)
+	}
+	// header-name
+	colon := strings.IndexByte(raw, ':')
+	if colon < 0 || !scanIsToken(strings.TrimRight(raw[:colon], " \t")) {
+		return NewParseError("extension-header", raw, 0, `header-name  =  token`)
+	}
+	gh.source = raw
+	gh.field = strings.TrimSpace(raw[:colon])
+	gh.value = strings.TrimSpace(raw[colon+1:])
+	return nil
+}
+
+// GenericHeaders keeps the header fields without a typed struct in their original order and case,
+// header field names are compared case-insensitively and a compact form matches its long form
+type GenericHeaders struct {
+	headers []*GenericHeader
+}
+
+func (ghs *GenericHeaders) SetHeaders(headers []*GenericHeader) {
+	ghs.headers = headers
+}
+func (ghs *GenericHeaders) GetHeaders() []*GenericHeader {
+	if ghs == nil {
+		return nil
+	}
+	return ghs.headers
+}
+func NewGenericHeaders(headers ...*GenericHeader) *GenericHeaders {
+	return &GenericHeaders{
+		headers: headers,
+	}
+}
+
+// Get returns the value of the first header field named field,"" when there is none
+func (ghs *GenericHeaders) Get(field string) string {
+	for _, header := range ghs.GetHeaders() {
+		if strings.EqualFold(headerFieldLong(header.GetField()), headerFieldLong(field)) {
+			return header.GetValue()
+		}
+	}
+	return ""
+}
+
+// Values returns the values of all the header fields named field in order
+func (ghs *GenericHeaders) Values(field string) []string {
+	values := make([]string, 0)
+	for _, header := range ghs.GetHeaders() {
+		if strings.EqualFold(headerFieldLong(header.GetField()), headerFieldLong(field)) {
+			values = append(values, header.GetValue())
+		}
+	}
+	return values
+}
+
+// Add appends a header field after the existing ones
+func (ghs *GenericHeaders) Add(field string, value string) {
+	ghs.headers = append(ghs.headers, NewGenericHeader(field, value))
+}
+
+// Del removes all the header fields named field
+func (ghs *GenericHeaders) Del(field string) {
+	headers := make([]*GenericHeader, 0, len(ghs.headers))
+	for _, header := range ghs.headers {
+		if !strings.EqualFold(headerFieldLong(header.GetField()), headerFieldLong(field)) {
+			headers = append(headers, header)
+		}
+	}
+	ghs.headers = headers
+}
+func (ghs *GenericHeaders) Raw() (result strings.Builder) {
+	for _, header := range ghs.GetHeaders() {
+		if header != nil {
+			headerBuilder := header.Raw()
+			result.WriteString(headerBuilder.String())
+		}
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package sip
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGenericHeader_Raw(t *testing.T) {
+	headers := []*GenericHeader{
+		NewGenericHeader("Allow", "INVITE, ACK, CANCEL, OPTIONS, BYE"),
+		NewGenericHeader("X-GB-Ver", "2.0"),
+		NewGenericHeader("Supported", ""),
+	}
+	for _, header := range headers {
+		result := header.Raw()
+		fmt.Print(result.String())
+	}
+}
+
+func TestGenericHeader_Parse(t *testing.T) {
+	raws := []string{
+		"Allow: INVITE, ACK, CANCEL, OPTIONS, BYE\r\n",
+		"x-gb-ver:2.0",
+		"Supported :",
+		"Bad Header: value",
+	}
+	for index, raw := range raws {
+		header := new(GenericHeader)
+		if err := header.Parse(raw); err != nil {
+			fmt.Println(index, err)
+			continue
+		}
+		fmt.Println(index, header.GetField(), header.GetValue())
+		result := header.Raw()
+		fmt.Print(result.String())
+	}
+}
+
+func TestGenericHeaders(t *testing.T) {
+	headers := NewGenericHeaders()
+	headers.Add("X-GB-Ver", "2.0")
+	headers.Add("Allow", "INVITE, ACK")
+	headers.Add("allow", "BYE")
+	if headers.Get("x-gb-ver") != "2.0" {
+		t.Error("get is not case-insensitive")
+	}
+	if values := headers.Values("ALLOW"); len(values) != 2 || values[1] != "BYE" {
+		t.Error("values mismatch", values)
+	}
+	headers.Del("Allow")
+	if len(headers.Values("Allow")) != 0 || len(headers.GetHeaders()) != 1 {
+		t.Error("del mismatch")
+	}
+	result := headers.Raw()
+	fmt.Print(result.String())
+}
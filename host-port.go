@@ -1,9 +1,9 @@
 package sip
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -66,6 +66,22 @@ func NewHostPort(name string, ipv4 net.IP, ipv6 net.IP, port uint16) *HostPort {
 	}
 }
 
+// Resolve returns the IP address of the host,a hostname is looked up with resolver
+func (hp *HostPort) Resolve(ctx context.Context, resolver Resolver) ([]net.IP, error) {
+	switch {
+	case hp.ipv4 != nil && len(strings.TrimSpace(hp.name)) == 0:
+		return []net.IP{hp.ipv4}, nil
+	case hp.ipv6 != nil && len(strings.TrimSpace(hp.name)) == 0:
+		return []net.IP{hp.ipv6}, nil
+	case len(strings.TrimSpace(hp.name)) == 0:
+		return nil, &net.AddrError{Err: "missing host", Addr: hp.source}
+	}
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hp.name, "["), "]")); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return resolver.LookupIP(ctx, strings.TrimSuffix(hp.name, "."))
+}
+
 func (hp *HostPort) Raw() (result strings.Builder) {
 	switch {
 	case len(strings.TrimSpace(hp.name)) > 0:
@@ -80,48 +96,56 @@ func (hp *HostPort) Raw() (result strings.Builder) {
 	}
 	return
 }
-func (hp *HostPort) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (hp *HostPort) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("hostport", raw, 0, `hostport  =  host [ ":" port ]`)
+	}
+	// the fields of an earlier parse are not kept
+	*hp = HostPort{source: raw}
+	// host and port separator,an IPv6address is only taken inside the brackets of an IPv6reference
+	host, port := raw, ""
+	if strings.HasPrefix(raw, "[") {
+		if index := strings.IndexByte(raw, ']'); index > 0 {
+			host, port = raw[:index+1], raw[index+1:]
+		}
+	} else if index := strings.IndexByte(raw, ':'); index >= 0 {
+		host, port = raw[:index], raw[index:]
 	}
-	hp.source = raw
-	// ipv4 address regexp
-	ipv4AddressRegexp := regexp.MustCompile(`((2(5[0-5]|[0-4]\d))|[0-1]?\d{1,2})(\.((2(5[0-5]|[0-4]\d))|[0-1]?\d{1,2})){3}`)
-	// host name regexp
-	hostnameRegexp := regexp.MustCompile(`[a-zA-Z0-9][-a-zA-Z0-9]{0,62}(\.[a-zA-Z0-9][-a-zA-Z0-9]{0,62})+\.?`)
+	host = stringTrimPrefixAndTrimSuffix(host, " ")
+	// the host is classified by its text only,a hostname is kept as it is and never looked up,see Resolve
 	switch {
-	case ipv4AddressRegexp.MatchString(raw):
-		hp.ipv4 = net.ParseIP(ipv4AddressRegexp.FindString(raw))
-		raw = regexp.MustCompile(`.*`+hp.ipv4.String()).ReplaceAllString(raw, "")
-	case hostnameRegexp.MatchString(raw):
-		hp.name = hostnameRegexp.FindString(raw)
-		raw = regexp.MustCompile(`.*`+hp.name).ReplaceAllString(raw, "")
-	default:
-		ipAddr, err := net.ResolveIPAddr("ip", raw)
-		if err == nil {
-			if ipAddr.IP.To16() != nil {
-				hp.ipv6 = ipAddr.IP.To16()
-				raw = regexp.MustCompile(`.*`+hp.ipv6.String()).ReplaceAllString(raw, "")
-			} else if ipAddr.IP.To4() != nil {
-				hp.ipv4 = ipAddr.IP.To4()
-				raw = regexp.MustCompile(`.*`+hp.ipv4.String()).ReplaceAllString(raw, "")
-			}
+	case strings.HasPrefix(host, "["):
+		ip := net.ParseIP(strings.TrimSuffix(host[1:], "]"))
+		if !strings.HasSuffix(host, "]") || ip == nil || ip.To4() != nil {
+			return NewParseError("hostport", hp.source, 0, `IPv6reference  =  "[" IPv6address "]"`)
 		}
+		hp.ipv6 = ip
+	case net.ParseIP(host).To4() != nil:
+		hp.ipv4 = net.ParseIP(host).To4()
+	case scanIsHostname(host):
+		hp.name = host
+	default:
+		return NewParseError("hostport", hp.source, 0, `host  =  hostname / IPv4address / IPv6reference`)
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// port regexp
-	portRegexp := regexp.MustCompile(`:( )*\d+`)
-	if portRegexp.MatchString(raw) {
-		ports := portRegexp.FindString(raw)
-		ports = regexp.MustCompile(`\d+`).FindString(ports)
-		if len(strings.TrimSpace(ports)) > 0 {
-			port, _ := strconv.Atoi(ports)
+	port = stringTrimPrefixAndTrimSuffix(port, " ")
+	if len(port) > 0 && !strings.HasPrefix(port, ":") {
+		return NewParseError("hostport", hp.source, parseErrorOffset(hp.source, port), `hostport  =  host [ ":" port ]`)
+	}
+	if strings.HasPrefix(port, ":") {
+		ports := stringTrimPrefixAndTrimSuffix(port[1:], " ")
+		if len(ports) > 0 && !scanIsDigits(ports) {
+			return NewParseError("hostport", hp.source, parseErrorOffset(hp.source, ports), `port  =  1*DIGIT`)
+		}
+		if len(ports) > 0 {
+			port, err := strconv.Atoi(ports)
+			if err != nil || port > 65535 {
+				return NewParseError("hostport", hp.source, parseErrorOffset(hp.source, ports), `port  =  1*DIGIT`)
+			}
 			if port > 0 {
 				hp.port = uint16(port)
 			}
 		}
 	}
+	return nil
 }
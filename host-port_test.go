@@ -1,6 +1,7 @@
 package sip
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"testing"
@@ -42,3 +43,43 @@ func TestHostPort_Parse(t *testing.T) {
 		}
 	}
 }
+
+func TestHostPort_ParseSyntactic(t *testing.T) {
+	hostport := new(HostPort)
+	if err := hostport.Parse("localhost:5060"); err != nil {
+		t.Fatal(err)
+	}
+	if hostport.GetName() != "localhost" || hostport.GetIPv4() != nil || hostport.GetIPv6() != nil {
+		t.Error("hostname was resolved while parsing")
+	}
+	hostport = new(HostPort)
+	hostport.Parse("[::1]:5061")
+	if !hostport.GetIPv6().Equal(net.IPv6loopback) || hostport.GetPort() != 5061 {
+		t.Error("ipv6 reference mismatch")
+	}
+	// a HostPort parsed again keeps nothing of the earlier parse
+	hostport.Parse("proxy.example.com")
+	if hostport.GetIPv6() != nil || hostport.GetPort() != 0 || hostport.GetName() != "proxy.example.com" {
+		t.Error("fields of the earlier parse kept")
+	}
+	for _, raw := range []string{"fe80::1", "[192.168.0.26]", "[fe80::1", "-bad.example.com", "bad_host", "host:99999999999999999999"} {
+		if err := new(HostPort).Parse(raw); err == nil {
+			t.Errorf("%q: expected a parse error", raw)
+		}
+	}
+}
+
+func TestHostPort_Resolve(t *testing.T) {
+	resolver := NewStaticResolver()
+	resolver.AddHost("proxy.example.com", net.IPv4(192, 168, 0, 1))
+	hostport := new(HostPort)
+	hostport.Parse("Proxy.Example.com.:5060")
+	ips, err := hostport.Resolve(context.Background(), resolver)
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 168, 0, 1)) {
+		t.Error("hostname resolve mismatch", ips, err)
+	}
+	hostport = NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060)
+	if ips, err := hostport.Resolve(context.Background(), resolver); err != nil || !ips[0].Equal(net.IPv4(192, 168, 0, 26)) {
+		t.Error("ip address resolve mismatch", ips, err)
+	}
+}
@@ -0,0 +1,215 @@
+package sip
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-10.3
+//
+// 10.3 Processing REGISTER Requests
+//
+// A registrar is a UAS that responds to REGISTER requests and maintains
+// a list of bindings that are accessible to proxy servers and redirect
+// servers within its administrative domain.  A registrar handles
+// requests according to Section 8.2 and Section 17.2, but it accepts
+// only REGISTER requests.
+//
+// For each address-of-record, the registrar maintains the contact
+// addresses bound to it.  The registrar also maintains, for each
+// binding, the Call-ID and CSeq of the last REGISTER request that
+// updated it, and the time the binding expires.
+
+// Binding is a contact address bound to an address-of-record,with the Call-ID and CSeq of the REGISTER that updated it last
+type Binding struct {
+	contact *Contact
+	callId  string
+	cseq    uint32
+	expires time.Time // the time the binding expires
+}
+
+func (b *Binding) SetContact(contact *Contact) {
+	b.contact = contact
+}
+func (b *Binding) GetContact() *Contact {
+	return b.contact
+}
+func (b *Binding) SetCallID(callId string) {
+	b.callId = callId
+}
+func (b *Binding) GetCallID() string {
+	return b.callId
+}
+func (b *Binding) SetCSeq(cseq uint32) {
+	b.cseq = cseq
+}
+func (b *Binding) GetCSeq() uint32 {
+	return b.cseq
+}
+func (b *Binding) SetExpires(expires time.Time) {
+	b.expires = expires
+}
+func (b *Binding) GetExpires() time.Time {
+	return b.expires
+}
+func NewBinding(contact *Contact, callId string, cseq uint32, expires time.Time) *Binding {
+	return &Binding{
+		contact: contact,
+		callId:  callId,
+		cseq:    cseq,
+		expires: expires,
+	}
+}
+
+// LocationStore keeps the bindings of the addresses-of-record of a registrar,
+// an address-of-record is a canonical URI such as sip:34020000001320000001@3402000000
+type LocationStore interface {
+	// Get returns the bindings of aor,expired ones included
+	Get(aor string) ([]*Binding, error)
+	// Put replaces the bindings of aor,no bindings removes aor
+	Put(aor string, bindings []*Binding) error
+}
+
+// MemoryLocationStore is a LocationStore in memory,the bindings are lost when the process exits
+type MemoryLocationStore struct {
+	bindings map[string][]*Binding
+	mutex    sync.Mutex
+}
+
+func NewMemoryLocationStore() *MemoryLocationStore {
+	return &MemoryLocationStore{
+		bindings: make(map[string][]*Binding),
+	}
+}
+func (ms *MemoryLocationStore) Get(aor string) ([]*Binding, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return append([]*Binding(nil), ms.bindings[aor]...), nil
+}
+func (ms *MemoryLocationStore) Put(aor string, bindings []*Binding) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if len(bindings) == 0 {
+		delete(ms.bindings, aor)
+		return nil
+	}
+	ms.bindings[aor] = append([]*Binding(nil), bindings...)
+	return nil
+}
+
+// FileLocationStore is a LocationStore kept in memory and saved to a JSON file on each Put,
+// the bindings survive a restart of the registrar
+type FileLocationStore struct {
+	path     string
+	bindings map[string][]*Binding
+	mutex    sync.Mutex
+}
+
+// locationRecord is a Binding in the file of a FileLocationStore
+type locationRecord struct {
+	Contact string    `json:"contact"`
+	CallID  string    `json:"call_id"`
+	CSeq    uint32    `json:"cseq"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileLocationStore returns a FileLocationStore saved to path,the bindings in path are loaded when it exists
+func NewFileLocationStore(path string) (*FileLocationStore, error) {
+	fs := &FileLocationStore{
+		path:     path,
+		bindings: make(map[string][]*Binding),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string][]locationRecord)
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	for aor, list := range records {
+		for _, record := range list {
+			contact := new(Contact)
+			if err := contact.Parse(record.Contact); err != nil {
+				return nil, err
+			}
+			fs.bindings[aor] = append(fs.bindings[aor], NewBinding(contact, record.CallID, record.CSeq, record.Expires))
+		}
+	}
+	return fs, nil
+}
+func (fs *FileLocationStore) GetPath() string {
+	return fs.path
+}
+func (fs *FileLocationStore) Get(aor string) ([]*Binding, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return append([]*Binding(nil), fs.bindings[aor]...), nil
+}
+
+// Put replaces the bindings of aor and saves all the bindings,the file is replaced as a whole
+func (fs *FileLocationStore) Put(aor string, bindings []*Binding) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	previous, ok := fs.bindings[aor]
+	if len(bindings) == 0 {
+		delete(fs.bindings, aor)
+	} else {
+		fs.bindings[aor] = append([]*Binding(nil), bindings...)
+	}
+	if err := fs.save(); err != nil {
+		// the bindings in memory stay those in the file
+		if ok {
+			fs.bindings[aor] = previous
+		} else {
+			delete(fs.bindings, aor)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes all the bindings to a temporary file renamed to the path,the caller holds the mutex
+func (fs *FileLocationStore) save() error {
+	records := make(map[string][]locationRecord, len(fs.bindings))
+	for aor, bindings := range fs.bindings {
+		for _, binding := range bindings {
+			raw := binding.GetContact().Raw()
+			records[aor] = append(records[aor], locationRecord{
+				Contact: raw.String(),
+				CallID:  binding.GetCallID(),
+				CSeq:    binding.GetCSeq(),
+				Expires: binding.GetExpires(),
+			})
+		}
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fs.path), filepath.Base(fs.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fs.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package sip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLocationStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bindings.json")
+	store, err := NewFileLocationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact := new(Contact)
+	if err := contact.Parse("Contact: <sip:34020000001320000001@192.168.0.26:5060>;q=0.7"); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Unix(3600, 0).UTC()
+	aor := "sip:34020000001320000001@3402000000"
+	if err := store.Put(aor, []*Binding{NewBinding(contact, "1011047669@192.168.0.26", 2, expires)}); err != nil {
+		t.Fatal(err)
+	}
+	// the bindings are loaded by another store of the same file
+	loaded, err := NewFileLocationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings, _ := loaded.Get(aor)
+	if len(bindings) != 1 || bindings[0].GetCallID() != "1011047669@192.168.0.26" || bindings[0].GetCSeq() != 2 ||
+		!bindings[0].GetExpires().Equal(expires) || bindings[0].GetContact().GetQ() != "0.7" {
+		t.Fatal("loaded bindings mismatch")
+	}
+	if err := loaded.Put(aor, nil); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _ := NewFileLocationStore(path); reloaded != nil {
+		if bindings, _ := reloaded.Get(aor); len(bindings) != 0 {
+			t.Error("bindings not removed")
+		}
+	}
+	// the registrar keeps its bindings in the file
+	registrar := NewRegistrar(loaded)
+	registrar.SetClock(NewManualClock(time.Unix(0, 0)))
+	if response := registrar.Register(transactionParse(t, sipMsgRegister)); response.GetStatusLine().GetStatusCode() != 200 {
+		t.Fatal("register mismatch")
+	}
+	reloaded, _ := NewFileLocationStore(path)
+	if bindings, _ := reloaded.Get(aor); len(bindings) != 1 {
+		t.Error("binding of the registrar not saved")
+	}
+}
@@ -0,0 +1,448 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3263.html#section-4
+//
+// 4 Client Usage
+//
+// The procedures here are invoked when a client needs to send a request
+// to a resource identified by a SIP or SIPS URI.  This URI can identify
+// the desired resource to which the request is targeted (in which case,
+// the URI is found in the Request-URI), or it can identify an
+// intermediate hop towards that resource (in which case, the URI is
+// found in the Route header).  The procedures defined here in no way
+// affect this URI (i.e., the URI is not rewritten with the result of
+// the DNS lookup), they only result in an IP address, port and
+// transport protocol where the request can be sent.
+//
+// https://www.rfc-editor.org/rfc/rfc3263.html#section-4.1
+//
+// 4.1 Selecting a Transport Protocol
+//
+// If the URI specifies a transport protocol in the transport parameter,
+// that transport protocol SHOULD be used.
+//
+// Otherwise, if no transport protocol is specified, but the TARGET is a
+// numeric IP address, the client SHOULD use UDP for a SIP URI, and TCP
+// for a SIPS URI.  Similarly, if no transport protocol is specified,
+// and the TARGET is not numeric, but an explicit port is provided, the
+// client SHOULD use UDP for a SIP URI, and TCP for a SIPS URI.
+//
+// Otherwise, if no transport protocol or port is specified, and the
+// target is not a numeric IP address, the client SHOULD perform a NAPTR
+// query for the domain in the URI.
+//
+// If no NAPTR records are found, the client constructs SRV queries for
+// those transport protocols it supports, and does a query for each.
+// If no SRV records are found, the client SHOULD use TCP for a SIPS
+// URI, and UDP for a SIP URI.
+//
+// https://www.rfc-editor.org/rfc/rfc3263.html#section-4.2
+//
+// 4.2 Determining Port and IP Address
+//
+// If TARGET is a numeric IP address, the client uses that address.  If
+// the URI also contains a port, it uses that port.  If no port is
+// specified, it uses the default port for the particular transport
+// protocol.
+//
+// If the TARGET was not a numeric IP address, but a port is present in
+// the URI, the client performs an A or AAAA record lookup of the domain
+// name.  The result will be a list of IP addresses, each of which can
+// be contacted at the specific port from the URI and transport protocol
+// determined previously.
+//
+// If the TARGET was not a numeric IP address, and no port was present
+// in the URI, the client performs an SRV query on the record returned
+// from the NAPTR processing of Section 4.1, if such processing was
+// performed.  If it was not, because a transport was specified
+// explicitly, the client performs an SRV query for that specific
+// transport, using the service identifier "_sips" for SIPS URIs.
+//
+// https://www.rfc-editor.org/rfc/rfc3263.html#section-4.3
+//
+// 4.3 Details of RFC 2782 Process
+//
+// RFC 2782 spells out the details of how a set of SRV records are
+// sorted and then tried.  However, it only states that the client
+// should "try to connect to the (protocol, address, service)" without
+// giving any details on what happens in the event of failure.  Those
+// details are described here for SIP.
+
+// locatorTransport is a transport protocol the Locator knows,
+// service is the NAPTR service field and prefix the SRV service and protocol labels
+type locatorTransport struct {
+	transport string // Via transport,example: "UDP","TLS"
+	secure    bool   // the transport can carry a SIPS URI
+	service   string // example: "SIP+D2U"
+	prefix    string // example: "_sip._udp."
+	port      uint16 // default port
+}
+
+var locatorTransports = []locatorTransport{
+	{transport: "UDP", service: "SIP+D2U", prefix: "_sip._udp.", port: 5060},
+	{transport: "TCP", service: "SIP+D2T", prefix: "_sip._tcp.", port: 5060},
+	{transport: "TLS", secure: true, service: "SIPS+D2T", prefix: "_sips._tcp.", port: 5061},
+	{transport: "SCTP", service: "SIP+D2S", prefix: "_sip._sctp.", port: 5060},
+	{transport: "WS", service: "SIP+D2W", prefix: "_sip._ws.", port: 80},
+	{transport: "WSS", secure: true, service: "SIPS+D2W", prefix: "_sips._ws.", port: 443},
+}
+
+// Target is one place a request can be sent to,the transport,IP address and port of a located server
+type Target struct {
+	transport string // "UDP" / "TCP" / "TLS" / "SCTP" / "WS" / "WSS"
+	host      string // the domain of the URI,the certificate of a TLS server is checked against it
+	ip        net.IP
+	port      uint16
+}
+
+func (t *Target) SetTransport(transport string) {
+	t.transport = transport
+}
+func (t *Target) GetTransport() string {
+	return t.transport
+}
+func (t *Target) SetHost(host string) {
+	t.host = host
+}
+func (t *Target) GetHost() string {
+	return t.host
+}
+func (t *Target) SetIP(ip net.IP) {
+	t.ip = ip
+}
+func (t *Target) GetIP() net.IP {
+	return t.ip
+}
+func (t *Target) SetPort(port uint16) {
+	t.port = port
+}
+func (t *Target) GetPort() uint16 {
+	return t.port
+}
+func NewTarget(transport string, host string, ip net.IP, port uint16) *Target {
+	return &Target{
+		transport: transport,
+		host:      host,
+		ip:        ip,
+		port:      port,
+	}
+}
+
+// Addr returns the address of the target for net.Dial,example: "192.168.0.1:5060","[2001:db8::1]:5061"
+func (t *Target) Addr() string {
+	return net.JoinHostPort(t.ip.String(), fmt.Sprint(t.port))
+}
+func (t *Target) String() string {
+	return fmt.Sprintf("%s %s", t.transport, t.Addr())
+}
+
+// Locator turns a SIP or SIPS URI into the ordered list of targets of RFC 3263,
+// a request is sent to the first target and to the next one when it fails
+type Locator struct {
+	client     DNSClient
+	transports []string   // the transports supported,in the order they are tried when the domain has no NAPTR record
+	random     *rand.Rand // picks among SRV records of the same priority by weight
+	mutex      sync.Mutex
+}
+
+func (l *Locator) SetClient(client DNSClient) {
+	l.client = client
+}
+func (l *Locator) GetClient() DNSClient {
+	return l.client
+}
+func (l *Locator) SetTransports(transports []string) {
+	l.transports = transports
+}
+func (l *Locator) GetTransports() []string {
+	return l.transports
+}
+func (l *Locator) SetRandom(random *rand.Rand) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.random = random
+}
+
+// NewLocator returns a Locator asking client,the transports default to "UDP","TCP" and "TLS"
+func NewLocator(client DNSClient, transports ...string) *Locator {
+	if len(transports) == 0 {
+		transports = []string{"UDP", "TCP", "TLS"}
+	}
+	return &Locator{
+		client:     client,
+		transports: transports,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Locate returns the targets of uri in the order they should be tried,
+// the maddr parameter takes the place of the host when it is present
+func (l *Locator) Locate(ctx context.Context, uri *SipUri) ([]*Target, error) {
+	if uri == nil || uri.GetHostPort() == nil {
+		return nil, &net.AddrError{Err: "missing host", Addr: ""}
+	}
+	secure := strings.EqualFold(uri.GetSchema(), sips)
+	hostport := uri.GetHostPort()
+	host, port := hostport.GetName(), hostport.GetPort()
+	switch {
+	case len(strings.TrimSpace(host)) > 0:
+	case hostport.GetIPv4() != nil:
+		host = hostport.GetIPv4().String()
+	case hostport.GetIPv6() != nil:
+		host = hostport.GetIPv6().String()
+	}
+	var transport *locatorTransport
+	if parameters := uri.GetParameters(); parameters != nil {
+		if len(strings.TrimSpace(parameters.GetMaddr())) > 0 {
+			host = strings.TrimSuffix(strings.TrimPrefix(parameters.GetMaddr(), "["), "]")
+		}
+		if len(strings.TrimSpace(parameters.GetTransport())) > 0 {
+			var err error
+			if transport, err = l.transport(parameters.GetTransport(), secure); err != nil {
+				return nil, err
+			}
+		}
+	}
+	host = strings.TrimSuffix(host, ".")
+	if len(host) == 0 {
+		return nil, &net.AddrError{Err: "missing host", Addr: uri.GetSource()}
+	}
+
+	// a numeric IP address or an explicit port,UDP for a SIP URI and TLS for a SIPS URI
+	if ip := net.ParseIP(host); ip != nil || port > 0 {
+		if transport == nil {
+			transport = locatorDefault(secure)
+		}
+		if port == 0 {
+			port = transport.port
+		}
+		if ip != nil {
+			return []*Target{NewTarget(transport.transport, host, ip, port)}, nil
+		}
+		return l.address(ctx, transport.transport, host, host, port)
+	}
+
+	// no transport,the NAPTR records of the domain and then the SRV records of each supported transport
+	if transport == nil {
+		targets, _ := l.naptr(ctx, host, secure)
+		if len(targets) > 0 {
+			return targets, nil
+		}
+		for _, name := range l.transports {
+			candidate, ok := locatorFind(name)
+			if !ok || (secure && !candidate.secure) {
+				continue
+			}
+			srvTargets, _ := l.srv(ctx, candidate.transport, host, candidate.prefix+host)
+			targets = append(targets, srvTargets...)
+		}
+		if len(targets) > 0 {
+			return targets, nil
+		}
+		transport = locatorDefault(secure)
+	} else if targets, _ := l.srv(ctx, transport.transport, host, transport.prefix+host); len(targets) > 0 {
+		return targets, nil
+	}
+
+	// no SRV record,the A and AAAA records of the domain at the default port
+	return l.address(ctx, transport.transport, host, host, transport.port)
+}
+
+// transport returns the transport of a transport-param,"tcp" in a SIPS URI is TLS over TCP
+func (l *Locator) transport(param string, secure bool) (*locatorTransport, error) {
+	name := strings.ToUpper(param)
+	if secure {
+		switch name {
+		case "TCP", "TLS":
+			name = "TLS"
+		case "WS", "WSS":
+			name = "WSS"
+		default:
+			return nil, &net.AddrError{Err: "transport can not carry a SIPS URI", Addr: param}
+		}
+	}
+	transport, ok := locatorFind(name)
+	if !ok || !l.supports(transport.transport) {
+		return nil, &net.AddrError{Err: "unsupported transport", Addr: param}
+	}
+	return &transport, nil
+}
+
+// supports reports whether transport is one of the transports of the Locator
+func (l *Locator) supports(transport string) bool {
+	for _, name := range l.transports {
+		if strings.EqualFold(name, transport) {
+			return true
+		}
+	}
+	return false
+}
+
+// naptr follows the NAPTR records of domain to their SRV records,
+// the records of the services not supported and the non-secure ones for a SIPS URI are skipped
+func (l *Locator) naptr(ctx context.Context, domain string, secure bool) ([]*Target, error) {
+	naptrs, err := l.client.LookupNAPTR(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	usable := make([]*NAPTR, 0, len(naptrs))
+	for _, naptr := range naptrs {
+		transport, ok := locatorService(naptr.Service)
+		if ok && strings.EqualFold(naptr.Flags, "s") && l.supports(transport.transport) && (!secure || transport.secure) {
+			usable = append(usable, naptr)
+		}
+	}
+	sort.SliceStable(usable, func(i, j int) bool {
+		if usable[i].Order != usable[j].Order {
+			return usable[i].Order < usable[j].Order
+		}
+		return usable[i].Preference < usable[j].Preference
+	})
+	targets := make([]*Target, 0)
+	for _, naptr := range usable {
+		transport, _ := locatorService(naptr.Service)
+		srvTargets, srvErr := l.srv(ctx, transport.transport, domain, naptr.Replacement)
+		targets = append(targets, srvTargets...)
+		err = srvErr
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+	return nil, err
+}
+
+// srv returns the targets of the SRV records of name in the order of RFC 2782,
+// a record whose target can not be resolved is skipped
+func (l *Locator) srv(ctx context.Context, transport string, domain string, name string) ([]*Target, error) {
+	srvs, err := l.client.LookupSRV(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	srvs = locatorSortSRV(srvs, l.random.Intn)
+	l.mutex.Unlock()
+	targets := make([]*Target, 0, len(srvs))
+	for _, srv := range srvs {
+		// a target of "." means the service is decidedly not available at this domain
+		if strings.TrimSuffix(srv.Target, ".") == "" {
+			continue
+		}
+		addressTargets, addressErr := l.address(ctx, transport, domain, strings.TrimSuffix(srv.Target, "."), srv.Port)
+		if addressErr != nil {
+			err = addressErr
+			continue
+		}
+		targets = append(targets, addressTargets...)
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+	if err == nil {
+		err = &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return nil, err
+}
+
+// address returns a target for each A and AAAA record of host
+func (l *Locator) address(ctx context.Context, transport string, domain string, host string, port uint16) ([]*Target, error) {
+	ips, err := l.client.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*Target, 0, len(ips))
+	for _, ip := range ips {
+		targets = append(targets, NewTarget(transport, domain, ip, port))
+	}
+	return targets, nil
+}
+
+// locatorDefault returns UDP for a SIP URI and TLS for a SIPS URI
+func locatorDefault(secure bool) *locatorTransport {
+	name := "UDP"
+	if secure {
+		name = "TLS"
+	}
+	transport, _ := locatorFind(name)
+	return &transport
+}
+
+// locatorFind returns the transport named name,case-insensitively
+func locatorFind(name string) (locatorTransport, bool) {
+	for _, transport := range locatorTransports {
+		if strings.EqualFold(transport.transport, name) {
+			return transport, true
+		}
+	}
+	return locatorTransport{}, false
+}
+
+// locatorService returns the transport of a NAPTR service field,case-insensitively
+func locatorService(service string) (locatorTransport, bool) {
+	for _, transport := range locatorTransports {
+		if strings.EqualFold(transport.service, service) {
+			return transport, true
+		}
+	}
+	return locatorTransport{}, false
+}
+
+// locatorSortSRV orders srvs by priority and within the same priority by a weighted random pick,
+// random returns a number in [0,n)
+//
+// https://www.rfc-editor.org/rfc/rfc2782.html
+//
+// To select a target to be contacted next, arrange all SRV RRs
+// (that have not been ordered yet) in any order, except that all
+// those with weight 0 are placed at the beginning of the list.
+//
+// Compute the sum of the weights of those RRs, and with each RR
+// associate the running sum in the selected order. Then choose a
+// uniform random number between 0 and the sum computed
+// (inclusive), and select the RR whose running sum value is the
+// first in the selected order which is greater than or equal to
+// the random number selected.
+func locatorSortSRV(srvs []*net.SRV, random func(n int) int) []*net.SRV {
+	sorted := append(make([]*net.SRV, 0, len(srvs)), srvs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		group := sorted[start:end]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Weight == 0 && group[j].Weight != 0
+		})
+		for index := range group {
+			sum := 0
+			for _, srv := range group[index:] {
+				sum += int(srv.Weight)
+			}
+			pick, running := random(sum+1), 0
+			for selected := index; selected < len(group); selected++ {
+				running += int(group[selected].Weight)
+				if running >= pick {
+					srv := group[selected]
+					copy(group[index+1:selected+1], group[index:selected])
+					group[index] = srv
+					break
+				}
+			}
+		}
+		start = end
+	}
+	return sorted
+}
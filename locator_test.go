@@ -0,0 +1,141 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestLocator_Locate(t *testing.T) {
+	fs := newDNSFakeServer(t, false,
+		// example.com prefers TCP over UDP and has TLS for a SIPS URI
+		dnsNAPTR("example.com", 10, 50, "SIP+D2T", "_sip._tcp.example.com"),
+		dnsNAPTR("example.com", 20, 50, "SIP+D2U", "_sip._udp.example.com"),
+		dnsNAPTR("example.com", 30, 50, "SIPS+D2T", "_sips._tcp.example.com"),
+		dnsNAPTR("example.com", 5, 50, "SIP+D2X", "_sip._x.example.com"),
+		dnsSRV("_sip._tcp.example.com", 0, 0, 5070, "sip1.example.com"),
+		dnsSRV("_sip._udp.example.com", 0, 0, 5060, "sip2.example.com"),
+		dnsSRV("_sips._tcp.example.com", 0, 0, 5061, "sip1.example.com"),
+		dnsA("example.com", "192.168.0.10"),
+		dnsA("sip1.example.com", "192.168.0.1"),
+		dnsA("sip2.example.com", "192.168.0.2"),
+		dnsA("sip2.example.com", "2001:db8::2"),
+		// srv.com has no NAPTR record,the first SRV target does not resolve and is failed over
+		dnsSRV("_sip._udp.srv.com", 0, 0, 5060, "dead.srv.com"),
+		dnsSRV("_sip._udp.srv.com", 1, 0, 5062, "sip.srv.com"),
+		dnsSRV("_sip._tcp.srv.com", 0, 0, 5064, "sip.srv.com"),
+		dnsA("sip.srv.com", "192.168.1.1"),
+		// a.com has only an A record
+		dnsA("a.com", "192.168.2.1"),
+	)
+	locator := NewLocator(NewNetDNSClient(fs.Addr()))
+	cases := []struct {
+		uri     string
+		targets string
+	}{
+		{"sip:34020000002000000001@192.168.0.26", "UDP 192.168.0.26:5060"},
+		{"sips:alice@[2001:db8::26]", "TLS [2001:db8::26]:5061"},
+		{"sip:192.168.0.26:5070;transport=tcp", "TCP 192.168.0.26:5070"},
+		{"sips:192.168.0.26;transport=tcp", "TLS 192.168.0.26:5061"},
+		{"sip:34020000002000000001@example.com:5080", "UDP 192.168.0.10:5080"},
+		{"sip:34020000002000000001@example.com", "TCP 192.168.0.1:5070,UDP 192.168.0.2:5060,UDP [2001:db8::2]:5060,TLS 192.168.0.1:5061"},
+		{"sips:34020000002000000001@example.com", "TLS 192.168.0.1:5061"},
+		{"sip:34020000002000000001@example.com;transport=udp", "UDP 192.168.0.2:5060,UDP [2001:db8::2]:5060"},
+		{"sip:bob@srv.com", "UDP 192.168.1.1:5062,TCP 192.168.1.1:5064"},
+		{"sip:bob@srv.com;transport=TCP", "TCP 192.168.1.1:5064"},
+		{"sip:bob@a.com", "UDP 192.168.2.1:5060"},
+		{"sip:bob@a.com;maddr=192.168.0.30", "UDP 192.168.0.30:5060"},
+		{"sip:bob@srv.com;maddr=a.com;transport=tcp", "TCP 192.168.2.1:5060"},
+	}
+	for _, c := range cases {
+		uri := new(SipUri)
+		if err := uri.Parse(c.uri); err != nil {
+			t.Error(err)
+			continue
+		}
+		targets, err := locator.Locate(context.Background(), uri)
+		if err != nil {
+			t.Error(c.uri, err)
+			continue
+		}
+		addrs := make([]string, 0, len(targets))
+		for _, target := range targets {
+			addrs = append(addrs, target.String())
+		}
+		fmt.Println(c.uri, "->", addrs)
+		if strings.Join(addrs, ",") != c.targets {
+			t.Errorf("%s: targets mismatch: %v", c.uri, addrs)
+		}
+	}
+	errors := []string{
+		"sip:bob@unknown.com",
+		"sips:bob@example.com;transport=udp",
+		"sip:bob@example.com;transport=sctp",
+	}
+	for _, raw := range errors {
+		uri := new(SipUri)
+		uri.Parse(raw)
+		if targets, err := locator.Locate(context.Background(), uri); err == nil {
+			t.Errorf("%s: expected an error,got %v", raw, targets)
+		}
+	}
+	// transport=ws is WSS in a SIPS URI,a Locator without the WebSocket transports refuses it
+	wsLocator := NewLocator(NewNetDNSClient(fs.Addr()), "UDP", "TCP", "TLS", "WS", "WSS")
+	wsCases := []struct {
+		uri     string
+		targets string
+	}{
+		{"sip:192.168.0.26;transport=ws", "WS 192.168.0.26:80"},
+		{"sips:192.168.0.26;transport=ws", "WSS 192.168.0.26:443"},
+		{"sip:bob@a.com:8080;transport=ws", "WS 192.168.2.1:8080"},
+	}
+	for _, c := range wsCases {
+		uri := new(SipUri)
+		uri.Parse(c.uri)
+		targets, err := wsLocator.Locate(context.Background(), uri)
+		if err != nil || len(targets) != 1 || targets[0].String() != c.targets {
+			t.Errorf("%s: targets mismatch: %v,%v", c.uri, targets, err)
+		}
+	}
+	uri := new(SipUri)
+	uri.Parse("sip:192.168.0.26;transport=ws")
+	if _, err := locator.Locate(context.Background(), uri); err == nil {
+		t.Error("expected an unsupported transport error")
+	}
+}
+
+func TestLocator_SortSRV(t *testing.T) {
+	srvs := []*net.SRV{
+		{Target: "c", Priority: 20, Weight: 0},
+		{Target: "b", Priority: 10, Weight: 60},
+		{Target: "a", Priority: 10, Weight: 0},
+		{Target: "d", Priority: 10, Weight: 40},
+	}
+	// the smallest running sum,the zero weight first and then the others in order
+	sorted := locatorSortSRV(srvs, func(n int) int { return 0 })
+	if sorted[0].Target != "a" || sorted[1].Target != "b" || sorted[2].Target != "d" || sorted[3].Target != "c" {
+		t.Error("srv zero weight order mismatch")
+	}
+	// the largest running sum,the last one of the priority
+	sorted = locatorSortSRV(srvs, func(n int) int { return n - 1 })
+	if sorted[0].Target != "d" || sorted[3].Target != "c" {
+		t.Error("srv weight order mismatch")
+	}
+	if srvs[0].Target != "c" {
+		t.Error("srv sort changed its input")
+	}
+	// the heavier record comes first more often
+	random, first := rand.New(rand.NewSource(1)), 0
+	for index := 0; index < 1000; index++ {
+		if locatorSortSRV(srvs, random.Intn)[0].Target == "b" {
+			first++
+		}
+	}
+	fmt.Println("weight 60 first:", first)
+	if first < 500 || first > 700 {
+		t.Error("srv weight distribution mismatch")
+	}
+}
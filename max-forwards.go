@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -56,7 +55,7 @@ type MaxForwards struct {
 }
 
 func (maxForwards *MaxForwards) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(max-forwards)$`).MatchString(field) {
+	if scanFieldIs(field, "max-forwards") {
 		maxForwards.field = strings.Title(field)
 	}
 }
@@ -88,29 +87,24 @@ func (maxForwards *MaxForwards) Raw() (result strings.Builder) {
 	return
 }
 
-func (maxForwards *MaxForwards) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (maxForwards *MaxForwards) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Max-Forwards", raw, 0, `Max-Forwards  =  "Max-Forwards" HCOLON 1*DIGIT`)
 	}
-	// max-forwards field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(max-forwards)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "max-forwards")
+	if !ok {
+		return NewParseError("Max-Forwards", raw, 0, `Max-Forwards  =  "Max-Forwards" HCOLON 1*DIGIT`)
 	}
-	maxForwards.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	maxForwards.field = field
 	maxForwards.source = raw
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// forwards regexp
-	forwardsRegexp := regexp.MustCompile(`\d+`)
-	if forwardsRegexp.MatchString(raw) {
-		forwards := forwardsRegexp.FindString(raw)
-		if len(forwards) > 0 {
-			forward, _ := strconv.Atoi(forwards)
-			maxForwards.forwards = uint8(forward)
-		}
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// forwards
+	// the value is kept in a uint8,a larger one does not fit
+	forward, err := strconv.ParseUint(raw, 10, 8)
+	if !scanIsDigits(raw) || err != nil {
+		return NewParseError("Max-Forwards", maxForwards.source, parseErrorOffset(maxForwards.source, raw), `Max-Forwards  =  "Max-Forwards" HCOLON 1*DIGIT`)
 	}
+	maxForwards.forwards = uint8(forward)
+	return nil
 }
@@ -3,14 +3,13 @@ package sip
 import (
 	"fmt"
 	"net"
-	"sync"
 	"testing"
 )
 
 func TestNameAddr_Raw(t *testing.T) {
-	p := sync.Map{}
-	p.Store("lr", "")
-	p.Store("hello", nil)
+	p := NewParams()
+	p.SetFlag("lr")
+	p.SetFlag("hello")
 	nas := []*NameAddr{
 		NewNameAddr("sip", NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 0), p),
 		NewNameAddr("sip", NewHostPort("www.baidu.com", net.IPv4(192, 168, 0, 26), nil, 0), p),
@@ -27,6 +26,7 @@ func TestNameAddr_Parse(t *testing.T) {
 		"sip:192.168.0.26;lr",
 		"sip:www.baidu.com;lr",
 		"sip:www.baidu.com;lr=3;hello=w;ls",
+		"sip:34020000001320000001@192.168.0.26:5060;lr",
 	}
 	for index, raw := range raws {
 		na := new(NameAddr)
@@ -36,4 +36,12 @@ func TestNameAddr_Parse(t *testing.T) {
 			fmt.Println(index, result.String())
 		}
 	}
+	// the user part of a remote target in the route set of a strict router
+	na := new(NameAddr)
+	if err := na.Parse("sip:34020000001320000001@192.168.0.26:5060"); err != nil {
+		t.Fatal(err)
+	}
+	if result := na.Raw(); na.GetUserInfo().GetUser() != "34020000001320000001" || result.String() != "sip:34020000001320000001@192.168.0.26:5060" {
+		t.Error("user part mismatch", result.String())
+	}
 }
@@ -1,12 +1,8 @@
 package sip
 
 import (
-	"fmt"
-	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 // uri-parameters    =  *( ";" uri-parameter)
@@ -28,17 +24,20 @@ import (
 // paramchar         =  param-unreserved / unreserved / escaped
 // param-unreserved  =  "[" / "]" / "/" / ":" / "&" / "+" / "$"
 //
+// https://www.rfc-editor.org/rfc/rfc7118.html#section-5.2
+//
+// transport-param   =/  "transport=" "ws"
+//
 type Parameters struct {
-	transport string      // transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls"/ other-transport),other-transport = token
-	user      string      // user-param =  "user=" ( "phone" / "ip" / other-user), other-user = token
-	method    string      // method-param =  "method=" Method
-	ttl       uint8       // ttl-param =  "ttl=" ttl
-	maddr     string      // maddr-param       =  "maddr=" host
-	lr        bool        // lr-param          =  "lr"
-	other     sync.Map    // other-param       =  pname [ "=" pvalue ]
-	isOrder   bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order     chan string // It is convenient to record the order of the original parameter fields when parsing
-	source    string      // source string
+	transport string   // transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls" / "ws" / other-transport),other-transport = token
+	user      string   // user-param =  "user=" ( "phone" / "ip" / other-user), other-user = token
+	method    string   // method-param =  "method=" Method
+	ttl       uint8    // ttl-param =  "ttl=" ttl
+	maddr     string   // maddr-param       =  "maddr=" host
+	lr        bool     // lr-param          =  "lr"
+	other     *Params  // other-param       =  pname [ "=" pvalue ]
+	order     []string // parameter names in the parsed order,the typed parameters included
+	source    string   // source string
 }
 
 func (p *Parameters) SetTransport(transport string) {
@@ -77,16 +76,16 @@ func (p *Parameters) SetLr(lr bool) {
 func (p *Parameters) GetLr() bool {
 	return p.lr
 }
-func (p *Parameters) SetOther(other sync.Map) {
+func (p *Parameters) SetOther(other *Params) {
 	p.other = other
 }
-func (p *Parameters) GetOther() sync.Map {
+func (p *Parameters) GetOther() *Params {
 	return p.other
 }
 func (p *Parameters) GetSource() string {
 	return p.source
 }
-func NewParameters(transport string, user string, method string, ttl uint8, maddr string, lr bool, other sync.Map) *Parameters {
+func NewParameters(transport string, user string, method string, ttl uint8, maddr string, lr bool, other *Params) *Parameters {
 	return &Parameters{
 		transport: transport,
 		user:      user,
@@ -95,218 +94,75 @@ func NewParameters(transport string, user string, method string, ttl uint8, madd
 		maddr:     maddr,
 		lr:        lr,
 		other:     other,
-		isOrder:   false,
 	}
 }
 func (p *Parameters) Raw() (result strings.Builder) {
-	if p.isOrder {
-		p.isOrder = false
-		for orders := range p.order {
-			if regexp.MustCompile(`((?i)(?:^transport))( )*=`).MatchString(orders) {
-				// transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls"/ other-transport),other-transport = token
-				if len(strings.TrimSpace(p.transport)) > 0 {
-					result.WriteString(fmt.Sprintf(";transport=%s", strings.ToLower(p.transport)))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(?:^user))( )*=`).MatchString(orders) {
-				// user-param =  "user=" ( "phone" / "ip" / other-user), other-user = token
-				if len(strings.TrimSpace(p.user)) > 0 {
-					result.WriteString(fmt.Sprintf(";user=%s", p.user))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(?:^method))( )*=`).MatchString(orders) {
-				// method-param =  "method=" Method
-				if len(strings.TrimSpace(p.method)) > 0 {
-					result.WriteString(fmt.Sprintf(";method=%s", p.method))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(?:^ttl))( )*=`).MatchString(orders) {
-				// ttl-param =  "ttl=" ttl
-				if p.ttl > 0 {
-					result.WriteString(fmt.Sprintf(";ttl=%d", p.ttl))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(?:^maddr))( )*=`).MatchString(orders) {
-				// maddr-param       =  "maddr=" host
-				if len(strings.TrimSpace(p.maddr)) > 0 {
-					result.WriteString(fmt.Sprintf(";maddr=%s", p.maddr))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(?:^lr))( )*=`).MatchString(orders) {
-				// lr-param          =  "lr"
-				if p.lr {
-					result.WriteString(";lr")
-				}
-				continue
-			}
-			ordersSlice := strings.Split(orders, "=")
-
-			if len(ordersSlice) == 1 {
-				if val, ok := p.other.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := p.other.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				} else {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", ordersSlice[1]))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], ordersSlice[1]))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				}
-			}
-
-		}
-
-	} else {
-		// transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls"/ other-transport),other-transport = token
-		if len(strings.TrimSpace(p.transport)) > 0 {
-			result.WriteString(fmt.Sprintf(";transport=%s", strings.ToLower(p.transport)))
-		}
-		// user-param =  "user=" ( "phone" / "ip" / other-user), other-user = token
-		if len(strings.TrimSpace(p.user)) > 0 {
-			result.WriteString(fmt.Sprintf(";user=%s", p.user))
-		}
-		// method-param =  "method=" Method
-		if len(strings.TrimSpace(p.method)) > 0 {
-			result.WriteString(fmt.Sprintf(";method=%s", p.method))
-		}
-		// ttl-param =  "ttl=" ttl
-		if p.ttl > 0 {
-			result.WriteString(fmt.Sprintf(";ttl=%d", p.ttl))
-		}
-		// maddr-param       =  "maddr=" host
-		if len(strings.TrimSpace(p.maddr)) > 0 {
-			result.WriteString(fmt.Sprintf(";maddr=%s", p.maddr))
-		}
-		// lr-param          =  "lr"
-		if p.lr {
-			result.WriteString(";lr")
-		}
+	typed := NewParams()
+	// transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls"/ other-transport),other-transport = token
+	if len(strings.TrimSpace(p.transport)) > 0 {
+		typed.Set("transport", strings.ToLower(p.transport))
 	}
-
-	// other     sync.Map
-	p.other.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(";%v", key))
-				return true
-			}
-			result.WriteString(fmt.Sprintf(";%v=%v", key, value))
-			return true
-		}
-		result.WriteString(fmt.Sprintf(";%v", key))
-		return true
-	})
+	// user-param =  "user=" ( "phone" / "ip" / other-user), other-user = token
+	if len(strings.TrimSpace(p.user)) > 0 {
+		typed.Set("user", p.user)
+	}
+	// method-param =  "method=" Method
+	if len(strings.TrimSpace(p.method)) > 0 {
+		typed.Set("method", p.method)
+	}
+	// ttl-param =  "ttl=" ttl
+	if p.ttl > 0 {
+		typed.Set("ttl", strconv.Itoa(int(p.ttl)))
+	}
+	// maddr-param       =  "maddr=" host
+	if len(strings.TrimSpace(p.maddr)) > 0 {
+		typed.Set("maddr", p.maddr)
+	}
+	// lr-param          =  "lr"
+	if p.lr {
+		typed.SetFlag("lr")
+	}
+	// other-param       =  pname [ "=" pvalue ]
+	result.WriteString(paramsMerge(p.order, typed, p.other).raw(";", ";", false))
 	return
 }
-func (p *Parameters) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (p *Parameters) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return nil
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	p.source = raw
-	// parameters other order
-	p.otherOrder(raw)
-	// tranport parameter regexp
-	transportRegexp := regexp.MustCompile(`(?i)(transport).*`)
-	// user parameter regexp
-	userRegexp := regexp.MustCompile(`(?i)(user).*`)
-	// method parameter regexp
-	methodRegexp := regexp.MustCompile(`(?i)(method).*`)
-	// ttl parameter regexp
-	ttlRegexp := regexp.MustCompile(`(?i)(ttl).*`)
-	// maddr parameter regexp
-	maddrRegexp := regexp.MustCompile(`(?i)(maddr).*`)
-	// lr parameterregexp
-	lrRegexp := regexp.MustCompile(`(?i)(lr).*`)
-
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		switch {
-		case transportRegexp.MatchString(raws):
-			transport := regexp.MustCompile(`(?i)(transport)`).ReplaceAllString(raws, "")
-			transport = regexp.MustCompile(`.*=`).ReplaceAllString(transport, "")
-			transport = stringTrimPrefixAndTrimSuffix(transport, " ")
-			if len(transport) > 0 {
-				p.transport = transport
-			}
-		case userRegexp.MatchString(raws):
-			user := regexp.MustCompile(`(?i)(user)`).ReplaceAllString(raws, "")
-			user = regexp.MustCompile(`.*=`).ReplaceAllString(user, "")
-			user = stringTrimPrefixAndTrimSuffix(user, " ")
-			if len(user) > 0 {
-				p.user = user
-			}
-		case methodRegexp.MatchString(raws):
-			method := regexp.MustCompile(`(?i)(method)`).ReplaceAllString(raws, "")
-			method = regexp.MustCompile(`.*=`).ReplaceAllString(method, "")
-			method = stringTrimPrefixAndTrimSuffix(method, " ")
-			if len(method) > 0 {
-				p.method = method
-			}
-		case ttlRegexp.MatchString(raws):
-			ttlStr := regexp.MustCompile(`(?i)(ttl)`).ReplaceAllString(raws, "")
-			ttlStr = regexp.MustCompile(`.*=`).ReplaceAllString(ttlStr, "")
-			ttlStr = stringTrimPrefixAndTrimSuffix(ttlStr, " ")
-			if len(ttlStr) > 0 {
-				ttl, _ := strconv.Atoi(ttlStr)
-				p.ttl = uint8(ttl)
-			}
-		case maddrRegexp.MatchString(raws):
-			maddr := regexp.MustCompile(`(?i)(maddr)`).ReplaceAllString(raws, "")
-			maddr = regexp.MustCompile(`.*=`).ReplaceAllString(maddr, "")
-			maddr = stringTrimPrefixAndTrimSuffix(maddr, " ")
-			if len(maddr) > 0 {
-				p.maddr = maddr
+	p.other = NewParams()
+	p.order = nil
+	parameter := NewParams()
+	if err := parameter.Parse(raw); err != nil {
+		return parseErrorWrap(err, p.source, raw)
+	}
+	for _, param := range parameter.list() {
+		p.order = append(p.order, param.name)
+		switch strings.ToLower(param.name) {
+		case "transport":
+			p.transport = param.value
+		case "user":
+			p.user = param.value
+		case "method":
+			p.method = param.value
+		case "ttl":
+			ttl, err := strconv.Atoi(param.value)
+			if err != nil || ttl < 0 || ttl > 255 {
+				return NewParseError("uri-parameters", p.source, parseErrorOffset(p.source, param.source), `ttl-param  =  "ttl=" ttl`)
 			}
-		case lrRegexp.MatchString(raws):
+			p.ttl = uint8(ttl)
+		case "maddr":
+			p.maddr = param.value
+		case "lr":
 			p.lr = true
 		default:
-			if len(strings.TrimSpace(raws)) > 0 {
-				if strings.Contains(raws, "=") {
-					gs := strings.Split(raws, "=")
-					if len(gs) > 1 {
-						p.other.Store(gs[0], gs[1])
-					} else {
-						p.other.Store(gs[0], "")
-					}
-				} else {
-					p.other.Store(raws, "")
-				}
-			}
+			p.other.set(param)
 		}
 	}
-}
-func (p *Parameters) otherOrder(parameter string) {
-	p.isOrder = true
-	p.order = make(chan string, 1024)
-	defer close(p.order)
-	parameter = stringTrimPrefixAndTrimSuffix(parameter, ";")
-	parameter = stringTrimPrefixAndTrimSuffix(parameter, " ")
-	parameters := strings.Split(parameter, ";")
-	for _, data := range parameters {
-		p.order <- data
-	}
+	return nil
 }
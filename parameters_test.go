@@ -2,12 +2,11 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestParameters_Raw(t *testing.T) {
-	parameters := NewParameters("udp", "34020000001320000001", "REGISTER", 5, "192.168.0.1", true, sync.Map{})
+	parameters := NewParameters("udp", "34020000001320000001", "REGISTER", 5, "192.168.0.1", true, nil)
 	result := parameters.Raw()
 	fmt.Println(result.String())
 }
@@ -17,6 +16,7 @@ func TestParameters_Parse(t *testing.T) {
 		";transport=udp;user=34020000001320000001;method=REGISTER;maddr=192.168.0.1;lr;ttl=5;;",
 		";transport=udp;user=34020000001320000001;maddr=192.168.0.1;lr;ttl=5;;method=REGISTER;",
 		";transport=udp;user=34020000001320000001;maddr=192.168.0.1;lr;ttl=5;;method=REGISTER;token",
+		";transport=ws;lr",
 	}
 	for index, raw := range raws {
 		parameters := new(Parameters)
@@ -24,10 +24,10 @@ func TestParameters_Parse(t *testing.T) {
 		if len(parameters.GetSource()) > 0 {
 			fmt.Print("index: ", index, ",transport: ", parameters.GetTransport(), ",user: ", parameters.GetUser(), ",ttl: ", parameters.GetTtl(), ",maddr: ", parameters.GetMaddr(), ",lr: ", parameters.GetLr(), ",method: ", parameters.GetMethod())
 			other := parameters.GetOther()
-			other.Range(func(key, value interface{}) bool {
+			for _, key := range other.Names() {
+				value, _ := other.Get(key)
 				fmt.Print(",key= ", key, ",value =", value)
-				return true
-			})
+			}
 			fmt.Println()
 			result := parameters.Raw()
 			fmt.Println(result.String())
@@ -0,0 +1,293 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7.3.1
+//
+// 7.3.1 Header Field Format
+//
+// Even though an arbitrary number of parameter pairs may be attached to
+// a header field value, any given parameter-name MUST NOT appear more
+// than once.
+//
+// When comparing header fields, field names are always case-
+// insensitive.  Unless otherwise stated in the definition of a
+// particular header field, field values, parameter names, and parameter
+// values are case-insensitive.  Tokens are always case-insensitive.
+// Unless specified otherwise, values expressed as quoted strings are
+// case-sensitive.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-25.1
+//
+// generic-param  =  token [ EQUAL gen-value ]
+// gen-value      =  token / host / quoted-string
+// quoted-string  =  SWS DQUOTE *(qdtext / quoted-pair ) DQUOTE
+// quoted-pair    =  "\" (%x00-09 / %x0B-0C / %x0E-7F)
+
+// param is one generic-param of a Params
+type param struct {
+	name   string // token, the case of the parsed or set name is kept
+	value  string // gen-value without the double quotes of a quoted-string
+	quoted bool   // the value was or has to be written as a quoted-string
+	source string // source string
+}
+
+// Params is an ordered list of generic-param,example: ";lr;transport=udp" or ";tag=a48s".
+// Names are compared case-insensitively, a parameter without a value is a flag,example: "lr","rport".
+// The zero value and nil are an empty list,a Params is copied with Clone.
+type Params struct {
+	params []param
+}
+
+func NewParams() *Params {
+	return &Params{}
+}
+
+// Len returns the number of parameters
+func (ps *Params) Len() int {
+	if ps == nil {
+		return 0
+	}
+	return len(ps.params)
+}
+
+// Names returns the parameter names in order
+func (ps *Params) Names() []string {
+	names := make([]string, 0, ps.Len())
+	if ps == nil {
+		return names
+	}
+	for _, p := range ps.params {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// index returns the position of the parameter named name,-1 when there is none
+func (ps *Params) index(name string) int {
+	if ps == nil {
+		return -1
+	}
+	for index, p := range ps.params {
+		if strings.EqualFold(p.name, name) {
+			return index
+		}
+	}
+	return -1
+}
+
+// list returns the parameters in order
+func (ps *Params) list() []param {
+	if ps == nil {
+		return nil
+	}
+	return ps.params
+}
+
+// source returns the parsed text of the parameter named name,"" when it was not parsed
+func (ps *Params) source(name string) string {
+	if index := ps.index(name); index >= 0 {
+		return ps.params[index].source
+	}
+	return ""
+}
+
+// Has reports whether a parameter named name is present,with or without a value
+func (ps *Params) Has(name string) bool {
+	return ps.index(name) >= 0
+}
+
+// Get returns the value of the parameter named name,a flag has an empty value
+func (ps *Params) Get(name string) (value string, ok bool) {
+	index := ps.index(name)
+	if index < 0 {
+		return "", false
+	}
+	return ps.params[index].value, true
+}
+
+// IsFlag reports whether the parameter named name is present without a value
+func (ps *Params) IsFlag(name string) bool {
+	index := ps.index(name)
+	return index >= 0 && len(ps.params[index].value) == 0 && !ps.params[index].quoted
+}
+
+// IsQuoted reports whether the value of the parameter named name is written as a quoted-string
+func (ps *Params) IsQuoted(name string) bool {
+	index := ps.index(name)
+	return index >= 0 && ps.params[index].quoted
+}
+
+// Set sets the value of the parameter named name in place or appends it,
+// the value is written as a quoted-string when it is not a token or host
+func (ps *Params) Set(name string, value string) {
+	ps.set(param{name: name, value: value})
+}
+
+// SetQuoted is Set with the value always written as a quoted-string
+func (ps *Params) SetQuoted(name string, value string) {
+	ps.set(param{name: name, value: value, quoted: true})
+}
+
+// SetFlag sets the parameter named name without a value
+func (ps *Params) SetFlag(name string) {
+	ps.set(param{name: name})
+}
+func (ps *Params) set(p param) {
+	if index := ps.index(p.name); index >= 0 {
+		ps.params[index] = p
+		return
+	}
+	ps.params = append(ps.params, p)
+}
+
+// Del removes the parameter named name
+func (ps *Params) Del(name string) {
+	if index := ps.index(name); index >= 0 {
+		ps.params = append(ps.params[:index:index], ps.params[index+1:]...)
+	}
+}
+
+// Clone returns a copy that does not share storage with ps
+func (ps *Params) Clone() *Params {
+	clone := NewParams()
+	if ps != nil && len(ps.params) > 0 {
+		clone.params = append(make([]param, 0, len(ps.params)), ps.params...)
+	}
+	return clone
+}
+
+// Raw writes the parameters as *( SEMI generic-param )
+func (ps *Params) Raw() (result strings.Builder) {
+	result.WriteString(ps.raw(";", ";", true))
+	return
+}
+
+// raw writes each parameter after a separator,lead is the separator of the first one.
+// quote is false for the uri-parameters and headers of a SIP-URI,where a pvalue is escaped instead of quoted.
+func (ps *Params) raw(lead string, separator string, quote bool) string {
+	var result strings.Builder
+	if ps == nil {
+		return ""
+	}
+	for index, p := range ps.params {
+		if index == 0 {
+			result.WriteString(lead)
+		} else {
+			result.WriteString(separator)
+		}
+		result.WriteString(p.name)
+		switch {
+		case p.quoted || (quote && len(p.value) > 0 && !paramsIsGenValue(p.value)):
+			result.WriteString(fmt.Sprintf("=\"%s\"", strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p.value)))
+		case len(p.value) > 0:
+			result.WriteString(fmt.Sprintf("=%s", p.value))
+		}
+	}
+	return result.String()
+}
+
+// Parse parses *( SEMI generic-param ),the leading SEMI is optional and the parameters replace the current ones
+func (ps *Params) Parse(raw string) error {
+	return ps.parse(raw, ';')
+}
+
+// parse splits raw at separator outside of quoted-strings
+func (ps *Params) parse(raw string, separator byte) error {
+	ps.params = nil
+	quoted, escaped, start := false, false, 0
+	for index := 0; index <= len(raw); index++ {
+		if index < len(raw) {
+			c := raw[index]
+			switch {
+			case escaped:
+				escaped = false
+				continue
+			case quoted && c == '\\':
+				escaped = true
+				continue
+			case c == '"':
+				quoted = !quoted
+				continue
+			case quoted || c != separator:
+				continue
+			}
+		}
+		if err := ps.parseParam(raw, start, index); err != nil {
+			return err
+		}
+		start = index + 1
+	}
+	return nil
+}
+
+// parseParam parses the generic-param at raw[start:end],blank parameters are skipped
+func (ps *Params) parseParam(raw string, start int, end int) error {
+	source := raw[start:end]
+	if len(strings.TrimSpace(source)) == 0 {
+		return nil
+	}
+	p := param{source: strings.TrimSpace(source)}
+	name, value := source, ""
+	hasValue := strings.Contains(source, "=")
+	if hasValue {
+		name, value = source[:strings.Index(source, "=")], source[strings.Index(source, "=")+1:]
+	}
+	p.name = strings.TrimSpace(name)
+	if len(p.name) == 0 || strings.ContainsAny(p.name, " \t\"") {
+		return NewParseError("generic-param", raw, start, `generic-param  =  token [ EQUAL gen-value ]`)
+	}
+	if hasValue {
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "\"") {
+			if len(value) < 2 || !strings.HasSuffix(value, "\"") {
+				return NewParseError("generic-param", raw, start+strings.Index(source, "\""), `quoted-string  =  SWS DQUOTE *(qdtext / quoted-pair ) DQUOTE`)
+			}
+			value = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value[1 : len(value)-1])
+			p.quoted = true
+		}
+		p.value = value
+	}
+	ps.params = append(ps.params, p)
+	return nil
+}
+
+// paramsIsGenValue reports whether value can be written as a token or host without double quotes
+func paramsIsGenValue(value string) bool {
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-.!%*_+`'~[]:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// paramsMerge returns the typed parameters of a header field and its extension parameters as one list,
+// the names of order come first as they were parsed,the others follow in the order of typed and then extension
+func paramsMerge(order []string, typed *Params, extension *Params) *Params {
+	merged := NewParams()
+	for _, name := range order {
+		if merged.Has(name) {
+			continue
+		}
+		if index := typed.index(name); index >= 0 {
+			merged.params = append(merged.params, typed.params[index])
+		} else if index := extension.index(name); index >= 0 {
+			merged.params = append(merged.params, extension.params[index])
+		}
+	}
+	for _, ps := range []*Params{typed, extension} {
+		for _, p := range ps.list() {
+			if !merged.Has(p.name) {
+				merged.params = append(merged.params, p)
+			}
+		}
+	}
+	return merged
+}
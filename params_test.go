@@ -0,0 +1,106 @@
+package sip
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParams_Raw(t *testing.T) {
+	ps := NewParams()
+	ps.SetFlag("lr")
+	ps.Set("transport", "udp")
+	ps.Set("protocol", "application/pkcs7-signature")
+	ps.SetQuoted("text", `say "hi"`)
+	ps.Set("maddr", "[2001:db8::1]")
+	result := ps.Raw()
+	fmt.Println(result.String())
+	if result.String() != `;lr;transport=udp;protocol="application/pkcs7-signature";text="say \"hi\"";maddr=[2001:db8::1]` {
+		t.Error("params raw mismatch")
+	}
+	ps.Set("TRANSPORT", "tcp")
+	ps.Del("Maddr")
+	result = ps.Raw()
+	fmt.Println(result.String())
+	if result.String() != `;lr;TRANSPORT=tcp;protocol="application/pkcs7-signature";text="say \"hi\""` {
+		t.Error("params set in place or del mismatch")
+	}
+}
+
+func TestParams_Parse(t *testing.T) {
+	raws := []string{
+		";lr;transport=udp",
+		"tag=a48s;x-id=\"a;b\";rport",
+		" ;Received = 192.168.0.26 ; branch=z9hG4bK1;rport=5060;",
+		`;text="say \"hi\""`,
+	}
+	for index, raw := range raws {
+		ps := new(Params)
+		if err := ps.Parse(raw); err != nil {
+			t.Error(err)
+			continue
+		}
+		result := ps.Raw()
+		fmt.Println(index, ps.Names(), result.String())
+		again := new(Params)
+		if err := again.Parse(result.String()); err != nil {
+			t.Error(err)
+			continue
+		}
+		resultAgain := again.Raw()
+		if resultAgain.String() != result.String() {
+			t.Errorf("%d: params round trip mismatch: %q != %q", index, resultAgain.String(), result.String())
+		}
+	}
+	ps := new(Params)
+	ps.Parse("LR;Transport=UDP;x=\"a;b\"")
+	if !ps.IsFlag("lr") || ps.IsFlag("transport") || !ps.IsQuoted("X") {
+		t.Error("params flag or quoted mismatch")
+	}
+	if value, ok := ps.Get("transport"); !ok || value != "UDP" {
+		t.Error("params case-insensitive get mismatch")
+	}
+	if value, _ := ps.Get("x"); value != "a;b" {
+		t.Error("params quoted value mismatch")
+	}
+	for _, raw := range []string{";=udp", `;x="abc`} {
+		if err := new(Params).Parse(raw); err == nil {
+			t.Errorf("%q: expected a parse error", raw)
+		}
+	}
+}
+
+func TestParams_Clone(t *testing.T) {
+	ps := NewParams()
+	ps.Set("tag", "a48s")
+	clone := ps.Clone()
+	clone.Set("tag", "hyh8")
+	clone.SetFlag("lr")
+	if value, _ := ps.Get("tag"); value != "a48s" || ps.Len() != 1 {
+		t.Error("params clone shares storage")
+	}
+	var nilParams *Params
+	if nilParams.Clone().Len() != 0 || nilParams.Has("lr") {
+		t.Error("nil params is not empty")
+	}
+}
+
+func TestParams_Stable(t *testing.T) {
+	raws := []string{
+		"Via: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1;x=1;rport;received=192.168.0.1\r\n",
+		"From: <sip:34020000001320000001@192.168.0.1:5060>;x=1;tag=123;lr\r\n",
+		"Contact: <sip:34020000001320000001@192.168.0.1:5060>;expires=3600;x-label=\"a;b\";q=0.7\r\n",
+	}
+	layers := []SipLayer{new(Via), new(From), new(Contact)}
+	for index, raw := range raws {
+		if err := layers[index].Parse(raw); err != nil {
+			t.Error(err)
+			continue
+		}
+		first := layers[index].Raw()
+		second := layers[index].Raw()
+		fmt.Print(index, " ", first.String())
+		if first.String() != raw || second.String() != raw {
+			t.Errorf("%d: repeated raw mismatch: %q,%q", index, first.String(), second.String())
+		}
+	}
+}
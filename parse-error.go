@@ -0,0 +1,85 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-21.4.1
+//
+// 21.4.1 400 Bad Request
+// The request could not be understood due to malformed syntax.  The
+// Reason-Phrase SHOULD identify the syntax problem in more detail, for
+// example, "Missing Call-ID header field".
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-20.43
+//
+// 399 Miscellaneous warning: The warning text can include arbitrary
+// information to be presented to a human user or logged.  A
+// system receiving this warning MUST NOT take any automated
+// action.
+
+// ParseError is returned by the Parse methods when the raw string does not match the RFC 3261 grammar
+type ParseError struct {
+	field  string // header field name or start-line that failed,example: "Via","CSeq","Request-Line"
+	offset int    // byte offset in source where the grammar rule was broken
+	rule   string // the broken grammar rule,example: `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`
+	source string // source string
+}
+
+func (pe *ParseError) GetField() string {
+	return pe.field
+}
+func (pe *ParseError) GetOffset() int {
+	return pe.offset
+}
+func (pe *ParseError) GetRule() string {
+	return pe.rule
+}
+func (pe *ParseError) GetSource() string {
+	return pe.source
+}
+func NewParseError(field string, source string, offset int, rule string) *ParseError {
+	if offset < 0 || offset > len(source) {
+		offset = len(source)
+	}
+	return &ParseError{
+		field:  field,
+		offset: offset,
+		rule:   rule,
+		source: source,
+	}
+}
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("sip: parse %s at offset %d: %s", pe.field, pe.offset, pe.rule)
+}
+
+// Warning returns a 399 Miscellaneous warning describing the error, to be added to the 400 Bad Request response,
+// warn-text is a quoted-string so the double quotes of the grammar rule are replaced with single quotes
+func (pe *ParseError) Warning(warnAgent string) *Warning {
+	return NewWarning(399, warnAgent, strings.ReplaceAll(pe.Error(), "\"", "'"))
+}
+
+// shift returns a copy of the error with the offset moved by the position of the source in an enclosing string
+func (pe *ParseError) shift(source string, offset int) *ParseError {
+	return NewParseError(pe.field, source, pe.offset+offset, pe.rule)
+}
+
+// parseErrorOffset returns the byte offset of sub in source, the end of source when sub is not found
+func parseErrorOffset(source string, sub string) int {
+	if len(sub) == 0 {
+		return len(source)
+	}
+	if index := strings.Index(source, sub); index >= 0 {
+		return index
+	}
+	return len(source)
+}
+
+// parseErrorWrap moves the offset of an error returned by a nested Parse by the position of sub in source
+func parseErrorWrap(err error, source string, sub string) error {
+	if pe, ok := err.(*ParseError); ok {
+		return pe.shift(source, parseErrorOffset(source, sub))
+	}
+	return err
+}
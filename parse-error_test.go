@@ -0,0 +1,66 @@
+package sip
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseError_Error(t *testing.T) {
+	pe := NewParseError("CSeq", "CSeq: abc REGISTER", 6, `CSeq  =  "CSeq" HCOLON 1*DIGIT LWS Method`)
+	fmt.Println(pe.Error())
+	warning := pe.Warning("192.168.0.26:5060")
+	result := warning.Raw()
+	fmt.Print(result.String())
+	if pe.GetOffset() != 6 || pe.GetField() != "CSeq" {
+		t.Error("parse error field or offset mismatch")
+	}
+	// offset out of range
+	pe = NewParseError("CSeq", "CSeq:", 100, "")
+	if pe.GetOffset() != len("CSeq:") {
+		t.Error("parse error offset not clamped")
+	}
+}
+
+func TestParseError_Parse(t *testing.T) {
+	tests := []struct {
+		layer  SipLayer
+		raw    string
+		field  string
+		offset int
+	}{
+		{new(CSeq), "CSeq: abc REGISTER", "CSeq", 6},
+		{new(CSeq), "CSeq: 1 REG{ISTER", "CSeq", 8},
+		{new(CSeq), "Cseqq: 1 REGISTER", "CSeq", 0},
+		{new(ContentLength), "Content-Length: 1a", "Content-Length", 16},
+		{new(CSeq), "CSeq: 2147483648 REGISTER", "CSeq", 6},
+		{new(CSeq), "CSeq: 99999999999999999999 REGISTER", "CSeq", 6},
+		{new(MaxForwards), "Max-Forwards: -1", "Max-Forwards", 14},
+		{new(MaxForwards), "Max-Forwards: 300", "Max-Forwards", 14},
+		{new(Expires), "Expires: ", "Expires", 8},
+		{new(Expires), "Expires: 99999999999", "Expires", 9},
+		{new(Via), "Via: SIP/2.0 192.168.0.26:5060;branch=z9hG4bK1", "Via", 13},
+		{new(Via), "Via: SIP/2.0/UDP 192.168.0.26:5060;ttl=300", "Via", 35},
+		{new(Via), "Via: SIP/2.0/UDP 192.168.0.26:5060;received=abc;branch=z9hG4bK1", "Via", 35},
+		{new(Via), "Via: SIP/2.0/UDP 192.168.0.26:65536", "Via", 30},
+		{new(From), "From: 34020000001320000001;tag=1", "From", 6},
+		{new(ContentType), "Content-Type: application", "Content-Type", 14},
+		{new(StatusLine), "SIP/2.0 40 Bad", "Status-Line", 8},
+		{new(RequestLine), "REGISTER sip:34020000002000000001@192.168.0.108:99999 SIP/2.0", "hostport", 48},
+		{new(Warning), "Warning: 30 192.168.0.1", "Warning", 9},
+		{new(SipMsg), "", "SIP-message", 0},
+		{new(SipMsg), "REGISTER sip:3402000000 SIP/2.0\r\nVia: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1\r\n\r\n", "From", 83},
+		{new(SipMsg), "REGISTER sip:3402000000 SIP/2.0\r\nVia: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1\r\nCSeq: x REGISTER\r\n\r\n", "CSeq", 91},
+	}
+	for index, test := range tests {
+		err := test.layer.Parse(test.raw)
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%d: %q: expected a parse error,got %v", index, test.raw, err)
+			continue
+		}
+		fmt.Println(index, pe.Error())
+		if pe.GetField() != test.field || pe.GetOffset() != test.offset {
+			t.Errorf("%d: %q: expected %s at offset %d,got %s at offset %d", index, test.raw, test.field, test.offset, pe.GetField(), pe.GetOffset())
+		}
+	}
+}
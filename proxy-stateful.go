@@ -0,0 +1,744 @@
+package sip
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.5
+//
+// 16.5 Determining Request Targets
+//
+// If the Request-URI of the request contains an maddr parameter, the
+// Request-URI MUST be placed into the target set as the only target
+// URI, and the proxy MUST proceed to Section 16.6.
+//
+// If the domain of the Request-URI indicates a domain this element is
+// not responsible for, the Request-URI MUST be placed into the target
+// set as the only target, and the element MUST proceed to the task of
+// Request Forwarding (Section 16.6).
+//
+// If the target set for the request has not been predetermined as
+// described above, this implies that the element is responsible for the
+// domain in the Request-URI, and the element MAY use whatever mechanism
+// it desires to determine where to send the request.  Any of these
+// mechanisms can be modeled as accessing an abstract Location Service.
+//
+// If the Request-URI indicates a resource at this proxy that does not
+// exist, the proxy MUST return a 404 (Not Found) response.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.6
+//
+// 16.6 Request Forwarding
+//
+// As soon as the target set is non-empty, a proxy MAY begin forwarding
+// the request.  A stateful proxy MAY process the set in any order.  It
+// MAY process multiple targets serially, allowing each client
+// transaction to complete before starting the next.  It MAY start
+// client transactions with every target in parallel.  It also MAY
+// arbitrarily divide the set into groups, processing the groups
+// serially and processing the targets in each group in parallel.
+//
+// A common ordering mechanism is to use the qvalue parameter of targets
+// obtained from Contact header fields (see Section 20.10).  Targets are
+// processed from highest qvalue to lowest qvalue.  Targets with equal
+// qvalues may be processed in parallel.
+//
+// 4. Record-Route
+//
+// If this proxy wishes to remain on the path of future requests in a
+// dialog created by this request (assuming the request creates a
+// dialog), it MUST insert a Record-Route header field value into the
+// copy before any existing Record-Route header field values, even if a
+// Route header field is already present.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.7
+//
+// 16.7 Response Processing
+//
+// 5. Check response for forwarding
+//
+// Until a final response has been sent on the server transaction, the
+// following responses MUST be forwarded immediately:
+//
+//    -  Any provisional response other than 100 (Trying)
+//
+//    -  Any 2xx response
+//
+// If a 6xx response is received, it is not immediately forwarded, but
+// the stateful proxy SHOULD cancel all client pending transactions as
+// described in Section 10, and it MUST NOT create any new branches in
+// this context.
+//
+// After a final response has been sent on the server transaction, the
+// following responses MUST be forwarded immediately:
+//
+//    -  Any 2xx response to an INVITE request
+//
+// 6. Choosing the best response
+//
+// A stateful proxy MUST send a final response to a response context's
+// server transaction if no final responses have been immediately
+// forwarded by the above rules and all client transactions in this
+// response context have been terminated.
+//
+// The proxy MUST choose the "best" final response among those received
+// and stored in the response context.
+//
+// If there are no final responses in the context, the proxy MUST send a
+// 408 (Request Timeout) response to the server transaction.
+//
+// Otherwise, the proxy MUST forward a response from the responses
+// stored in the response context.  It MUST choose from the 6xx class
+// responses if any exist in the context.  If no 6xx class responses
+// are present, the proxy SHOULD choose from the lowest response class
+// stored in the response context.  The proxy MAY select any response
+// within that chosen class.  The proxy SHOULD give preference to
+// responses that provide information affecting resubmission of this
+// request, such as 401, 407, 415, 420, and 484 if the 4xx class is
+// chosen.
+//
+// If the selected response is a 503 (Service Unavailable) response, the
+// proxy MUST generate a 500 (Server Internal Error) response and forward
+// that to the server transaction.
+//
+// 7. Aggregate Authorization Header Field Values
+//
+// If the selected response is a 401 (Unauthorized) or 407 (Proxy
+// Authentication Required), the proxy MUST collect any WWW-Authenticate
+// and Proxy-Authenticate header field values from all other 401
+// (Unauthorized) and 407 (Proxy Authentication Required) responses
+// received so far in this response context and add them to this
+// response without modification before forwarding.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.8
+//
+// 16.8 Processing Timer C
+//
+// If timer C should fire, the proxy MUST either reset the timer with
+// any value it chooses, or terminate the client transaction.  If the
+// client transaction has received a provisional response, the proxy
+// MUST generate a CANCEL request matching that transaction.  If the
+// client transaction has not received a provisional response, the proxy
+// MUST behave as if the transaction received a 408 (Request Timeout)
+// response.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.10
+//
+// 16.10 CANCEL Processing
+//
+// A stateful proxy MAY generate a CANCEL to any other request it has
+// generated at any time (subject to receiving a provisional response to
+// that request as described in section 9.1).  A proxy MUST cancel any
+// pending client transactions associated with a response context when
+// it receives a matching CANCEL request.
+//
+// While a CANCEL request is handled in a stateful proxy by its
+// transaction layer, the proxy MUST NOT create new branches in the
+// response context of the cancelled request.
+
+// proxyTimerC is the default Timer C of an INVITE branch,RFC 3261 16.6 item 11 asks for more than 3 minutes
+const proxyTimerC = 3*time.Minute + 10*time.Second
+
+// TargetHandler returns the target set of a request a StatefulProxy is responsible for,
+// example: the bindings of a location service. The Contacts are tried from the highest q to the lowest,
+// those of the same q in parallel. The request is forwarded to its Request-URI when there are none,
+// a StatusError is the response of the proxy instead.
+type TargetHandler func(sm *SipMsg) ([]*Contact, error)
+
+// StatefulProxy forwards each request in server and client transactions by RFC 3261 16,
+// it forks a request to the target set of its TargetHandler and sends the best response back.
+// An ACK of a 2xx and a response matching no client transaction are forwarded statelessly.
+type StatefulProxy struct {
+	transactions *TransactionLayer
+	stateless    *StatelessProxy          // forwards what matches no transaction
+	handler      TargetHandler            // the target set of a request,nil forwards to the Request-URI
+	domains      []string                 // the domains the proxy is responsible for besides its own host
+	recordRoute  bool                     // Record-Route on a request creating a dialog
+	timerC       time.Duration            // Timer C of an INVITE branch
+	contexts     map[string]*proxyContext // the response contexts by the key of their server transaction
+	mutex        sync.Mutex
+}
+
+// proxyContext is the response context of a request forwarded by a StatefulProxy
+type proxyContext struct {
+	st        *ServerTransaction
+	request   *SipMsg // the request after route preprocessing,copied on each branch
+	invite    bool
+	loop      string          // the loop detection component of the branches
+	groups    [][]*RequestUri // the targets not tried yet,a group is forked in parallel
+	branches  []*proxyBranch
+	responses []*SipMsg // the final responses of 3xx-6xx without the Via of the proxy
+	final     bool      // a final response is sent on the server transaction
+	canceled  bool      // no new branch is created
+	mutex     sync.Mutex
+}
+
+// proxyBranch is a client transaction of a response context
+type proxyBranch struct {
+	request     *SipMsg // the request as sent
+	target      *Target
+	provisional bool // a provisional response is received
+	cancel      bool // the branch is canceled on its first provisional response
+	canceled    bool // the CANCEL is sent
+	done        bool // a final response is received
+	timerC      Timer
+}
+
+func (sp *StatefulProxy) GetTransactions() *TransactionLayer {
+	return sp.transactions
+}
+func (sp *StatefulProxy) GetLocator() *Locator {
+	return sp.stateless.GetLocator()
+}
+func (sp *StatefulProxy) GetHost() string {
+	return sp.stateless.GetHost()
+}
+
+// SetPort sets the port of the proxy,example: the port a transport listening on port 0 gets
+func (sp *StatefulProxy) SetPort(port uint16) {
+	sp.stateless.SetPort(port)
+}
+func (sp *StatefulProxy) GetPort() uint16 {
+	return sp.stateless.GetPort()
+}
+func (sp *StatefulProxy) SetHandler(handler TargetHandler) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.handler = handler
+}
+func (sp *StatefulProxy) GetHandler() TargetHandler {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.handler
+}
+
+// SetDomains sets the domains the proxy is responsible for besides its own host,
+// the handler determines the targets of the requests to them
+func (sp *StatefulProxy) SetDomains(domains ...string) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.domains = append([]string(nil), domains...)
+}
+func (sp *StatefulProxy) GetDomains() []string {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return append([]string(nil), sp.domains...)
+}
+
+// SetRecordRoute sets whether the proxy stays on the path of the dialogs created by the requests it forwards
+func (sp *StatefulProxy) SetRecordRoute(recordRoute bool) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.recordRoute = recordRoute
+}
+func (sp *StatefulProxy) GetRecordRoute() bool {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.recordRoute
+}
+func (sp *StatefulProxy) SetTimerC(timerC time.Duration) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.timerC = timerC
+}
+func (sp *StatefulProxy) GetTimerC() time.Duration {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.timerC
+}
+
+// NewStatefulProxy returns a StatefulProxy at host:port,it becomes the handler and the stray handler of transactions.
+// locator finds the next hop of a request,handler determines its targets.
+func NewStatefulProxy(transactions *TransactionLayer, locator *Locator, host string, port uint16, handler TargetHandler) *StatefulProxy {
+	sp := &StatefulProxy{
+		transactions: transactions,
+		stateless:    NewStatelessProxy(transactions.GetTransport(), locator, host, port),
+		handler:      handler,
+		recordRoute:  true,
+		timerC:       proxyTimerC,
+		contexts:     make(map[string]*proxyContext),
+	}
+	transactions.SetHandler(sp.Handle)
+	transactions.SetStrayHandler(sp.stateless.Handle)
+	return sp
+}
+
+// Len returns the number of response contexts without a final response
+func (sp *StatefulProxy) Len() int {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return len(sp.contexts)
+}
+
+// Handle is the RequestHandler of the transactions of the proxy
+func (sp *StatefulProxy) Handle(sm *SipMsg, source *Source, st *ServerTransaction) {
+	ctx := context.Background()
+	if st == nil {
+		// the ACK of a 2xx is end to end
+		sp.stateless.Forward(ctx, sm, source)
+		return
+	}
+	if strings.EqualFold(sm.GetRequestLine().GetMethod(), "CANCEL") {
+		key, _ := transactionMethodKey(sm, "INVITE")
+		sp.mutex.Lock()
+		pc := sp.contexts[key]
+		sp.mutex.Unlock()
+		if pc != nil {
+			st.Respond(proxyResponse(sm, 200, ""))
+			sp.cancel(ctx, pc, true)
+			return
+		}
+		// RFC 3261 16.10 forwards a CANCEL matching no response context statelessly,
+		// it is forwarded to its Request-URI in a transaction here so that its server transaction is answered
+	}
+	sp.forward(ctx, sm, st)
+}
+
+// forward processes a request received in st by RFC 3261 16.3-16.6 and forks it to its targets
+func (sp *StatefulProxy) forward(ctx context.Context, sm *SipMsg, st *ServerTransaction) {
+	request, err := sm.Clone()
+	if err != nil {
+		return
+	}
+	host, port := sp.GetHost(), sp.GetPort()
+	loop := proxyLoop(request)
+	if err := proxyMaxForwards(request); err != nil {
+		sp.reject(st, err)
+		return
+	}
+	if proxyLooped(request, host, port, loop) {
+		sp.reject(st, NewStatusError(482, ""))
+		return
+	}
+	proxyPreprocess(request, host, port)
+	groups, err := sp.targets(request)
+	if err != nil {
+		sp.reject(st, err)
+		return
+	}
+	pc := &proxyContext{
+		st:      st,
+		request: request,
+		invite:  strings.EqualFold(request.GetRequestLine().GetMethod(), "INVITE"),
+		loop:    loop,
+		groups:  groups,
+	}
+	sp.mutex.Lock()
+	sp.contexts[st.GetKey()] = pc
+	sp.mutex.Unlock()
+	sp.next(ctx, pc)
+}
+
+// reject answers a request the proxy does not forward with the status code of err,500 when it is not a StatusError
+func (sp *StatefulProxy) reject(st *ServerTransaction, err error) {
+	statusError, ok := err.(*StatusError)
+	if !ok {
+		statusError = NewStatusError(500, "")
+	}
+	st.Respond(proxyResponse(st.GetRequest(), statusError.GetStatusCode(), statusError.GetReasonPhrase()))
+}
+
+// targets returns the target set of a request in groups of the same q,from the highest q to the lowest.
+// The Request-URI is the only target of a request with a Route after preprocessing,of a request within a dialog,
+// and by RFC 3261 16.5 of a Request-URI with an maddr parameter or of a domain the proxy is not responsible for.
+func (sp *StatefulProxy) targets(sm *SipMsg) ([][]*RequestUri, error) {
+	requestUri := [][]*RequestUri{{sm.GetRequestLine().GetUri()}}
+	handler := sp.GetHandler()
+	if handler == nil || len(proxyRoutes(sm)) > 0 || (sm.GetTo() != nil && len(sm.GetTo().GetTag()) > 0) ||
+		!sp.responsible(sm.GetRequestLine().GetUri()) {
+		return requestUri, nil
+	}
+	contacts, err := handler(sm)
+	if err != nil {
+		return nil, err
+	}
+	var qs []float64
+	byQ := make(map[float64][]*RequestUri)
+	for _, contact := range contacts {
+		uri := dialogTarget(contact)
+		if uri == nil {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(contact.GetQ()), 64)
+		if err != nil {
+			q = 1
+		}
+		if _, ok := byQ[q]; !ok {
+			qs = append(qs, q)
+		}
+		byQ[q] = append(byQ[q], uri)
+	}
+	if len(qs) == 0 {
+		return requestUri, nil
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(qs)))
+	groups := make([][]*RequestUri, 0, len(qs))
+	for _, q := range qs {
+		groups = append(groups, byQ[q])
+	}
+	return groups, nil
+}
+
+// responsible reports whether the proxy determines the targets of a Request-URI without an maddr parameter,
+// one of its own host or of its domains
+func (sp *StatefulProxy) responsible(requestUri *RequestUri) bool {
+	if requestUri == nil || requestUri.GetSipUri() == nil {
+		return false
+	}
+	sipUri := requestUri.GetSipUri()
+	if sipUri.GetParameters() != nil && len(strings.TrimSpace(sipUri.GetParameters().GetMaddr())) > 0 {
+		return false
+	}
+	if proxyLocal(sipUri.GetHostPort(), sp.GetHost(), sp.GetPort()) {
+		return true
+	}
+	// a domain has no port
+	host := registrarHost(sipUri.GetHostPort())
+	for _, domain := range sp.GetDomains() {
+		if proxyHost(host, 0, domain, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// next forks the request of pc to its next group of targets
+func (sp *StatefulProxy) next(ctx context.Context, pc *proxyContext) {
+	pc.mutex.Lock()
+	if pc.final || pc.canceled || len(pc.groups) == 0 {
+		pc.mutex.Unlock()
+		return
+	}
+	group := pc.groups[0]
+	pc.groups = pc.groups[1:]
+	branches := make([]*proxyBranch, 0, len(group))
+	for range group {
+		branch := new(proxyBranch)
+		branches = append(branches, branch)
+		pc.branches = append(pc.branches, branch)
+	}
+	pc.mutex.Unlock()
+	for i, uri := range group {
+		if err := sp.fork(ctx, pc, branches[i], uri); err != nil {
+			// the branch fails as if its transaction received a 503,or the StatusError of fork
+			code := uint(503)
+			if statusError, ok := err.(*StatusError); ok {
+				code = statusError.GetStatusCode()
+			}
+			sp.process(ctx, pc, branches[i], proxyResponse(pc.st.GetRequest(), code, ""))
+		}
+	}
+}
+
+// fork sends a copy of the request of pc to uri in a new client transaction by RFC 3261 16.6,
+// a StatusError 480 is returned when uri has no target and 487 when a final response is sent or the request is canceled meanwhile
+func (sp *StatefulProxy) fork(ctx context.Context, pc *proxyContext, branch *proxyBranch, uri *RequestUri) error {
+	request, err := pc.request.Clone()
+	if err != nil {
+		return err
+	}
+	host, port := sp.GetHost(), sp.GetPort()
+	request.GetRequestLine().SetUri(uri)
+	if sp.GetRecordRoute() && proxyDialog(request) {
+		request.PushRecordRoute(proxyRecordRoute(host, port))
+	}
+	targets, err := sp.GetLocator().Locate(ctx, proxyNextHop(request))
+	if err != nil {
+		return err
+	}
+	// a target of no next hop fails its branch with 480 by RFC 3261 16.5
+	if len(targets) == 0 {
+		return NewStatusError(480, "")
+	}
+	target := targets[0]
+	request.PushVia(NewVia("SIP", 2.0, target.GetTransport(), host, port, 0, "", "", GenUnixNanoBranch()+"."+pc.loop, 0, "", nil))
+	pc.mutex.Lock()
+	if pc.final || pc.canceled {
+		pc.mutex.Unlock()
+		return NewStatusError(487, "")
+	}
+	branch.request, branch.target = request, target
+	sp.startTimerC(ctx, pc, branch)
+	pc.mutex.Unlock()
+	_, err = sp.transactions.Request(ctx, request, target, func(sm *SipMsg, ct *ClientTransaction) {
+		sp.receive(ctx, pc, branch, sm)
+	})
+	return err
+}
+
+// receive handles a response of a branch,the Via of the proxy is removed
+func (sp *StatefulProxy) receive(ctx context.Context, pc *proxyContext, branch *proxyBranch, sm *SipMsg) {
+	response, err := sm.Clone()
+	if err != nil {
+		return
+	}
+	response.PopVia()
+	sp.process(ctx, pc, branch, response)
+}
+
+// process handles the response of a branch by RFC 3261 16.7,the response goes to the server transaction as it is
+func (sp *StatefulProxy) process(ctx context.Context, pc *proxyContext, branch *proxyBranch, response *SipMsg) {
+	code := response.GetStatusLine().GetStatusCode()
+	var forward *SipMsg
+	var cancels []*proxyBranch
+	next, best := false, false
+	pc.mutex.Lock()
+	switch {
+	case code < 200:
+		if branch.done {
+			break
+		}
+		branch.provisional = true
+		sp.startTimerC(ctx, pc, branch)
+		if branch.cancel && !branch.canceled {
+			branch.canceled = true
+			cancels = append(cancels, branch)
+		}
+		if code != 100 && !pc.final {
+			forward = response
+		}
+	case code < 300:
+		branch.done = true
+		transactionStop(branch.timerC)
+		// every 2xx of an INVITE is forwarded,the UAC acknowledges each dialog
+		if !pc.final || pc.invite {
+			forward = response
+		}
+		if !pc.final {
+			pc.final = true
+			cancels = pc.pending()
+		}
+	default:
+		if branch.done {
+			break
+		}
+		branch.done = true
+		transactionStop(branch.timerC)
+		if pc.final {
+			break
+		}
+		pc.responses = append(pc.responses, response)
+		if code >= 600 {
+			pc.canceled = true
+			cancels = pc.pending()
+		}
+		if pc.complete() {
+			if len(pc.groups) > 0 && !pc.canceled {
+				next = true
+			} else {
+				pc.final = true
+				best = true
+			}
+		}
+	}
+	final := pc.final
+	pc.mutex.Unlock()
+	if final {
+		sp.remove(pc)
+	}
+	if forward != nil {
+		pc.st.Respond(forward)
+	}
+	for _, branch := range cancels {
+		sp.send(ctx, branch)
+	}
+	if next {
+		sp.next(ctx, pc)
+	}
+	if best {
+		pc.st.Respond(pc.best())
+	}
+}
+
+// startTimerC starts Timer C of a branch of an INVITE again,the caller holds the mutex
+func (sp *StatefulProxy) startTimerC(ctx context.Context, pc *proxyContext, branch *proxyBranch) {
+	if !pc.invite {
+		return
+	}
+	transactionStop(branch.timerC)
+	branch.timerC = sp.transactions.GetClock().AfterFunc(sp.GetTimerC(), func() {
+		sp.timeout(ctx, pc, branch)
+	})
+}
+
+// timeout handles Timer C of a branch by RFC 3261 16.8,a branch with a provisional response is canceled
+// and Timer C is started again,a branch without one or already canceled fails as if it received a 408
+func (sp *StatefulProxy) timeout(ctx context.Context, pc *proxyContext, branch *proxyBranch) {
+	pc.mutex.Lock()
+	if branch.done {
+		pc.mutex.Unlock()
+		return
+	}
+	if !branch.provisional || branch.canceled {
+		pc.mutex.Unlock()
+		sp.process(ctx, pc, branch, proxyResponse(pc.st.GetRequest(), 408, ""))
+		return
+	}
+	branch.canceled = true
+	sp.startTimerC(ctx, pc, branch)
+	pc.mutex.Unlock()
+	sp.send(ctx, branch)
+}
+
+// cancel cancels the pending branches of pc,no new branch is created.
+// upstream is true for the CANCEL of the request of pc.
+func (sp *StatefulProxy) cancel(ctx context.Context, pc *proxyContext, upstream bool) {
+	pc.mutex.Lock()
+	pc.canceled = pc.canceled || upstream
+	cancels := pc.pending()
+	pc.mutex.Unlock()
+	for _, branch := range cancels {
+		sp.send(ctx, branch)
+	}
+}
+
+// remove takes pc out of the response contexts,a CANCEL no longer matches it
+func (sp *StatefulProxy) remove(pc *proxyContext) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if sp.contexts[pc.st.GetKey()] == pc {
+		delete(sp.contexts, pc.st.GetKey())
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-9.1
+//
+// 9.1 Client Behavior
+//
+// The Request-URI, Call-ID, To, the numeric part of CSeq, and From
+// header fields in the CANCEL request MUST be identical to those in the
+// request being cancelled, including tags.  A CANCEL constructed by a
+// client MUST have only a single Via header field value matching the
+// top Via value in the request being cancelled.
+//
+// If the request being cancelled contains a Route header field, the
+// CANCEL request MUST include that Route header field's values.
+//
+// If no provisional response has been received, the CANCEL request MUST
+// NOT be sent; rather, the client MUST wait for the arrival of a
+// provisional response before sending the request.
+
+// send sends the CANCEL of a branch to the target of its request
+func (sp *StatefulProxy) send(ctx context.Context, branch *proxyBranch) {
+	request := branch.request
+	if request == nil {
+		return
+	}
+	requestLine := request.GetRequestLine()
+	cancel := new(SipMsg)
+	cancel.SetRequestLine(NewRequestLine("CANCEL", requestLine.GetUri(), requestLine.GetSchema(), requestLine.GetVersion()))
+	cancel.SetVia(request.GetVia())
+	cancel.SetRoutes(request.GetRoutes())
+	cancel.SetMaxForwards(NewMaxForwards(70))
+	cancel.SetFrom(request.GetFrom())
+	cancel.SetTo(request.GetTo())
+	cancel.SetCallID(request.GetCallID())
+	cancel.SetCSeq(NewCSeq(request.GetCSeq().GetNumber(), "CANCEL"))
+	cancel.SetContentLength(NewContentLength(0))
+	sp.transactions.Request(ctx, cancel, branch.target, nil)
+}
+
+// pending returns the branches of an INVITE to be canceled now,a branch without a provisional response
+// is canceled when it gets one. The caller holds the mutex.
+func (pc *proxyContext) pending() []*proxyBranch {
+	if !pc.invite {
+		return nil
+	}
+	var cancels []*proxyBranch
+	for _, branch := range pc.branches {
+		switch {
+		case branch.done || branch.canceled:
+		case branch.provisional:
+			branch.canceled = true
+			cancels = append(cancels, branch)
+		default:
+			branch.cancel = true
+		}
+	}
+	return cancels
+}
+
+// complete reports whether every branch has a final response,the caller holds the mutex
+func (pc *proxyContext) complete() bool {
+	for _, branch := range pc.branches {
+		if !branch.done {
+			return false
+		}
+	}
+	return true
+}
+
+// best returns the best final response of pc by RFC 3261 16.7 items 6 and 7
+func (pc *proxyContext) best() *SipMsg {
+	pc.mutex.Lock()
+	responses := pc.responses
+	pc.mutex.Unlock()
+	if len(responses) == 0 {
+		return proxyResponse(pc.st.GetRequest(), 408, "")
+	}
+	best := responses[0]
+	for _, response := range responses[1:] {
+		if proxyBetter(response.GetStatusLine().GetStatusCode(), best.GetStatusLine().GetStatusCode()) {
+			best = response
+		}
+	}
+	code := best.GetStatusLine().GetStatusCode()
+	if code == 503 {
+		return proxyResponse(pc.st.GetRequest(), 500, "")
+	}
+	if code != 401 && code != 407 {
+		return best
+	}
+	selected := best
+	best, err := selected.Clone()
+	if err != nil {
+		return proxyResponse(pc.st.GetRequest(), 500, "")
+	}
+	for _, response := range responses {
+		if response == selected || (response.GetStatusLine().GetStatusCode() != 401 && response.GetStatusLine().GetStatusCode() != 407) {
+			continue
+		}
+		for _, wwwAuthenticate := range response.GetWWWAuthenticates() {
+			best.AddWWWAuthenticate(wwwAuthenticate)
+		}
+		for _, value := range response.GetGenericHeaders().Values("Proxy-Authenticate") {
+			best.GetGenericHeaders().Add("Proxy-Authenticate", value)
+		}
+	}
+	return best
+}
+
+// proxyBetter reports whether the status code a is a better final response than b,
+// a 6xx first,then the lowest class,in the 4xx class the ones affecting resubmission of the request
+func proxyBetter(a, b uint) bool {
+	if a/100 == 6 || b/100 == 6 {
+		return a/100 == 6 && b/100 != 6
+	}
+	if a/100 != b/100 {
+		return a/100 < b/100
+	}
+	return a/100 == 4 && proxyResubmission(a) && !proxyResubmission(b)
+}
+
+// proxyResubmission reports whether a 4xx gives information affecting resubmission of the request
+func proxyResubmission(code uint) bool {
+	switch code {
+	case 401, 407, 415, 420, 484:
+		return true
+	}
+	return false
+}
+
+// proxyDialog reports whether a request creates a dialog,an INVITE,SUBSCRIBE or REFER outside of a dialog
+func proxyDialog(sm *SipMsg) bool {
+	switch strings.ToUpper(sm.GetRequestLine().GetMethod()) {
+	case "INVITE", "SUBSCRIBE", "REFER":
+		return sm.GetTo() == nil || len(strings.TrimSpace(sm.GetTo().GetTag())) == 0
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statefulProxyTest returns a StatefulProxy at 192.168.0.10:5060 of the domain 3402000000 forking to contacts on a recording transport
+func statefulProxyTest(t *testing.T, contacts ...string) (*StatefulProxy, *TransactionLayer, *proxyTransport, *ManualClock) {
+	pt := &proxyTransport{transactionTransport: &transactionTransport{transport: "UDP"}}
+	clock := NewManualClock(time.Unix(0, 0))
+	tl := NewTransactionLayer(NewTransportLayer(pt), nil)
+	tl.SetClock(clock)
+	var targets []*Contact
+	for _, raw := range contacts {
+		contact := new(Contact)
+		if err := contact.Parse("Contact: " + raw); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, contact)
+	}
+	sp := NewStatefulProxy(tl, NewLocator(nil), "192.168.0.10", 5060, func(sm *SipMsg) ([]*Contact, error) {
+		return targets, nil
+	})
+	sp.SetDomains("3402000000")
+	return sp, tl, pt, clock
+}
+
+// statefulProxySent returns the requests sent downstream by the host of their Request-URI,
+// and the first lines of the responses sent upstream
+func statefulProxySent(t *testing.T, pt *proxyTransport) (map[string]*SipMsg, []string) {
+	requests := make(map[string]*SipMsg)
+	var lines []string
+	for _, raw := range pt.take() {
+		sm := transactionParse(t, raw)
+		if sm.GetStatusLine() != nil {
+			lines = append(lines, raw[:strings.Index(raw, "\r\n")])
+			continue
+		}
+		requests[sm.GetRequestLine().GetMethod()+" "+sm.GetRequestLine().GetUri().GetSipUri().GetHostPort().GetIPv4().String()] = sm
+	}
+	return requests, lines
+}
+
+func TestStatefulProxy_Fork(t *testing.T) {
+	sp, tl, pt, _ := statefulProxyTest(t, "<sip:34020000001320000001@192.168.0.21>", "<sip:34020000001320000001@192.168.0.22>")
+	tl.Handle(transactionParse(t, transactionInvite), nil)
+	requests, _ := statefulProxySent(t, pt)
+	first, second := requests["INVITE 192.168.0.21"], requests["INVITE 192.168.0.22"]
+	if first == nil || second == nil {
+		t.Fatal("INVITE not forked", requests)
+	}
+	recordRoute := first.GetRecordRoutes()[0].Raw()
+	fmt.Print(recordRoute.String())
+	if recordRoute.String() != "Record-Route: <sip:192.168.0.10:5060;lr>\r\n" || first.GetMaxForwards().GetForwards() != 69 || len(first.GetVias()) != 2 {
+		t.Error("forked INVITE mismatch")
+	}
+	if first.GetVia().GetBranch() == second.GetVia().GetBranch() || sp.Len() != 1 {
+		t.Error("branches mismatch")
+	}
+	// a provisional response is forwarded at once,a 2xx cancels the other branch
+	tl.Handle(transactionResponse(first, 180), nil)
+	tl.Handle(transactionResponse(second, 200), nil)
+	requests, lines := statefulProxySent(t, pt)
+	if fmt.Sprint(lines) != "[SIP/2.0 180 Ringing SIP/2.0 200 OK]" {
+		t.Error("forwarded responses mismatch", lines)
+	}
+	cancel := requests["CANCEL 192.168.0.21"]
+	if cancel == nil || cancel.GetVia().GetBranch() != first.GetVia().GetBranch() || len(cancel.GetVias()) != 1 {
+		t.Fatal("branch not canceled", requests)
+	}
+	// the 487 of the canceled branch is not forwarded,a 2xx of the other branch is
+	tl.Handle(transactionResponse(first, 487), nil)
+	if _, lines := statefulProxySent(t, pt); len(lines) != 0 {
+		t.Error("response after the 2xx forwarded", lines)
+	}
+	tl.Handle(transactionResponse(second, 200), nil)
+	if _, lines := statefulProxySent(t, pt); fmt.Sprint(lines) != "[SIP/2.0 200 OK]" || sp.Len() != 0 {
+		t.Error("retransmission of the 2xx not forwarded", lines)
+	}
+}
+
+func TestStatefulProxy_Sequential(t *testing.T) {
+	_, tl, pt, _ := statefulProxyTest(t, "<sip:34020000001320000001@192.168.0.21>;q=0.5", "<sip:34020000001320000001@192.168.0.22>;q=1.0")
+	tl.Handle(transactionParse(t, transactionInvite), nil)
+	requests, _ := statefulProxySent(t, pt)
+	second := requests["INVITE 192.168.0.22"]
+	if len(requests) != 1 || second == nil {
+		t.Fatal("highest q not tried first", requests)
+	}
+	tl.Handle(transactionResponse(second, 486), nil)
+	requests, lines := statefulProxySent(t, pt)
+	first := requests["INVITE 192.168.0.21"]
+	if first == nil || len(lines) != 0 {
+		t.Fatal("next target not tried", requests, lines)
+	}
+	tl.Handle(transactionResponse(first, 503), nil)
+	if _, lines := statefulProxySent(t, pt); fmt.Sprint(lines) != "[SIP/2.0 486 Busy Here]" {
+		t.Error("best response mismatch", lines)
+	}
+}
+
+func TestStatefulProxy_Challenge(t *testing.T) {
+	_, tl, pt, _ := statefulProxyTest(t, "<sip:34020000001320000001@192.168.0.21>", "<sip:34020000001320000001@192.168.0.22>", "<sip:34020000001320000001@192.168.0.23>")
+	register := strings.Replace(strings.Replace(transactionInvite, "INVITE sip", "REGISTER sip", 1), "1 INVITE", "1 REGISTER", 1)
+	tl.Handle(transactionParse(t, register), nil)
+	requests, _ := statefulProxySent(t, pt)
+	if len(requests) != 3 || requests["REGISTER 192.168.0.21"].GetRecordRoutes() != nil {
+		t.Fatal("REGISTER not forked", requests)
+	}
+	unauthorized := transactionResponse(requests["REGISTER 192.168.0.21"], 401)
+	wwwAuthenticate := new(WWWAuthenticate)
+	if err := wwwAuthenticate.Parse(`WWW-Authenticate: Digest realm="3402000000",nonce="9bd055"`); err != nil {
+		t.Fatal(err)
+	}
+	unauthorized.SetWWWAuthenticate(wwwAuthenticate)
+	required := transactionResponse(requests["REGISTER 192.168.0.22"], 407)
+	required.GetGenericHeaders().Add("Proxy-Authenticate", `Digest realm="3402000001", nonce="5a2f1c"`)
+	tl.Handle(transactionResponse(requests["REGISTER 192.168.0.23"], 503), nil)
+	tl.Handle(unauthorized, nil)
+	tl.Handle(required, nil)
+	sent := pt.take()
+	if len(sent) != 1 {
+		t.Fatal("best response mismatch", sent)
+	}
+	fmt.Print(sent[0])
+	best := transactionParse(t, sent[0])
+	if best.GetStatusLine().GetStatusCode() != 401 || len(best.GetWWWAuthenticates()) != 1 || len(best.GetVias()) != 1 ||
+		fmt.Sprint(best.GetGenericHeaders().Values("Proxy-Authenticate")) != `[Digest realm="3402000001", nonce="5a2f1c"]` {
+		t.Error("challenges not aggregated")
+	}
+}
+
+func TestStatefulProxy_Cancel(t *testing.T) {
+	sp, tl, pt, _ := statefulProxyTest(t, "<sip:34020000001320000001@192.168.0.21>")
+	tl.Handle(transactionParse(t, transactionInvite), nil)
+	requests, _ := statefulProxySent(t, pt)
+	invite := requests["INVITE 192.168.0.21"]
+	cancel := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "1 CANCEL", 1))
+	cancel.GetRequestLine().SetMethod("CANCEL")
+	tl.Handle(cancel, nil)
+	// the branch is canceled once it gets a provisional response
+	requests, lines := statefulProxySent(t, pt)
+	if fmt.Sprint(lines) != "[SIP/2.0 200 OK]" || len(requests) != 0 {
+		t.Error("CANCEL mismatch", requests, lines)
+	}
+	tl.Handle(transactionResponse(invite, 180), nil)
+	requests, _ = statefulProxySent(t, pt)
+	if requests["CANCEL 192.168.0.21"] == nil {
+		t.Fatal("branch not canceled on its provisional response", requests)
+	}
+	tl.Handle(transactionResponse(invite, 487), nil)
+	if _, lines := statefulProxySent(t, pt); fmt.Sprint(lines) != "[SIP/2.0 487 Request Terminated]" || sp.Len() != 0 {
+		t.Error("487 not forwarded", lines)
+	}
+}
+
+func TestStatefulProxy_NoTarget(t *testing.T) {
+	sp, tl, pt, _ := statefulProxyTest(t, "<sip:34020000001320000001@nowhere.example.com:5060>")
+	sp.GetLocator().SetClient(proxyDNSClient{})
+	tl.Handle(transactionParse(t, transactionInvite), nil)
+	// the branch of no target fails with 480,the best response of the only branch
+	if requests, lines := statefulProxySent(t, pt); len(requests) != 0 || fmt.Sprint(lines) != "[SIP/2.0 480 Temporarily not available]" {
+		t.Error("480 mismatch", requests, lines)
+	}
+}
+
+func TestStatefulProxy_TimerC(t *testing.T) {
+	sp, tl, pt, clock := statefulProxyTest(t, "<sip:34020000001320000001@192.168.0.21>")
+	sp.SetTimerC(3 * time.Minute)
+	tl.Handle(transactionParse(t, transactionInvite), nil)
+	requests, _ := statefulProxySent(t, pt)
+	invite := requests["INVITE 192.168.0.21"]
+	tl.Handle(transactionResponse(invite, 183), nil)
+	// Timer C cancels a branch with a provisional response,and fails it when it fires again
+	clock.Advance(3 * time.Minute)
+	requests, _ = statefulProxySent(t, pt)
+	if requests["CANCEL 192.168.0.21"] == nil {
+		t.Fatal("branch not canceled by Timer C", requests)
+	}
+	clock.Advance(3 * time.Minute)
+	if _, lines := statefulProxySent(t, pt); fmt.Sprint(lines) != "[SIP/2.0 408 Request Timeout]" {
+		t.Error("Timer C mismatch", lines)
+	}
+}
+
+func TestStatefulProxy_Targets(t *testing.T) {
+	sp, _, _, _ := statefulProxyTest(t, "<sip:34020000001320000001@192.168.0.21;transport=tcp;ob>")
+	// the handler determines the targets of an out-of-dialog request to a domain of the proxy only
+	tests := []struct {
+		from, to string
+		target   string
+	}{
+		{"", "", "sip:34020000001320000001@192.168.0.21;transport=tcp;ob"},
+		{"sip:34020000001320000001@3402000000", "sip:34020000001320000001@192.168.0.10", "sip:34020000001320000001@192.168.0.21;transport=tcp;ob"},
+		{"sip:34020000001320000001@3402000000", "sip:34020000001320000001@3402000000;maddr=192.168.0.30", "sip:34020000001320000001@3402000000;maddr=192.168.0.30"},
+		{"sip:34020000001320000001@3402000000", "sip:34020000001320000001@4401000000", "sip:34020000001320000001@4401000000"},
+		{"To: <sip:34020000001320000001@3402000000>", "To: <sip:34020000001320000001@3402000000>;tag=776", "sip:34020000001320000001@3402000000"},
+	}
+	for _, test := range tests {
+		sm := transactionParse(t, strings.Replace(transactionInvite, test.from, test.to, 1))
+		groups, err := sp.targets(sm)
+		if err != nil || len(groups) != 1 || len(groups[0]) != 1 {
+			t.Fatal("targets mismatch", test.to, err)
+		}
+		if target := groups[0][0].Raw(); target.String() != test.target {
+			t.Error("target mismatch", test.to, target.String())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package sip
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.11
+//
+// 16.11 Stateless Proxy
+//
+// When acting statelessly, a proxy is a simple message forwarder.  Much
+// of the processing performed when acting statelessly is the same as
+// when behaving statefully.  The differences are detailed here.
+//
+// A stateless proxy does not have any notion of a transaction, or of
+// the response context used to describe stateful proxy behavior.
+// Instead, the stateless proxy takes messages, both requests and
+// responses, directly from the transport layer (See section 18).  As a
+// result, stateless proxies do not retransmit messages on their own.
+// They do, however, forward all retransmissions they receive (they do
+// not have the ability to distinguish a retransmission from the
+// original message).
+//
+// A stateless proxy MUST choose one and only one target from the target
+// set.  This choice MUST only rely on fields in the message and time-
+// invariant properties of the server.  In particular, a retransmitted
+// request MUST be forwarded to the same destination each time it is
+// processed.
+//
+// The stateless proxy MAY use any technique it likes to guarantee
+// uniqueness of its branch IDs across transactions.  However, the
+// following procedure is RECOMMENDED.  The proxy examines the
+// branch ID in the topmost Via header field of the received request.
+// If it begins with the magic cookie, the first component of the branch
+// ID of the outgoing request is computed as a hash of the received
+// branch ID.  Otherwise, the first component of the branch ID is
+// computed as a hash of the topmost Via, the tag in the To header
+// field, the tag in the From header field, the Call-ID header field,
+// the CSeq number (but not method), and the Request-URI from the
+// received request.  One of these fields will always vary across two
+// different transactions.
+//
+// Response processing as described in Section 16.7 does not apply to a
+// proxy behaving statelessly.  When a response arrives at a stateless
+// proxy, the proxy MUST inspect the sent-by value in the first
+// (topmost) Via header field value.  If that address matches the proxy,
+// (it equals a value this proxy has inserted into previous requests)
+// the proxy MUST remove that header field value from the response and
+// forward the result to the location indicated in the next Via header
+// field value.  The proxy MUST NOT add to, modify, or remove the
+// message body.  Unless specified otherwise, the proxy MUST NOT remove
+// any other header field values.  If the address does not match the
+// proxy, the message MUST be silently discarded.
+
+// StatelessProxy forwards each request to its next hop and each response to the previous hop by RFC 3261 16.11,
+// it keeps no state and forwards every retransmission it receives. The proxy is addressed by host:port,
+// the sent-by of the Via it pushes,a Route value or a Request-URI of that address is its own.
+type StatelessProxy struct {
+	transports *TransportLayer
+	locator    *Locator // locates the next hop of a request
+	host       string
+	port       uint16
+	mutex      sync.Mutex
+}
+
+func (sp *StatelessProxy) GetTransports() *TransportLayer {
+	return sp.transports
+}
+func (sp *StatelessProxy) GetLocator() *Locator {
+	return sp.locator
+}
+func (sp *StatelessProxy) GetHost() string {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.host
+}
+
+// SetPort sets the port of the proxy,example: the port a transport listening on port 0 gets
+func (sp *StatelessProxy) SetPort(port uint16) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.port = port
+}
+func (sp *StatelessProxy) GetPort() uint16 {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.port
+}
+
+// NewStatelessProxy returns a StatelessProxy at host:port sending on transports,locator finds the next hop of a request
+func NewStatelessProxy(transports *TransportLayer, locator *Locator, host string, port uint16) *StatelessProxy {
+	return &StatelessProxy{
+		transports: transports,
+		locator:    locator,
+		host:       host,
+		port:       port,
+	}
+}
+
+// Handle is the Handler of the transports of the proxy,the error of Forward is dropped
+func (sp *StatelessProxy) Handle(sm *SipMsg, source *Source) {
+	sp.Forward(context.Background(), sm, source)
+}
+
+// Forward forwards a request received from source to its next hop,or a response to the address of its next Via.
+// A StatusError 483,482 or 480 is returned when a request is answered by the proxy instead,
+// a response whose top Via is not of the proxy is discarded.
+func (sp *StatelessProxy) Forward(ctx context.Context, sm *SipMsg, source *Source) error {
+	if sm.GetStatusLine() != nil {
+		return sp.response(ctx, sm)
+	}
+	if sm.GetRequestLine() == nil || sm.GetVia() == nil {
+		raw := sm.GetSource()
+		return NewParseError("Via", raw, 0, "a request forwarded by a proxy has a Via")
+	}
+	host, port := sp.GetHost(), sp.GetPort()
+	loop := proxyLoop(sm)
+	branch := sp.branch(sm, loop)
+	if err := proxyMaxForwards(sm); err != nil {
+		return sp.reject(ctx, sm, source, err)
+	}
+	if proxyLooped(sm, host, port, loop) {
+		return sp.reject(ctx, sm, source, NewStatusError(482, ""))
+	}
+	proxyPreprocess(sm, host, port)
+	uri := proxyNextHop(sm)
+	targets, err := sp.locator.Locate(ctx, uri)
+	if err != nil {
+		return err
+	}
+	// a next hop of no target is answered with 480 by RFC 3261 16.5
+	if len(targets) == 0 {
+		return sp.reject(ctx, sm, source, NewStatusError(480, ""))
+	}
+	// the first target only,a retransmission goes to the same one
+	target := targets[0]
+	sm.PushVia(NewVia("SIP", 2.0, target.GetTransport(), host, port, 0, "", "", branch, 0, "", nil))
+	return sp.transports.Send(ctx, sm, target)
+}
+
+// response forwards a response to the address of its next Via after removing the Via of the proxy
+func (sp *StatelessProxy) response(ctx context.Context, sm *SipMsg) error {
+	via := sm.GetVia()
+	if via == nil || !proxyHost(via.GetHost(), via.GetPort(), sp.GetHost(), sp.GetPort()) {
+		return nil
+	}
+	sm.PopVia()
+	if sm.GetVia() == nil {
+		return nil
+	}
+	return sp.transports.Respond(ctx, sm, nil)
+}
+
+// reject answers a request the proxy does not forward with the status code of err,an ACK is dropped
+func (sp *StatelessProxy) reject(ctx context.Context, sm *SipMsg, source *Source, err error) error {
+	statusError, ok := err.(*StatusError)
+	if !ok || strings.EqualFold(sm.GetRequestLine().GetMethod(), "ACK") {
+		return err
+	}
+	response := proxyResponse(sm, statusError.GetStatusCode(), statusError.GetReasonPhrase())
+	if respondErr := sp.transports.Respond(ctx, response, source); respondErr != nil {
+		return respondErr
+	}
+	return err
+}
+
+// branch returns the branch of the Via the proxy pushes on a received request by RFC 3261 16.11,
+// a hash of the branch of its top Via followed by the loop detection component
+func (sp *StatelessProxy) branch(sm *SipMsg, loop string) string {
+	via := sm.GetVia()
+	first := ""
+	if branch := via.GetBranch(); strings.HasPrefix(branch, "z9hG4bK") {
+		first = proxyHash(branch)
+	} else {
+		// the loop detection component covers the To tag,the From tag,the Call-ID,the CSeq number and the Request-URI
+		raw := via.Raw()
+		first = proxyHash(raw.String(), loop)
+	}
+	return "z9hG4bK" + first + "." + loop
+}
@@ -0,0 +1,153 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyTransport is a transactionTransport that also records the targets of the messages sent on it
+type proxyTransport struct {
+	*transactionTransport
+	targets []string
+}
+
+func (pt *proxyTransport) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	pt.mutex.Lock()
+	pt.targets = append(pt.targets, target.String())
+	pt.mutex.Unlock()
+	return pt.transactionTransport.Send(ctx, sm, target)
+}
+
+// proxyDNSClient is a DNSClient of no records
+type proxyDNSClient struct{}
+
+func (proxyDNSClient) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	return nil, nil
+}
+func (proxyDNSClient) LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	return nil, nil
+}
+func (proxyDNSClient) LookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	return nil, nil
+}
+
+// statelessProxyTest returns a StatelessProxy at 192.168.0.10:5060 on a recording transport
+func statelessProxyTest() (*StatelessProxy, *proxyTransport) {
+	pt := &proxyTransport{transactionTransport: &transactionTransport{transport: "UDP"}}
+	return NewStatelessProxy(NewTransportLayer(pt), NewLocator(nil), "192.168.0.10", 5060), pt
+}
+
+// statelessProxyRoute returns transactionInvite with the Route header field route
+func statelessProxyRoute(t *testing.T, route string) *SipMsg {
+	return transactionParse(t, strings.Replace(transactionInvite, "Max-Forwards: ", route+"\r\nMax-Forwards: ", 1))
+}
+
+func TestStatelessProxy_Forward(t *testing.T) {
+	sp, pt := statelessProxyTest()
+	route := "Route: <sip:192.168.0.10;lr>, <sip:192.168.0.20;lr>"
+	if err := sp.Forward(context.Background(), statelessProxyRoute(t, route), nil); err != nil {
+		t.Fatal(err)
+	}
+	sent := pt.take()
+	fmt.Print(sent[0])
+	forwarded := transactionParse(t, sent[0])
+	routeRaw := forwarded.GetRoute().Raw()
+	if routeRaw.String() != "Route: <sip:192.168.0.20;lr>\r\n" || forwarded.GetMaxForwards().GetForwards() != 69 || len(forwarded.GetVias()) != 2 {
+		t.Error("forwarded request mismatch")
+	}
+	if via := forwarded.GetVia(); via.GetHost() != "192.168.0.10" || !strings.HasPrefix(via.GetBranch(), "z9hG4bK") {
+		t.Error("Via of the proxy mismatch")
+	}
+	if fmt.Sprint(pt.targets) != "[UDP 192.168.0.20:5060]" {
+		t.Error("next hop mismatch", pt.targets)
+	}
+	// a retransmission and the CANCEL of the INVITE get the same branch
+	sp.Forward(context.Background(), statelessProxyRoute(t, route), nil)
+	cancel := statelessProxyRoute(t, route)
+	cancel.GetRequestLine().SetMethod("CANCEL")
+	cancel.GetCSeq().SetMethod("CANCEL")
+	sp.Forward(context.Background(), cancel, nil)
+	for _, raw := range pt.take() {
+		if transactionParse(t, raw).GetVia().GetBranch() != forwarded.GetVia().GetBranch() {
+			t.Error("branch of a retransmission mismatch")
+		}
+	}
+	// the response goes back to the previous hop without the Via of the proxy
+	if err := sp.Forward(context.Background(), NewResponse(forwarded, 200, ""), nil); err != nil {
+		t.Fatal(err)
+	}
+	sent = pt.take()
+	if len(sent) != 1 || len(transactionParse(t, sent[0]).GetVias()) != 1 || transactionParse(t, sent[0]).GetVia().GetHost() != "192.168.0.108" {
+		t.Error("forwarded response mismatch", sent)
+	}
+	// a response of another element is discarded
+	sp.Forward(context.Background(), NewResponse(transactionParse(t, transactionInvite), 200, ""), nil)
+	if len(pt.take()) != 0 {
+		t.Error("response not of the proxy forwarded")
+	}
+}
+
+func TestStatelessProxy_Reject(t *testing.T) {
+	sp, pt := statelessProxyTest()
+	request := statelessProxyRoute(t, "Route: <sip:192.168.0.20;lr>")
+	request.GetMaxForwards().SetForwards(0)
+	if err, ok := sp.Forward(context.Background(), request, nil).(*StatusError); !ok || err.GetStatusCode() != 483 {
+		t.Error("Max-Forwards 0 forwarded")
+	}
+	sent := pt.takeLines()
+	if fmt.Sprint(sent) != "[SIP/2.0 483 Too Many Hops]" {
+		t.Error("483 mismatch", sent)
+	}
+	// the request comes back to the proxy unchanged
+	sp.Forward(context.Background(), statelessProxyRoute(t, "Route: <sip:192.168.0.10;lr>, <sip:192.168.0.20;lr>"), nil)
+	looped := transactionParse(t, pt.take()[0])
+	if err, ok := sp.Forward(context.Background(), looped, nil).(*StatusError); !ok || err.GetStatusCode() != 482 {
+		t.Error("loop not detected")
+	}
+	if sent := pt.takeLines(); fmt.Sprint(sent) != "[SIP/2.0 482 Loop Detected]" {
+		t.Error("482 mismatch", sent)
+	}
+	// a spiral with another Request-URI is forwarded
+	looped.GetRequestLine().GetUri().GetSipUri().GetUserInfo().SetUser("34020000001320000002")
+	if err := sp.Forward(context.Background(), looped, nil); err != nil {
+		t.Error(err)
+	}
+	pt.take()
+	// a next hop of no target is answered with 480
+	sp.GetLocator().SetClient(proxyDNSClient{})
+	if err, ok := sp.Forward(context.Background(), statelessProxyRoute(t, "Route: <sip:nowhere.example.com:5060;lr>"), nil).(*StatusError); !ok || err.GetStatusCode() != 480 {
+		t.Error("request of no target not answered")
+	}
+	if sent := pt.takeLines(); fmt.Sprint(sent) != "[SIP/2.0 480 Temporarily not available]" {
+		t.Error("480 mismatch", sent)
+	}
+}
+
+func TestStatelessProxy_StrictRouting(t *testing.T) {
+	sp, pt := statelessProxyTest()
+	// the next hop is a strict router
+	sp.Forward(context.Background(), statelessProxyRoute(t, "Route: <sip:192.168.0.20>"), nil)
+	strict := transactionParse(t, pt.take()[0])
+	requestUri, route := strict.GetRequestLine().GetUri().Raw(), strict.GetRoute().Raw()
+	fmt.Print(requestUri.String(), "\r\n", route.String())
+	if requestUri.String() != "sip:192.168.0.20" || route.String() != "Route: <sip:34020000001320000001@3402000000>\r\n" {
+		t.Error("strict routing mismatch")
+	}
+	// the previous hop is a strict router,it put the URI of the proxy in the Request-URI
+	request := statelessProxyRoute(t, "Route: <sip:34020000001320000001@192.168.0.26:5070>")
+	local := new(RequestUri)
+	if err := local.Parse("sip:192.168.0.10"); err != nil {
+		t.Fatal(err)
+	}
+	request.GetRequestLine().SetUri(local)
+	pt.targets = nil
+	sp.Forward(context.Background(), request, nil)
+	restored := transactionParse(t, pt.take()[0])
+	requestUri = restored.GetRequestLine().GetUri().Raw()
+	if requestUri.String() != "sip:34020000001320000001@192.168.0.26:5070" || restored.GetRoute() != nil || fmt.Sprint(pt.targets) != "[UDP 192.168.0.26:5070]" {
+		t.Error("Request-URI of a strict router mismatch", requestUri.String(), pt.targets)
+	}
+}
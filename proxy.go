@@ -0,0 +1,279 @@
+package sip
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.3
+//
+// 16.3 Request Validation
+//
+// 3. Max-Forwards check
+//
+// If the request does not contain a Max-Forwards header field, this
+// check is passed.
+//
+// If the request contains a Max-Forwards header field with a field
+// value greater than zero, the check is passed.
+//
+// If the request contains a Max-Forwards header field with a field
+// value of zero (0), the element MUST NOT forward the request.  If the
+// request was for OPTIONS, the element MAY act as the final recipient
+// and respond per Section 11.  Otherwise, the element MUST return a 483
+// (Too many hops) response.
+//
+// 4. Optional Loop Detection check
+//
+// An element MAY check for forwarding loops before forwarding a
+// request.  If the request contains a Via header field with a sent-
+// by value that equals a value placed into previous requests by the
+// proxy, the request has been forwarded by this element before.  The
+// request has either looped or is legitimately spiraling through the
+// element.  To determine if the request has looped, the element MAY
+// perform the branch parameter calculation described in Step 8 of
+// Section 16.6 on this message and compare it to the parameter received
+// in that Via header field.  If the parameters match, the request has
+// looped.  If they differ, the request is spiraling, and processing
+// continues.  If a loop is detected, the element MAY return a 482
+// (Loop Detected) response.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.4
+//
+// 16.4 Route Information Preprocessing
+//
+// The proxy MUST inspect the Request-URI of the request.  If the
+// Request-URI of the request contains a value this proxy previously
+// placed into a Record-Route header field (see Section 16.6 item 4),
+// the proxy MUST replace the Request-URI in the request with the last
+// value from the Route header field, and remove that value from the
+// Route header field.  The proxy MUST then proceed as if it received
+// this modified request.
+//
+// If the first value in the Route header field indicates this proxy,
+// the proxy MUST remove that value from the request.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.6
+//
+// 6. Postprocess routing information
+//
+// If the copy contains a Route header field, the proxy MUST inspect the
+// URI in its first value.  If that URI does not contain an lr
+// parameter, the proxy MUST modify the copy as follows:
+//
+//    -  The proxy MUST place the Request-URI into the Route header
+//       field as the last value.
+//
+//    -  The proxy MUST then place the first Route header field value
+//       into the Request-URI and remove that value from the Route
+//       header field.
+//
+// 7. Determine Next-Hop Address, Port, and Transport
+//
+// If the proxy has reformatted the request to send to a strict-routing
+// element as described in step 6 above, the proxy MUST apply those
+// procedures to the Request-URI of the request.  Otherwise, the proxy
+// MUST apply the procedures to the first value in the Route header
+// field, if present, else the Request-URI.
+
+// proxyLocal reports whether the hostport of a URI is host:port,the address of a proxy,a missing port is 5060
+func proxyLocal(hp *HostPort, host string, port uint16) bool {
+	if hp == nil {
+		return false
+	}
+	name := hp.GetName()
+	switch {
+	case len(strings.TrimSpace(name)) > 0:
+	case hp.GetIPv4() != nil:
+		name = hp.GetIPv4().String()
+	case hp.GetIPv6() != nil:
+		name = hp.GetIPv6().String()
+	}
+	return proxyHost(name, hp.GetPort(), host, port)
+}
+
+// proxyHost reports whether host:port equals local:localPort,a port 0 is 5060
+func proxyHost(host string, port uint16, local string, localPort uint16) bool {
+	if port == 0 {
+		port = 5060
+	}
+	if localPort == 0 {
+		localPort = 5060
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	local = strings.TrimSuffix(strings.TrimPrefix(local, "["), "]")
+	if ip, localIP := net.ParseIP(host), net.ParseIP(local); ip != nil && localIP != nil {
+		return ip.Equal(localIP) && port == localPort
+	}
+	return strings.EqualFold(strings.TrimSuffix(host, "."), strings.TrimSuffix(local, ".")) && port == localPort
+}
+
+// proxyURI returns the URI of a Route value as a Request-URI,nil when it does not parse
+func proxyURI(nameAddr *NameAddr) *RequestUri {
+	requestUri := new(RequestUri)
+	if !sipMsgCopy(nameAddr, requestUri) || requestUri.GetSipUri() == nil {
+		return nil
+	}
+	return requestUri
+}
+
+// proxyLr reports whether the URI of a Route value has the lr parameter,the next hop is a loose router
+func proxyLr(nameAddr *NameAddr) bool {
+	requestUri := proxyURI(nameAddr)
+	return requestUri != nil && requestUri.GetSipUri().GetParameters() != nil && requestUri.GetSipUri().GetParameters().GetLr()
+}
+
+// proxyRoutes returns the values of all Route header fields of sm in order
+func proxyRoutes(sm *SipMsg) []*NameAddr {
+	var routes []*NameAddr
+	for _, route := range sm.GetRoutes() {
+		routes = append(routes, route.GetNameAddrs()...)
+	}
+	return routes
+}
+
+// proxySetRoutes replaces the Route header fields of sm with a single one of routes,none when routes is empty
+func proxySetRoutes(sm *SipMsg, routes []*NameAddr) {
+	if len(routes) == 0 {
+		sm.SetRoutes(nil)
+		return
+	}
+	sm.SetRoute(NewRoute(routes...))
+}
+
+// proxyMaxForwards decrements the Max-Forwards of a request to be forwarded,a request without one gets 70.
+// A StatusError 483 is returned when the request must not be forwarded.
+func proxyMaxForwards(sm *SipMsg) error {
+	maxForwards := sm.GetMaxForwards()
+	switch {
+	case maxForwards == nil:
+		sm.SetMaxForwards(NewMaxForwards(70))
+	case maxForwards.GetForwards() == 0:
+		return NewStatusError(483, "")
+	default:
+		maxForwards.SetForwards(maxForwards.GetForwards() - 1)
+	}
+	return nil
+}
+
+// proxyLoop returns the loop detection component of the branch of a request forwarded by a proxy,
+// a hash of the To tag,the From tag,the Call-ID,the Request-URI and the CSeq number of the received request.
+// The topmost Via of RFC 3261 16.6 item 8 is left out,it is the previous hop and differs each time the request comes back.
+func proxyLoop(sm *SipMsg) string {
+	var to, from, callId, requestUri string
+	var cseq uint32
+	if sm.GetTo() != nil {
+		to = sm.GetTo().GetTag()
+	}
+	if sm.GetFrom() != nil {
+		from = sm.GetFrom().GetTag()
+	}
+	if sm.GetCallID() != nil {
+		raw := sm.GetCallID().Raw()
+		callId = raw.String()
+	}
+	if sm.GetRequestLine() != nil && sm.GetRequestLine().GetUri() != nil {
+		raw := sm.GetRequestLine().GetUri().Raw()
+		requestUri = raw.String()
+	}
+	if sm.GetCSeq() != nil {
+		cseq = sm.GetCSeq().GetNumber()
+	}
+	return proxyHash(to, from, callId, requestUri, cseq)
+}
+
+// proxyLooped reports whether a received request carries a Via of the proxy at host:port with the loop component loop,
+// the request has been forwarded by the proxy before and came back unchanged
+func proxyLooped(sm *SipMsg, host string, port uint16, loop string) bool {
+	for _, via := range sm.GetVias() {
+		if proxyHost(via.GetHost(), via.GetPort(), host, port) && strings.HasSuffix(via.GetBranch(), "."+loop) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyPreprocess processes the Route header fields of a received request by RFC 3261 16.4,
+// the Route value of the proxy at host:port is removed
+func proxyPreprocess(sm *SipMsg, host string, port uint16) {
+	routes := proxyRoutes(sm)
+	changed := false
+	// the previous hop is a strict router,it put the URI of the proxy in the Request-URI
+	if requestUri := sm.GetRequestLine().GetUri(); len(routes) > 0 && requestUri != nil && requestUri.GetSipUri() != nil &&
+		proxyLocal(requestUri.GetSipUri().GetHostPort(), host, port) {
+		if last := proxyURI(routes[len(routes)-1]); last != nil {
+			sm.GetRequestLine().SetUri(last)
+			routes = routes[:len(routes)-1]
+			changed = true
+		}
+	}
+	if len(routes) > 0 {
+		if first := proxyURI(routes[0]); first != nil && proxyLocal(first.GetSipUri().GetHostPort(), host, port) {
+			routes = routes[1:]
+			changed = true
+		}
+	}
+	if changed {
+		proxySetRoutes(sm, routes)
+	}
+}
+
+// proxyNextHop postprocesses the Route header fields of a request to be forwarded by RFC 3261 16.6 item 6,
+// and returns the URI of its next hop,the first Route value of a loose router or the Request-URI
+func proxyNextHop(sm *SipMsg) *SipUri {
+	routes := proxyRoutes(sm)
+	if len(routes) == 0 {
+		return sm.GetRequestLine().GetUri().GetSipUri()
+	}
+	if proxyLr(routes[0]) {
+		if requestUri := proxyURI(routes[0]); requestUri != nil {
+			return requestUri.GetSipUri()
+		}
+		return nil
+	}
+	// the next hop is a strict router,it takes the Request-URI
+	strict := proxyURI(routes[0])
+	if strict == nil {
+		return nil
+	}
+	if target := new(NameAddr); sipMsgCopy(sm.GetRequestLine().GetUri(), target) {
+		routes = append(routes, target)
+	}
+	sm.GetRequestLine().SetUri(strict)
+	proxySetRoutes(sm, routes[1:])
+	return strict.GetSipUri()
+}
+
+// proxyResponse returns the response of a proxy or a registrar to a request it answers itself,
+// the To tag is a hash of the transaction of the request,the same for its retransmissions
+func proxyResponse(request *SipMsg, statusCode uint, reasonPhrase string) *SipMsg {
+	response := NewResponse(request, statusCode, reasonPhrase)
+	if to := response.GetTo(); to != nil && statusCode != 100 && len(strings.TrimSpace(to.GetTag())) == 0 {
+		key, _ := transactionServerKey(request)
+		to.SetTag(proxyHash(key))
+	}
+	return response
+}
+
+// proxyRecordRoute returns the Record-Route value of the proxy at host:port,a loose router
+func proxyRecordRoute(host string, port uint16) *RecordRoute {
+	hostport := host
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		hostport = "[" + host + "]"
+	}
+	if port > 0 {
+		hostport += fmt.Sprintf(":%d", port)
+	}
+	recordRoute := new(RecordRoute)
+	if err := recordRoute.Parse(fmt.Sprintf("Record-Route: <sip:%s;lr>", hostport)); err != nil {
+		return nil
+	}
+	return recordRoute
+}
+
+// proxyHash returns the hex md5 of values,truncated to 16 digits
+func proxyHash(values ...interface{}) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintln(values...))))[:16]
+}
@@ -0,0 +1,37 @@
+package sip
+
+import (
+	"testing"
+)
+
+func TestProxy_Local(t *testing.T) {
+	cases := []struct {
+		host  string
+		port  uint16
+		local bool
+	}{
+		{"192.168.0.10", 0, true},
+		{"192.168.0.10", 5060, true},
+		{"192.168.0.10", 5070, false},
+		{"192.168.0.11", 5060, false},
+		{"PROXY.example.com.", 0, false},
+	}
+	for _, c := range cases {
+		if proxyHost(c.host, c.port, "192.168.0.10", 5060) != c.local {
+			t.Error("local address mismatch", c.host, c.port)
+		}
+	}
+	if !proxyHost("PROXY.example.com.", 0, "proxy.example.com", 5060) || !proxyHost("[::1]", 5060, "::1", 0) {
+		t.Error("local hostname mismatch")
+	}
+	route := new(Route)
+	if err := route.Parse("Route: <sip:192.168.0.10;lr>, <sip:192.168.0.20>"); err != nil {
+		t.Fatal(err)
+	}
+	if !proxyLr(route.GetNameAddrs()[0]) || proxyLr(route.GetNameAddrs()[1]) {
+		t.Error("lr parameter mismatch")
+	}
+	if !proxyLocal(proxyURI(route.GetNameAddrs()[0]).GetSipUri().GetHostPort(), "192.168.0.10", 0) {
+		t.Error("Route of the proxy not local")
+	}
+}
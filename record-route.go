@@ -0,0 +1,118 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-20.30
+//
+// 20.30 Record-Route
+
+// The Record-Route header field is inserted by proxies in a request to
+// force future requests in the dialog to be routed through the proxy.
+
+// Examples of its use with the Route header field are described in
+// Sections 16.12.1.
+
+// Example:
+
+// 	Record-Route: <sip:server10.biloxi.com;lr>,
+// 				<sip:bigbox3.site3.atlanta.com;lr>
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-25.1
+//
+// Record-Route  =  "Record-Route" HCOLON rec-route *(COMMA rec-route)
+// rec-route     =  name-addr *( SEMI rr-param )
+// rr-param      =  generic-param
+// generic-param  =  token [ EQUAL gen-value ]
+// gen-value      =  token / host / quoted-string
+// SEMI    =  SWS ";" SWS ; semicolon
+// HCOLON  =  *( SP / HTAB ) ":" SWS
+
+type RecordRoute struct {
+	field     string // "Record-Route"
+	nameAddrs []*NameAddr
+	source    string // source string
+}
+
+func (rr *RecordRoute) SetField(field string) {
+	if scanFieldIs(field, "record-route") {
+		rr.field = strings.Title(field)
+	} else {
+		rr.field = "Record-Route"
+	}
+}
+func (rr *RecordRoute) GetField() string {
+	return rr.field
+}
+func (rr *RecordRoute) SetNameAddrs(nameAddrs []*NameAddr) {
+	rr.nameAddrs = nameAddrs
+}
+func (rr *RecordRoute) GetNameAddrs() []*NameAddr {
+	return rr.nameAddrs
+}
+func (rr *RecordRoute) GetSource() string {
+	return rr.source
+}
+func NewRecordRoute(nameAddrs ...*NameAddr) *RecordRoute {
+	return &RecordRoute{
+		field:     "record-route",
+		nameAddrs: nameAddrs,
+	}
+}
+func (rr *RecordRoute) Raw() (result strings.Builder) {
+	field := rr.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "record-route"
+	}
+	result.WriteString(fmt.Sprintf("%s:", strings.Title(field)))
+	if rr.nameAddrs != nil {
+		for _, nameAddr := range rr.nameAddrs {
+			if nameAddr != nil {
+				nameAddrBuilder := nameAddr.Raw()
+				result.WriteString(fmt.Sprintf(" <%s>,", nameAddrBuilder.String()))
+			}
+		}
+	}
+	temp := result.String()
+	result.Reset()
+	temp = strings.TrimSuffix(temp, ",")
+	result.WriteString(temp)
+	result.WriteString("\r\n")
+	return
+}
+func (rr *RecordRoute) Parse(raw string) error {
+	raw = scanLine(raw)
+	if len(strings.TrimSpace(raw)) == 0 {
+		return NewParseError("Record-Route", raw, 0, `Record-Route  =  "Record-Route" HCOLON rec-route *(COMMA rec-route)`)
+	}
+	field, value, ok := scanField(raw, "record-route")
+	if !ok {
+		return NewParseError("Record-Route", raw, 0, `Record-Route  =  "Record-Route" HCOLON rec-route *(COMMA rec-route)`)
+	}
+	rr.field = field
+	rr.source = raw
+	rr.nameAddrs = make([]*NameAddr, 0)
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	raw = stringTrimPrefixAndTrimSuffix(raw, ",")
+	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	// name-addr,the values are split only when one of them ends with RAQUOT
+	values := []string{raw}
+	if scanIsRaquotComma(raw) {
+		values = strings.Split(raw, ",")
+	}
+	for _, raws := range values {
+		nameAddrs := strings.ReplaceAll(raws, ">", "")
+		nameAddrs = strings.ReplaceAll(nameAddrs, "<", "")
+		nameAddrs = stringTrimPrefixAndTrimSuffix(nameAddrs, " ")
+		nameAddr := new(NameAddr)
+		if err := nameAddr.Parse(nameAddrs); err != nil {
+			return parseErrorWrap(err, rr.source, nameAddrs)
+		}
+		if len(nameAddr.GetSource()) > 0 {
+			rr.nameAddrs = append(rr.nameAddrs, nameAddr)
+		}
+	}
+	return nil
+}
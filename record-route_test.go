@@ -0,0 +1,41 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestRecordRoute_Raw(t *testing.T) {
+	p := NewParams()
+	p.SetFlag("lr")
+	recordRoutes := []*RecordRoute{
+		NewRecordRoute(
+			NewNameAddr("sip", NewHostPort("www.baidu.com", nil, nil, 5060), p),
+			NewNameAddr("sip", NewHostPort("www.163.com", nil, nil, 0), nil),
+			NewNameAddr("sip", NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), nil),
+		),
+	}
+	for _, recordRoute := range recordRoutes {
+		result := recordRoute.Raw()
+		fmt.Print(result.String())
+
+	}
+}
+
+func TestRecordRoute_Parse(t *testing.T) {
+	raws := []string{
+		"Record-Route: <sip:www.baidu.com:5060;lr>, <sip:www.163.com>, <sip:192.168.0.26:5060>",
+		"Record-Route: <sip:www.163.com>, <sip:192.168.0.26:5060>",
+		"Record-Route: <sip:www.baidu.com:5060;lr>",
+		"Record-Route: <sip:www.baidu.com:5060;lr>,,",
+	}
+	for index, raw := range raws {
+		recordRoute := new(RecordRoute)
+		recordRoute.Parse(raw)
+		if len(recordRoute.GetSource()) > 0 {
+			result := recordRoute.Raw()
+			fmt.Print(index, "-----", result.String())
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package sip
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-10.3
+//
+// 10.3 Processing REGISTER Requests
+//
+// 5. The registrar extracts the address-of-record from the To header
+//    field of the request.  If the address-of-record is not valid for
+//    the domain in the Request-URI, the registrar MUST send a 404 (Not
+//    Found) response and skip the remaining steps.  The URI MUST then
+//    be converted to a canonical form.  To do that, all URI parameters
+//    MUST be removed (including the user-param), and any escaped
+//    characters MUST be converted to their unescaped form.  The result
+//    serves as an index into the list of bindings.
+//
+// 6. The registrar checks whether the request contains the Contact
+//    header field.  If not, it skips to the last step.  If the
+//    Contact header field is present, the registrar checks if there
+//    is one Contact field value that contains the special value "*"
+//    and an Expires field.  If the request has additional Contact
+//    fields or an expiration time other than zero, the request is
+//    invalid, and the server MUST return a 400 (Invalid Request) and
+//    skip the remaining steps.  If not, the registrar checks whether
+//    the Call-ID agrees with the value stored for each binding.  If
+//    not, it MUST remove the binding.  If it does agree, it MUST
+//    remove the binding only if the CSeq in the request is higher than
+//    the value stored for that binding.  Otherwise, the update MUST be
+//    aborted and the request fails.
+//
+// 7. The registrar now processes each contact address in the Contact
+//    header field in turn.  For each address, it determines the
+//    expiration interval as follows:
+//
+//    -  If the field value has an "expires" parameter, that value
+//       MUST be taken as the requested expiration.
+//
+//    -  If there is no such parameter, but the request has an
+//       Expires header field, that value MUST be taken as the
+//       requested expiration.
+//
+//    -  If there is neither, a locally-configured default value MUST
+//       be taken as the requested expiration.
+//
+//    The registrar MAY choose an expiration less than the requested
+//    expiration interval.  If and only if the requested expiration
+//    interval is greater than zero AND smaller than one hour AND
+//    less than a registrar-configured minimum, the registrar MAY
+//    reject the registration with a response of 423 (Interval Too
+//    Brief).  This response MUST contain a Min-Expires header field
+//    that states the minimum expiration interval the registrar is
+//    willing to honor.  It then skips the remaining steps.
+//
+//    For each address, the registrar then searches the list of
+//    current bindings using the URI comparison rules.  If the binding
+//    does not exist, it is tentatively added.  If the binding does
+//    exist, the registrar checks the Call-ID value.  If the Call-ID
+//    value in the existing binding differs from the Call-ID value in
+//    the request, the binding MUST be removed if the expiration time
+//    is zero and updated otherwise.  If they are the same, the
+//    registrar compares the CSeq value.  If the value is higher than
+//    that of the existing binding, it MUST update or remove the
+//    binding as above.  If not, the update MUST be aborted and the
+//    request fails.
+//
+//    The binding updates MUST be committed (that is, made visible to
+//    the proxy or redirect server) if and only if all binding updates
+//    and additions succeed.
+//
+// 8. The registrar returns a 200 (OK) response.  The response MUST
+//    contain Contact header field values enumerating all current
+//    bindings.  Each Contact value MUST feature an "expires"
+//    parameter indicating its expiration interval chosen by the
+//    registrar.
+
+const (
+	registrarExpires    = 3600      // the expiration of a Contact with none requested
+	registrarMinExpires = 60        // the Min-Expires of a registrar
+	registrarMaxExpires = 1<<32 - 1 // delta-seconds are at most (2**32)-1 by RFC 3261 20.19
+)
+
+// Registrar processes REGISTER requests by RFC 3261 10.3 and keeps the bindings in a LocationStore,
+// it is also a TargetHandler of a StatefulProxy for the addresses-of-record it registers
+type Registrar struct {
+	store          LocationStore
+	clock          Clock
+	minExpires     uint32 // a shorter expiration other than zero is answered with 423
+	maxExpires     uint32 // a longer expiration is shortened,0 is no maximum
+	defaultExpires uint32 // the expiration of a Contact with none requested
+	mutex          sync.Mutex
+}
+
+func (r *Registrar) GetStore() LocationStore {
+	return r.store
+}
+
+// SetClock sets the clock of the expirations,example: a ManualClock in a test
+func (r *Registrar) SetClock(clock Clock) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clock = clock
+}
+func (r *Registrar) GetClock() Clock {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.clock
+}
+func (r *Registrar) SetMinExpires(minExpires uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.minExpires = minExpires
+}
+func (r *Registrar) GetMinExpires() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.minExpires
+}
+func (r *Registrar) SetMaxExpires(maxExpires uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.maxExpires = maxExpires
+}
+func (r *Registrar) GetMaxExpires() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.maxExpires
+}
+func (r *Registrar) SetDefaultExpires(defaultExpires uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.defaultExpires = defaultExpires
+}
+func (r *Registrar) GetDefaultExpires() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.defaultExpires
+}
+
+// NewRegistrar returns a Registrar keeping the bindings in store,a Min-Expires of 60 and a default expiration of 3600 seconds
+func NewRegistrar(store LocationStore) *Registrar {
+	return &Registrar{
+		store:          store,
+		clock:          SystemClock{},
+		minExpires:     registrarMinExpires,
+		defaultExpires: registrarExpires,
+	}
+}
+
+// Register processes a REGISTER and returns its response,a 200 with the current bindings of the address-of-record
+// and a Date,or the response of the StatusError the request fails with. The To tag is a hash of the transaction.
+func (r *Registrar) Register(sm *SipMsg) *SipMsg {
+	bindings, err := r.register(sm)
+	if err != nil {
+		statusError, ok := err.(*StatusError)
+		if !ok {
+			statusError = NewStatusError(500, "")
+		}
+		response := proxyResponse(sm, statusError.GetStatusCode(), statusError.GetReasonPhrase())
+		if statusError.GetStatusCode() == 423 {
+			response.GetGenericHeaders().Add("Min-Expires", strconv.FormatUint(uint64(r.GetMinExpires()), 10))
+		}
+		return response
+	}
+	now := r.GetClock().Now()
+	response := proxyResponse(sm, 200, "")
+	response.SetContacts(registrarContacts(bindings, now))
+	response.SetDate(NewDate("", now))
+	return response
+}
+
+// register updates the bindings of the address-of-record of a REGISTER by RFC 3261 10.3 steps 5-7,
+// and returns the current bindings
+func (r *Registrar) register(sm *SipMsg) ([]*Binding, error) {
+	if sm.GetRequestLine() == nil || !strings.EqualFold(sm.GetRequestLine().GetMethod(), "REGISTER") {
+		return nil, NewStatusError(405, "")
+	}
+	to, callId, cseq := sm.GetTo(), sm.GetCallID(), sm.GetCSeq()
+	if to == nil || callId == nil || cseq == nil {
+		return nil, NewStatusError(400, "")
+	}
+	aor := registrarAOR(to.GetSchema(), to.GetUser(), to.GetHost())
+	if len(aor) == 0 {
+		return nil, NewStatusError(404, "")
+	}
+	id := registrarCallID(callId)
+	now := r.GetClock().Now()
+	requested := -1
+	if sm.GetExpires() != nil {
+		requested = int(sm.GetExpires().GetExpire())
+	}
+	// the bindings are read and written as a whole
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	current, err := r.store.Get(aor)
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]*Binding, 0, len(current))
+	for _, binding := range current {
+		if binding.GetExpires().After(now) {
+			bindings = append(bindings, binding)
+		}
+	}
+	contacts := sm.GetContacts()
+	if len(contacts) == 0 {
+		// a query of the bindings
+		return registrarSort(bindings), nil
+	}
+	star := false
+	for _, contact := range contacts {
+		star = star || contact.GetStar()
+	}
+	if star {
+		if len(contacts) > 1 || requested != 0 {
+			return nil, NewStatusError(400, "")
+		}
+		for _, binding := range bindings {
+			if binding.GetCallID() == id && cseq.GetNumber() <= binding.GetCSeq() {
+				return nil, NewStatusError(500, "")
+			}
+		}
+		if err := r.store.Put(aor, nil); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	for _, contact := range contacts {
+		if dialogTarget(contact) == nil {
+			return nil, NewStatusError(400, "")
+		}
+		expires := contact.GetExpires()
+		if expires < 0 {
+			expires = requested
+		}
+		if expires < 0 {
+			expires = int(r.defaultExpires)
+		}
+		if expires > 0 && expires < registrarExpires && expires < int(r.minExpires) {
+			return nil, NewStatusError(423, "")
+		}
+		if uint64(expires) > registrarMaxExpires {
+			return nil, NewStatusError(400, "")
+		}
+		if r.maxExpires > 0 && expires > int(r.maxExpires) {
+			expires = int(r.maxExpires)
+		}
+		index := -1
+		for i, binding := range bindings {
+			if registrarEqual(binding.GetContact(), contact) {
+				index = i
+				break
+			}
+		}
+		if index >= 0 && bindings[index].GetCallID() == id && cseq.GetNumber() <= bindings[index].GetCSeq() {
+			return nil, NewStatusError(500, "")
+		}
+		if index >= 0 {
+			bindings = append(bindings[:index], bindings[index+1:]...)
+		}
+		if expires > 0 {
+			stored := new(Contact)
+			if !sipMsgCopy(contact, stored) {
+				return nil, NewStatusError(400, "")
+			}
+			stored.SetExpires(-1)
+			bindings = append(bindings, NewBinding(stored, id, cseq.GetNumber(), now.Add(time.Duration(expires)*time.Second)))
+		}
+	}
+	if err := r.store.Put(aor, bindings); err != nil {
+		return nil, err
+	}
+	return registrarSort(bindings), nil
+}
+
+// Lookup returns the Contacts bound to aor from the highest q to the lowest,
+// each with its remaining expiration. aor is a URI,its parameters are ignored.
+func (r *Registrar) Lookup(aor string) ([]*Contact, error) {
+	uri := new(RequestUri)
+	if err := uri.Parse(aor); err != nil || uri.GetSipUri() == nil {
+		return nil, NewStatusError(404, "")
+	}
+	return r.lookup(uri.GetSipUri())
+}
+
+// Targets is the TargetHandler of a StatefulProxy,the Contacts bound to the Request-URI.
+// A StatusError 404 is returned when there are none.
+func (r *Registrar) Targets(sm *SipMsg) ([]*Contact, error) {
+	if sm.GetRequestLine() == nil || sm.GetRequestLine().GetUri() == nil || sm.GetRequestLine().GetUri().GetSipUri() == nil {
+		return nil, NewStatusError(404, "")
+	}
+	contacts, err := r.lookup(sm.GetRequestLine().GetUri().GetSipUri())
+	if err == nil && len(contacts) == 0 {
+		return nil, NewStatusError(404, "")
+	}
+	return contacts, err
+}
+
+// lookup returns the Contacts bound to the address-of-record of uri
+func (r *Registrar) lookup(uri *SipUri) ([]*Contact, error) {
+	user := ""
+	if uri.GetUserInfo() != nil {
+		user = uri.GetUserInfo().GetUser()
+	}
+	aor := registrarAOR(uri.GetSchema(), user, registrarHost(uri.GetHostPort()))
+	bindings, err := r.store.Get(aor)
+	if err != nil {
+		return nil, err
+	}
+	now := r.GetClock().Now()
+	current := make([]*Binding, 0, len(bindings))
+	for _, binding := range bindings {
+		if binding.GetExpires().After(now) {
+			current = append(current, binding)
+		}
+	}
+	return registrarContacts(registrarSort(current), now), nil
+}
+
+// registrarAOR returns the canonical address-of-record of a URI,schema:user@host without the port and the parameters,
+// "" when there is no host
+func registrarAOR(schema string, user string, host string) string {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if len(host) == 0 {
+		return ""
+	}
+	schema = strings.ToLower(strings.TrimSpace(schema))
+	if len(schema) == 0 {
+		schema = "sip"
+	}
+	if len(strings.TrimSpace(user)) == 0 {
+		return schema + ":" + host
+	}
+	return schema + ":" + strings.TrimSpace(user) + "@" + host
+}
+
+// registrarHost returns the host of hp,its name or its IP address
+func registrarHost(hp *HostPort) string {
+	switch {
+	case hp == nil:
+		return ""
+	case len(strings.TrimSpace(hp.GetName())) > 0:
+		return hp.GetName()
+	case hp.GetIPv4() != nil:
+		return hp.GetIPv4().String()
+	case hp.GetIPv6() != nil:
+		return hp.GetIPv6().String()
+	}
+	return ""
+}
+
+// registrarCallID returns the value of a Call-ID header field
+func registrarCallID(callId *CallID) string {
+	if len(strings.TrimSpace(callId.GetHost())) == 0 {
+		return callId.GetLocalId()
+	}
+	return callId.GetLocalId() + "@" + callId.GetHost()
+}
+
+// registrarEqual reports whether the URIs of two Contacts are equivalent by RFC 3261 19.1.4,
+// the user part is case-sensitive and a port,a user,ttl,method or maddr parameter or a header in only one of them differs
+func registrarEqual(a *Contact, b *Contact) bool {
+	if !strings.EqualFold(registrarSchema(a), registrarSchema(b)) || a.GetUser() != b.GetUser() ||
+		a.GetPort() != b.GetPort() || !proxyHost(a.GetHost(), a.GetPort(), b.GetHost(), b.GetPort()) {
+		return false
+	}
+	// any uri-parameter appearing in both URIs must match
+	aParams, bParams := registrarUriParams(a.GetUriParams()), registrarUriParams(b.GetUriParams())
+	for name, value := range aParams {
+		if other, ok := bParams[name]; ok && !strings.EqualFold(value, other) {
+			return false
+		}
+	}
+	for _, name := range []string{"user", "ttl", "method", "maddr"} {
+		_, inA := aParams[name]
+		_, inB := bParams[name]
+		if inA != inB {
+			return false
+		}
+	}
+	// header components are never ignored
+	aHeaders, bHeaders := registrarHeaders(a.GetHeaders()), registrarHeaders(b.GetHeaders())
+	if len(aHeaders) != len(bHeaders) {
+		return false
+	}
+	for name, value := range aHeaders {
+		if other, ok := bHeaders[name]; !ok || value != other {
+			return false
+		}
+	}
+	return true
+}
+
+// registrarSchema returns the schema of a Contact,sip when it has none
+func registrarSchema(contact *Contact) string {
+	if len(strings.TrimSpace(contact.GetSchema())) == 0 {
+		return "sip"
+	}
+	return strings.TrimSpace(contact.GetSchema())
+}
+
+// registrarUriParams returns the uri-parameters by their lowercase names
+func registrarUriParams(parameters *Parameters) map[string]string {
+	params := NewParams()
+	if parameters != nil {
+		raw := parameters.Raw()
+		if params.Parse(raw.String()) != nil {
+			return nil
+		}
+	}
+	return registrarHeaders(params)
+}
+
+// registrarHeaders returns the headers of a URI by their lowercase names
+func registrarHeaders(headers *Params) map[string]string {
+	result := make(map[string]string)
+	if headers == nil {
+		return result
+	}
+	for _, p := range headers.list() {
+		result[strings.ToLower(p.name)] = p.value
+	}
+	return result
+}
+
+// registrarQ returns the q of a Contact,1.0 when it has none
+func registrarQ(contact *Contact) float64 {
+	q, err := strconv.ParseFloat(strings.TrimSpace(contact.GetQ()), 64)
+	if err != nil {
+		return 1
+	}
+	return q
+}
+
+// registrarSort sorts bindings from the highest q to the lowest,bindings of the same q stay in order
+func registrarSort(bindings []*Binding) []*Binding {
+	sort.SliceStable(bindings, func(i, j int) bool {
+		return registrarQ(bindings[i].GetContact()) > registrarQ(bindings[j].GetContact())
+	})
+	return bindings
+}
+
+// registrarContacts returns copies of the Contacts of bindings,each with the seconds left before it expires at now
+func registrarContacts(bindings []*Binding, now time.Time) []*Contact {
+	contacts := make([]*Contact, 0, len(bindings))
+	for _, binding := range bindings {
+		contact := new(Contact)
+		if !sipMsgCopy(binding.GetContact(), contact) {
+			continue
+		}
+		contact.SetExpires(int((binding.GetExpires().Sub(now) + time.Second - 1) / time.Second))
+		contacts = append(contacts, contact)
+	}
+	return contacts
+}
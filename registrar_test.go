@@ -0,0 +1,183 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registrarRegister returns sipMsgRegister with the CSeq number cseq,the Contact header fields contacts and the Expires expires
+func registrarRegister(t *testing.T, cseq int, contacts string, expires string) *SipMsg {
+	raw := strings.Replace(sipMsgRegister, "CSeq: 1 ", fmt.Sprintf("CSeq: %d ", cseq), 1)
+	raw = strings.Replace(raw, "Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n", contacts, 1)
+	raw = strings.Replace(raw, "Expires: 3600\r\n", expires, 1)
+	return transactionParse(t, raw)
+}
+
+// registrarTest returns a Registrar on a MemoryLocationStore and its ManualClock
+func registrarTest() (*Registrar, *ManualClock) {
+	clock := NewManualClock(time.Unix(0, 0))
+	registrar := NewRegistrar(NewMemoryLocationStore())
+	registrar.SetClock(clock)
+	return registrar, clock
+}
+
+func TestRegistrar_Register(t *testing.T) {
+	registrar, clock := registrarTest()
+	response := registrar.Register(transactionParse(t, sipMsgRegister))
+	result := response.Raw()
+	fmt.Print(result.String())
+	if response.GetStatusLine().GetStatusCode() != 200 || len(response.GetTo().GetTag()) == 0 || response.GetDate() == nil {
+		t.Fatal("200 mismatch")
+	}
+	if contacts := response.GetContacts(); len(contacts) != 1 || contacts[0].GetExpires() != 3600 {
+		t.Error("binding mismatch")
+	}
+	// a second Contact is added,the first one is refreshed with its own expires
+	clock.Advance(100 * time.Second)
+	response = registrar.Register(registrarRegister(t, 2,
+		"Contact: <sip:34020000001320000001@192.168.0.26:5060>;expires=1800, <sip:34020000001320000001@192.168.0.27:5060>;q=0.5\r\n", "Expires: 600\r\n"))
+	contacts := response.GetContacts()
+	if len(contacts) != 2 || contacts[0].GetExpires() != 1800 || contacts[1].GetExpires() != 600 || contacts[1].GetQ() != "0.5" {
+		t.Error("bindings mismatch", len(contacts))
+	}
+	// the Contacts of the address-of-record in order of q
+	contacts, err := registrar.Lookup("sip:34020000001320000001@3402000000;transport=udp")
+	if err != nil || len(contacts) != 2 || contacts[0].GetHost() != "192.168.0.26" {
+		t.Error("lookup mismatch", err)
+	}
+	// a binding expires
+	clock.Advance(601 * time.Second)
+	if contacts, _ := registrar.Lookup("sip:34020000001320000001@3402000000"); len(contacts) != 1 || contacts[0].GetExpires() != 1199 {
+		t.Error("binding not expired")
+	}
+	// a query returns the bindings unchanged
+	if response := registrar.Register(registrarRegister(t, 3, "", "")); len(response.GetContacts()) != 1 {
+		t.Error("query mismatch")
+	}
+	// a Contact with expires 0 is removed
+	response = registrar.Register(registrarRegister(t, 4, "Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n", "Expires: 0\r\n"))
+	if response.GetStatusLine().GetStatusCode() != 200 || len(response.GetContacts()) != 0 {
+		t.Error("binding not removed")
+	}
+}
+
+func TestRegistrar_Reject(t *testing.T) {
+	registrar, _ := registrarTest()
+	registrar.SetMinExpires(300)
+	response := registrar.Register(registrarRegister(t, 1, "Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n", "Expires: 60\r\n"))
+	result := response.Raw()
+	fmt.Print(result.String())
+	if response.GetStatusLine().GetStatusCode() != 423 || response.GetGenericHeaders().Get("Min-Expires") != "300" {
+		t.Error("423 mismatch")
+	}
+	if response := registrar.Register(registrarRegister(t, 2, "Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n", "")); response.GetStatusLine().GetStatusCode() != 200 {
+		t.Fatal("default expiration not accepted")
+	}
+	// a REGISTER of the same Call-ID with a CSeq not higher fails,another Call-ID updates the binding
+	if response := registrar.Register(registrarRegister(t, 2, "Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n", "")); response.GetStatusLine().GetStatusCode() != 500 {
+		t.Error("CSeq out of order accepted")
+	}
+	other := registrarRegister(t, 1, "Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n", "Expires: 1200\r\n")
+	other.GetCallID().SetLocalId("1011047670")
+	if response := registrar.Register(other); response.GetStatusLine().GetStatusCode() != 200 || response.GetContacts()[0].GetExpires() != 1200 {
+		t.Error("binding of another Call-ID not updated")
+	}
+	// * removes all the bindings with Expires 0 only
+	if response := registrar.Register(registrarRegister(t, 3, "Contact: *\r\n", "Expires: 60\r\n")); response.GetStatusLine().GetStatusCode() != 400 {
+		t.Error("* without Expires 0 accepted")
+	}
+	if response := registrar.Register(registrarRegister(t, 3, "Contact: *\r\n", "Expires: 0\r\n")); response.GetStatusLine().GetStatusCode() != 200 || len(response.GetContacts()) != 0 {
+		t.Error("* not accepted")
+	}
+	// a * built in code is written as one and removes the bindings alike
+	star := NewContact("", "", "", "", "", 0, "", -1, nil)
+	star.SetStar(true)
+	if result := star.Raw(); result.String() != "Contact: *\r\n" {
+		t.Error("* mismatch", result.String())
+	}
+	unregister := registrarRegister(t, 4, "", "Expires: 0\r\n")
+	unregister.SetContact(star)
+	if response := registrar.Register(unregister); response.GetStatusLine().GetStatusCode() != 200 {
+		t.Error("* in code not accepted")
+	}
+	invite := transactionParse(t, transactionInvite)
+	if _, err := registrar.Targets(invite); err == nil {
+		t.Error("target of no binding")
+	}
+}
+
+func TestRegistrar_Expires(t *testing.T) {
+	registrar, _ := registrarTest()
+	// an expiration out of delta-seconds is not a Contact
+	if err := new(SipMsg).Parse(strings.Replace(sipMsgRegister, "5060>", "5060>;expires=99999999999", 1)); err == nil {
+		t.Error("expires out of range parsed")
+	}
+	register := transactionParse(t, sipMsgRegister)
+	register.GetContacts()[0].SetExpires(99999999999)
+	response := registrar.Register(register)
+	if response.GetStatusLine().GetStatusCode() != 400 {
+		t.Error("expiration out of range granted")
+	}
+	// the longest expiration with no maximum is (2**32)-1,a maximum shortens it
+	register = registrarRegister(t, 2, "Contact: <sip:34020000001320000001@192.168.0.26:5060>;expires=4294967295\r\n", "")
+	if contacts := registrar.Register(register).GetContacts(); len(contacts) != 1 || uint64(contacts[0].GetExpires()) != registrarMaxExpires {
+		t.Error("longest expiration mismatch")
+	}
+	registrar.SetMaxExpires(7200)
+	register = registrarRegister(t, 3, "Contact: <sip:34020000001320000001@192.168.0.26:5060>;expires=4294967295\r\n", "")
+	if contacts := registrar.Register(register).GetContacts(); len(contacts) != 1 || contacts[0].GetExpires() != 7200 {
+		t.Error("expiration not shortened")
+	}
+	// a Contact of no user is bound and written without "@"
+	response = registrar.Register(registrarRegister(t, 4, "Contact: <sip:192.168.0.108:5060>\r\n", "Expires: 600\r\n"))
+	result := response.Raw()
+	fmt.Print(result.String())
+	if !strings.Contains(result.String(), "Contact: <sip:192.168.0.108:5060>;expires=600\r\n") {
+		t.Error("userless Contact mismatch")
+	}
+}
+
+func TestRegistrar_Equal(t *testing.T) {
+	// the Contact URIs compared by RFC 3261 19.1.4
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"<sip:bob@Biloxi.com>", "<SIP:bob@biloxi.COM>", true},
+		{"<sip:bob@biloxi.com>", "<sip:Bob@biloxi.com>", false},
+		{"<sip:bob@biloxi.com>", "<sip:bob@biloxi.com:5060>", false},
+		{"<sip:bob@biloxi.com;transport=tcp>", "<sip:bob@biloxi.com>", true},
+		{"<sip:bob@biloxi.com;transport=tcp>", "<sip:bob@biloxi.com;transport=udp>", false},
+		{"<sip:bob@biloxi.com;maddr=239.255.255.1>", "<sip:bob@biloxi.com>", false},
+		{"<sip:bob@biloxi.com;ob>", "<sip:bob@biloxi.com;OB>", true},
+		{"<sip:bob@biloxi.com?Subject=next>", "<sip:bob@biloxi.com>", false},
+	}
+	for _, test := range tests {
+		a, b := new(Contact), new(Contact)
+		if err := a.Parse("Contact: " + test.a); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Parse("Contact: " + test.b); err != nil {
+			t.Fatal(err)
+		}
+		if registrarEqual(a, b) != test.equal || registrarEqual(b, a) != test.equal {
+			t.Error("comparison mismatch", test.a, test.b)
+		}
+	}
+	// the bindings differing by a uri-parameter are kept apart,a target is the full URI of its binding
+	registrar, _ := registrarTest()
+	response := registrar.Register(registrarRegister(t, 1,
+		"Contact: <sip:34020000001320000001@192.168.0.26:5060;transport=tcp>, <sip:34020000001320000001@192.168.0.26:5060;transport=udp>;q=0.5\r\n", ""))
+	if response.GetStatusLine().GetStatusCode() != 200 || len(response.GetContacts()) != 2 {
+		t.Fatal("bindings mismatch")
+	}
+	contacts, err := registrar.Targets(transactionParse(t, transactionInvite))
+	if err != nil || len(contacts) != 2 {
+		t.Fatal("targets mismatch", err)
+	}
+	if target := dialogTarget(contacts[0]).Raw(); target.String() != "sip:34020000001320000001@192.168.0.26:5060;transport=tcp" {
+		t.Error("target mismatch", target.String())
+	}
+}
@@ -0,0 +1,488 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-10.2.1
+//
+// 10.2.1 Adding Bindings
+//
+// The REGISTER request sent to a registrar includes the contact
+// address(es) to which SIP requests for the address-of-record should be
+// forwarded.  The address-of-record is included in the To header field
+// of the REGISTER request.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-10.2.1.1
+//
+// 10.2.1.1 Setting the Expiration Interval of Contact Addresses
+//
+// If a UA receives a 423 (Interval Too Brief) response, it MAY retry
+// the registration after making the expiration interval of all contact
+// addresses in the REGISTER request equal to or greater than the
+// expiration interval within the Min-Expires header field of the 423
+// (Interval Too Brief) response.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-10.2.4
+//
+// 10.2.4 Refreshing Bindings
+//
+// Each UA is responsible for refreshing the bindings that it has
+// previously established.  A UA SHOULD NOT refresh bindings set up by
+// other UAs.
+//
+// The 200 (OK) response from the registrar contains a list of Contact
+// fields enumerating all current bindings.  The UA compares each
+// contact address to see if it created the contact address, using
+// comparison rules in Section 19.1.4.  If so, it updates the expiration
+// time interval according to the expires parameter or, if absent, the
+// Expires field value.  The UA then issues a REGISTER request for each
+// of its bindings before the expiration interval has elapsed.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-22.2
+//
+// 22.2 User-to-User Authentication
+//
+// When a UAC resubmits a request with its credentials after receiving a
+// 401 (Unauthorized) or 407 (Proxy Authentication Required) response,
+// it MUST increment the CSeq header field value as it would normally
+// when sending an updated request.
+
+// RegistrationState is the state of a Registration
+type RegistrationState int
+
+const (
+	RegistrationUnregistered  RegistrationState = iota // no binding,the initial state
+	RegistrationRegistering                            // a REGISTER adding the binding is sent
+	RegistrationRegistered                             // the registrar accepted the binding,it is refreshed before it expires
+	RegistrationUnregistering                          // a REGISTER removing the binding is sent
+	RegistrationFailed                                 // the registrar rejected a REGISTER or did not answer it
+)
+
+func (rs RegistrationState) String() string {
+	switch rs {
+	case RegistrationUnregistered:
+		return "Unregistered"
+	case RegistrationRegistering:
+		return "Registering"
+	case RegistrationRegistered:
+		return "Registered"
+	case RegistrationUnregistering:
+		return "Unregistering"
+	case RegistrationFailed:
+		return "Failed"
+	}
+	return fmt.Sprintf("RegistrationState(%d)", int(rs))
+}
+
+// RegistrationHandler is called on each change of the state of a Registration,response is the one that caused it,
+// nil when the REGISTER could not be sent
+type RegistrationHandler func(state RegistrationState, response *SipMsg)
+
+const (
+	registrationExpires = 3600             // the expiration requested by default
+	registrationMargin  = 30 * time.Second // a binding is refreshed this long before it expires
+	registrationFloor   = 5 * time.Second  // the shortest interval between refreshes,whatever the registrar grants
+)
+
+// Registration keeps the binding of the Contact of a UA at a registrar by RFC 3261 10.2,
+// the REGISTERs share the Call-ID of the UA and increment its CSeq. A 401 or 407 is answered with Digest credentials,
+// a 423 with the Min-Expires of the registrar,and the binding is refreshed before it expires.
+type Registration struct {
+	transactions *TransactionLayer
+	ua           *UA
+	registrar    *RequestUri // the Request-URI of the REGISTERs
+	target       *Target     // the address the REGISTERs are sent to
+	username     string
+	password     string
+	expires      uint32        // the expiration requested
+	margin       time.Duration // a binding is refreshed this long before it expires,half of its expiration at most
+	handler      RegistrationHandler
+	state        RegistrationState
+	granted      uint32           // the expiration granted by the registrar
+	challenge    *WWWAuthenticate // the last challenge,answered in each REGISTER
+	proxy        bool             // the challenge is of a 407
+	nc           uint32           // the nonce count of the challenge
+	answered     bool             // the challenge is answered and not accepted yet
+	refresh      Timer
+	ctx          context.Context // the context of the retries and refreshes,canceled by Unregister and Close
+	cancel       context.CancelFunc
+	done         chan struct{} // closed when the unregistration completes
+	mutex        sync.Mutex
+}
+
+func (r *Registration) GetUA() *UA {
+	return r.ua
+}
+func (r *Registration) GetRegistrar() *RequestUri {
+	return r.registrar
+}
+func (r *Registration) GetTarget() *Target {
+	return r.target
+}
+
+// SetCredentials sets the Digest username and password answering a challenge
+func (r *Registration) SetCredentials(username string, password string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.username, r.password = username, password
+}
+func (r *Registration) GetUsername() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.username
+}
+func (r *Registration) SetExpires(expires uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.expires = expires
+}
+func (r *Registration) GetExpires() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.expires
+}
+func (r *Registration) SetMargin(margin time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.margin = margin
+}
+func (r *Registration) GetMargin() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.margin
+}
+func (r *Registration) SetHandler(handler RegistrationHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handler = handler
+}
+func (r *Registration) GetHandler() RegistrationHandler {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.handler
+}
+func (r *Registration) GetState() RegistrationState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.state
+}
+
+// GetGranted returns the expiration granted by the registrar to the binding
+func (r *Registration) GetGranted() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.granted
+}
+
+// NewRegistration returns the Registration of the Contact of ua at the registrar with the Request-URI registrar,
+// the REGISTERs are sent to target in client transactions of transactions
+func NewRegistration(transactions *TransactionLayer, ua *UA, registrar *RequestUri, target *Target) *Registration {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registration{
+		transactions: transactions,
+		ua:           ua,
+		registrar:    registrar,
+		target:       target,
+		expires:      registrationExpires,
+		margin:       registrationMargin,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Register sends a REGISTER adding the binding,the outcome is passed to the RegistrationHandler.
+// ctx is of this REGISTER only,the retries and refreshes go on until Unregister or Close.
+func (r *Registration) Register(ctx context.Context) error {
+	r.mutex.Lock()
+	transactionStop(r.refresh)
+	r.renew()
+	changed := r.change(RegistrationRegistering)
+	expires := r.expires
+	r.mutex.Unlock()
+	r.notify(changed, RegistrationRegistering, nil)
+	return r.send(ctx, expires)
+}
+
+// Unregister sends a REGISTER removing the binding and waits for its final response until ctx is done,
+// nothing is sent when there is no binding. The retries and refreshes of the registration stop.
+func (r *Registration) Unregister(ctx context.Context) error {
+	r.mutex.Lock()
+	transactionStop(r.refresh)
+	if r.state == RegistrationUnregistered || r.state == RegistrationFailed {
+		r.cancel()
+		r.mutex.Unlock()
+		return nil
+	}
+	r.renew()
+	changed := r.change(RegistrationUnregistering)
+	done := make(chan struct{})
+	r.done = done
+	r.mutex.Unlock()
+	r.notify(changed, RegistrationUnregistering, nil)
+	if err := r.send(ctx, 0); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the retries and refreshes of the registration,the binding is left to expire at the registrar
+func (r *Registration) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	transactionStop(r.refresh)
+	r.cancel()
+}
+
+// renew cancels the context of the retries and refreshes and starts another one,the caller holds the mutex
+func (r *Registration) renew() {
+	r.cancel()
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+}
+
+// send sends a REGISTER requesting expires with the credentials of the last challenge in ctx,
+// the REGISTERs answering its response go in the context of the registration
+func (r *Registration) send(ctx context.Context, expires uint32) error {
+	sm := r.ua.NewRequest("REGISTER", r.registrar)
+	sm.SetExpires(NewExpires(expires))
+	r.mutex.Lock()
+	r.credentials(sm)
+	own := r.ctx
+	r.mutex.Unlock()
+	_, err := r.transactions.Request(ctx, sm, r.target, func(response *SipMsg, ct *ClientTransaction) {
+		r.receive(own, expires, response, ct)
+	})
+	if err != nil {
+		r.fail(nil)
+	}
+	return err
+}
+
+// receive handles the response to a REGISTER requesting expires sent in the context ctx of the registration,
+// a response after the context is canceled is dropped
+func (r *Registration) receive(ctx context.Context, expires uint32, response *SipMsg, ct *ClientTransaction) {
+	code := response.GetStatusLine().GetStatusCode()
+	if code < 200 {
+		return
+	}
+	r.mutex.Lock()
+	if ctx.Err() != nil {
+		r.mutex.Unlock()
+		return
+	}
+	// a response to a REGISTER replaced by an unregistration,or the other way round
+	if (expires == 0) != (r.state == RegistrationUnregistering) {
+		r.mutex.Unlock()
+		return
+	}
+	switch {
+	case code < 300:
+		r.answered = false
+		if expires == 0 {
+			r.granted = 0
+			r.complete(RegistrationUnregistered, response)
+			return
+		}
+		granted, ok := registrationGranted(response, ct.GetRequest().GetContact(), expires)
+		if !ok {
+			// the registrar did not keep the binding
+			r.mutex.Unlock()
+			r.fail(response)
+			return
+		}
+		r.granted = granted
+		if granted == 0 {
+			r.complete(RegistrationUnregistered, response)
+			return
+		}
+		margin := r.margin
+		if half := time.Duration(granted) * time.Second / 2; margin > half {
+			margin = half
+		}
+		interval := time.Duration(granted)*time.Second - margin
+		if interval < registrationFloor {
+			interval = registrationFloor
+		}
+		r.refresh = r.transactions.GetClock().AfterFunc(interval, func() {
+			if ctx.Err() == nil {
+				r.send(ctx, r.GetExpires())
+			}
+		})
+		r.complete(RegistrationRegistered, response)
+		return
+	case code == 401 || code == 407:
+		challenge := registrationChallenge(response, code == 407)
+		// credentials answering the same challenge again are rejected,a stale nonce is answered once more
+		if challenge == nil || r.answered && !challenge.GetStale() || !registrationAlgorithm(challenge.GetAlgorithm()) {
+			r.mutex.Unlock()
+			r.fail(response)
+			return
+		}
+		r.challenge, r.proxy, r.nc, r.answered = challenge, code == 407, 0, true
+	case code == 423:
+		minExpires, err := strconv.ParseUint(strings.TrimSpace(response.GetGenericHeaders().Get("Min-Expires")), 10, 32)
+		if err != nil || uint32(minExpires) <= expires {
+			r.mutex.Unlock()
+			r.fail(response)
+			return
+		}
+		r.expires = uint32(minExpires)
+		expires = r.expires
+	default:
+		r.mutex.Unlock()
+		r.fail(response)
+		return
+	}
+	r.mutex.Unlock()
+	r.send(ctx, expires)
+}
+
+// complete moves the registration to state after the final response of a REGISTER,the caller holds the mutex,
+// it is released
+func (r *Registration) complete(state RegistrationState, response *SipMsg) {
+	changed := r.change(state)
+	var done chan struct{}
+	if state != RegistrationRegistered {
+		done, r.done = r.done, nil
+	}
+	r.mutex.Unlock()
+	if done != nil {
+		close(done)
+	}
+	r.notify(changed, state, response)
+}
+
+// fail moves the registration to the Failed state,the binding is no longer refreshed
+func (r *Registration) fail(response *SipMsg) {
+	r.mutex.Lock()
+	transactionStop(r.refresh)
+	r.answered = false
+	r.complete(RegistrationFailed, response)
+}
+
+// change sets the state and reports whether it changed,the caller holds the mutex
+func (r *Registration) change(state RegistrationState) bool {
+	changed := r.state != state
+	r.state = state
+	return changed
+}
+
+// notify passes a change of state to the RegistrationHandler
+func (r *Registration) notify(changed bool, state RegistrationState, response *SipMsg) {
+	if handler := r.GetHandler(); changed && handler != nil {
+		handler(state, response)
+	}
+}
+
+// credentials adds the Digest credentials answering the last challenge to a REGISTER,the caller holds the mutex
+func (r *Registration) credentials(sm *SipMsg) {
+	challenge := r.challenge
+	if challenge == nil {
+		return
+	}
+	r.nc++
+	uri := sm.GetRequestLine().GetUri()
+	uriRaw := uri.Raw()
+	// the algorithm token is case-insensitive,registrationAlgorithm accepted the challenge
+	algorithm := "MD5"
+	if strings.EqualFold(strings.TrimSpace(challenge.GetAlgorithm()), "MD5-sess") {
+		algorithm = "MD5-sess"
+	}
+	dp := &DigestParams{
+		Digest: Digest{
+			Realm:    challenge.GetRealm(),
+			UserName: r.username,
+			Password: r.password,
+		},
+		Algorithm: algorithm,
+		Method:    "REGISTER",
+		URI:       uriRaw.String(),
+		Nonce:     challenge.GetNonce(),
+	}
+	nc := ""
+	if qop := registrationQop(challenge.GetQop()); len(qop) > 0 {
+		dp.Qop, dp.Cnonce, dp.Nc = qop, genRandomHex(8), r.nc
+		nc = fmt.Sprintf("%08x", r.nc)
+	}
+	if algorithm == "MD5-sess" && len(dp.Cnonce) == 0 {
+		dp.Cnonce = genRandomHex(8)
+	}
+	authorization := NewAuthorization(r.username, challenge.GetRealm(), challenge.GetNonce(), uri, GenDigestResponse(dp),
+		algorithm, dp.Cnonce, challenge.GetOpaque(), dp.Qop, nc, nil)
+	if !r.proxy {
+		sm.SetAuthorization(authorization)
+		return
+	}
+	raw := authorization.Raw()
+	sm.GetGenericHeaders().Add("Proxy-Authorization", strings.TrimSpace(strings.TrimPrefix(raw.String(), "Authorization:")))
+}
+
+// registrationChallenge returns the first Digest challenge of a 401 or of a 407,nil when there is none
+func registrationChallenge(response *SipMsg, proxy bool) *WWWAuthenticate {
+	if !proxy {
+		return response.GetWWWAuthenticate()
+	}
+	for _, value := range response.GetGenericHeaders().Values("Proxy-Authenticate") {
+		challenge := new(WWWAuthenticate)
+		if err := challenge.Parse("WWW-Authenticate: " + value); err == nil {
+			return challenge
+		}
+	}
+	return nil
+}
+
+// registrationAlgorithm reports whether the Digest algorithm of a challenge is supported,MD5 when there is none
+func registrationAlgorithm(algorithm string) bool {
+	switch strings.ToUpper(strings.TrimSpace(algorithm)) {
+	case "", "MD5", "MD5-SESS":
+		return true
+	}
+	return false
+}
+
+// registrationQop returns the qop answering the qop-options of a challenge,auth before auth-int,"" when there are none
+func registrationQop(options string) string {
+	qop := ""
+	for _, option := range strings.Split(options, ",") {
+		switch strings.ToLower(strings.TrimSpace(option)) {
+		case "auth":
+			return "auth"
+		case "auth-int":
+			qop = "auth-int"
+		}
+	}
+	return qop
+}
+
+// registrationGranted returns the expiration granted to contact by the 2xx of a REGISTER requesting expires,
+// the expires of contact in the response or else its Expires. ok is false when the response lists the bindings
+// of the address-of-record without contact,a response without any Contact as GB28181 platforms send grants its Expires.
+func registrationGranted(response *SipMsg, contact *Contact, expires uint32) (granted uint32, ok bool) {
+	bound := len(response.GetContacts()) == 0
+	for _, binding := range response.GetContacts() {
+		if contact == nil || !registrarEqual(binding, contact) {
+			continue
+		}
+		if binding.GetExpires() >= 0 {
+			return uint32(binding.GetExpires()), true
+		}
+		bound = true
+	}
+	if !bound {
+		return 0, false
+	}
+	if response.GetExpires() != nil {
+		return response.GetExpires().GetExpire(), true
+	}
+	return expires, true
+}
@@ -0,0 +1,271 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registrationTest returns the Registration of a camera at 192.168.0.26 on a recording transport,
+// the states it passes through are sent on the channel
+func registrationTest(t *testing.T) (*Registration, *TransactionLayer, *transactionTransport, *ManualClock, chan RegistrationState) {
+	tl, tt, clock := transactionTest("UDP")
+	ua := NewUA(NewFrom("", "<", "sip", "34020000001320000001", "3402000000", 0, "", nil), "UDP", "192.168.0.26", 5060)
+	registrar := new(RequestUri)
+	if err := registrar.Parse("sip:34020000002000000001@192.168.0.108:5060"); err != nil {
+		t.Fatal(err)
+	}
+	registration := NewRegistration(tl, ua, registrar, NewTarget("UDP", "", net.IPv4(192, 168, 0, 108), 5060))
+	registration.SetCredentials("34020000001320000001", "12345678")
+	states := make(chan RegistrationState, 16)
+	registration.SetHandler(func(state RegistrationState, response *SipMsg) {
+		states <- state
+	})
+	return registration, tl, tt, clock, states
+}
+
+// registrationTransport is a transactionTransport failing the messages sent in a canceled context
+type registrationTransport struct {
+	*transactionTransport
+}
+
+func (rt *registrationTransport) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rt.transactionTransport.Send(ctx, sm, target)
+}
+
+// registrationSent returns the only REGISTER sent since the last call
+func registrationSent(t *testing.T, tt *transactionTransport) *SipMsg {
+	sent := tt.take()
+	if len(sent) != 1 {
+		t.Fatal("REGISTER not sent", sent)
+	}
+	return transactionParse(t, sent[0])
+}
+
+// registrationStates returns the states received on states so far
+func registrationStates(states chan RegistrationState) string {
+	var received []string
+	for {
+		select {
+		case state := <-states:
+			received = append(received, state.String())
+		default:
+			return fmt.Sprint(received)
+		}
+	}
+}
+
+func TestRegistration_Register(t *testing.T) {
+	registration, tl, tt, clock, states := registrationTest(t)
+	if err := registration.Register(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	register := registrationSent(t, tt)
+	// the challenge is answered with the next CSeq and the same Call-ID
+	unauthorized := transactionResponse(register, 401)
+	unauthorized.SetWWWAuthenticate(NewWWWAuthenticate("3402000000", "", "9bd055", "", false, "MD5", "auth", nil))
+	tl.Handle(unauthorized, nil)
+	authorized := registrationSent(t, tt)
+	raw := authorized.Raw()
+	fmt.Print(raw.String())
+	authorization := authorized.GetAuthorization()
+	if authorization == nil || authorized.GetCSeq().GetNumber() != register.GetCSeq().GetNumber()+1 || authorized.GetCallID().GetLocalId() != register.GetCallID().GetLocalId() {
+		t.Fatal("REGISTER with credentials mismatch")
+	}
+	dp := &DigestParams{
+		Digest:    Digest{Realm: "3402000000", UserName: "34020000001320000001", Password: "12345678"},
+		Qop:       "auth",
+		Algorithm: "MD5",
+		Method:    "REGISTER",
+		URI:       "sip:34020000002000000001@192.168.0.108:5060",
+		Nonce:     "9bd055",
+		Cnonce:    authorization.GetCNonce(),
+		Nc:        1,
+	}
+	if authorization.GetNc() != "00000001" || authorization.GetResponse() != GenDigestResponse(dp) {
+		t.Error("Digest response mismatch")
+	}
+	// a 423 is answered with the Min-Expires of the registrar
+	brief := transactionResponse(authorized, 423)
+	brief.GetGenericHeaders().Add("Min-Expires", "7200")
+	tl.Handle(brief, nil)
+	longer := registrationSent(t, tt)
+	if longer.GetExpires().GetExpire() != 7200 || longer.GetAuthorization().GetNc() != "00000002" {
+		t.Error("Min-Expires not adopted")
+	}
+	ok := transactionResponse(longer, 200)
+	contact := longer.GetContact()
+	contact.SetExpires(7200)
+	ok.SetContact(contact)
+	tl.Handle(ok, nil)
+	if registration.GetState() != RegistrationRegistered || registration.GetGranted() != 7200 {
+		t.Fatal("not registered", registration.GetState())
+	}
+	// the binding is refreshed 30 seconds before it expires
+	clock.Advance(7169 * time.Second)
+	if sent := tt.take(); len(sent) != 0 {
+		t.Error("binding refreshed early")
+	}
+	clock.Advance(time.Second)
+	refresh := registrationSent(t, tt)
+	if refresh.GetCSeq().GetNumber() != longer.GetCSeq().GetNumber()+1 || refresh.GetExpires().GetExpire() != 7200 {
+		t.Error("refresh mismatch")
+	}
+	tl.Handle(transactionResponse(refresh, 200), nil)
+	// the binding is removed when the registration stops
+	done := make(chan error, 1)
+	go func() {
+		done <- registration.Unregister(context.Background())
+	}()
+	var unregister []string
+	for deadline := time.Now().Add(2 * time.Second); len(unregister) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		unregister = tt.take()
+	}
+	if len(unregister) != 1 || !strings.Contains(unregister[0], "Expires: 0\r\n") {
+		t.Fatal("unregistration not sent", unregister)
+	}
+	tl.Handle(transactionResponse(transactionParse(t, unregister[0]), 200), nil)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if received := registrationStates(states); received != "[Registering Registered Unregistering Unregistered]" {
+		t.Error("states mismatch", received)
+	}
+}
+
+func TestRegistration_Fail(t *testing.T) {
+	registration, tl, tt, _, states := registrationTest(t)
+	registration.Register(context.Background())
+	register := registrationSent(t, tt)
+	// credentials rejected by a 407 of the same challenge
+	required := transactionResponse(register, 407)
+	required.GetGenericHeaders().Add("Proxy-Authenticate", `Digest realm="3402000000", nonce="5a2f1c"`)
+	tl.Handle(required, nil)
+	authorized := registrationSent(t, tt)
+	if len(authorized.GetGenericHeaders().Values("Proxy-Authorization")) != 1 || authorized.GetAuthorization() != nil {
+		t.Fatal("proxy credentials mismatch")
+	}
+	required = transactionResponse(authorized, 407)
+	required.GetGenericHeaders().Add("Proxy-Authenticate", `Digest realm="3402000000", nonce="5a2f1c"`)
+	tl.Handle(required, nil)
+	if sent := tt.take(); len(sent) != 0 || registration.GetState() != RegistrationFailed {
+		t.Error("rejected credentials sent again")
+	}
+	// a failed registration has no binding to remove
+	if err := registration.Unregister(context.Background()); err != nil || len(tt.take()) != 0 {
+		t.Error("unregistration of a failed registration sent")
+	}
+	if received := registrationStates(states); received != "[Registering Failed]" {
+		t.Error("states mismatch", received)
+	}
+}
+
+func TestRegistration_Close(t *testing.T) {
+	registration, _, _, clock, states := registrationTest(t)
+	rt := &registrationTransport{transactionTransport: &transactionTransport{transport: "UDP"}}
+	tl := NewTransactionLayer(NewTransportLayer(rt), nil)
+	tl.SetClock(clock)
+	registration.transactions = tl
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := registration.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+	register := registrationSent(t, rt.transactionTransport)
+	// the challenge is answered after the context of Register is canceled
+	cancel()
+	unauthorized := transactionResponse(register, 401)
+	unauthorized.SetWWWAuthenticate(NewWWWAuthenticate("3402000000", "", "9bd055", "", false, "MD5", "auth", nil))
+	tl.Handle(unauthorized, nil)
+	authorized := registrationSent(t, rt.transactionTransport)
+	ok := transactionResponse(authorized, 200)
+	ok.SetExpires(NewExpires(600))
+	tl.Handle(ok, nil)
+	if registration.GetState() != RegistrationRegistered || registration.GetGranted() != 600 {
+		t.Fatal("not registered", registration.GetState())
+	}
+	clock.Advance(570 * time.Second)
+	refresh := registrationSent(t, rt.transactionTransport)
+	// a closed registration neither answers a challenge nor refreshes the binding
+	registration.Close()
+	unauthorized = transactionResponse(refresh, 401)
+	unauthorized.SetWWWAuthenticate(NewWWWAuthenticate("3402000000", "", "a6b9f1", "", true, "MD5", "auth", nil))
+	tl.Handle(unauthorized, nil)
+	clock.Advance(600 * time.Second)
+	if sent := rt.take(); len(sent) != 0 {
+		t.Error("REGISTER sent after Close", sent)
+	}
+	if received := registrationStates(states); received != "[Registering Registered]" {
+		t.Error("states mismatch", received)
+	}
+}
+
+func TestRegistration_Granted(t *testing.T) {
+	// the 2xx of a REGISTER decides the binding by the Contacts it lists
+	tests := []struct {
+		contact string
+		state   RegistrationState
+		refresh time.Duration
+	}{
+		{"", RegistrationRegistered, 3570 * time.Second},
+		{"<sip:34020000001320000001@192.168.0.26:5060>;expires=600", RegistrationRegistered, 570 * time.Second},
+		{"<sip:34020000001320000001@192.168.0.26:5060>;expires=2", RegistrationRegistered, registrationFloor},
+		{"<sip:34020000001320000001@192.168.0.26:5060>;expires=0", RegistrationUnregistered, 0},
+		{"<sip:34020000001320000001@192.168.0.27:5060>;expires=600", RegistrationFailed, 0},
+	}
+	for _, test := range tests {
+		registration, tl, tt, clock, _ := registrationTest(t)
+		registration.Register(context.Background())
+		ok := transactionResponse(registrationSent(t, tt), 200)
+		if len(test.contact) > 0 {
+			contact := new(Contact)
+			if err := contact.Parse("Contact: " + test.contact); err != nil {
+				t.Fatal(err)
+			}
+			ok.SetContact(contact)
+		}
+		tl.Handle(ok, nil)
+		if registration.GetState() != test.state {
+			t.Error("state mismatch", test.contact, registration.GetState())
+			continue
+		}
+		if test.refresh == 0 {
+			continue
+		}
+		clock.Advance(test.refresh - time.Millisecond)
+		if sent := tt.take(); len(sent) != 0 {
+			t.Error("binding refreshed early", test.contact)
+		}
+		clock.Advance(time.Millisecond)
+		registrationSent(t, tt)
+	}
+}
+
+func TestRegistration_Algorithm(t *testing.T) {
+	// the algorithm of a challenge is case-insensitive
+	registration, tl, tt, _, _ := registrationTest(t)
+	registration.Register(context.Background())
+	unauthorized := transactionResponse(registrationSent(t, tt), 401)
+	unauthorized.SetWWWAuthenticate(NewWWWAuthenticate("3402000000", "", "9bd055", "", false, "md5-SESS", "auth", nil))
+	tl.Handle(unauthorized, nil)
+	authorization := registrationSent(t, tt).GetAuthorization()
+	dp := &DigestParams{
+		Digest:    Digest{Realm: "3402000000", UserName: "34020000001320000001", Password: "12345678"},
+		Qop:       "auth",
+		Algorithm: "MD5-sess",
+		Method:    "REGISTER",
+		URI:       "sip:34020000002000000001@192.168.0.108:5060",
+		Nonce:     "9bd055",
+		Cnonce:    authorization.GetCNonce(),
+		Nc:        1,
+	}
+	if authorization.GetAlgorithm() != "MD5-sess" || authorization.GetResponse() != GenDigestResponse(dp) {
+		t.Error("MD5-sess credentials mismatch", authorization.GetAlgorithm())
+	}
+}
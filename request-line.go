@@ -2,8 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
@@ -172,67 +170,39 @@ func (rl *RequestLine) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return result
 }
-func (rl *RequestLine) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (rl *RequestLine) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
-	}
-	// method regexp string
-	methodsRegexpStr := `^(?i)(`
-	for _, v := range methods {
-		methodsRegexpStr += v + "|"
-	}
-	methodsRegexpStr = strings.TrimSuffix(methodsRegexpStr, "|")
-	methodsRegexpStr += ")( )?"
-	// method regexp
-	methodRegexp := regexp.MustCompile(methodsRegexpStr)
-
-	// schema regexp string
-	schemasRegexpStr := `( )?(?i)(`
-	for _, v := range schemas {
-		schemasRegexpStr += v + "|"
-	}
-	schemasRegexpStr = strings.TrimSuffix(schemasRegexpStr, "|")
-	schemasRegexpStr += ")( )?"
-	// schema and version regexp
-	schemaAndVersionRegexp := regexp.MustCompile(schemasRegexpStr + `/( )?\d\.\d`)
-
-	if !methodRegexp.MatchString(raw) && !schemaAndVersionRegexp.MatchString(raw) {
-		return
+		return NewParseError("Request-Line", raw, 0, `Request-Line  =  Method SP Request-URI SP SIP-Version CRLF`)
 	}
 	rl.source = raw
 	rl.uri = new(RequestUri)
-	if methodRegexp.MatchString(raw) {
-		method := methodRegexp.FindString(raw)
-		method = stringTrimPrefixAndTrimSuffix(method, " ")
+	// method
+	if method := scanUntil(raw, " "); scanIsMethod(method) {
 		rl.method = method
-		raw = strings.TrimPrefix(raw, method)
+		raw = raw[len(method):]
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(schemasRegexpStr)
-	// version regexp
-	versionRegexp := regexp.MustCompile(`\d\.[0-9]{1}`)
-	if schemaAndVersionRegexp.MatchString(raw) {
-		schemaAndVersion := schemaAndVersionRegexp.FindString(raw)
-		schemaAndVersion = stringTrimPrefixAndTrimSuffix(schemaAndVersion, " ")
-		if schemaRegexp.MatchString(schemaAndVersion) {
-			schema := schemaRegexp.FindString(schemaAndVersion)
-			schema = stringTrimPrefixAndTrimSuffix(schema, " ")
+	// schema and version
+	if index := strings.LastIndexByte(raw, ' '); index >= 0 {
+		if schema, version, ok := scanVersion(raw[index+1:]); ok {
 			rl.schema = schema
-		}
-		if versionRegexp.MatchString(schemaAndVersion) {
-			versions := versionRegexp.Find([]byte(schemaAndVersion))
-			version, _ := strconv.ParseFloat(string(versions), 64)
 			rl.version = version
+			raw = raw[:index]
 		}
-		raw = strings.ReplaceAll(raw, schemaAndVersion, "")
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	if len(strings.TrimSpace(raw)) > 0 {
-
-		rl.uri.Parse(raw)
+	if len(rl.method) == 0 {
+		return NewParseError("Request-Line", rl.source, 0, `Method  =  INVITEm / ACKm / OPTIONSm / BYEm / CANCELm / REGISTERm / extension-method`)
+	}
+	if len(rl.schema) == 0 {
+		return NewParseError("Request-Line", rl.source, len(rl.source), `SIP-Version  =  "SIP" "/" 1*DIGIT "." 1*DIGIT`)
+	}
+	if len(strings.TrimSpace(raw)) == 0 {
+		return NewParseError("Request-Line", rl.source, parseErrorOffset(rl.source, rl.schema), `Request-URI  =  SIP-URI / SIPS-URI / absoluteURI`)
+	}
+	if err := rl.uri.Parse(raw); err != nil {
+		return parseErrorWrap(err, rl.source, raw)
 	}
+	return nil
 }
@@ -3,7 +3,6 @@ package sip
 import (
 	"fmt"
 	"net"
-	"sync"
 	"testing"
 )
 
@@ -11,10 +10,10 @@ func TestRequestLine_Raw(t *testing.T) {
 	reqLines := []*RequestLine{
 		NewRequestLine("register",
 			NewRequestUri(
-				NewSipUri(NewUserInfo("34020000001320000001", "17631300986", ""), NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), NewParameters("udp", "", "", 0, "", false, sync.Map{}), sync.Map{})), "sip", 2.0),
+				NewSipUri(NewUserInfo("34020000001320000001", "17631300986", ""), NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), NewParameters("udp", "", "", 0, "", false, nil), nil)), "sip", 2.0),
 		NewRequestLine("INvite",
 			NewRequestUri(
-				NewSipUri(NewUserInfo("34020000001320000001", "17631300989", "xxYYzz123"), NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), NewParameters("udp", "kokutas", "invite", 0, "192.168.0.1", false, sync.Map{}), sync.Map{})), "sip", 2.0),
+				NewSipUri(NewUserInfo("34020000001320000001", "17631300989", "xxYYzz123"), NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), NewParameters("udp", "kokutas", "invite", 0, "192.168.0.1", false, nil), nil)), "sip", 2.0),
 	}
 	for _, reqLine := range reqLines {
 		result := reqLine.Raw()
@@ -49,14 +48,14 @@ func TestRequestLine_Parse(t *testing.T) {
 			fmt.Println(index, "request-uri->sip/uri->uri-parameters->ttl:", reqLine.uri.sipUri.parameters.ttl)
 			fmt.Println(index, "request-uri->sip/uri->uri-parameters->maddr:", reqLine.uri.sipUri.parameters.maddr)
 			fmt.Println(index, "request-uri->sip/uri->uri-parameters->lr:", reqLine.uri.sipUri.parameters.lr)
-			reqLine.uri.sipUri.parameters.other.Range(func(key, value interface{}) bool {
+			for _, key := range reqLine.uri.sipUri.parameters.other.Names() {
+				value, _ := reqLine.uri.sipUri.parameters.other.Get(key)
 				fmt.Println(index, "request-uri->sip/uri->uri-parameters->other:", key, value)
-				return true
-			})
-			reqLine.uri.sipUri.headers.Range(func(key, value interface{}) bool {
+			}
+			for _, key := range reqLine.uri.sipUri.headers.Names() {
+				value, _ := reqLine.uri.sipUri.headers.Get(key)
 				fmt.Println(index, "request-uri->sip/uri->headers:", key, value)
-				return true
-			})
+			}
 			fmt.Println(index, "schema:", reqLine.schema)
 			fmt.Println(index, "version:", reqLine.version)
 			result := reqLine.Raw()
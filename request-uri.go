@@ -122,13 +122,13 @@ func NewRequestUri(sipUri *SipUri) *RequestUri {
 }
 func (requestUri *RequestUri) Raw() (result strings.Builder) {
 	if requestUri.sipUri == nil {
-		requestUri.sipUri = new(SipUri)
+		return new(SipUri).Raw()
 	}
 	return requestUri.sipUri.Raw()
 }
-func (requestUri *RequestUri) Parse(raw string) {
+func (requestUri *RequestUri) Parse(raw string) error {
 	if requestUri.sipUri == nil {
 		requestUri.sipUri = new(SipUri)
 	}
-	requestUri.sipUri.Parse(raw)
+	return requestUri.sipUri.Parse(raw)
 }
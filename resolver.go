@@ -0,0 +1,100 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.1.1
+//
+// 18.1.1 Sending Requests
+//
+// The client side of the transport layer is responsible for sending the
+// request and receiving responses.  The user of the transport layer
+// passes the client transport the request, an IP address, port,
+// transport, and possibly TTL for multicast destinations.
+//
+// Parsing a host never looks it up,the host of a HostPort is turned into IP addresses
+// with a Resolver only when the transport layer has to contact it.
+
+// Resolver looks up the IP addresses of a hostname
+type Resolver interface {
+	LookupIP(ctx context.Context, host string) ([]net.IP, error)
+}
+
+// NetResolver is a Resolver backed by a net.Resolver,the zero value uses net.DefaultResolver
+type NetResolver struct {
+	resolver *net.Resolver
+}
+
+func (nr *NetResolver) SetResolver(resolver *net.Resolver) {
+	nr.resolver = resolver
+}
+func (nr *NetResolver) GetResolver() *net.Resolver {
+	return nr.resolver
+}
+func NewNetResolver(resolver *net.Resolver) *NetResolver {
+	return &NetResolver{
+		resolver: resolver,
+	}
+}
+
+func (nr *NetResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	resolver := nr.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return resolver.LookupIP(ctx, "ip", host)
+}
+
+// StaticResolver is a Resolver that answers from a fixed table of hosts,
+// it does no network I/O and is meant for tests,example: AddHost("proxy.example.com", net.IPv4(192, 168, 0, 1))
+type StaticResolver struct {
+	hosts map[string][]net.IP // lower-case hostname without the trailing dot
+	mutex sync.RWMutex
+}
+
+func NewStaticResolver() *StaticResolver {
+	return &StaticResolver{
+		hosts: make(map[string][]net.IP),
+	}
+}
+
+// AddHost appends ips to the addresses of host
+func (sr *StaticResolver) AddHost(host string, ips ...net.IP) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	if sr.hosts == nil {
+		sr.hosts = make(map[string][]net.IP)
+	}
+	host = staticResolverKey(host)
+	sr.hosts[host] = append(sr.hosts[host], ips...)
+}
+
+// DelHost removes host and its addresses
+func (sr *StaticResolver) DelHost(host string) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	delete(sr.hosts, staticResolverKey(host))
+}
+
+// LookupIP returns a copy of the addresses of host,a *net.DNSError that is not found when there is none
+func (sr *StaticResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+	ips := sr.hosts[staticResolverKey(host)]
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return append(make([]net.IP, 0, len(ips)), ips...), nil
+}
+
+// staticResolverKey compares hostnames case-insensitively and with or without the trailing dot
+func staticResolverKey(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
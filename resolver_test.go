@@ -0,0 +1,41 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestStaticResolver_LookupIP(t *testing.T) {
+	resolver := NewStaticResolver()
+	resolver.AddHost("proxy.example.com", net.IPv4(192, 168, 0, 1))
+	resolver.AddHost("PROXY.example.com.", net.ParseIP("2001:db8::1"))
+	ips, err := resolver.LookupIP(context.Background(), "proxy.example.com")
+	fmt.Println(ips, err)
+	if err != nil || len(ips) != 2 {
+		t.Error("static resolver lookup mismatch")
+	}
+	ips[0] = nil
+	if ips, _ := resolver.LookupIP(context.Background(), "proxy.example.com"); ips[0] == nil {
+		t.Error("static resolver shares storage")
+	}
+	resolver.DelHost("proxy.example.com")
+	_, err = resolver.LookupIP(context.Background(), "proxy.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Error("expected a not found error", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := resolver.LookupIP(ctx, "proxy.example.com"); err != context.Canceled {
+		t.Error("expected a canceled error", err)
+	}
+}
+
+func TestNetResolver_LookupIP(t *testing.T) {
+	var resolver Resolver = NewNetResolver(nil)
+	ips, err := resolver.LookupIP(context.Background(), "localhost")
+	fmt.Println(ips, err)
+}
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -36,7 +35,7 @@ type Route struct {
 }
 
 func (r *Route) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(route)$`).MatchString(field) {
+	if scanFieldIs(field, "route") {
 		r.field = strings.Title(field)
 	} else {
 		r.field = "Route"
@@ -61,10 +60,11 @@ func NewRoute(nameAddrs ...*NameAddr) *Route {
 	}
 }
 func (r *Route) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(r.field)) == 0 {
-		r.field = "route"
+	field := r.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "route"
 	}
-	result.WriteString(fmt.Sprintf("%s:", strings.Title(r.field)))
+	result.WriteString(fmt.Sprintf("%s:", strings.Title(field)))
 	if r.nameAddrs != nil {
 		for _, nameAddr := range r.nameAddrs {
 			if nameAddr != nil {
@@ -80,57 +80,37 @@ func (r *Route) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return
 }
-func (r *Route) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (r *Route) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Route", raw, 0, `Route  =  "Route" HCOLON route-param *(COMMA route-param)`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(route)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "route")
+	if !ok {
+		return NewParseError("Route", raw, 0, `Route  =  "Route" HCOLON route-param *(COMMA route-param)`)
 	}
-	r.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	r.field = field
 	r.source = raw
 	r.nameAddrs = make([]*NameAddr, 0)
-	raw = fieldRegexp.ReplaceAllString(raw, "")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
 	raw = stringTrimPrefixAndTrimSuffix(raw, ",")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// name-addr regexp
-	nameAddrRegexp := regexp.MustCompile(`>( )*,`)
-	if nameAddrRegexp.MatchString(raw) {
-		rawSlice := strings.Split(raw, ",")
-		if len(rawSlice) == 1 {
-			nameAddrs := regexp.MustCompile(`>`).ReplaceAllString(rawSlice[0], "")
-			nameAddrs = regexp.MustCompile(`<`).ReplaceAllString(nameAddrs, "")
-			nameAddrs = stringTrimPrefixAndTrimSuffix(nameAddrs, " ")
-			nameAddr := new(NameAddr)
-			nameAddr.Parse(nameAddrs)
-			if len(nameAddr.GetSource()) > 0 {
-				r.nameAddrs = append(r.nameAddrs, nameAddr)
-			}
-		} else {
-			for _, raws := range rawSlice {
-				nameAddrs := regexp.MustCompile(`>`).ReplaceAllString(raws, "")
-				nameAddrs = regexp.MustCompile(`<`).ReplaceAllString(nameAddrs, "")
-				nameAddrs = stringTrimPrefixAndTrimSuffix(nameAddrs, " ")
-				nameAddr := new(NameAddr)
-				nameAddr.Parse(nameAddrs)
-				if len(nameAddr.GetSource()) > 0 {
-					r.nameAddrs = append(r.nameAddrs, nameAddr)
-				}
-			}
-		}
-	} else {
-		nameAddrs := regexp.MustCompile(`>`).ReplaceAllString(raw, "")
-		nameAddrs = regexp.MustCompile(`<`).ReplaceAllString(nameAddrs, "")
+	// name-addr,the values are split only when one of them ends with RAQUOT
+	values := []string{raw}
+	if scanIsRaquotComma(raw) {
+		values = strings.Split(raw, ",")
+	}
+	for _, raws := range values {
+		nameAddrs := strings.ReplaceAll(raws, ">", "")
+		nameAddrs = strings.ReplaceAll(nameAddrs, "<", "")
 		nameAddrs = stringTrimPrefixAndTrimSuffix(nameAddrs, " ")
 		nameAddr := new(NameAddr)
-		nameAddr.Parse(nameAddrs)
+		if err := nameAddr.Parse(nameAddrs); err != nil {
+			return parseErrorWrap(err, r.source, nameAddrs)
+		}
 		if len(nameAddr.GetSource()) > 0 {
 			r.nameAddrs = append(r.nameAddrs, nameAddr)
 		}
 	}
+	return nil
 }
@@ -3,18 +3,17 @@ package sip
 import (
 	"fmt"
 	"net"
-	"sync"
 	"testing"
 )
 
 func TestRoute_Raw(t *testing.T) {
-	p := sync.Map{}
-	p.Store("lr", nil)
+	p := NewParams()
+	p.SetFlag("lr")
 	routers := []*Route{
 		NewRoute(
 			NewNameAddr("sip", NewHostPort("www.baidu.com", nil, nil, 5060), p),
-			NewNameAddr("sip", NewHostPort("www.163.com", nil, nil, 0), sync.Map{}),
-			NewNameAddr("sip", NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), sync.Map{}),
+			NewNameAddr("sip", NewHostPort("www.163.com", nil, nil, 0), nil),
+			NewNameAddr("sip", NewHostPort("", net.IPv4(192, 168, 0, 26), nil, 5060), nil),
 		),
 	}
 	for _, route := range routers {
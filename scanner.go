@@ -0,0 +1,293 @@
+package sip
+
+import (
+	"strconv"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-25.1
+//
+// alphanum  =  ALPHA / DIGIT
+// token     =  1*(alphanum / "-" / "." / "!" / "%" / "*"
+//              / "_" / "+" / "`" / "'" / "~" )
+// HCOLON    =  *( SP / HTAB ) ":" SWS
+//
+// The scan functions below take the place of regular expressions on the parsing path,
+// they walk the bytes of a header line once and return substrings of it instead of copies.
+
+// scanLine removes the CR and LF of a header line and the spaces around it
+func scanLine(raw string) string {
+	if strings.IndexByte(raw, '\r') >= 0 {
+		raw = strings.ReplaceAll(raw, "\r", "")
+	}
+	if strings.IndexByte(raw, '\n') >= 0 {
+		raw = strings.ReplaceAll(raw, "\n", "")
+	}
+	return stringTrimPrefixAndTrimSuffix(raw, " ")
+}
+
+// scanField matches the header field name at the start of line case-insensitively against names,
+// field is the text before HCOLON as written,value is the text after it
+func scanField(line string, names ...string) (field string, value string, ok bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return "", line, false
+	}
+	if !scanFieldIs(strings.TrimRight(line[:colon], " \t"), names...) {
+		return "", line, false
+	}
+	return line[:colon], line[colon+1:], true
+}
+
+// scanFieldIs reports whether field is one of names,case-insensitively
+func scanFieldIs(field string, names ...string) bool {
+	for _, name := range names {
+		if strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanIsToken reports whether raw is a non-empty token
+func scanIsToken(raw string) bool {
+	return len(raw) > 0 && scanToken(raw) == len(raw)
+}
+
+// scanToken returns the length of the token at the start of raw
+func scanToken(raw string) int {
+	for index := 0; index < len(raw); index++ {
+		c := raw[index]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-.!%*_+`'~", c) >= 0:
+		default:
+			return index
+		}
+	}
+	return len(raw)
+}
+
+// scanIsDigits reports whether raw is 1*DIGIT
+func scanIsDigits(raw string) bool {
+	return len(raw) > 0 && scanDigits(raw) == len(raw)
+}
+
+// scanDigits returns the length of the digits at the start of raw
+func scanDigits(raw string) int {
+	for index := 0; index < len(raw); index++ {
+		if raw[index] < '0' || raw[index] > '9' {
+			return index
+		}
+	}
+	return len(raw)
+}
+
+// scanUntil returns raw before the first of the bytes in any,all of raw when there is none
+func scanUntil(raw string, any string) string {
+	if index := strings.IndexAny(raw, any); index >= 0 {
+		return raw[:index]
+	}
+	return raw
+}
+
+// scanVersion parses SIP-Version  =  "SIP" "/" 1*DIGIT "." 1*DIGIT,
+// the schema is kept as written and may be any of schemas
+func scanVersion(raw string) (schema string, version float64, ok bool) {
+	slash := strings.IndexByte(raw, '/')
+	if slash <= 0 {
+		return "", 0, false
+	}
+	schema = stringTrimPrefixAndTrimSuffix(raw[:slash], " ")
+	if !scanIsSchema(schema) {
+		return "", 0, false
+	}
+	versions := stringTrimPrefixAndTrimSuffix(raw[slash+1:], " ")
+	major := scanDigits(versions)
+	if major == 0 || major+1 >= len(versions) || versions[major] != '.' || !scanIsDigits(versions[major+1:]) {
+		return "", 0, false
+	}
+	version, _ = strconv.ParseFloat(versions, 64)
+	return schema, version, true
+}
+
+// scanIsSchema reports whether raw is one of schemas,case-insensitively
+func scanIsSchema(raw string) bool {
+	for _, schema := range schemas {
+		if strings.EqualFold(raw, schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanIsMethod reports whether raw is one of methods,case-insensitively
+func scanIsMethod(raw string) bool {
+	for _, method := range methods {
+		if strings.EqualFold(raw, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanIsHostname reports whether raw is hostname  =  *( domainlabel "." ) toplabel [ "." ],
+// a label is letters,digits and inner hyphens
+func scanIsHostname(raw string) bool {
+	raw = strings.TrimSuffix(raw, ".")
+	if len(raw) == 0 {
+		return false
+	}
+	for len(raw) > 0 {
+		label := scanUntil(raw, ".")
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for index := 0; index < len(label); index++ {
+			c := label[index]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+		if len(label) == len(raw) {
+			break
+		}
+		raw = raw[len(label)+1:]
+		if len(raw) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// scanTelephoneSubscriber returns the telephone-subscriber at the start of raw,"" when there is none,
+// example: "010-12345678","+86-010-40020021","+12125551212","13755969903"
+func scanTelephoneSubscriber(raw string) string {
+	// a global number or a local number with up to 4 groups of digits separated by "-"
+	digits := strings.TrimPrefix(raw, "+")
+	groups := strings.Split(digits, "-")
+	if len(groups) >= 2 && len(groups) <= 4 && (len(groups) < 4 || len(groups[0]) <= 3) {
+		matched := true
+		for _, group := range groups {
+			matched = matched && scanIsDigits(group)
+		}
+		if matched {
+			return raw
+		}
+	}
+	if strings.HasPrefix(raw, "+") && scanDigits(digits) > 0 {
+		return raw[:1+scanDigits(digits)]
+	}
+	if len(raw) == 11 && scanIsDigits(raw) {
+		return raw
+	}
+	return ""
+}
+
+// scanIsRaquotComma reports whether a RAQUOT in raw is followed by a COMMA,that is raw holds more than one name-addr
+func scanIsRaquotComma(raw string) bool {
+	for index := strings.IndexByte(raw, '>'); index >= 0; index = strings.IndexByte(raw, '>') {
+		raw = strings.TrimLeft(raw[index+1:], " ")
+		if strings.HasPrefix(raw, ",") {
+			return true
+		}
+	}
+	return false
+}
+
+// scanSchema returns the position of the schema followed by an optional SP and a colon at raw[index:],
+// end is the position after the colon,-1 when there is none
+func scanSchema(raw string, index int) (end int) {
+	if c := raw[index] | 0x20; c != 's' && c != 't' {
+		return -1
+	}
+	for _, schema := range []string{sips, sip, tel} {
+		if len(raw)-index < len(schema) || !strings.EqualFold(raw[index:index+len(schema)], schema) {
+			continue
+		}
+		end = index + len(schema)
+		if end < len(raw) && raw[end] == ' ' {
+			end++
+		}
+		if end < len(raw) && raw[end] == ':' {
+			return end + 1
+		}
+	}
+	return -1
+}
+
+// scanAddr is the ( name-addr / addr-spec ) of a From,To or Contact header field
+type scanAddr struct {
+	name   string // display-name
+	spec   string // the quote before the URI,example: "<"
+	schema string
+	user   string
+	host   string
+	port   uint16
+	params string // the uri-parameters and headers of the URI,example: ";transport=tcp?X=y"
+	rest   string // the text after the URI,where the header parameters are
+}
+
+// scanAddress splits raw into the display-name and the parts of the URI,
+// ok is false when raw has no URI and rest is then the text where the URI was expected
+func scanAddress(raw string) (addr scanAddr, ok bool) {
+	// display-name,the text before the last schema
+	for index := len(raw) - 1; index >= 0; index-- {
+		if scanSchema(raw, index) < 0 {
+			continue
+		}
+		if name := stringTrimPrefixAndTrimSuffix(strings.TrimSuffix(raw[:index], "<"), " "); len(name) > 0 {
+			addr.name = name
+			raw = stringTrimPrefixAndTrimSuffix(raw[len(name):], " ")
+		}
+		break
+	}
+	// spec,the quote before the first schema
+	first, end := scanSchemaFirst(raw)
+	for _, spec := range []string{"'", "\"", "<"} {
+		if index := strings.Index(raw, spec); index >= 0 && index < first {
+			addr.spec = spec
+			raw = stringTrimPrefixAndTrimSuffix(raw[strings.LastIndex(raw[:first], spec)+1:], " ")
+			first, end = scanSchemaFirst(raw)
+			break
+		}
+	}
+	if first < 0 {
+		addr.rest = raw
+		return addr, false
+	}
+	addr.schema = stringTrimPrefixAndTrimSuffix(raw[first:end-1], " ")
+	// the URI ends at the RAQUOT of a name-addr,or at the header parameters of an addr-spec
+	uri := raw[end:]
+	if addr.spec == "<" {
+		uri = scanUntil(uri, ">")
+	} else {
+		uri = scanUntil(uri, "; ")
+	}
+	addr.rest = raw[end+len(uri):]
+	// user
+	if index := strings.LastIndexByte(uri, '@'); index >= 0 {
+		addr.user = stringTrimPrefixAndTrimSuffix(uri[:index], " ")
+		uri = uri[index+1:]
+	}
+	// host and port,then the uri-parameters and headers
+	host := scanUntil(uri, ";?")
+	addr.params = uri[len(host):]
+	if index := strings.LastIndexByte(host, ':'); index >= 0 && index > strings.LastIndexByte(host, ']') && scanIsDigits(host[index+1:]) {
+		port, _ := strconv.Atoi(host[index+1:])
+		addr.port = uint16(port)
+		host = host[:index]
+	}
+	addr.host = stringTrimPrefixAndTrimSuffix(host, " ")
+	return addr, true
+}
+
+// scanSchemaFirst returns the position of the first schema in raw and the position after its colon,-1 when there is none
+func scanSchemaFirst(raw string) (index int, end int) {
+	for index = 0; index < len(raw); index++ {
+		if end = scanSchema(raw, index); end >= 0 {
+			return index, end
+		}
+	}
+	return -1, -1
+}
@@ -1,13 +1,16 @@
 package sip
 
-import "strings"
+import (
+	"bytes"
+	"io"
+	"strings"
+)
 
 type SipMsg struct {
 	*RequestLine
 	*StatusLine
 	*Authorization
 	*CallID
-	*Contact
 	*ContentLength
 	*ContentType
 	*CSeq
@@ -15,16 +18,27 @@ type SipMsg struct {
 	*Expires
 	*From
 	*MaxForwards
-	*Route
 	*Subject
 	*To
 	*UserAgent
-	*Via
 	*Warning
 	*WWWAuthenticate
-	isOrder bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order   chan string // It is convenient to record the order of the original parameter fields when parsing
-	source  string      // source string
+	contacts     []*Contact         // Contact header field values in order
+	recordRoutes []*RecordRoute     // Record-Route header field values in order,the topmost first
+	routes       []*Route           // Route header field values in order,the topmost first
+	vias         []*Via             // Via header field values in order,the topmost first
+	challenges   []*WWWAuthenticate // WWW-Authenticate header field values after the first one in order
+	body         []byte             // message-body
+	generic      *GenericHeaders    // header fields without a typed struct in original order and case
+	headerForm   HeaderForm         // form of the header field names written by Raw
+	joinValues   bool               // write the values of a multi-valued header field comma-joined on a single header line
+	headerOrder  HeaderOrder        // order of the header fields written by Raw
+	customOrder  []string           // header field names written first with HeaderOrderCustom
+	order        []string           // header field names in the order of the parsed message
+	lines        []string           // unfolded header lines left by ParseBytes for the Get methods
+	fields       []uint8            // sipMsgIndex of the header field name of each line left
+	err          error              // error of the first header line left by ParseBytes that does not parse
+	source       string             // source string
 }
 
 func (sm *SipMsg) SetRequestLine(requestLine *RequestLine) {
@@ -40,118 +54,369 @@ func (sm *SipMsg) GetStatusLine() *StatusLine {
 	return sm.StatusLine
 }
 func (sm *SipMsg) SetAuthorization(authorization *Authorization) {
+	sm.drop("authorization")
 	sm.Authorization = authorization
 }
 func (sm *SipMsg) GetAuthorization() *Authorization {
+	sm.load("authorization")
 	return sm.Authorization
 }
 func (sm *SipMsg) SetCallID(callId *CallID) {
+	sm.drop("call-id")
 	sm.CallID = callId
 }
 func (sm *SipMsg) GetCallID() *CallID {
+	sm.load("call-id")
 	return sm.CallID
 }
+
+// SetContact replaces all the Contact header field values with a single one
 func (sm *SipMsg) SetContact(contact *Contact) {
-	sm.Contact = contact
+	sm.drop("contact")
+	sm.contacts = nil
+	if contact != nil {
+		sm.contacts = []*Contact{contact}
+	}
 }
+
+// GetContact returns the first Contact header field value
 func (sm *SipMsg) GetContact() *Contact {
-	return sm.Contact
+	sm.load("contact")
+	if len(sm.contacts) == 0 {
+		return nil
+	}
+	return sm.contacts[0]
+}
+func (sm *SipMsg) SetContacts(contacts []*Contact) {
+	sm.drop("contact")
+	sm.contacts = contacts
+}
+func (sm *SipMsg) GetContacts() []*Contact {
+	sm.load("contact")
+	return sm.contacts
+}
+
+// AddContact appends a Contact header field value,a REGISTER response lists every binding of the address-of-record
+func (sm *SipMsg) AddContact(contact *Contact) {
+	sm.load("contact")
+	if contact != nil {
+		sm.contacts = append(sm.contacts, contact)
+	}
 }
 func (sm *SipMsg) SetContentLength(contentLength *ContentLength) {
+	sm.drop("content-length")
 	sm.ContentLength = contentLength
 }
 func (sm *SipMsg) GetContentLength() *ContentLength {
+	sm.load("content-length")
 	return sm.ContentLength
 }
 func (sm *SipMsg) SetContentType(contentType *ContentType) {
+	sm.drop("content-type")
 	sm.ContentType = contentType
 }
 func (sm *SipMsg) GetContentType() *ContentType {
+	sm.load("content-type")
 	return sm.ContentType
 }
 func (sm *SipMsg) SetCSeq(cseq *CSeq) {
+	sm.drop("cseq")
 	sm.CSeq = cseq
 }
 func (sm *SipMsg) GetCSeq() *CSeq {
+	sm.load("cseq")
 	return sm.CSeq
 }
 func (sm *SipMsg) SetDate(date *Date) {
+	sm.drop("date")
 	sm.Date = date
 }
 func (sm *SipMsg) GetDate() *Date {
+	sm.load("date")
 	return sm.Date
 }
 func (sm *SipMsg) SetExpires(expires *Expires) {
+	sm.drop("expires")
 	sm.Expires = expires
 }
 func (sm *SipMsg) GetExpires() *Expires {
+	sm.load("expires")
 	return sm.Expires
 }
 func (sm *SipMsg) SetFrom(from *From) {
+	sm.drop("from")
 	sm.From = from
 }
 func (sm *SipMsg) GetFrom() *From {
+	sm.load("from")
 	return sm.From
 }
 func (sm *SipMsg) SetMaxForwards(maxForwards *MaxForwards) {
+	sm.drop("max-forwards")
 	sm.MaxForwards = maxForwards
 }
 func (sm *SipMsg) GetMaxForwards() *MaxForwards {
+	sm.load("max-forwards")
 	return sm.MaxForwards
 }
+
+// SetRoute replaces all the Route header field values with a single one
 func (sm *SipMsg) SetRoute(route *Route) {
-	sm.Route = route
+	sm.drop("route")
+	sm.routes = nil
+	if route != nil {
+		sm.routes = []*Route{route}
+	}
 }
+
+// GetRoute returns the topmost Route header field value
 func (sm *SipMsg) GetRoute() *Route {
-	return sm.Route
+	sm.load("route")
+	if len(sm.routes) == 0 {
+		return nil
+	}
+	return sm.routes[0]
+}
+func (sm *SipMsg) SetRoutes(routes []*Route) {
+	sm.drop("route")
+	sm.routes = routes
+}
+func (sm *SipMsg) GetRoutes() []*Route {
+	sm.load("route")
+	return sm.routes
+}
+
+// AddRoute appends a Route header field value at the bottom of the route set
+func (sm *SipMsg) AddRoute(route *Route) {
+	sm.load("route")
+	if route != nil {
+		sm.routes = append(sm.routes, route)
+	}
+}
+
+// PopRoute removes and returns the topmost Route header field value,nil when there is none
+func (sm *SipMsg) PopRoute() *Route {
+	sm.load("route")
+	if len(sm.routes) == 0 {
+		return nil
+	}
+	route := sm.routes[0]
+	sm.routes = sm.routes[1:]
+	return route
+}
+func (sm *SipMsg) SetRecordRoutes(recordRoutes []*RecordRoute) {
+	sm.drop("record-route")
+	sm.recordRoutes = recordRoutes
+}
+func (sm *SipMsg) GetRecordRoutes() []*RecordRoute {
+	sm.load("record-route")
+	return sm.recordRoutes
+}
+
+// PushRecordRoute inserts a Record-Route header field value at the top,
+// a proxy that wishes to remain on the path of future requests in a dialog inserts its own URI
+func (sm *SipMsg) PushRecordRoute(recordRoute *RecordRoute) {
+	sm.load("record-route")
+	if recordRoute != nil {
+		sm.recordRoutes = append([]*RecordRoute{recordRoute}, sm.recordRoutes...)
+	}
 }
 func (sm *SipMsg) SetSubject(subject *Subject) {
+	sm.drop("subject")
 	sm.Subject = subject
 }
 func (sm *SipMsg) GetSubject() *Subject {
+	sm.load("subject")
 	return sm.Subject
 }
 func (sm *SipMsg) SetTo(to *To) {
+	sm.drop("to")
 	sm.To = to
 }
 func (sm *SipMsg) GetTo() *To {
+	sm.load("to")
 	return sm.To
 }
 func (sm *SipMsg) SetUserAgent(userAgent *UserAgent) {
+	sm.drop("user-agent")
 	sm.UserAgent = userAgent
 }
 func (sm *SipMsg) GetUserAgent() *UserAgent {
+	sm.load("user-agent")
 	return sm.UserAgent
 }
+
+// SetVia replaces all the Via header field values with a single one
 func (sm *SipMsg) SetVia(via *Via) {
-	sm.Via = via
+	sm.drop("via")
+	sm.vias = nil
+	if via != nil {
+		sm.vias = []*Via{via}
+	}
 }
+
+// GetVia returns the topmost Via header field value
 func (sm *SipMsg) GetVia() *Via {
-	return sm.Via
+	sm.load("via")
+	if len(sm.vias) == 0 {
+		return nil
+	}
+	return sm.vias[0]
+}
+func (sm *SipMsg) SetVias(vias []*Via) {
+	sm.drop("via")
+	sm.vias = vias
+}
+func (sm *SipMsg) GetVias() []*Via {
+	sm.load("via")
+	return sm.vias
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.6
+//
+// 8. Add a Via header field value
+// The proxy MUST insert a Via header field value into the copy before
+// the existing Via header field values.
+
+// PushVia inserts a Via header field value before the existing ones
+func (sm *SipMsg) PushVia(via *Via) {
+	sm.load("via")
+	if via != nil {
+		sm.vias = append([]*Via{via}, sm.vias...)
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-16.7
+//
+// 3. Via
+// The proxy removes the topmost Via header field value from the response.
+
+// PopVia removes and returns the topmost Via header field value,nil when there is none
+func (sm *SipMsg) PopVia() *Via {
+	sm.load("via")
+	if len(sm.vias) == 0 {
+		return nil
+	}
+	via := sm.vias[0]
+	sm.vias = sm.vias[1:]
+	return via
+}
+
+// SetHeaderForm sets the form of the header field names written by Raw,the compact forms keep a UDP message under the MTU,
+// the header fields of the message are not changed
+func (sm *SipMsg) SetHeaderForm(headerForm HeaderForm) {
+	sm.headerForm = headerForm
+}
+func (sm *SipMsg) GetHeaderForm() HeaderForm {
+	return sm.headerForm
+}
+
+// SetHeaderOrder sets the order of the header fields written by Raw,with HeaderOrderCustom the header fields named by fields
+// (long or compact form) are written first in that order,the other header fields follow in the recommended order
+func (sm *SipMsg) SetHeaderOrder(headerOrder HeaderOrder, fields ...string) {
+	sm.headerOrder = headerOrder
+	sm.customOrder = fields
+}
+func (sm *SipMsg) GetHeaderOrder() HeaderOrder {
+	return sm.headerOrder
+}
+
+// SetJoinValues sets whether the values of Via,Contact,Route and Record-Route are written comma-joined on a single header line,
+// by default each value is written on its own header line
+func (sm *SipMsg) SetJoinValues(joinValues bool) {
+	sm.joinValues = joinValues
+}
+func (sm *SipMsg) GetJoinValues() bool {
+	return sm.joinValues
 }
 func (sm *SipMsg) SetWarning(warning *Warning) {
+	sm.drop("warning")
 	sm.Warning = warning
 }
 func (sm *SipMsg) GetWarning() *Warning {
+	sm.load("warning")
 	return sm.Warning
 }
+
+// SetWWWAuthenticate replaces all the WWW-Authenticate header field values with a single one
 func (sm *SipMsg) SetWWWAuthenticate(wwwAuthenticate *WWWAuthenticate) {
+	sm.drop("www-authenticate")
 	sm.WWWAuthenticate = wwwAuthenticate
+	sm.challenges = nil
 }
+
+// GetWWWAuthenticate returns the first WWW-Authenticate header field value
 func (sm *SipMsg) GetWWWAuthenticate() *WWWAuthenticate {
+	sm.load("www-authenticate")
 	return sm.WWWAuthenticate
 }
+
+// GetWWWAuthenticates returns the WWW-Authenticate header field values in order,a challenge for each realm
+func (sm *SipMsg) GetWWWAuthenticates() []*WWWAuthenticate {
+	sm.load("www-authenticate")
+	if sm.WWWAuthenticate == nil {
+		return nil
+	}
+	return append([]*WWWAuthenticate{sm.WWWAuthenticate}, sm.challenges...)
+}
+
+// AddWWWAuthenticate appends a WWW-Authenticate header field value,
+// example: a proxy collects the challenges of all the 401 responses of a request
+func (sm *SipMsg) AddWWWAuthenticate(wwwAuthenticate *WWWAuthenticate) {
+	sm.load("www-authenticate")
+	switch {
+	case wwwAuthenticate == nil:
+	case sm.WWWAuthenticate == nil:
+		sm.WWWAuthenticate = wwwAuthenticate
+	default:
+		sm.challenges = append(sm.challenges, wwwAuthenticate)
+	}
+}
+func (sm *SipMsg) SetGenericHeaders(genericHeaders *GenericHeaders) {
+	sm.drop("")
+	sm.generic = genericHeaders
+}
+
+// GetGenericHeaders returns the header fields without a typed struct,
+// the collection is created on first use so that headers can be added to a new message
+func (sm *SipMsg) GetGenericHeaders() *GenericHeaders {
+	sm.load("")
+	if sm.generic == nil {
+		sm.generic = NewGenericHeaders()
+	}
+	return sm.generic
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7.4
+//
+// 7.4 Bodies
+//
+// Requests, including new requests defined in extensions to this
+// specification, MAY contain message bodies unless otherwise noted.
+// The interpretation of the body depends on the request method.
+//
+// For response messages, the request method and the response status
+// code determine the type and interpretation of any message body.  All
+// responses MAY include a body.
+
+// SetBody sets the message-body,the Content-Length header field is computed from it when the message is written,
+// the type of the body is still given by the Content-Type header field,example: "Application/MANSCDP+xml","application/sdp"
+func (sm *SipMsg) SetBody(body []byte) {
+	sm.body = body
+}
+func (sm *SipMsg) GetBody() []byte {
+	return sm.body
+}
 func (sm *SipMsg) GetSource() string {
 	return sm.source
 }
 func NewSipMsg(requestLine *RequestLine, statusLine *StatusLine, authorization *Authorization, callId *CallID, contact *Contact, contentLength *ContentLength, contentType *ContentType, cseq *CSeq, date *Date, expires *Expires, from *From, maxForwards *MaxForwards, route *Route, subject *Subject, to *To, userAgent *UserAgent, via *Via, warning *Warning, wwwAuthenticate *WWWAuthenticate) *SipMsg {
 
-	return &SipMsg{
+	sm := &SipMsg{
 		RequestLine:     requestLine,
 		StatusLine:      statusLine,
 		Authorization:   authorization,
 		CallID:          callId,
-		Contact:         contact,
 		ContentLength:   contentLength,
 		ContentType:     contentType,
 		CSeq:            cseq,
@@ -159,27 +424,117 @@ func NewSipMsg(requestLine *RequestLine, statusLine *StatusLine, authorization *
 		Expires:         expires,
 		From:            from,
 		MaxForwards:     maxForwards,
-		Route:           route,
 		Subject:         subject,
 		To:              to,
 		UserAgent:       userAgent,
-		Via:             via,
 		Warning:         warning,
 		WWWAuthenticate: wwwAuthenticate,
-		isOrder:         false,
 	}
+	sm.SetContact(contact)
+	sm.SetRoute(route)
+	sm.SetVia(via)
+	return sm
 }
-func CreateUacSipMsg(headerFields []string, parameters map[string]string) *SipMsg {
-	sm := new(SipMsg)
 
-	return sm
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-8.2.6.2
+//
+// 8.2.6.2 Headers and Tags
+//
+// The From field of the response MUST equal the From header field of
+// the request.  The Call-ID header field of the response MUST equal the
+// Call-ID header field of the request.  The CSeq header field of the
+// response MUST equal the CSeq field of the request.  The Via header
+// field values in the response MUST equal the Via header field values
+// in the request and MUST maintain the same ordering.
+//
+// If a request contained a To tag in the request, the To header field
+// in the response MUST equal that of the request.  However, if the To
+// header field in the request did not contain a tag, the URI in the To
+// header field in the response MUST equal the URI in the To header
+// field; additionally, the UAS MUST add a tag to the To header field in
+// the response (with the exception of the 100 (Trying) response, in
+// which a tag MAY be present).
+
+// NewResponse returns a response to request with copies of its Via,From,To,Call-ID and CSeq header fields,
+// the default reason phrase of statusCode is used when reasonPhrase is empty. The To tag is left to the UAS.
+func NewResponse(request *SipMsg, statusCode uint, reasonPhrase string) *SipMsg {
+	schema, version := "SIP", 2.0
+	if requestLine := request.GetRequestLine(); requestLine != nil {
+		schema, version = requestLine.GetSchema(), requestLine.GetVersion()
+	}
+	if len(reasonPhrase) == 0 {
+		reasonPhrase = statusReasonPhrase(statusCode)
+	}
+	response := new(SipMsg)
+	response.SetStatusLine(NewStatusLine(schema, version, statusCode, reasonPhrase))
+	vias := make([]*Via, 0, len(request.GetVias()))
+	for _, via := range request.GetVias() {
+		if clone := new(Via); sipMsgCopy(via, clone) {
+			vias = append(vias, clone)
+		}
+	}
+	response.SetVias(vias)
+	if from, clone := request.GetFrom(), new(From); from != nil && sipMsgCopy(from, clone) {
+		response.SetFrom(clone)
+	}
+	if to, clone := request.GetTo(), new(To); to != nil && sipMsgCopy(to, clone) {
+		response.SetTo(clone)
+	}
+	if callId, clone := request.GetCallID(), new(CallID); callId != nil && sipMsgCopy(callId, clone) {
+		response.SetCallID(clone)
+	}
+	if cseq, clone := request.GetCSeq(), new(CSeq); cseq != nil && sipMsgCopy(cseq, clone) {
+		response.SetCSeq(clone)
+	}
+	response.SetContentLength(NewContentLength(0))
+	return response
 }
-func CreateUasSipMsg(headerFields []string, parameters map[string]string) *SipMsg {
-	sm := new(SipMsg)
 
-	return sm
+// sipMsgHeader is a header field that is written by Raw and read by Parse
+type sipMsgHeader interface {
+	Raw() strings.Builder
+	Parse(raw string) error
+}
+
+// sipMsgCopy parses what from writes into to,it reports whether to parsed
+func sipMsgCopy(from sipMsgHeader, to sipMsgHeader) bool {
+	raw := from.Raw()
+	return to.Parse(raw.String()) == nil
+}
+
+// Clone returns a copy of sm written by Raw and parsed again,a change to one of them does not change the other
+func (sm *SipMsg) Clone() (*SipMsg, error) {
+	raw := sm.Raw()
+	clone := new(SipMsg)
+	if err := clone.Parse(raw.String()); err != nil {
+		return nil, err
+	}
+	clone.headerForm, clone.joinValues, clone.headerOrder = sm.headerForm, sm.joinValues, sm.headerOrder
+	clone.customOrder = append([]string(nil), sm.customOrder...)
+	return clone, nil
 }
 func (sm *SipMsg) Raw() (result strings.Builder) {
+	sm.write(&result)
+	return
+}
+
+// Bytes returns the message as Raw writes it,the transports write it without a copy of the string of Raw
+func (sm *SipMsg) Bytes() []byte {
+	var buffer bytes.Buffer
+	sm.write(&buffer)
+	return buffer.Bytes()
+}
+
+// sipMsgWriter is the strings.Builder of Raw or the bytes.Buffer of Bytes
+type sipMsgWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+// write writes the start-line,the header fields and the message-body of the message to result
+func (sm *SipMsg) write(result sipMsgWriter) {
+	// the header lines left by ParseBytes are written by their typed header
+	sm.Load()
 	if sm.RequestLine != nil {
 		rl := sm.RequestLine.Raw()
 		result.WriteString(rl.String())
@@ -187,62 +542,695 @@ func (sm *SipMsg) Raw() (result strings.Builder) {
 		sl := sm.StatusLine.Raw()
 		result.WriteString(sl.String())
 	}
-	if sm.Via != nil {
-		via := sm.Via.Raw()
-		result.WriteString(via.String())
+	// header field names in the order to write
+	parsed := sm.headerOrder == HeaderOrderParsed && len(sm.order) > 0
+	names := sipMsgFields
+	switch {
+	case parsed:
+		names = append(append(make([]string, 0, len(sm.order)+len(sipMsgFields)), sm.order...), sipMsgFields...)
+	case sm.headerOrder == HeaderOrderCustom:
+		names = append(append(make([]string, 0, len(sm.customOrder)+len(sipMsgFields)), sm.customOrder...), sipMsgFields...)
+	}
+	var headers strings.Builder
+	written := make(map[string]bool)
+	genericWritten := make(map[*GenericHeader]bool)
+	for _, name := range names {
+		field := sipMsgField(name)
+		if len(field) == 0 {
+			// a parsed name stands for the next generic header field of that name,a custom name for all of them
+			for _, header := range sm.generic.GetHeaders() {
+				if header != nil && !genericWritten[header] && strings.EqualFold(headerFieldLong(header.GetField()), headerFieldLong(name)) {
+					genericWritten[header] = true
+					headerBuilder := header.Raw()
+					headers.WriteString(headerBuilder.String())
+					if parsed {
+						break
+					}
+				}
+			}
+			continue
+		}
+		if written[field] {
+			continue
+		}
+		written[field] = true
+		// a challenge answers the credentials of the request,they are not echoed back
+		if field == "authorization" && sm.WWWAuthenticate != nil && !parsed {
+			continue
+		}
+		// Content-Length is the last header field,the generic header fields go before it
+		if field == "content-length" && !parsed {
+			for _, header := range sm.generic.GetHeaders() {
+				if header != nil && !genericWritten[header] {
+					genericWritten[header] = true
+					headerBuilder := header.Raw()
+					headers.WriteString(headerBuilder.String())
+				}
+			}
+		}
+		headers.WriteString(sm.fieldRaw(field))
+	}
+	for _, header := range sm.generic.GetHeaders() {
+		if header != nil && !genericWritten[header] {
+			headerBuilder := header.Raw()
+			headers.WriteString(headerBuilder.String())
+		}
+	}
+	result.WriteString(headerFormRaw(headers.String(), sm.headerForm))
+	result.WriteString("\r\n")
+	result.Write(sm.body)
+}
+
+// HeaderOrder is the order of the header fields written by SipMsg.Raw
+type HeaderOrder int
+
+const (
+	HeaderOrderParsed      HeaderOrder = iota // the order of the parsed message,the recommended order for a message that was not parsed
+	HeaderOrderRecommended                    // the recommended order,whether the message was parsed or not
+	HeaderOrderCustom                         // the header fields given to SetHeaderOrder first,then the recommended order
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7.3.1
+//
+// The relative order of header fields with different field names is not
+// significant.  However, it is RECOMMENDED that header fields which are
+// needed for proxy processing (Via, Route, Record-Route, Proxy-Require,
+// Max-Forwards, and Proxy-Authorization, for example) appear towards
+// the top of the message to facilitate rapid parsing.
+
+// sipMsgFields is the recommended order of the header fields,Content-Length is the last one
+var sipMsgFields = []string{
+	"via",
+	"route",
+	"record-route",
+	"max-forwards",
+	"from",
+	"to",
+	"call-id",
+	"cseq",
+	"contact",
+	"expires",
+	"www-authenticate",
+	"authorization",
+	"date",
+	"subject",
+	"user-agent",
+	"warning",
+	"content-type",
+	"content-length",
+}
+
+// sipMsgField returns the long lower-case name of a header field name,compact forms included
+func sipMsgField(name string) string {
+	name = headerFieldLong(strings.TrimSpace(name))
+	for _, field := range sipMsgFields {
+		if strings.EqualFold(field, name) {
+			return field
+		}
+	}
+	return ""
+}
+
+// fieldRaw returns the raw header line of a long lower-case header field name
+func (sm *SipMsg) fieldRaw(field string) string {
+	var result strings.Builder
+	switch field {
+	case "via":
+		raws := make([]string, 0)
+		for _, via := range sm.vias {
+			if via != nil {
+				viaBuilder := via.Raw()
+				raws = append(raws, viaBuilder.String())
+			}
+		}
+		return sm.valuesRaw(raws)
+	case "from":
+		if sm.From != nil {
+			result = sm.From.Raw()
+		}
+	case "to":
+		if sm.To != nil {
+			result = sm.To.Raw()
+		}
+	case "call-id":
+		if sm.CallID != nil {
+			result = sm.CallID.Raw()
+		}
+	case "contact":
+		raws := make([]string, 0)
+		for _, contact := range sm.contacts {
+			if contact != nil {
+				contactBuilder := contact.Raw()
+				raws = append(raws, contactBuilder.String())
+			}
+		}
+		return sm.valuesRaw(raws)
+	case "route":
+		raws := make([]string, 0)
+		for _, route := range sm.routes {
+			if route != nil {
+				routeBuilder := route.Raw()
+				raws = append(raws, routeBuilder.String())
+			}
+		}
+		return sm.valuesRaw(raws)
+	case "record-route":
+		raws := make([]string, 0)
+		for _, recordRoute := range sm.recordRoutes {
+			if recordRoute != nil {
+				recordRouteBuilder := recordRoute.Raw()
+				raws = append(raws, recordRouteBuilder.String())
+			}
+		}
+		return sm.valuesRaw(raws)
+	case "user-agent":
+		if sm.UserAgent != nil {
+			result = sm.UserAgent.Raw()
+		}
+	case "cseq":
+		if sm.CSeq != nil {
+			result = sm.CSeq.Raw()
+		}
+	case "expires":
+		if sm.Expires != nil {
+			result = sm.Expires.Raw()
+		}
+	case "max-forwards":
+		if sm.MaxForwards != nil {
+			result = sm.MaxForwards.Raw()
+		}
+	case "date":
+		if sm.Date != nil {
+			result = sm.Date.Raw()
+		}
+	case "subject":
+		if sm.Subject != nil {
+			result = sm.Subject.Raw()
+		}
+	case "warning":
+		if sm.Warning != nil {
+			result = sm.Warning.Raw()
+		}
+	case "content-type":
+		if sm.ContentType != nil {
+			result = sm.ContentType.Raw()
+		}
+	case "content-length":
+		// the size of the message-body when the message is written,the length set in the ContentLength is not used
+		contentLength := NewContentLength(uint(len(sm.body)))
+		if sm.ContentLength != nil {
+			contentLength.SetField(sm.ContentLength.GetField())
+		}
+		result = contentLength.Raw()
+	case "www-authenticate":
+		// a challenge has commas of its own,each value is written on a header line of its own -- RFC 3261 7.3.1
+		for _, wwwAuthenticate := range sm.GetWWWAuthenticates() {
+			wwwAuthenticateBuilder := wwwAuthenticate.Raw()
+			result.WriteString(wwwAuthenticateBuilder.String())
+		}
+	case "authorization":
+		if sm.Authorization != nil {
+			result = sm.Authorization.Raw()
+		}
+	}
+	return result.String()
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7
+//
+// generic-message  =  start-line
+//                     *message-header
+//                     CRLF
+//                     [ message-body ]
+// start-line       =  Request-Line / Status-Line
+
+// Parse parses a whole SIP request or response. Any CRLF appearing before the start-line is ignored,
+// header fields extended over multiple lines by preceding each extra line with SP or HTAB are unfolded
+// and each header field is handed to its typed parser.
+func (sm *SipMsg) Parse(raw string) error {
+	raw = strings.TrimLeft(raw, "\r\n")
+	// header and body separator
+	header, body := raw, ""
+	if index := strings.Index(raw, "\r\n\r\n"); index >= 0 {
+		header, body = raw[:index], raw[index+4:]
+	} else if index := strings.Index(raw, "\n\n"); index >= 0 {
+		header, body = raw[:index], raw[index+2:]
 	}
-	if sm.From != nil {
-		from := sm.From.Raw()
-		result.WriteString(from.String())
+	return sm.parse(raw, header, []byte(body), false)
+}
+
+// ParseBytes parses a SIP request or response read from a transport buffer. Only the start-line,Content-Length
+// and the presence of the mandatory header fields are checked,the other header fields are kept as lines of the
+// message and handed to their typed parser on first use by the Get methods,which skip a header field that does
+// not parse. Load parses all of them at once and returns the first error.
+//
+// The transports reuse their read buffer,so data is not kept: the header is copied into the string the header lines
+// left for later are cut from,and the message-body is copied into the body of the message,each byte is copied once.
+// The source of the message is its header.
+func (sm *SipMsg) ParseBytes(data []byte) error {
+	data = bytes.TrimLeft(data, "\r\n")
+	// header and body separator
+	header, body := data, []byte(nil)
+	if index := bytes.Index(data, []byte("\r\n\r\n")); index >= 0 {
+		header, body = data[:index], data[index+4:]
+	} else if index := bytes.Index(data, []byte("\n\n")); index >= 0 {
+		header, body = data[:index], data[index+2:]
 	}
-	if sm.To != nil {
-		to := sm.To.Raw()
-		result.WriteString(to.String())
+	raw := string(header)
+	return sm.parse(raw, raw, body, true)
+}
+
+// Load parses the header fields left by ParseBytes,the error of the first header field that does not parse is returned
+func (sm *SipMsg) Load() error {
+	sm.load("")
+	for len(sm.lines) > 0 {
+		sm.load(sipMsgName(sm.fields[0]))
 	}
-	if sm.CallID != nil {
-		callId := sm.CallID.Raw()
-		result.WriteString(callId.String())
+	return sm.err
+}
+
+// parse parses the header and the message-body of raw,the body of ParseBytes is still in the buffer of the transport
+// and is copied,the one of Parse is a copy already
+func (sm *SipMsg) parse(raw string, header string, body []byte, lazy bool) error {
+	// the header fields of an earlier parse are not kept,the settings of Raw are
+	*sm = SipMsg{headerForm: sm.headerForm, joinValues: sm.joinValues, headerOrder: sm.headerOrder, customOrder: sm.customOrder}
+	if len(strings.TrimSpace(raw)) == 0 {
+		return NewParseError("SIP-message", raw, 0, `SIP-message  =  Request / Response`)
 	}
-	if sm.Contact != nil {
-		contact := sm.Contact.Raw()
-		result.WriteString(contact.String())
+	lines := sipMsgUnfold(header)
+	if len(lines) == 0 {
+		return NewParseError("SIP-message", raw, 0, `SIP-message  =  Request / Response`)
 	}
-	if sm.Route != nil {
-		route := sm.Route.Raw()
-		result.WriteString(route.String())
+	// start-line
+	if _, _, ok := scanVersion(scanUntil(lines[0], " ")); ok {
+		statusLine := new(StatusLine)
+		if err := statusLine.Parse(lines[0]); err != nil {
+			return parseErrorWrap(err, raw, lines[0])
+		}
+		sm.StatusLine = statusLine
+	} else {
+		requestLine := new(RequestLine)
+		if err := requestLine.Parse(lines[0]); err != nil {
+			return parseErrorWrap(err, raw, lines[0])
+		}
+		sm.RequestLine = requestLine
 	}
-	if sm.UserAgent != nil {
-		userAgent := sm.UserAgent.Raw()
-		result.WriteString(userAgent.String())
+	sm.source = raw
+	sm.lines = nil
+	sm.fields = nil
+	sm.err = nil
+	lines = lines[1:]
+	// message-header
+	sm.sipMsgOrder(lines)
+	for _, line := range lines {
+		index := strings.Index(line, ":")
+		if index <= 0 {
+			return NewParseError("message-header", raw, parseErrorOffset(raw, line), `message-header  =  field-name HCOLON field-value`)
+		}
+		field := sipMsgField(line[:index])
+		// Content-Length frames the message-body,it is never left for later
+		if lazy && field != "content-length" {
+			// the lines left reuse the array of the unfolded lines,a line is read before its index is written
+			if sm.lines == nil {
+				sm.lines, sm.fields = lines[:0], make([]uint8, 0, len(lines))
+			}
+			sm.lines = append(sm.lines, line)
+			sm.fields = append(sm.fields, sipMsgIndex(field))
+			continue
+		}
+		if err := sm.parseLine(field, line); err != nil {
+			return err
+		}
+	}
+	// https://www.rfc-editor.org/rfc/rfc3261.html#section-8.1.1
+	//
+	// A valid SIP request formulated by a UAC MUST, at a minimum, contain
+	// the following header fields: To, From, CSeq, Call-ID, Max-Forwards,
+	// and Via; all of these header fields are mandatory in all SIP
+	// requests.
+	//
+	// Max-Forwards is not required here,a proxy inserts it when it is missing.
+	switch {
+	case len(sm.vias) == 0 && !sm.pending("via"):
+		return NewParseError("Via", raw, len(header), "missing Via header field")
+	case sm.From == nil && !sm.pending("from"):
+		return NewParseError("From", raw, len(header), "missing From header field")
+	case sm.To == nil && !sm.pending("to"):
+		return NewParseError("To", raw, len(header), "missing To header field")
+	case sm.CallID == nil && !sm.pending("call-id"):
+		return NewParseError("Call-ID", raw, len(header), "missing Call-ID header field")
+	case sm.CSeq == nil && !sm.pending("cseq"):
+		return NewParseError("CSeq", raw, len(header), "missing CSeq header field")
 	}
-	if sm.CSeq != nil {
-		cseq := sm.CSeq.Raw()
-		result.WriteString(cseq.String())
+	// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.3
+	//
+	// In the case of message-oriented transports (such as UDP), if the
+	// message has a Content-Length header field, the message body is
+	// assumed to contain that many bytes.  Any additional bytes in the
+	// transport packet beyond the end of the body MUST be discarded.  If
+	// the transport packet ends before the end of the message body, this
+	// is considered an error.
+	if sm.ContentLength != nil {
+		if int(sm.ContentLength.GetLength()) > len(body) {
+			return NewParseError("Content-Length", raw, len(raw), "message-body shorter than Content-Length")
+		}
+		body = body[:sm.ContentLength.GetLength()]
 	}
-	if sm.Expires != nil {
-		expires := sm.Expires.Raw()
-		result.WriteString(expires.String())
+	sm.body = nil
+	if len(body) > 0 && lazy {
+		sm.body = append([]byte(nil), body...)
+	} else if len(body) > 0 {
+		sm.body = body
 	}
-	if sm.MaxForwards != nil {
-		if sm.MaxForwards.GetForwards() == 0 {
-			sm.MaxForwards.SetForwards(70)
+	return nil
+}
+
+// sipMsgIndex returns the index plus one of a long lower-case header field name in sipMsgFields,
+// 0 for a header field without a typed struct
+func sipMsgIndex(field string) uint8 {
+	for index, name := range sipMsgFields {
+		if name == field {
+			return uint8(index + 1)
 		}
-		maxForwards := sm.MaxForwards.Raw()
-		result.WriteString(maxForwards.String())
 	}
-	contentLength := sm.ContentLength.Raw()
-	result.WriteString(contentLength.String())
+	return 0
+}
 
-	if sm.WWWAuthenticate != nil {
-		wwwAuthenticate := sm.WWWAuthenticate.Raw()
-		result.WriteString(wwwAuthenticate.String())
-	} else if sm.Authorization != nil {
-		authorization := sm.Authorization.Raw()
-		result.WriteString(authorization.String())
+// sipMsgName returns the long lower-case header field name of a sipMsgIndex
+func sipMsgName(index uint8) string {
+	if index == 0 {
+		return ""
 	}
+	return sipMsgFields[index-1]
+}
 
-	result.WriteString("\r\n")
+// parseLine parses a header line of the message,the offset of an error is counted in the whole message
+func (sm *SipMsg) parseLine(field string, line string) error {
+	if len(field) == 0 {
+		header := new(GenericHeader)
+		if err := header.Parse(line); err != nil {
+			return parseErrorWrap(err, sm.source, line)
+		}
+		if sm.generic == nil {
+			sm.generic = NewGenericHeaders()
+		}
+		sm.generic.headers = append(sm.generic.headers, header)
+		return nil
+	}
+	if err := sm.parseField(field, line); err != nil {
+		// a folded header line is not found in the message as is,the offset is then counted from its field-name
+		if !strings.Contains(sm.source, line) {
+			return parseErrorWrap(err, sm.source, line[:strings.Index(line, ":")])
+		}
+		return parseErrorWrap(err, sm.source, line)
+	}
+	return nil
+}
+
+// pending reports whether a header line of a long lower-case header field name is left by ParseBytes
+func (sm *SipMsg) pending(field string) bool {
+	index := sipMsgIndex(field)
+	for _, pending := range sm.fields {
+		if pending == index {
+			return true
+		}
+	}
+	return false
+}
+
+// load hands the header lines of a long lower-case header field name left by ParseBytes to their typed parser,
+// "" loads the header fields without a typed struct
+func (sm *SipMsg) load(field string) {
+	if !sm.pending(field) {
+		return
+	}
+	// the lines kept are moved to the front of the same arrays
+	index := sipMsgIndex(field)
+	lines, fields := sm.lines, sm.fields
+	sm.lines, sm.fields = lines[:0], fields[:0]
+	for i, line := range lines {
+		if fields[i] != index {
+			sm.lines, sm.fields = append(sm.lines, line), append(sm.fields, fields[i])
+			continue
+		}
+		if err := sm.parseLine(field, line); err != nil && sm.err == nil {
+			sm.err = err
+		}
+	}
+}
+
+// drop discards the header lines of a long lower-case header field name left by ParseBytes,the header field is being set
+func (sm *SipMsg) drop(field string) {
+	if !sm.pending(field) {
+		return
+	}
+	// the lines kept are moved to the front of the same arrays
+	index := sipMsgIndex(field)
+	lines, fields := sm.lines, sm.fields
+	sm.lines, sm.fields = lines[:0], fields[:0]
+	for i, line := range lines {
+		if fields[i] != index {
+			sm.lines, sm.fields = append(sm.lines, line), append(sm.fields, fields[i])
+		}
+	}
+}
+
+// parseField parses a header line into the typed header of a long lower-case header field name,
+// the values of Via,Contact,Route and Record-Route are appended in order whether they are comma-joined
+// on one header line or repeated on several header lines,the WWW-Authenticate header lines are appended in order,
+// for any other header field the last one wins
+func (sm *SipMsg) parseField(field string, line string) error {
+	switch field {
+	case "via":
+		for _, value := range sipMsgValues(line) {
+			via := new(Via)
+			if err := via.Parse(value); err != nil {
+				return sipMsgValueError(err, line, value)
+			}
+			sm.vias = append(sm.vias, via)
+		}
+	case "from":
+		from := new(From)
+		if err := from.Parse(line); err != nil {
+			return err
+		}
+		sm.From = from
+	case "to":
+		to := new(To)
+		if err := to.Parse(line); err != nil {
+			return err
+		}
+		sm.To = to
+	case "call-id":
+		callId := new(CallID)
+		if err := callId.Parse(line); err != nil {
+			return err
+		}
+		sm.CallID = callId
+	case "contact":
+		for _, value := range sipMsgValues(line) {
+			contact := new(Contact)
+			if err := contact.Parse(value); err != nil {
+				return sipMsgValueError(err, line, value)
+			}
+			sm.contacts = append(sm.contacts, contact)
+		}
+	case "route":
+		for _, value := range sipMsgValues(line) {
+			route := new(Route)
+			if err := route.Parse(value); err != nil {
+				return sipMsgValueError(err, line, value)
+			}
+			sm.routes = append(sm.routes, route)
+		}
+	case "record-route":
+		for _, value := range sipMsgValues(line) {
+			recordRoute := new(RecordRoute)
+			if err := recordRoute.Parse(value); err != nil {
+				return sipMsgValueError(err, line, value)
+			}
+			sm.recordRoutes = append(sm.recordRoutes, recordRoute)
+		}
+	case "user-agent":
+		userAgent := new(UserAgent)
+		if err := userAgent.Parse(line); err != nil {
+			return err
+		}
+		sm.UserAgent = userAgent
+	case "cseq":
+		cseq := new(CSeq)
+		if err := cseq.Parse(line); err != nil {
+			return err
+		}
+		sm.CSeq = cseq
+	case "expires":
+		expires := new(Expires)
+		if err := expires.Parse(line); err != nil {
+			return err
+		}
+		sm.Expires = expires
+	case "max-forwards":
+		maxForwards := new(MaxForwards)
+		if err := maxForwards.Parse(line); err != nil {
+			return err
+		}
+		sm.MaxForwards = maxForwards
+	case "date":
+		date := new(Date)
+		if err := date.Parse(line); err != nil {
+			return err
+		}
+		sm.Date = date
+	case "subject":
+		subject := new(Subject)
+		if err := subject.Parse(line); err != nil {
+			return err
+		}
+		sm.Subject = subject
+	case "warning":
+		warning := new(Warning)
+		if err := warning.Parse(line); err != nil {
+			return err
+		}
+		sm.Warning = warning
+	case "content-type":
+		contentType := new(ContentType)
+		if err := contentType.Parse(line); err != nil {
+			return err
+		}
+		sm.ContentType = contentType
+	case "content-length":
+		contentLength := new(ContentLength)
+		if err := contentLength.Parse(line); err != nil {
+			return err
+		}
+		sm.ContentLength = contentLength
+	case "www-authenticate":
+		wwwAuthenticate := new(WWWAuthenticate)
+		if err := wwwAuthenticate.Parse(line); err != nil {
+			return err
+		}
+		if sm.WWWAuthenticate == nil {
+			sm.WWWAuthenticate = wwwAuthenticate
+		} else {
+			sm.challenges = append(sm.challenges, wwwAuthenticate)
+		}
+	case "authorization":
+		authorization := new(Authorization)
+		if err := authorization.Parse(line); err != nil {
+			return err
+		}
+		sm.Authorization = authorization
+	}
+	return nil
+}
+
+// sipMsgUnfold splits the header part of a message into lines and joins folded continuation lines
+func sipMsgUnfold(raw string) (lines []string) {
+	lines = make([]string, 0, strings.Count(raw, "\n")+1)
+	for len(raw) > 0 {
+		line := raw
+		if index := strings.IndexByte(raw, '\n'); index >= 0 {
+			line, raw = raw[:index], raw[index+1:]
+		} else {
+			raw = ""
+		}
+		line = strings.TrimSuffix(line, "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
 	return
 }
-func (sm *SipMsg) Parse(raw string)       {}
-func (sm *SipMsg) sipMsgOrder(raw string) {}
+func (sm *SipMsg) sipMsgOrder(lines []string) {
+	sm.order = make([]string, 0, len(lines))
+	for _, line := range lines {
+		if index := strings.Index(line, ":"); index > 0 {
+			sm.order = append(sm.order, strings.TrimSpace(line[:index]))
+		}
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7.3.1
+//
+// Multiple header field rows with the same field-name MAY be present in a
+// message if and only if the entire field-value for that header field is
+// defined as a comma-separated list [i.e., #(values)].  It MUST be
+// possible to combine the multiple header field rows into one "field-
+// name: field-value" pair, without changing the semantics of the
+// message, by appending each subsequent field-value to the first, each
+// separated by a comma.
+
+// sipMsgValues splits a header line of a comma-separated list into one header line per value,
+// commas inside a quoted-string or between "<" and ">" do not separate values
+func sipMsgValues(line string) (lines []string) {
+	index := strings.Index(line, ":")
+	if index < 0 {
+		return []string{line}
+	}
+	name, value := line[:index+1], line[index+1:]
+	quoted, escaped, angle, start := false, false, false, 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && value[i] == '\\':
+			escaped = true
+		case value[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case value[i] == '<':
+			angle = true
+		case value[i] == '>':
+			angle = false
+		case value[i] == ',' && !angle:
+			if len(strings.TrimSpace(value[start:i])) > 0 {
+				lines = append(lines, name+" "+strings.TrimSpace(value[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	if len(strings.TrimSpace(value[start:])) > 0 || len(lines) == 0 {
+		lines = append(lines, name+" "+strings.TrimSpace(value[start:]))
+	}
+	return
+}
+
+// sipMsgValueError moves the offset of an error returned for a single value header line back into the whole header line
+func sipMsgValueError(err error, line string, value string) error {
+	pe, ok := err.(*ParseError)
+	if !ok {
+		return err
+	}
+	index := strings.Index(value, ":")
+	offset := pe.GetOffset()
+	if offset > index+1 {
+		offset += parseErrorOffset(line, value[index+2:]) - (index + 2)
+	}
+	return NewParseError(pe.GetField(), line, offset, pe.GetRule())
+}
+
+// valuesRaw writes the header lines of a multi-valued header field,one header line per value by default,
+// or a single header line with the values comma-joined when SetJoinValues(true)
+func (sm *SipMsg) valuesRaw(raws []string) string {
+	if !sm.joinValues || len(raws) == 0 {
+		return strings.Join(raws, "")
+	}
+	var result strings.Builder
+	result.WriteString(strings.TrimSuffix(raws[0], "\r\n"))
+	for _, raw := range raws[1:] {
+		raw = strings.TrimSuffix(raw, "\r\n")
+		if index := strings.Index(raw, ":"); index >= 0 {
+			raw = raw[index+1:]
+		}
+		result.WriteString(", ")
+		result.WriteString(strings.TrimSpace(raw))
+	}
+	result.WriteString("\r\n")
+	return result.String()
+}
@@ -3,7 +3,7 @@ package sip
 import (
 	"fmt"
 	"net"
-	"sync"
+	"strings"
 	"testing"
 )
 
@@ -27,13 +27,13 @@ func TestSipMsg_Raw(t *testing.T) {
 			NewUserInfo(uasId, "", ""),
 			NewHostPort("", uasIp, nil, uasPort),
 			nil,
-			sync.Map{}))
+			nil))
 	reqLine := NewRequestLine(method, reqUri, schema, version)
-	from := NewFrom("", "<", schema, uacId, uacIp.String(), uacPort, "123", sync.Map{})
-	to := NewTo("", "<", schema, uacId, uacIp.String(), uacPort, "", sync.Map{})
-	contact := NewContact("", "<", schema, uasId, uasIp.String(), uasPort, "", -1, sync.Map{})
+	from := NewFrom("", "<", schema, uacId, uacIp.String(), uacPort, "123", nil)
+	to := NewTo("", "<", schema, uacId, uacIp.String(), uacPort, "", nil)
+	contact := NewContact("", "<", schema, uasId, uasIp.String(), uasPort, "", -1, nil)
 	callId := NewCallID("abcdefg", uacIp.String())
-	via := NewVia(schema, 2.0, transport, uasIp.String(), uasPort, 0, "", "", "xxxxx", 0, "", sync.Map{})
+	via := NewVia(schema, 2.0, transport, uasIp.String(), uasPort, 0, "", "", "xxxxx", 0, "", nil)
 	expires := NewExpires(expire)
 	maxForwards := NewMaxForwards(70)
 	contentLength := NewContentLength(0)
@@ -64,7 +64,7 @@ func TestSipMsg_Raw(t *testing.T) {
 	statusLine = NewStatusLine(schema, version, 401, ClientError[401])
 	sm.GetTo().SetTag("456")
 	nonce := GenNonce(uacIp.String(), callId.GetSource())
-	wwwAuthenticate := NewWWWAuthenticate(uasId[:10], "", nonce, "", false, algorithm, "", sync.Map{})
+	wwwAuthenticate := NewWWWAuthenticate(uasId[:10], "", nonce, "", false, algorithm, "", nil)
 	sm.SetStatusLine(statusLine)
 	sm.SetWWWAuthenticate(wwwAuthenticate)
 	result = sm.Raw()
@@ -81,10 +81,544 @@ func TestSipMsg_Raw(t *testing.T) {
 		Nonce:     nonce,
 	}
 	response := GenDigestResponse(dp)
-	authorization := NewAuthorization(uacId, uasId[:10], nonce, reqUri, response, algorithm, "", "", "", "", sync.Map{})
+	authorization := NewAuthorization(uacId, uasId[:10], nonce, reqUri, response, algorithm, "", "", "", "", nil)
 	sm.SetRequestLine(reqLine)
 	sm.SetAuthorization(authorization)
 	result = sm.Raw()
 	fmt.Print(result.String())
 
 }
+
+func TestSipMsg_Parse(t *testing.T) {
+	raws := []string{
+		"REGISTER sip:34020000002000000001@192.168.0.108:5060 SIP/2.0\r\n" +
+			"Via: SIP/2.0/UDP 192.168.0.26:5060;rport;branch=z9hG4bK1371463273\r\n" +
+			"From: <sip:34020000001320000001@192.168.0.26:5060>;tag=2043466181\r\n" +
+			"To: <sip:34020000001320000001@192.168.0.26:5060>\r\n" +
+			"Call-ID: 1011047669@192.168.0.26\r\n" +
+			"CSeq: 1 REGISTER\r\n" +
+			"Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n" +
+			"Max-Forwards: 70\r\n" +
+			"User-Agent: IP Camera\r\n" +
+			"Expires: 3600\r\n" +
+			"Content-Length: 0\r\n\r\n",
+		"\r\n\r\nSIP/2.0 401 Unauthorized\r\n" +
+			"v: SIP/2.0/UDP 192.168.0.26:5060;rport=5060;received=192.168.0.26;branch=z9hG4bK1371463273\r\n" +
+			"f: <sip:34020000001320000001@192.168.0.26:5060>;tag=2043466181\r\n" +
+			"t: <sip:34020000001320000001@192.168.0.26:5060>;tag=1706594930\r\n" +
+			"i: 1011047669@192.168.0.26\r\n" +
+			"CSeq: 1 REGISTER\r\n" +
+			"WWW-Authenticate: Digest realm=\"3402000000\",\r\n" +
+			" nonce=\"a2f61c3bbd7ab3f4\", algorithm=MD5\r\n" +
+			"l: 0\r\n\r\n",
+		"MESSAGE sip:34020000002000000001@3402000000 SIP/2.0\n" +
+			"Via: SIP/2.0/UDP 192.168.0.26:5060;rport;branch=z9hG4bK1371463274\n" +
+			"From: <sip:34020000001320000001@3402000000>;tag=2043466182\n" +
+			"To: <sip:34020000002000000001@3402000000>\n" +
+			"Call-ID: 1011047670@192.168.0.26\n" +
+			"CSeq: 20 MESSAGE\n" +
+			"Content-Type: Application/MANSCDP+xml\n" +
+			"Max-Forwards: 70\n" +
+			"Content-Length: 5\n\n" +
+			"<?xml version=\"1.0\"?>",
+	}
+	for index, raw := range raws {
+		sm := new(SipMsg)
+		if err := sm.Parse(raw); err != nil {
+			t.Errorf("%d: %v", index, err)
+			continue
+		}
+		if len(sm.GetSource()) == 0 {
+			t.Errorf("%d: message not parsed", index)
+			continue
+		}
+		if sm.GetVia() == nil || sm.GetFrom() == nil || sm.GetTo() == nil || sm.GetCallID() == nil || sm.GetCSeq() == nil {
+			t.Errorf("%d: mandatory header fields not parsed", index)
+			continue
+		}
+		fmt.Println(index, "branch:", sm.GetVia().GetBranch(), "cseq:", sm.GetCSeq().GetNumber(), sm.GetCSeq().GetMethod(), "call-id:", sm.GetCallID().GetLocalId())
+		result := sm.Raw()
+		fmt.Print(result.String())
+	}
+}
+
+func TestSipMsg_ParseAgain(t *testing.T) {
+	// a message parsed into a SipMsg used before keeps nothing of the earlier one
+	first := strings.Replace(sipMsgRegister, "Expires: 3600\r\n",
+		"Expires: 3600\r\nVia: SIP/2.0/UDP 192.168.0.1:5060;branch=z9hG4bK1\r\nRoute: <sip:192.168.0.1;lr>\r\nRecord-Route: <sip:192.168.0.1;lr>\r\n"+
+			"WWW-Authenticate: Digest realm=\"a\", nonce=\"1\"\r\nWWW-Authenticate: Digest realm=\"b\", nonce=\"2\"\r\nX-Test: 1\r\n", 1)
+	for _, parse := range []func(sm *SipMsg, raw string) error{
+		func(sm *SipMsg, raw string) error { return sm.Parse(raw) },
+		func(sm *SipMsg, raw string) error { return sm.ParseBytes([]byte(raw)) },
+	} {
+		sm := new(SipMsg)
+		if err := parse(sm, first); err != nil {
+			t.Fatal(err)
+		}
+		if len(sm.GetVias()) != 2 || len(sm.GetContacts()) != 1 || len(sm.GetWWWAuthenticates()) != 2 {
+			t.Fatal("first message mismatch")
+		}
+		if err := parse(sm, sipMsgMessage); err != nil {
+			t.Fatal(err)
+		}
+		if len(sm.GetVias()) != 1 || len(sm.GetContacts()) != 0 || len(sm.GetRoutes()) != 0 || len(sm.GetRecordRoutes()) != 0 ||
+			sm.GetWWWAuthenticate() != nil || len(sm.GetWWWAuthenticates()) != 0 || sm.GetExpires() != nil || len(sm.GetGenericHeaders().Values("X-Test")) != 0 {
+			t.Error("header fields of the first message kept")
+		}
+		if result := sm.Raw(); result.String() != sipMsgMessage {
+			t.Error("raw mismatch", result.String())
+		}
+	}
+}
+
+func TestSipMsg_MultiValued(t *testing.T) {
+	raw := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/UDP proxy.biloxi.com;branch=z9hG4bK2, SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1\r\n" +
+		"Via: SIP/2.0/UDP 192.168.0.27:5060;branch=z9hG4bK0\r\n" +
+		"Record-Route: <sip:server10.biloxi.com;lr>, <sip:bigbox3.site3.atlanta.com;lr>\r\n" +
+		"From: <sip:34020000001320000001@192.168.0.26:5060>;tag=2043466181\r\n" +
+		"To: <sip:34020000001320000001@192.168.0.26:5060>;tag=1706594930\r\n" +
+		"Call-ID: 1011047669@192.168.0.26\r\n" +
+		"CSeq: 2 REGISTER\r\n" +
+		"Contact: \"a,b\" <sip:34020000001320000001@192.168.0.26:5060>;expires=3600, <sip:34020000001320000001@192.168.0.27:5060>;expires=1800\r\n" +
+		"Contact: <sip:34020000001320000001@192.168.0.28:5060>;expires=60\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.GetVias()) != 3 || len(sm.GetContacts()) != 3 || len(sm.GetRecordRoutes()) != 2 {
+		t.Fatalf("vias: %d,contacts: %d,record-routes: %d", len(sm.GetVias()), len(sm.GetContacts()), len(sm.GetRecordRoutes()))
+	}
+	result := sm.Raw()
+	fmt.Print(result.String())
+	// a proxy forwarding the response removes its own Via
+	via := sm.PopVia()
+	if via.GetBranch() != "z9hG4bK2" || sm.GetVia().GetBranch() != "z9hG4bK1" {
+		t.Error("pop via mismatch")
+	}
+	sm.PushVia(via)
+	if sm.GetVia() != via {
+		t.Error("push via mismatch")
+	}
+	sm.SetJoinValues(true)
+	result = sm.Raw()
+	fmt.Print(result.String())
+	if strings.Count(result.String(), "Via:") != 1 || strings.Count(result.String(), "Contact:") != 1 {
+		t.Error("values not joined")
+	}
+	// re-parse the joined form
+	joined := new(SipMsg)
+	if err := joined.Parse(result.String()); err != nil {
+		t.Fatal(err)
+	}
+	if len(joined.GetVias()) != 3 || len(joined.GetContacts()) != 3 || len(joined.GetRecordRoutes()) != 2 {
+		t.Errorf("joined vias: %d,contacts: %d,record-routes: %d", len(joined.GetVias()), len(joined.GetContacts()), len(joined.GetRecordRoutes()))
+	}
+}
+
+func TestSipMsg_Challenges(t *testing.T) {
+	raw := "SIP/2.0 401 Unauthorized\r\n" +
+		"Via: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=2043466181\r\n" +
+		"To: <sip:34020000001320000001@3402000000>;tag=1706594930\r\n" +
+		"Call-ID: 1011047669@192.168.0.26\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		"WWW-Authenticate: Digest realm=\"3402000000\",nonce=\"9bd055\"\r\n" +
+		"WWW-Authenticate: Digest realm=\"3402000001\",nonce=\"5a2f1c\"\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	// a challenge for each realm,a forking proxy aggregates them
+	challenges := sm.GetWWWAuthenticates()
+	if len(challenges) != 2 || challenges[0] != sm.GetWWWAuthenticate() {
+		t.Fatal("challenges mismatch", len(challenges))
+	}
+	result := sm.Raw()
+	fmt.Print(result.String())
+	if strings.Count(result.String(), "WWW-Authenticate:") != 2 {
+		t.Error("challenges not written")
+	}
+	sm.SetWWWAuthenticate(challenges[1])
+	if len(sm.GetWWWAuthenticates()) != 1 {
+		t.Error("challenges not replaced")
+	}
+}
+
+func TestSipMsg_GenericHeaders(t *testing.T) {
+	raw := "MESSAGE sip:34020000002000000001@3402000000 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1371463274\r\n" +
+		"X-GB-Ver: 2.0\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=2043466182\r\n" +
+		"To: <sip:34020000002000000001@3402000000>\r\n" +
+		"Allow: INVITE, ACK, CANCEL\r\n" +
+		"Call-ID: 1011047670@192.168.0.26\r\n" +
+		"CSeq: 20 MESSAGE\r\n" +
+		"allow: BYE\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if sm.GetGenericHeaders().Get("x-gb-ver") != "2.0" || len(sm.GetGenericHeaders().Values("Allow")) != 2 {
+		t.Error("generic header fields not parsed")
+	}
+	result := sm.Raw()
+	fmt.Print(result.String())
+	if result.String() != raw {
+		t.Error("generic header fields not written in original order and case")
+	}
+}
+
+func TestSipMsg_Body(t *testing.T) {
+	body := "<?xml version=\"1.0\"?>\r\n" +
+		"<Notify>\r\n" +
+		"<CmdType>Keepalive</CmdType>\r\n" +
+		"<SN>1</SN>\r\n" +
+		"<DeviceID>34020000001320000001</DeviceID>\r\n" +
+		"<Status>OK</Status>\r\n" +
+		"</Notify>\r\n"
+	raw := "MESSAGE sip:34020000002000000001@3402000000 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1371463274\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=2043466182\r\n" +
+		"To: <sip:34020000002000000001@3402000000>\r\n" +
+		"Call-ID: 1011047670@192.168.0.26\r\n" +
+		"CSeq: 20 MESSAGE\r\n" +
+		"Content-Type: Application/MANSCDP+xml\r\n" +
+		"Max-Forwards: 70\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n", len(body)) +
+		body
+	sm := new(SipMsg)
+	if err := sm.Parse(raw + "garbage after the body"); err != nil {
+		t.Fatal(err)
+	}
+	if string(sm.GetBody()) != body {
+		t.Errorf("body mismatch: %q", sm.GetBody())
+	}
+	result := sm.Raw()
+	fmt.Print(result.String())
+	if result.String() != raw {
+		t.Error("message with body not written back")
+	}
+	// Content-Length follows the body
+	sm.SetBody([]byte("<Notify></Notify>"))
+	result = sm.Raw()
+	if !strings.Contains(result.String(), "Content-Length: 17\r\n\r\n<Notify></Notify>") {
+		t.Error("Content-Length not computed from the body")
+	}
+	sm.SetBody(nil)
+	result = sm.Raw()
+	if !strings.HasSuffix(result.String(), "Content-Length: 0\r\n\r\n") {
+		t.Error("Content-Length of an empty body is not 0")
+	}
+	// the datagram ends before the end of the message body
+	if err := new(SipMsg).Parse(raw[:len(raw)-10]); err == nil {
+		t.Error("body shorter than Content-Length accepted")
+	}
+}
+
+func TestSipMsg_HeaderForm(t *testing.T) {
+	raw := "INVITE sip:34020000001320000001@3402000000 SIP/2.0\r\n" +
+		"v: SIP/2.0/UDP 192.168.0.108:5060;branch=z9hG4bK1371463275\r\n" +
+		"f: <sip:34020000002000000001@3402000000>;tag=2043466183\r\n" +
+		"t: <sip:34020000001320000001@3402000000>\r\n" +
+		"i: 1011047671@192.168.0.108\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"m: <sip:34020000002000000001@192.168.0.108:5060>\r\n" +
+		"k: timer\r\n" +
+		"s: 34020000001320000001:0,34020000002000000001:0\r\n" +
+		"c: application/sdp\r\n" +
+		"l: 0\r\n\r\n"
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if sm.GetContact() == nil || sm.GetSubject() == nil || sm.GetContentType() == nil || sm.GetGenericHeaders().Get("Supported") != "timer" {
+		t.Fatal("compact header fields not parsed")
+	}
+	sm.SetHeaderForm(HeaderFormLong)
+	long := sm.Raw()
+	fmt.Print(long.String())
+	for _, field := range []string{"Via:", "From:", "To:", "Call-ID:", "Contact:", "Supported:", "Subject:", "Content-Type:", "Content-Length:"} {
+		if !strings.Contains(long.String(), "\r\n"+field) {
+			t.Error("long form not written:", field)
+		}
+	}
+	sm.SetHeaderForm(HeaderFormCompact)
+	compact := sm.Raw()
+	fmt.Print(compact.String())
+	if len(compact.String()) >= len(long.String()) {
+		t.Error("compact form not shorter")
+	}
+	for _, field := range []string{"v:", "f:", "t:", "i:", "m:", "k:", "s:", "c:", "l:", "CSeq:"} {
+		if !strings.Contains(compact.String(), "\r\n"+field) {
+			t.Error("compact form not written:", field)
+		}
+	}
+	if sm.GetVia().GetField() != "v" {
+		t.Error("header field changed by Raw")
+	}
+	// compact forms set in lower case
+	via := new(Via)
+	via.SetField("V")
+	contact := new(Contact)
+	contact.SetField("contact")
+	if via.GetField() != "v" || contact.GetField() != "Contact" {
+		t.Error("set field mismatch:", via.GetField(), contact.GetField())
+	}
+}
+
+func TestSipMsg_HeaderOrder(t *testing.T) {
+	raw := "SIP/2.0 401 Unauthorized\r\n" +
+		"To: <sip:34020000001320000001@3402000000>;tag=1706594930\r\n" +
+		"Content-Length: 0\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=2043466181\r\n" +
+		"X-GB-Ver: 2.0\r\n" +
+		"Call-ID: 1011047669@192.168.0.26\r\n" +
+		"Max-Forwards: 0\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		"WWW-Authenticate: Digest realm=\"3402000000\", nonce=\"a2f61c3bbd7ab3f4\", algorithm=MD5\r\n" +
+		"Via: SIP/2.0/UDP 192.168.0.26:5060;branch=z9hG4bK1371463273\r\n\r\n"
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	// parsed order,rendering twice gives the same message
+	first, second := sm.Raw(), sm.Raw()
+	if first.String() != raw || second.String() != raw {
+		t.Errorf("parsed order not kept:\n%s", second.String())
+	}
+	// recommended order
+	sm.SetHeaderOrder(HeaderOrderRecommended)
+	result := sm.Raw()
+	fmt.Print(result.String())
+	lines := strings.Split(strings.TrimSpace(result.String()), "\r\n")
+	if !strings.HasPrefix(lines[1], "Via:") || !strings.HasPrefix(lines[len(lines)-1], "Content-Length:") {
+		t.Error("recommended order mismatch")
+	}
+	if !strings.Contains(result.String(), "Max-Forwards: 0\r\n") || sm.GetMaxForwards().GetForwards() != 0 {
+		t.Error("Max-Forwards changed by Raw")
+	}
+	// custom order,the other header fields follow in the recommended order
+	sm.SetHeaderOrder(HeaderOrderCustom, "i", "x-gb-ver", "CSeq")
+	result = sm.Raw()
+	fmt.Print(result.String())
+	lines = strings.Split(strings.TrimSpace(result.String()), "\r\n")
+	if !strings.HasPrefix(lines[1], "Call-ID:") || !strings.HasPrefix(lines[2], "X-GB-Ver:") || !strings.HasPrefix(lines[3], "CSeq:") || !strings.HasPrefix(lines[4], "Via:") {
+		t.Error("custom order mismatch")
+	}
+}
+
+// sipMsgRegister and sipMsgMessage are the REGISTER and the keep-alive MESSAGE a GB28181 camera sends
+const sipMsgRegister = "REGISTER sip:34020000002000000001@192.168.0.108:5060 SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 192.168.0.26:5060;rport;branch=z9hG4bK1371463273\r\n" +
+	"From: <sip:34020000001320000001@3402000000>;tag=2043466181\r\n" +
+	"To: <sip:34020000001320000001@3402000000>\r\n" +
+	"Call-ID: 1011047669@192.168.0.26\r\n" +
+	"CSeq: 1 REGISTER\r\n" +
+	"Contact: <sip:34020000001320000001@192.168.0.26:5060>\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"User-Agent: IP Camera\r\n" +
+	"Expires: 3600\r\n" +
+	"Content-Length: 0\r\n\r\n"
+const sipMsgMessage = "MESSAGE sip:34020000002000000001@3402000000 SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 192.168.0.26:5060;rport;branch=z9hG4bK1371463274\r\n" +
+	"From: <sip:34020000001320000001@3402000000>;tag=2043466182\r\n" +
+	"To: <sip:34020000002000000001@3402000000>\r\n" +
+	"Call-ID: 1011047670@192.168.0.26\r\n" +
+	"CSeq: 20 MESSAGE\r\n" +
+	"Content-Type: Application/MANSCDP+xml\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"User-Agent: IP Camera\r\n" +
+	"Content-Length: 168\r\n\r\n" +
+	"<?xml version=\"1.0\" encoding=\"GB2312\"?>\r\n" +
+	"<Notify>\r\n" +
+	"<CmdType>Keepalive</CmdType>\r\n" +
+	"<SN>1</SN>\r\n" +
+	"<DeviceID>34020000001320000001</DeviceID>\r\n" +
+	"<Status>OK</Status>\r\n" +
+	"</Notify>\r\n"
+
+func TestSipMsg_ParseBytes(t *testing.T) {
+	for index, raw := range []string{sipMsgRegister, sipMsgMessage} {
+		sm := new(SipMsg)
+		if err := sm.ParseBytes([]byte(raw)); err != nil {
+			t.Errorf("%d: %v", index, err)
+			continue
+		}
+		// the header fields are parsed on first use
+		if sm.From != nil || len(sm.lines) == 0 {
+			t.Errorf("%d: header fields parsed before first use", index)
+		}
+		if sm.GetCSeq().GetNumber() == 0 || sm.GetVia().GetBranch() == "" || sm.GetFrom().GetTag() == "" {
+			t.Errorf("%d: header fields not parsed on first use", index)
+		}
+		if err := sm.Load(); err != nil {
+			t.Errorf("%d: %v", index, err)
+		}
+		eager := new(SipMsg)
+		eager.Parse(raw)
+		lazyResult, eagerResult := sm.Raw(), eager.Raw()
+		fmt.Print(lazyResult.String())
+		if lazyResult.String() != eagerResult.String() || lazyResult.String() != raw || string(sm.Bytes()) != raw {
+			t.Errorf("%d: lazily parsed message mismatch:\n%s", index, lazyResult.String())
+		}
+	}
+	// a malformed header field is skipped by its Get method and reported by Load
+	sm := new(SipMsg)
+	if err := sm.ParseBytes([]byte(strings.Replace(sipMsgRegister, "Expires: 3600", "Expires: x", 1))); err != nil {
+		t.Fatal(err)
+	}
+	if sm.GetExpires() != nil {
+		t.Error("malformed Expires returned")
+	}
+	if err := sm.Load(); err == nil {
+		t.Error("malformed Expires not reported")
+	}
+	// a header field set before its first use replaces the parsed one
+	sm = new(SipMsg)
+	sm.ParseBytes([]byte(sipMsgRegister))
+	sm.SetExpires(NewExpires(0))
+	if sm.GetExpires().GetExpire() != 0 {
+		t.Error("Expires set before first use overwritten")
+	}
+	// the mandatory header fields are still required
+	if err := new(SipMsg).ParseBytes([]byte(strings.Replace(sipMsgRegister, "CSeq: 1 REGISTER\r\n", "", 1))); err == nil {
+		t.Error("missing CSeq accepted")
+	}
+}
+
+func TestSipMsg_NewResponse(t *testing.T) {
+	request := new(SipMsg)
+	if err := request.Parse(sipMsgRegister); err != nil {
+		t.Fatal(err)
+	}
+	response := NewResponse(request, 401, "")
+	result := response.Raw()
+	fmt.Print(result.String())
+	expected := "SIP/2.0 401 Unauthorized\r\n" +
+		"Via: SIP/2.0/UDP 192.168.0.26:5060;rport;branch=z9hG4bK1371463273\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=2043466181\r\n" +
+		"To: <sip:34020000001320000001@3402000000>\r\n" +
+		"Call-ID: 1011047669@192.168.0.26\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	if result.String() != expected {
+		t.Error("response mismatch")
+	}
+	// the header fields are copies
+	response.GetTo().SetTag("456")
+	if request.GetTo().GetTag() != "" {
+		t.Error("To of the request changed")
+	}
+	if response = NewResponse(request, 488, "Bad SDP"); response.GetStatusLine().GetReasonPhrase() != "Bad SDP" {
+		t.Error("reason phrase mismatch")
+	}
+}
+
+func TestSipMsg_Clone(t *testing.T) {
+	sm := new(SipMsg)
+	if err := sm.Parse(sipMsgMessage); err != nil {
+		t.Fatal(err)
+	}
+	sm.SetHeaderForm(HeaderFormCompact)
+	clone, err := sm.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.GetVia().SetBranch("z9hG4bK1")
+	if sm.GetVia().GetBranch() != "z9hG4bK1371463274" {
+		t.Error("Via of the original changed")
+	}
+	clone.GetVia().SetBranch(sm.GetVia().GetBranch())
+	result, cloneResult := sm.Raw(), clone.Raw()
+	fmt.Print(cloneResult.String())
+	if result.String() != cloneResult.String() {
+		t.Error("clone mismatch")
+	}
+}
+
+func TestSipMsg_ParseBytesAllocs(t *testing.T) {
+	for _, test := range []struct {
+		raw     string
+		ceiling float64 // allocations of ParseBytes and the Get methods of a registrar or a keep-alive
+		read    func(sm *SipMsg) bool
+	}{
+		{sipMsgRegister, 39, func(sm *SipMsg) bool {
+			return sm.GetVia() != nil && sm.GetFrom() != nil && sm.GetTo() != nil && sm.GetCallID() != nil && sm.GetCSeq() != nil && sm.GetContact() != nil && sm.GetExpires() != nil
+		}},
+		{sipMsgMessage, 34, func(sm *SipMsg) bool {
+			return sm.GetVia() != nil && sm.GetFrom() != nil && sm.GetTo() != nil && sm.GetCallID() != nil && sm.GetCSeq() != nil && len(sm.GetBody()) > 0
+		}},
+	} {
+		data := []byte(test.raw)
+		lazy := testing.AllocsPerRun(100, func() {
+			sm := new(SipMsg)
+			if err := sm.ParseBytes(data); err != nil || !test.read(sm) {
+				t.Fatal("header fields not parsed", err)
+			}
+		})
+		// Parse of the buffer of a transport needs a string of it
+		eager := testing.AllocsPerRun(100, func() {
+			sm := new(SipMsg)
+			if err := sm.Parse(string(data)); err != nil || !test.read(sm) {
+				t.Fatal("header fields not parsed", err)
+			}
+		})
+		fmt.Println(test.raw[:strings.Index(test.raw, " ")], "ParseBytes:", lazy, "Parse:", eager)
+		if lazy > test.ceiling || lazy >= eager {
+			t.Errorf("%d allocations of ParseBytes,ceiling %d,Parse %d", int(lazy), int(test.ceiling), int(eager))
+		}
+	}
+}
+
+func BenchmarkSipMsg_ParseRegister(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := new(SipMsg).Parse(sipMsgRegister); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSipMsg_ParseMessage(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := new(SipMsg).Parse(sipMsgMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// a registrar reads the Via,From,To,Call-ID,CSeq,Contact and Expires of a REGISTER
+func BenchmarkSipMsg_ParseBytesRegister(b *testing.B) {
+	data := []byte(sipMsgRegister)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sm := new(SipMsg)
+		if err := sm.ParseBytes(data); err != nil {
+			b.Fatal(err)
+		}
+		if sm.GetVia() == nil || sm.GetFrom() == nil || sm.GetTo() == nil || sm.GetCallID() == nil || sm.GetCSeq() == nil || sm.GetContact() == nil || sm.GetExpires() == nil {
+			b.Fatal("header fields not parsed")
+		}
+	}
+}
+
+// a keep-alive answers with the Via,From,To,Call-ID and CSeq of a MESSAGE and reads its body
+func BenchmarkSipMsg_ParseBytesMessage(b *testing.B) {
+	data := []byte(sipMsgMessage)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sm := new(SipMsg)
+		if err := sm.ParseBytes(data); err != nil {
+			b.Fatal(err)
+		}
+		if sm.GetVia() == nil || sm.GetFrom() == nil || sm.GetTo() == nil || sm.GetCallID() == nil || sm.GetCSeq() == nil || len(sm.GetBody()) == 0 {
+			b.Fatal("header fields not parsed")
+		}
+	}
+}
@@ -2,10 +2,7 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261.html#section-25.1
@@ -41,6 +38,12 @@ import (
 //                      ( "udp" / "tcp" / "sctp" / "tls"
 //                      / other-transport)
 // other-transport   =  token
+//
+// https://www.rfc-editor.org/rfc/rfc7118.html#section-5.2
+//
+// transport-param   =/  "transport=" "ws"
+//
+// A SIPS URI with transport=ws is reached over WSS.
 // user-param        =  "user=" ( "phone" / "ip" / other-user)
 // other-user        =  token
 // method-param      =  "method=" Method
@@ -66,14 +69,12 @@ type SipUri struct {
 	userinfo   *UserInfo
 	hostport   *HostPort
 	parameters *Parameters
-	headers    sync.Map
-	isOrder    bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order      chan string // It is convenient to record the order of the original parameter fields when parsing
-	source     string      // sip-uri/sips-uri source string
+	headers    *Params // headers  =  "?" header *( "&" header )
+	source     string  // sip-uri/sips-uri source string
 }
 
 func (su *SipUri) SetSchema(schema string) {
-	if regexp.MustCompile(`^(?i)(sip|sips)$`).MatchString(schema) {
+	if scanFieldIs(schema, "sip", "sips") {
 		su.schema = strings.ToLower(schema)
 	} else {
 		su.schema = "sip"
@@ -101,181 +102,104 @@ func (su *SipUri) GetParameters() *Parameters {
 	return su.parameters
 }
 
-func (su *SipUri) SetHeaders(headers sync.Map) {
+func (su *SipUri) SetHeaders(headers *Params) {
 	su.headers = headers
 }
-func (su *SipUri) GetHeaders() sync.Map {
+func (su *SipUri) GetHeaders() *Params {
 	return su.headers
 }
 
 func (su *SipUri) GetSource() string {
 	return su.source
 }
-func NewSipUri(userinfo *UserInfo, hostport *HostPort, parameters *Parameters, headers sync.Map) *SipUri {
+func NewSipUri(userinfo *UserInfo, hostport *HostPort, parameters *Parameters, headers *Params) *SipUri {
 	return &SipUri{
 		schema:     "sip",
 		userinfo:   userinfo,
 		hostport:   hostport,
 		parameters: parameters,
 		headers:    headers,
-		isOrder:    false,
 	}
 }
 func (su *SipUri) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(su.schema)) == 0 {
-		su.schema = "sip"
+	schema := su.schema
+	if len(strings.TrimSpace(schema)) == 0 {
+		schema = "sip"
 	}
-	result.WriteString(fmt.Sprintf("%s:", strings.ToLower(su.schema)))
+	result.WriteString(fmt.Sprintf("%s:", strings.ToLower(schema)))
+	// the "@" is only written after a userinfo,example: "sip:proxy.example.com;lr"
 	if su.userinfo != nil {
-		userinfo := su.userinfo.Raw()
-		result.WriteString(userinfo.String())
+		if userinfo := su.userinfo.Raw(); userinfo.Len() > 0 {
+			result.WriteString(fmt.Sprintf("%s@", userinfo.String()))
+		}
 	}
 	if su.hostport != nil {
 		hostport := su.hostport.Raw()
-		result.WriteString(fmt.Sprintf("@%s", hostport.String()))
+		result.WriteString(hostport.String())
 	}
 	if su.parameters != nil {
 		parameters := su.parameters.Raw()
 		result.WriteString(parameters.String())
 	}
-	var headers strings.Builder
-	if su.isOrder {
-		for orders := range su.order {
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := su.headers.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						headers.WriteString(fmt.Sprintf("&%v=%v", ordersSlice[0], val))
-					} else {
-						headers.WriteString(fmt.Sprintf("&%v", ordersSlice[0]))
-					}
-				} else {
-					headers.WriteString(fmt.Sprintf("&%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := su.headers.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						headers.WriteString(fmt.Sprintf("&%v=%v", ordersSlice[0], val))
-					} else {
-						headers.WriteString(fmt.Sprintf("&%v", ordersSlice[0]))
-					}
-				} else {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", ordersSlice[1]))) > 0 {
-						headers.WriteString(fmt.Sprintf("&%v=%v", ordersSlice[0], ordersSlice[1]))
-					} else {
-						headers.WriteString(fmt.Sprintf("&%v", ordersSlice[0]))
-					}
-				}
-			}
-		}
-	}
-
-	su.headers.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				headers.WriteString(fmt.Sprintf("&%v", key))
-				return true
-			}
-			headers.WriteString(fmt.Sprintf("&%v=%v", key, value))
-			return true
-		}
-		headers.WriteString(fmt.Sprintf("&%v", key))
-		return true
-	})
-	if len(headers.String()) > 0 {
-		result.WriteString(fmt.Sprintf("?%s", headers.String()))
-	}
+	// header  =  hname "=" hvalue
+	result.WriteString(su.headers.raw("?", "&", false))
 	return
 }
-func (su *SipUri) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (su *SipUri) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("SIP-URI", raw, 0, `SIP-URI  =  "sip:" [ userinfo ] hostport uri-parameters [ headers ]`)
 	}
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(`^((?i)(sip|sips)( )?:)`)
-	if !schemaRegexp.MatchString(raw) {
-		return
+	// schema
+	colon := strings.IndexByte(raw, ':')
+	if colon < 0 || !scanFieldIs(strings.TrimSuffix(raw[:colon], " "), "sip", "sips") {
+		return NewParseError("SIP-URI", raw, 0, `SIP-URI  =  "sip:" [ userinfo ] hostport uri-parameters [ headers ]`)
 	}
-	schema := schemaRegexp.FindString(raw)
-	schema = regexp.MustCompile(`:`).ReplaceAllString(schema, "")
-	schema = stringTrimPrefixAndTrimSuffix(schema, " ")
-	su.schema = schema
+	su.schema = strings.TrimSuffix(raw[:colon], " ")
 	su.source = raw
 
 	su.userinfo = new(UserInfo)
 	su.hostport = new(HostPort)
 	su.parameters = new(Parameters)
-	su.headers = sync.Map{}
+	su.headers = NewParams()
 
-	raw = schemaRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// headers regexp
-	headersRegexp := regexp.MustCompile(`\?.*`)
-	if headersRegexp.MatchString(raw) {
-
-		headers := headersRegexp.FindString(raw)
-		raw = headersRegexp.ReplaceAllString(raw, "")
-		headers = regexp.MustCompile(`\?`).ReplaceAllString(headers, "")
+	raw = stringTrimPrefixAndTrimSuffix(raw[colon+1:], " ")
+	// headers
+	if index := strings.IndexByte(raw, '?'); index >= 0 {
+		headers := raw[index+1:]
+		raw = raw[:index]
 		headers = stringTrimPrefixAndTrimSuffix(headers, "&")
 		headers = stringTrimPrefixAndTrimSuffix(headers, " ")
-		// sip-uri/sips-uri header order
-		su.headersOrder(headers)
-		if len(strings.TrimSpace(headers)) > 0 {
-			headersSlice := strings.Split(headers, "&")
-			if len(headersSlice) == 1 {
-				kvs := strings.Split(headersSlice[0], "=")
-				if len(kvs) == 1 {
-					su.headers.Store(kvs[0], "")
-				} else {
-					su.headers.Store(kvs[0], kvs[1])
-				}
-			} else {
-				for _, hs := range headersSlice {
-					kvs := strings.Split(hs, "=")
-					if len(kvs) == 1 {
-						su.headers.Store(kvs[0], "")
-					} else {
-						su.headers.Store(kvs[0], kvs[1])
-					}
-				}
-			}
+		if err := su.headers.parse(headers, '&'); err != nil {
+			return parseErrorWrap(err, su.source, headers)
 		}
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// uri-parameters regexp
-	uriparametersRegexp := regexp.MustCompile(`;.*`)
-	if uriparametersRegexp.MatchString(raw) {
-		parameters := uriparametersRegexp.FindString(raw)
-		parameters = stringTrimPrefixAndTrimSuffix(parameters, ";")
-		su.parameters.Parse(parameters)
-		raw = uriparametersRegexp.ReplaceAllString(raw, "")
+	// uri-parameters
+	if index := strings.IndexByte(raw, ';'); index >= 0 {
+		parameters := stringTrimPrefixAndTrimSuffix(raw[index:], ";")
+		if err := su.parameters.Parse(parameters); err != nil {
+			return parseErrorWrap(err, su.source, parameters)
+		}
+		raw = raw[:index]
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// host port regexp
-	hostportRegexp := regexp.MustCompile(`@.*`)
-	if hostportRegexp.MatchString(raw) {
-		hostport := hostportRegexp.FindString(raw)
-		hostport = regexp.MustCompile(`@`).ReplaceAllString(hostport, "")
-		hostport = stringTrimPrefixAndTrimSuffix(hostport, " ")
-		su.hostport.Parse(hostport)
-		raw = hostportRegexp.ReplaceAllString(raw, "")
+	// host port,the whole text is the hostport when there is no userinfo
+	hostport := raw
+	if index := strings.LastIndexByte(raw, '@'); index >= 0 {
+		hostport = stringTrimPrefixAndTrimSuffix(raw[index+1:], " ")
+		raw = raw[:index]
+	} else {
+		raw = ""
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	if len(strings.TrimSpace(raw)) > 0 {
-		su.userinfo.Parse(raw)
+	if err := su.hostport.Parse(hostport); err != nil {
+		return parseErrorWrap(err, su.source, hostport)
 	}
-}
-func (su *SipUri) headersOrder(raw string) {
-	su.isOrder = true
-	su.order = make(chan string, 1024)
-	defer close(su.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, "&")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, "&")
-	for _, raws := range rawSlice {
-		su.order <- raws
+	if len(strings.TrimSpace(raw)) > 0 {
+		if err := su.userinfo.Parse(raw); err != nil {
+			return parseErrorWrap(err, su.source, raw)
+		}
 	}
+	return nil
 }
@@ -3,18 +3,17 @@ package sip
 import (
 	"fmt"
 	"net"
-	"sync"
 	"testing"
 )
 
 func TestSipUri_Raw(t *testing.T) {
-	var headers sync.Map
-	headers.Store("token", "xyz")
-	headers.Store("expires", 3600)
-	headers.Store("xxxxxxx", nil)
+	headers := NewParams()
+	headers.Set("token", "xyz")
+	headers.Set("expires", "3600")
+	headers.SetFlag("xxxxxxx")
 	sipUri := NewSipUri(NewUserInfo("34020000001320000001", "+086-17621400864", "Ali12345"),
 		NewHostPort("www.baidu.com", net.IPv4(192, 168, 0, 1), nil, 5060),
-		NewParameters("udp", "kokutas", "register", 5, "192.168.0.26", true, sync.Map{}), headers)
+		NewParameters("udp", "kokutas", "register", 5, "192.168.0.26", true, nil), headers)
 	result := sipUri.Raw()
 	fmt.Println(result.String())
 }
@@ -43,10 +42,10 @@ func TestSipUri_Parse(t *testing.T) {
 			fmt.Println(index, "uri-parameters-ttl:", sipUri.parameters.ttl)
 			fmt.Println(index, "uri-parameters-maddr:", sipUri.parameters.maddr)
 			fmt.Println(index, "uri-parameters-lr:", sipUri.parameters.lr)
-			sipUri.headers.Range(func(key, value interface{}) bool {
+			for _, key := range sipUri.headers.Names() {
+				value, _ := sipUri.headers.Get(key)
 				fmt.Println(index, key, value)
-				return true
-			})
+			}
 			result := sipUri.Raw()
 			fmt.Println(index, result.String())
 		}
@@ -2,6 +2,8 @@ package sip
 
 import (
 	"crypto/md5"
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -150,9 +152,101 @@ var methods = map[string]string{
 	"SUBSCRIBE": "SUBSCRIBE",
 }
 
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-7.3.3
+//
+// 7.3.3 Compact Form
+//
+// SIP provides a mechanism to represent common header field names in an
+// abbreviated form.  This may be useful when messages would otherwise
+// become too large to be carried on the transport available to it
+// (exceeding the maximum transmission unit (MTU) when using UDP, for
+// example).  These compact forms are defined in Section 20.  A compact
+// form MAY be substituted for the longer form of a header field name at
+// any time without changing the semantics of the message.  A header
+// field name MAY appear in both long and short forms within the same
+// message.  Implementations MUST accept both the long and short forms of
+// each header name.
+var compactForms = map[string]string{
+	"c": "Content-Type",
+	"e": "Content-Encoding",
+	"f": "From",
+	"i": "Call-ID",
+	"k": "Supported",
+	"l": "Content-Length",
+	"m": "Contact",
+	"s": "Subject",
+	"t": "To",
+	"v": "Via",
+}
+
+// HeaderForm is the form of the header field names written by SipMsg.Raw
+type HeaderForm int
+
+const (
+	HeaderFormParsed  HeaderForm = iota // the header field names as parsed or set
+	HeaderFormLong                      // the long form,example: "Via","Content-Length"
+	HeaderFormCompact                   // the compact form when the header field has one,example: "v","l"
+)
+
+// headerFieldLong returns the long form of a compact header field name,any other name is returned unchanged
+func headerFieldLong(field string) string {
+	if len(field) != 1 {
+		return field
+	}
+	for compact, long := range compactForms {
+		if strings.EqualFold(field, compact) {
+			return long
+		}
+	}
+	return field
+}
+
+// headerFieldCompact returns the compact form of a header field name,the name is returned unchanged when there is none
+func headerFieldCompact(field string) string {
+	for compact, long := range compactForms {
+		if strings.EqualFold(field, long) || strings.EqualFold(field, compact) {
+			return compact
+		}
+	}
+	return field
+}
+
+// headerFieldTitle returns the name set by SetField,a compact form in lower case and a long form with the first letters in upper case
+func headerFieldTitle(field string) string {
+	if _, ok := compactForms[strings.ToLower(field)]; ok {
+		return strings.ToLower(field)
+	}
+	return strings.Title(field)
+}
+
+// headerFormRaw rewrites the names of the header lines in the form requested
+func headerFormRaw(raw string, form HeaderForm) string {
+	if form == HeaderFormParsed {
+		return raw
+	}
+	var result strings.Builder
+	for _, line := range strings.SplitAfter(raw, "\r\n") {
+		index := strings.Index(line, ":")
+		if index <= 0 {
+			result.WriteString(line)
+			continue
+		}
+		field := strings.TrimSpace(line[:index])
+		switch form {
+		case HeaderFormLong:
+			field = headerFieldLong(field)
+		case HeaderFormCompact:
+			field = headerFieldCompact(field)
+		}
+		result.WriteString(field)
+		result.WriteString(line[index:])
+	}
+	return result.String()
+}
+
 type SipLayer interface {
 	Raw() strings.Builder
-	Parse(raw string)
+	Parse(raw string) error
 }
 
 func stringTrimPrefixAndTrimSuffix(source string, sub string) string {
@@ -174,3 +268,22 @@ func GenUnixNanoBranch() string {
 	rand.Seed(time.Now().UnixNano())
 	return fmt.Sprintf("z9hG4bK%x", md5.Sum([]byte(fmt.Sprintf("%v%v", time.Now().UnixNano(), rand.Intn(60000)))))
 }
+
+// GenTag returns a From or To tag of 64 random bits,RFC 3261 19.3 asks for at least 32
+func GenTag() string {
+	return genRandomHex(8)
+}
+
+// GenCallID returns a Call-ID of 128 random bits at host,host may be empty
+func GenCallID(host string) *CallID {
+	return NewCallID(genRandomHex(16), host)
+}
+
+// genRandomHex returns size cryptographically random bytes in hex
+func genRandomHex(size int) string {
+	random := make([]byte, size)
+	if _, err := cryptorand.Read(random); err != nil {
+		rand.Read(random)
+	}
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,49 @@
+package sip
+
+import "fmt"
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-21
+//
+// 21 Response Codes
+//
+// The response codes are consistent with, and extend, HTTP/1.1 response
+// codes.  Not all HTTP/1.1 response codes are appropriate, and only
+// those that are appropriate are given here.
+
+// StatusError is an error that is answered with a final response,
+// example: 400 Bad Request for a stream message without Content-Length,513 Message Too Large
+type StatusError struct {
+	statusCode   uint   // Status-Code of the response to send
+	reasonPhrase string // Reason-Phrase of the response to send
+}
+
+func (se *StatusError) GetStatusCode() uint {
+	return se.statusCode
+}
+func (se *StatusError) GetReasonPhrase() string {
+	return se.reasonPhrase
+}
+
+// NewStatusError returns a StatusError,the default reason phrase of the status code is used when reasonPhrase is empty
+func NewStatusError(statusCode uint, reasonPhrase string) *StatusError {
+	if len(reasonPhrase) == 0 {
+		reasonPhrase = statusReasonPhrase(statusCode)
+	}
+	return &StatusError{
+		statusCode:   statusCode,
+		reasonPhrase: reasonPhrase,
+	}
+}
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("sip: %d %s", se.statusCode, se.reasonPhrase)
+}
+
+// statusReasonPhrase returns the default reason phrase of a status code,"" for a status code not defined
+func statusReasonPhrase(statusCode uint) string {
+	for _, phrases := range []map[int]string{Informational, Success, Redirection, ClientError, ServerError, GlobalFailure} {
+		if phrase, ok := phrases[int(statusCode)]; ok {
+			return phrase
+		}
+	}
+	return ""
+}
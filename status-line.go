@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -80,7 +79,7 @@ type StatusLine struct {
 }
 
 func (sl *StatusLine) SetSchema(schema string) {
-	if regexp.MustCompile(`(?i)(sip|sips)`).MatchString(schema) {
+	if scanFieldIs(schema, "sip", "sips") {
 		sl.schema = schema
 	} else {
 		sl.schema = "sip"
@@ -119,12 +118,13 @@ func NewStatusLine(schema string, version float64, statusCode uint, reasonPhrase
 	}
 }
 func (sl *StatusLine) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(sl.schema)) == 0 {
-		sl.schema = "sip"
+	schema := sl.schema
+	if len(strings.TrimSpace(schema)) == 0 {
+		schema = "sip"
 	}
 	// schema: sip,sips,tel etc.
-	if len(strings.TrimSpace(sl.schema)) > 0 {
-		result.WriteString(strings.ToUpper(sl.schema))
+	if len(strings.TrimSpace(schema)) > 0 {
+		result.WriteString(strings.ToUpper(schema))
 	}
 	// version: 2.0
 	result.WriteString(fmt.Sprintf("/%1.1f", sl.version))
@@ -135,58 +135,30 @@ func (sl *StatusLine) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return result
 }
-func (sl *StatusLine) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (sl *StatusLine) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
-	}
-	// schema regexp string
-	schemasRegexpStr := `^(?i)(`
-	for _, v := range schemas {
-		schemasRegexpStr += v + "|"
+		return NewParseError("Status-Line", raw, 0, `Status-Line  =  SIP-Version SP Status-Code SP Reason-Phrase CRLF`)
 	}
-	schemasRegexpStr = strings.TrimSuffix(schemasRegexpStr, "|")
-	schemasRegexpStr += ")( )?"
-	// schema and version regexp
-	schemaAndVersionRegexp := regexp.MustCompile(schemasRegexpStr + `/( )?\d\.\d`)
-
-	if !schemaAndVersionRegexp.MatchString(raw) {
-		return
+	// schema and version
+	version := scanUntil(raw, " ")
+	schema, sipVersion, ok := scanVersion(version)
+	if !ok {
+		return NewParseError("Status-Line", raw, 0, `Status-Line  =  SIP-Version SP Status-Code SP Reason-Phrase CRLF`)
 	}
 	sl.source = raw
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(schemasRegexpStr)
-	// version regexp
-	versionRegexp := regexp.MustCompile(`\d\.[0-9]{1}`)
-	if schemaAndVersionRegexp.MatchString(raw) {
-		schemaAndVersion := schemaAndVersionRegexp.FindString(raw)
-		schemaAndVersion = stringTrimPrefixAndTrimSuffix(schemaAndVersion, " ")
-		if schemaRegexp.MatchString(schemaAndVersion) {
-			schema := schemaRegexp.FindString(schemaAndVersion)
-			schema = stringTrimPrefixAndTrimSuffix(schema, " ")
-			sl.schema = schema
-		}
-		if versionRegexp.MatchString(schemaAndVersion) {
-			versions := versionRegexp.Find([]byte(schemaAndVersion))
-			version, _ := strconv.ParseFloat(string(versions), 64)
-			sl.version = version
-		}
-		raw = strings.ReplaceAll(raw, schemaAndVersion, "")
-	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// status-code regexp
-	statusCodeRegexp := regexp.MustCompile(`\d+`)
-	if statusCodeRegexp.MatchString(raw) {
-		statusCodes := statusCodeRegexp.FindString(raw)
-		statusCode, _ := strconv.Atoi(statusCodes)
-		sl.statusCode = uint(statusCode)
-		raw = strings.ReplaceAll(raw, statusCodes, "")
+	sl.schema = schema
+	sl.version = sipVersion
+	raw = stringTrimPrefixAndTrimSuffix(raw[len(version):], " ")
+	// status-code
+	if scanDigits(raw) != 3 || (len(raw) > 3 && raw[3] != ' ') {
+		return NewParseError("Status-Line", sl.source, parseErrorOffset(sl.source, raw), `Status-Code  =  3DIGIT`)
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	statusCode, _ := strconv.Atoi(raw[:3])
+	sl.statusCode = uint(statusCode)
+	raw = stringTrimPrefixAndTrimSuffix(raw[3:], " ")
 	if len(strings.TrimSpace(raw)) > 0 {
 		sl.reasonPhrase = raw
 	}
+	return nil
 }
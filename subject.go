@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -31,7 +30,7 @@ type Subject struct {
 }
 
 func (s *Subject) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(subject|s)$`).MatchString(field) {
+	if scanFieldIs(field, "subject", "s") {
 		s.field = field
 	} else {
 		s.field = "Subject"
@@ -56,39 +55,34 @@ func NewSubject(text string) *Subject {
 	}
 }
 func (s *Subject) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(s.field)) == 0 {
-		s.field = "Subject"
+	field := s.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Subject"
 	}
-	result.WriteString(fmt.Sprintf("%s:", s.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 	if len(strings.TrimSpace(s.text)) > 0 {
 		result.WriteString(fmt.Sprintf(" %s", s.text))
 	}
 	result.WriteString("\r\n")
 	return
 }
-func (s *Subject) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (s *Subject) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Subject", raw, 0, `Subject  =  ( "Subject" / "s" ) HCOLON [TEXT-UTF8-TRIM]`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(subject|s)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "subject", "s")
+	if !ok {
+		return NewParseError("Subject", raw, 0, `Subject  =  ( "Subject" / "s" ) HCOLON [TEXT-UTF8-TRIM]`)
 	}
-	field := regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	s.field = field
+	s.field = stringTrimPrefixAndTrimSuffix(field, " ")
 	s.source = raw
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return nil
 	}
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
 	if len(strings.TrimSpace(raw)) > 0 {
 		s.text = raw
 	}
-
+	return nil
 }
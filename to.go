@@ -2,11 +2,7 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
-	"strconv"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261.html#section-8.1.1.2
@@ -88,23 +84,22 @@ import (
 // to-param  =  tag-param / generic-param
 
 type To struct {
-	field     string      // "To" / "t"
-	name      string      // display-name
-	spec      string      // named spec of URI,recommend set be uri spec <uri>,example: <sip:xxx>/"sip:xxx"/sip:xxx
-	schema    string      // sip,sips,tel etc.
-	user      string      // user part
-	host      string      // host part
-	port      uint16      // port part
-	tag       string      // tag
-	parameter sync.Map    // parameter-param
-	isOrder   bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order     chan string // It is convenient to record the order of the original parameter fields when parsing
-	source    string      // source string
+	field     string   // "To" / "t"
+	name      string   // display-name
+	spec      string   // named spec of URI,recommend set be uri spec <uri>,example: <sip:xxx>/"sip:xxx"/sip:xxx
+	schema    string   // sip,sips,tel etc.
+	user      string   // user part
+	host      string   // host part
+	port      uint16   // port part
+	tag       string   // tag
+	parameter *Params  // generic-param
+	order     []string // parameter names in the parsed order,tag included
+	source    string   // source string
 }
 
 func (t *To) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(to|t)$`).MatchString(field) {
-		t.field = strings.Title(field)
+	if scanFieldIs(field, "to", "t") {
+		t.field = headerFieldTitle(field)
 	}
 }
 func (t *To) GetField() string {
@@ -152,16 +147,16 @@ func (t *To) SetTag(tag string) {
 func (t *To) GetTag() string {
 	return t.tag
 }
-func (t *To) SetParameter(parameter sync.Map) {
+func (t *To) SetParameter(parameter *Params) {
 	t.parameter = parameter
 }
-func (t *To) GetParameter() sync.Map {
+func (t *To) GetParameter() *Params {
 	return t.parameter
 }
 func (t *To) GetSource() string {
 	return t.source
 }
-func NewTo(name, spec, schema, user, host string, port uint16, tag string, parameter sync.Map) *To {
+func NewTo(name, spec, schema, user, host string, port uint16, tag string, parameter *Params) *To {
 	return &To{
 		name:      name,
 		spec:      spec,
@@ -171,7 +166,6 @@ func NewTo(name, spec, schema, user, host string, port uint16, tag string, param
 		port:      port,
 		tag:       tag,
 		parameter: parameter,
-		isOrder:   false,
 	}
 }
 
@@ -195,8 +189,12 @@ func (t *To) Raw() (result strings.Builder) {
 	if len(strings.TrimSpace(t.user)) > 0 {
 		uri += t.user
 	}
+	// the "@" is only written after a user,example: "sip:192.168.0.108:5060"
 	if len(strings.TrimSpace(t.host)) > 0 {
-		uri += fmt.Sprintf("@%s", t.host)
+		if len(strings.TrimSpace(t.user)) > 0 {
+			uri += "@"
+		}
+		uri += t.host
 	}
 	if t.port > 0 {
 		uri += fmt.Sprintf(":%d", t.port)
@@ -214,220 +212,63 @@ func (t *To) Raw() (result strings.Builder) {
 		}
 
 	}
+	// from-param  =  tag-param / generic-param
+	typed := NewParams()
 	if len(strings.TrimSpace(t.tag)) > 0 {
-		result.WriteString(fmt.Sprintf(";tag=%s", t.tag))
-	}
-	if t.isOrder {
-		t.isOrder = false
-		for orders := range t.order {
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := t.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						if strings.Contains(fmt.Sprintf("%v", val), "/") {
-							result.WriteString(fmt.Sprintf(";%v=\"%v\"", ordersSlice[0], val))
-						} else {
-							result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-						}
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-
-				} else {
-					result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := t.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						if strings.Contains(fmt.Sprintf("%v", val), "/") {
-							result.WriteString(fmt.Sprintf(";%v=\"%v\"", ordersSlice[0], val))
-						} else {
-							result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-						}
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-
-				} else {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", ordersSlice[1]))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], ordersSlice[1]))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				}
-			}
-		}
+		typed.Set("tag", t.tag)
 	}
-	t.parameter.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(";%v", key))
-				return true
-			}
-			if strings.Contains(fmt.Sprintf("%v", value), "/") {
-				result.WriteString(fmt.Sprintf(";%v=\"%v\"", key, value))
-			} else {
-				result.WriteString(fmt.Sprintf(";%v=%v", key, value))
-			}
-			return true
-		}
-		result.WriteString(fmt.Sprintf(";%v", key))
-		return true
-	})
+	parameter := paramsMerge(t.order, typed, t.parameter).Raw()
+	result.WriteString(parameter.String())
 	result.WriteString("\r\n")
 	return
 }
 
-func (t *To) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (t *To) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("To", raw, 0, `To  =  ( "To" / "t" ) HCOLON ( name-addr / addr-spec ) *( SEMI to-param )`)
 	}
-	// to field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(to|t)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "to", "t")
+	if !ok {
+		return NewParseError("To", raw, 0, `To  =  ( "To" / "t" ) HCOLON ( name-addr / addr-spec ) *( SEMI to-param )`)
 	}
-	t.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	t.field = field
 	t.source = raw
-	t.parameter = sync.Map{}
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	t.parameter = NewParams()
+	t.order = nil
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
 
-	// schema regexp
-	schemasRegexpStr := `(?i)(`
-	for _, v := range schemas {
-		schemasRegexpStr += v + "|"
-	}
-	schemasRegexpStr = strings.TrimSuffix(schemasRegexpStr, "|")
-	schemasRegexpStr += ")( )?:"
-
-	// display-name regexp
-	nameRegexp := regexp.MustCompile(`.*` + schemasRegexpStr)
-	if nameRegexp.MatchString(raw) {
-		name := nameRegexp.FindString(raw)
-		name = regexp.MustCompile(schemasRegexpStr+`$`).ReplaceAllString(name, "")
-		name = regexp.MustCompile(`<$`).ReplaceAllString(name, "")
-		name = stringTrimPrefixAndTrimSuffix(name, " ")
-		if len(name) > 0 {
-			t.name = name
-			raw = regexp.MustCompile(`.*`+name).ReplaceAllString(raw, "")
-			raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-		}
-	}
-	//uri spec  regexp: named spec of URI
-	switch {
-	case regexp.MustCompile(`'.*?` + schemasRegexpStr).MatchString(raw):
-		t.spec = "'"
-		raw = regexp.MustCompile(`.*'`).ReplaceAllString(raw, "")
-	case regexp.MustCompile(`".*?` + schemasRegexpStr).MatchString(raw):
-		t.spec = "\""
-		raw = regexp.MustCompile(`.*"`).ReplaceAllString(raw, "")
-	case regexp.MustCompile(`<.*?` + schemasRegexpStr).MatchString(raw):
-		t.spec = "<"
-		raw = regexp.MustCompile(`.*<`).ReplaceAllString(raw, "")
-	default:
-		t.spec = ""
+	// ( name-addr / addr-spec )
+	addr, ok := scanAddress(raw)
+	t.name, t.spec, t.schema = addr.name, addr.spec, addr.schema
+	t.user, t.host, t.port = addr.user, addr.host, addr.port
+	raw = addr.rest
+	if !ok {
+		return NewParseError("To", t.source, parseErrorOffset(t.source, raw), `To  =  ( "To" / "t" ) HCOLON ( name-addr / addr-spec ) *( SEMI to-param )`)
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(schemasRegexpStr)
-	if schemaRegexp.MatchString(raw) {
-		schema := schemaRegexp.FindString(raw)
-		schema = regexp.MustCompile(`:`).ReplaceAllString(schema, "")
-		schema = stringTrimPrefixAndTrimSuffix(schema, " ")
-		t.schema = schema
-	}
-
-	// user regexp
-	userRegexp := regexp.MustCompile(schemasRegexpStr + `.*@`)
-	if userRegexp.MatchString(raw) {
-		user := userRegexp.FindString(raw)
-		user = regexp.MustCompile(schemasRegexpStr).ReplaceAllString(user, "")
-		user = regexp.MustCompile(`@`).ReplaceAllString(user, "")
-		user = stringTrimPrefixAndTrimSuffix(user, " ")
-		if len(user) > 0 {
-			t.user = user
-			raw = regexp.MustCompile(`.*`+user).ReplaceAllString(raw, "")
-		}
-
+	// to-param
+	if index := strings.Index(raw, ">"); index >= 0 && t.spec == "<" {
+		raw = raw[index+1:]
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// host regexp
-	hostRegexp := regexp.MustCompile(`@.*`)
-	if hostRegexp.MatchString(raw) {
-		host := hostRegexp.FindString(raw)
-		host = regexp.MustCompile(`;.*`).ReplaceAllString(host, "")
-		host = regexp.MustCompile(`:.*`).ReplaceAllString(host, "")
-		host = regexp.MustCompile(`@`).ReplaceAllString(host, "")
-		host = stringTrimPrefixAndTrimSuffix(host, " ")
-		if len(host) > 0 {
-			t.host = host
-			raw = regexp.MustCompile(`.*`+host).ReplaceAllString(raw, "")
-		}
-	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// port regexp
-	portRegexp := regexp.MustCompile(`.*?:\d+`)
-	if portRegexp.MatchString(raw) {
-		ports := portRegexp.FindString(raw)
-		ports = regexp.MustCompile(`.*:`).ReplaceAllString(ports, "")
-		ports = stringTrimPrefixAndTrimSuffix(ports, " ")
-		if len(ports) > 0 {
-			port, _ := strconv.Atoi(ports)
-			t.port = uint16(port)
-			raw = regexp.MustCompile(`.*`+ports).ReplaceAllString(raw, "")
-		}
+	if index := strings.Index(raw, ";"); index >= 0 {
+		raw = raw[index:]
+	} else {
+		raw = ""
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// tag regexp
-	tagRegexp := regexp.MustCompile(`(?i)(tag)( )?=.*`)
-	if tagRegexp.MatchString(raw) {
-		tag := tagRegexp.FindString(raw)
-		tag = regexp.MustCompile(`(?i)tag( )?=`).ReplaceAllString(tag, "")
-		tag = regexp.MustCompile(`;.*`).ReplaceAllString(tag, "")
-		tag = stringTrimPrefixAndTrimSuffix(tag, " ")
-		if len(tag) > 0 {
-			t.tag = tag
-			raw = regexp.MustCompile(`.*`+tag).ReplaceAllString(raw, "")
-		}
+	parameter := NewParams()
+	if err := parameter.Parse(raw); err != nil {
+		return parseErrorWrap(err, t.source, raw)
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	t.parameterOrder(raw)
-	// parameter regexp
-	if len(raw) > 0 {
-		rawSlice := strings.Split(raw, ";")
-		if len(rawSlice) == 1 {
-			kvs := strings.Split(rawSlice[0], "=")
-			if len(kvs) == 1 {
-				t.parameter.Store(kvs[0], "")
-			} else {
-				t.parameter.Store(kvs[0], kvs[1])
-			}
-		} else {
-			for _, raws := range rawSlice {
-				kvs := strings.Split(raws, "=")
-				if len(kvs) == 1 {
-					t.parameter.Store(kvs[0], "")
-				} else {
-					t.parameter.Store(kvs[0], kvs[1])
-				}
-			}
+	for _, p := range parameter.list() {
+		t.order = append(t.order, p.name)
+		switch strings.ToLower(p.name) {
+		case "tag":
+			// tag-param  =  "tag" EQUAL token
+			t.tag = p.value
+		default:
+			t.parameter.set(p)
 		}
 	}
-}
-func (t *To) parameterOrder(raw string) {
-	t.isOrder = true
-	t.order = make(chan string, 1024)
-	defer close(t.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		t.order <- raws
-	}
+	return nil
 }
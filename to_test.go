@@ -2,18 +2,17 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestTo_Raw(t *testing.T) {
-	p := sync.Map{}
-	p.Store("hei", "hei")
-	p.Store("ha", nil)
+	p := NewParams()
+	p.Set("hei", "hei")
+	p.SetFlag("ha")
 	ts := []*To{
-		NewTo("", "<", "sip", "34020000001320000001", "192.168.0.1", 5060, "tag123", sync.Map{}),
-		NewTo("34020000001320000001", "'", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", sync.Map{}),
-		NewTo("tom", "\"", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", sync.Map{}),
+		NewTo("", "<", "sip", "34020000001320000001", "192.168.0.1", 5060, "tag123", nil),
+		NewTo("34020000001320000001", "'", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", nil),
+		NewTo("tom", "\"", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", nil),
 		NewTo("alisa", "", "sip", "34020000001320000001", "www.baidu.com", 0, "tag123", p),
 	}
 	for _, t := range ts {
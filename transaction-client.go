@@ -0,0 +1,360 @@
+package sip
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.1.1.2
+//
+//                                |INVITE from TU
+//              Timer A fires     |INVITE sent
+//              Reset A,          V                      Timer B fires
+//              INVITE sent +-----------+                or Transport Err.
+//                +---------|           |---------------+inform TU
+//                |         |  Calling  |               |
+//                +-------->|           |-------------->|
+//                          +-----------+ 2xx           |
+//                             |  |       2xx to TU     |
+//                             |  |1xx                  |
+//     300-699 +---------------+  |1xx to TU            |
+//    ACK sent |                  |                     |
+// resp. to TU |  1xx             V                     |
+//             |  1xx to TU  -----------+               |
+//             |  +---------|           |               |
+//             |  |         |Proceeding |-------------->|
+//             |  +-------->|           | 2xx           |
+//             |            +-----------+ 2xx to TU     |
+//             |       300-699    |                     |
+//             |       ACK sent,  |                     |
+//             |       resp. to TU|                     |
+//             |                  |                     |      NOTE:
+//             |  300-699         V                     |
+//             |  ACK sent  +-----------+Transport Err.  |  transitions
+//             |  +---------|           |Inform TU      |  labeled with
+//             |  |         | Completed |-------------->|  the event
+//             |  +-------->|           |               |  over the action
+//             |            +-----------+               |  to take
+//             |              ^   |                     |
+//             |              |   | Timer D fires       |
+//             +--------------+   | -                   |
+//                                |                     |
+//                                V                     |
+//                          +-----------+               |
+//                          |           |               |
+//                          | Terminated|<--------------+
+//                          |           |
+//                          +-----------+
+//
+//                  Figure 5: INVITE client transaction
+//
+// A 2xx moves the transaction to the "Accepted" state of RFC 6026 instead of "Terminated",
+// the retransmissions of the 2xx are passed to the TU until Timer M fires.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.1.2.2
+//
+//                                    |Request from TU
+//                                    |send request
+//                Timer E             V
+//                send request  +-----------+
+//                    +---------|           |-------------------+
+//                    |         |  Trying   |  Timer F          |
+//                    +-------->|           |  or Transport Err.|
+//                              +-----------+  inform TU        |
+//                 200-699         |  |                         |
+//                 resp. to TU     |  |1xx                      |
+//                 +---------------+  |resp. to TU              |
+//                 |                  |                         |
+//                 |   Timer E        V       Timer F           |
+//                 |   send req +-----------+ or Transport Err. |
+//                 |  +---------|           | inform TU         |
+//                 |  |         |Proceeding |------------------>|
+//                 |  +-------->|           |-----+             |
+//                 |            +-----------+     |1xx          |
+//                 |              |      ^        |resp to TU   |
+//                 | 200-699      |      +--------+             |
+//                 | resp. to TU  |                             |
+//                 |              |                             |
+//                 |              V                             |
+//                 |            +-----------+                   |
+//                 |            |           |                   |
+//                 |            | Completed |                   |
+//                 |            |           |                   |
+//                 |            +-----------+                   |
+//                 |              ^   |                         |
+//                 |              |   | Timer K                 |
+//                 +--------------+   | -                       |
+//                                    |                         |
+//                                    V                         |
+//              NOTE:           +-----------+                   |
+//                              |           |                   |
+//          transitions         | Terminated|<------------------+
+//          labeled with        |           |
+//          the event           +-----------+
+//          over the action
+//          to take
+//
+//                  Figure 6: non-INVITE client transaction
+
+// ClientTransaction is an INVITE or a non-INVITE client transaction,it retransmits its request over an unreliable
+// transport,passes the responses to the TU and acknowledges a non-2xx final response to an INVITE
+type ClientTransaction struct {
+	layer      *TransactionLayer
+	key        string // the branch of the top Via and the method of the request
+	request    *SipMsg
+	ack        *SipMsg // the ACK of a non-2xx final response,sent again for each retransmission of the response
+	target     *Target
+	handler    ResponseHandler
+	invite     bool
+	reliable   bool
+	state      TransactionState
+	interval   time.Duration // the interval of the next retransmission
+	retransmit Timer         // Timer A / Timer E
+	timeout    Timer         // Timer B / Timer F
+	wait       Timer         // Timer D / Timer K / Timer M
+	err        error         // the transport error that terminated the transaction
+	mutex      sync.Mutex
+}
+
+func (ct *ClientTransaction) GetKey() string {
+	return ct.key
+}
+func (ct *ClientTransaction) GetRequest() *SipMsg {
+	return ct.request
+}
+
+// GetTarget returns where the request is sent,the transport is TCP when a large request is switched from UDP
+func (ct *ClientTransaction) GetTarget() *Target {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	return ct.target
+}
+func (ct *ClientTransaction) GetState() TransactionState {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	return ct.state
+}
+
+// GetError returns the transport error that terminated the transaction,nil when there is none
+func (ct *ClientTransaction) GetError() error {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	return ct.err
+}
+
+func newClientTransaction(layer *TransactionLayer, request *SipMsg, target *Target, handler ResponseHandler) *ClientTransaction {
+	key, _ := transactionClientKey(request)
+	invite := strings.EqualFold(request.GetRequestLine().GetMethod(), "INVITE")
+	state := TransactionTrying
+	if invite {
+		state = TransactionCalling
+	}
+	return &ClientTransaction{
+		layer:   layer,
+		key:     key,
+		request: request,
+		target:  target,
+		handler: handler,
+		invite:  invite,
+		state:   state,
+	}
+}
+
+// start sends the request and starts Timer A and Timer B,or Timer E and Timer F.
+// A response received meanwhile waits for the timers to be started.
+func (ct *ClientTransaction) start(ctx context.Context) error {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	if err := ct.layer.transport.Send(ctx, ct.request, ct.target); err != nil {
+		ct.state = TransactionTerminated
+		return err
+	}
+	// the transport layer switches a large request from UDP to TCP
+	if transport := ct.request.GetVia().GetTransport(); !strings.EqualFold(transport, ct.target.GetTransport()) {
+		ct.target = NewTarget(strings.ToUpper(transport), ct.target.GetHost(), ct.target.GetIP(), ct.target.GetPort())
+	}
+	ct.reliable = transactionReliable(ct.target.GetTransport())
+	clock, t1 := ct.layer.clock, ct.layer.t1
+	if !ct.reliable {
+		ct.interval = t1
+		ct.retransmit = clock.AfterFunc(ct.interval, ct.timerRetransmit)
+	}
+	ct.timeout = clock.AfterFunc(64*t1, ct.timerTimeout)
+	return nil
+}
+
+// timerRetransmit is Timer A,doubled at each retransmission,or Timer E,doubled up to T2 and T2 in the Proceeding state
+func (ct *ClientTransaction) timerRetransmit() {
+	ct.mutex.Lock()
+	switch {
+	case ct.invite && ct.state == TransactionCalling:
+		ct.interval *= 2
+	case !ct.invite && ct.state == TransactionTrying:
+		ct.interval *= 2
+		if ct.interval > ct.layer.t2 {
+			ct.interval = ct.layer.t2
+		}
+	case !ct.invite && ct.state == TransactionProceeding:
+		ct.interval = ct.layer.t2
+	default:
+		ct.mutex.Unlock()
+		return
+	}
+	ct.retransmit = ct.layer.clock.AfterFunc(ct.interval, ct.timerRetransmit)
+	ct.mutex.Unlock()
+	if err := ct.layer.transport.Send(context.Background(), ct.request, ct.target); err != nil {
+		ct.fail(err)
+	}
+}
+
+// timerTimeout is Timer B or Timer F,the TU is given a 408 response
+func (ct *ClientTransaction) timerTimeout() {
+	ct.mutex.Lock()
+	if ct.state != TransactionCalling && ct.state != TransactionTrying && ct.state != TransactionProceeding {
+		ct.mutex.Unlock()
+		return
+	}
+	ct.terminate()
+	ct.mutex.Unlock()
+	ct.layer.removeClient(ct)
+	ct.pass(NewResponse(ct.request, 408, ""))
+}
+
+// timerWait is Timer D,Timer K or Timer M,the retransmissions of the final response are no longer expected
+func (ct *ClientTransaction) timerWait() {
+	ct.mutex.Lock()
+	if ct.state != TransactionCompleted && ct.state != TransactionAccepted {
+		ct.mutex.Unlock()
+		return
+	}
+	ct.terminate()
+	ct.mutex.Unlock()
+	ct.layer.removeClient(ct)
+}
+
+// fail terminates the transaction on a transport error,the TU is given a 503 response
+func (ct *ClientTransaction) fail(err error) {
+	ct.mutex.Lock()
+	if ct.state == TransactionTerminated {
+		ct.mutex.Unlock()
+		return
+	}
+	ct.err = err
+	ct.terminate()
+	ct.mutex.Unlock()
+	ct.layer.removeClient(ct)
+	ct.pass(NewResponse(ct.request, 503, ""))
+}
+
+// terminate stops the timers,the caller holds the mutex
+func (ct *ClientTransaction) terminate() {
+	ct.state = TransactionTerminated
+	transactionStop(ct.retransmit, ct.timeout, ct.wait)
+}
+
+// pass hands a response to the TU
+func (ct *ClientTransaction) pass(sm *SipMsg) {
+	if ct.handler != nil {
+		ct.handler(sm, ct)
+	}
+}
+
+// receive handles a response matching the transaction
+func (ct *ClientTransaction) receive(sm *SipMsg) {
+	code := sm.GetStatusLine().GetStatusCode()
+	clock, t1 := ct.layer.clock, ct.layer.t1
+	var ack *SipMsg
+	pass := false
+	ct.mutex.Lock()
+	switch ct.state {
+	case TransactionCalling, TransactionTrying, TransactionProceeding:
+		pass = true
+		switch {
+		case code < 200:
+			// an INVITE is no longer retransmitted,a non-INVITE request is retransmitted every T2
+			if ct.invite {
+				transactionStop(ct.retransmit, ct.timeout)
+			}
+			ct.state = TransactionProceeding
+		case ct.invite && code < 300:
+			transactionStop(ct.retransmit, ct.timeout)
+			ct.state = TransactionAccepted
+			ct.wait = clock.AfterFunc(64*t1, ct.timerWait)
+		case ct.invite:
+			transactionStop(ct.retransmit, ct.timeout)
+			ct.ack = ct.newACK(sm)
+			ack = ct.ack
+			ct.complete(ct.layer.timerD)
+		default:
+			transactionStop(ct.retransmit, ct.timeout)
+			ct.complete(ct.layer.t4)
+		}
+	case TransactionCompleted:
+		// a retransmission of the final response is acknowledged again and absorbed
+		ack = ct.ack
+	case TransactionAccepted:
+		pass = code >= 200 && code < 300
+	}
+	terminated := ct.state == TransactionTerminated
+	ct.mutex.Unlock()
+	if ack != nil {
+		ct.layer.transport.Send(context.Background(), ack, ct.target)
+	}
+	if terminated {
+		ct.layer.removeClient(ct)
+	}
+	if pass {
+		ct.pass(sm)
+	}
+}
+
+// complete moves the transaction to the Completed state for wait over an unreliable transport,
+// to the Terminated state at once over a reliable one. The caller holds the mutex.
+func (ct *ClientTransaction) complete(wait time.Duration) {
+	if ct.reliable {
+		ct.terminate()
+		return
+	}
+	ct.state = TransactionCompleted
+	ct.wait = ct.layer.clock.AfterFunc(wait, ct.timerWait)
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.1.1.3
+//
+// 17.1.1.3 Construction of the ACK Request
+//
+// The ACK request constructed by the client transaction MUST contain
+// values for the Call-ID, From, and Request-URI that are equal to the
+// values of those header fields in the request passed to the transport
+// by the client transaction (call this the "original request").  The To
+// header field in the ACK MUST equal the To header field in the
+// response being acknowledged, and therefore will usually differ from
+// the To header field in the original request by the addition of the
+// tag parameter.  The ACK MUST contain a single Via header field, and
+// this MUST be equal to the top Via header field of the original
+// request.  The CSeq header field in the ACK MUST contain the same
+// value for the sequence number as was present in the original request,
+// but the method parameter MUST be equal to "ACK".
+//
+// If the INVITE request whose response is being acknowledged had Route
+// header fields, those header fields MUST appear in the ACK.  This is
+// to ensure that the ACK can be routed properly through any downstream
+// stateless proxies.
+
+// newACK returns the ACK of a non-2xx final response,the caller holds the mutex
+func (ct *ClientTransaction) newACK(response *SipMsg) *SipMsg {
+	requestLine := ct.request.GetRequestLine()
+	ack := new(SipMsg)
+	ack.SetRequestLine(NewRequestLine("ACK", requestLine.GetUri(), requestLine.GetSchema(), requestLine.GetVersion()))
+	ack.SetVia(ct.request.GetVia())
+	ack.SetRoutes(ct.request.GetRoutes())
+	ack.SetMaxForwards(NewMaxForwards(70))
+	ack.SetFrom(ct.request.GetFrom())
+	ack.SetTo(response.GetTo())
+	ack.SetCallID(ct.request.GetCallID())
+	ack.SetCSeq(NewCSeq(ct.request.GetCSeq().GetNumber(), "ACK"))
+	ack.SetContentLength(NewContentLength(0))
+	return ack
+}
@@ -0,0 +1,198 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transactionPassed returns a ResponseHandler that records the status codes passed to the TU
+func transactionPassed(codes *[]uint) ResponseHandler {
+	return func(sm *SipMsg, ct *ClientTransaction) {
+		*codes = append(*codes, sm.GetStatusLine().GetStatusCode())
+	}
+}
+
+func TestClientTransaction_NonInvite(t *testing.T) {
+	tl, tt, clock := transactionTest("UDP")
+	target := NewTarget("UDP", "", net.IPv4(192, 168, 0, 108), 5060)
+	var codes []uint
+	message := transactionParse(t, sipMsgMessage)
+	ct, err := tl.Request(context.Background(), message, target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.GetState() != TransactionTrying || len(tt.take()) != 1 {
+		t.Fatal("request not sent")
+	}
+	// Timer E: 500ms,1s,2s,4s,4s
+	for _, interval := range []time.Duration{T1, 2 * T1, 4 * T1, T2, T2} {
+		clock.Advance(interval - time.Millisecond)
+		if len(tt.take()) != 0 {
+			t.Error("retransmitted before", interval)
+		}
+		clock.Advance(time.Millisecond)
+		if len(tt.take()) != 1 {
+			t.Error("not retransmitted after", interval)
+		}
+	}
+	tl.Handle(transactionResponse(message, 100), nil)
+	if ct.GetState() != TransactionProceeding {
+		t.Error("state mismatch", ct.GetState())
+	}
+	clock.Advance(T2)
+	if len(tt.take()) != 1 {
+		t.Error("not retransmitted in Proceeding")
+	}
+	tl.Handle(transactionResponse(message, 200), nil)
+	tl.Handle(transactionResponse(message, 200), nil)
+	fmt.Println(codes, ct.GetState())
+	if len(codes) != 2 || codes[0] != 100 || codes[1] != 200 || ct.GetState() != TransactionCompleted {
+		t.Error("responses mismatch", codes)
+	}
+	// Timer K
+	clock.Advance(T4)
+	if ct.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 || len(tt.take()) != 0 {
+		t.Error("not terminated by Timer K", ct.GetState(), tl.Len(), clock.Len())
+	}
+}
+
+func TestClientTransaction_Timeout(t *testing.T) {
+	tl, tt, clock := transactionTest("UDP")
+	target := NewTarget("UDP", "", net.IPv4(192, 168, 0, 108), 5060)
+	var codes []uint
+	ct, err := tl.Request(context.Background(), transactionParse(t, sipMsgMessage), target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Timer F
+	clock.Advance(64 * T1)
+	sent := len(tt.take())
+	fmt.Println(sent, codes, ct.GetState())
+	if sent != 11 || len(codes) != 1 || codes[0] != 408 || ct.GetState() != TransactionTerminated {
+		t.Error("timeout mismatch", sent, codes)
+	}
+	if tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("timers left", tl.Len(), clock.Len())
+	}
+
+	// a transport error is passed as 503
+	codes = nil
+	ct, err = tl.Request(context.Background(), transactionParse(t, sipMsgRegister), target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.fail(&net.AddrError{Err: "unreachable", Addr: "192.168.0.108"})
+	clock.Advance(T1)
+	if len(codes) != 1 || codes[0] != 503 || ct.GetError() == nil || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("transport error mismatch", codes, ct.GetError())
+	}
+}
+
+func TestClientTransaction_Invite(t *testing.T) {
+	tl, tt, clock := transactionTest("UDP")
+	tl.SetTimerD(40 * time.Second)
+	target := NewTarget("UDP", "", net.IPv4(192, 168, 0, 26), 5060)
+	var codes []uint
+	invite := transactionParse(t, transactionInvite)
+	ct, err := tl.Request(context.Background(), invite, target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.GetState() != TransactionCalling {
+		t.Error("state mismatch", ct.GetState())
+	}
+	// Timer A: 500ms,1s
+	clock.Advance(3 * T1)
+	if len(tt.take()) != 3 {
+		t.Error("retransmissions mismatch")
+	}
+	// a provisional response stops the retransmissions
+	tl.Handle(transactionResponse(invite, 100), nil)
+	clock.Advance(time.Minute)
+	if ct.GetState() != TransactionProceeding || len(tt.take()) != 0 {
+		t.Error("retransmitted in Proceeding", ct.GetState())
+	}
+	// a non-2xx final response is acknowledged in the transaction
+	tl.Handle(transactionResponse(invite, 486), nil)
+	sent := tt.take()
+	if len(sent) != 1 {
+		t.Fatal("ACK not sent")
+	}
+	fmt.Print(sent[0])
+	ack := transactionParse(t, sent[0])
+	if ack.GetRequestLine().GetMethod() != "ACK" || ack.GetCSeq().GetMethod() != "ACK" || ack.GetCSeq().GetNumber() != 1 ||
+		ack.GetTo().GetTag() != "776" || ack.GetVia().GetBranch() != invite.GetVia().GetBranch() {
+		t.Error("ACK mismatch")
+	}
+	tl.Handle(transactionResponse(invite, 486), nil)
+	if len(tt.take()) != 1 || len(codes) != 2 || ct.GetState() != TransactionCompleted {
+		t.Error("retransmitted response mismatch", codes, ct.GetState())
+	}
+	// Timer D of the layer
+	clock.Advance(32 * time.Second)
+	if ct.GetState() != TransactionCompleted {
+		t.Error("terminated before Timer D", ct.GetState())
+	}
+	clock.Advance(8 * time.Second)
+	if ct.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated by Timer D", ct.GetState())
+	}
+}
+
+func TestClientTransaction_Accepted(t *testing.T) {
+	tl, tt, clock := transactionTest("UDP")
+	target := NewTarget("UDP", "", net.IPv4(192, 168, 0, 26), 5060)
+	var codes []uint
+	invite := transactionParse(t, transactionInvite)
+	ct, err := tl.Request(context.Background(), invite, target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.take()
+	// the retransmissions of the 2xx are passed to the TU,the ACK is left to it
+	tl.Handle(transactionResponse(invite, 200), nil)
+	tl.Handle(transactionResponse(invite, 200), nil)
+	tl.Handle(transactionResponse(invite, 180), nil)
+	if len(codes) != 2 || ct.GetState() != TransactionAccepted || len(tt.take()) != 0 {
+		t.Error("2xx mismatch", codes, ct.GetState())
+	}
+	// Timer M
+	clock.Advance(64 * T1)
+	if ct.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated by Timer M", ct.GetState())
+	}
+}
+
+func TestClientTransaction_Reliable(t *testing.T) {
+	tl, tt, clock := transactionTest("TCP")
+	target := NewTarget("TCP", "", net.IPv4(192, 168, 0, 26), 5060)
+	var codes []uint
+	invite := transactionParse(t, strings.Replace(transactionInvite, "SIP/2.0/UDP", "SIP/2.0/TCP", 1))
+	ct, err := tl.Request(context.Background(), invite, target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Second)
+	if len(tt.take()) != 1 {
+		t.Error("retransmitted over TCP")
+	}
+	// Timer D is 0 over a reliable transport
+	tl.Handle(transactionResponse(invite, 486), nil)
+	if len(tt.take()) != 1 || ct.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated", ct.GetState(), tl.Len(), clock.Len())
+	}
+	message := transactionParse(t, strings.Replace(sipMsgMessage, "SIP/2.0/UDP", "SIP/2.0/TCP", 1))
+	ct, err = tl.Request(context.Background(), message, target, transactionPassed(&codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Timer K is 0 over a reliable transport
+	tl.Handle(transactionResponse(message, 200), nil)
+	if ct.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated", ct.GetState(), tl.Len(), clock.Len())
+	}
+}
@@ -0,0 +1,370 @@
+package sip
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.2.1
+//
+//                                |INVITE
+//                                |pass INV to TU
+//             INVITE             V send 100 if TU won't in 200ms
+//             send response+-----------+
+//                 +--------|           |--------+101-199 from TU
+//                 |        | Proceeding|        |send response
+//                 +------->|           |<-------+
+//                          |           |          Transport Err.
+//                          |           |          Inform TU
+//                          |           |--------------->+
+//                          +-----------+                |
+//             300-699 from TU |     |2xx from TU        |
+//             send response   |     |send response      |
+//                             |     +------------------>+
+//                             |                         |
+//             INVITE          V          Timer G fires  |
+//             send response+-----------+ send response  |
+//                 +--------|           |--------+       |
+//                 |        | Completed |        |       |
+//                 +------->|           |<-------+       |
+//                          +-----------+                |
+//                             |     |                   |
+//                         ACK |     |                   |
+//                         -   |     +------------------>+
+//                             |        Timer H fires    |
+//                             V        or Transport Err.|
+//                          +-----------+  Inform TU     |
+//                          |           |                |
+//                          | Confirmed |                |
+//                          |           |                |
+//                          +-----------+                |
+//                                |                      |
+//                                |Timer I fires         |
+//                                |-                     |
+//                                |                      |
+//                                V                      |
+//                          +-----------+                |
+//                          |           |                |
+//                          | Terminated|<---------------+
+//                          |           |
+//                          +-----------+
+//
+//               Figure 7: INVITE server transaction
+//
+// A 2xx from the TU moves the transaction to the "Accepted" state of RFC 6026 instead of "Terminated",
+// the retransmissions of the INVITE are absorbed and the TU retransmits the 2xx until Timer L fires.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.2.2
+//
+//                                   |Request received
+//                                   |pass to TU
+//                                   V
+//                             +-----------+
+//                             |           |
+//                             | Trying    |-------------+
+//                             |           |             |
+//                             +-----------+             |200-699 from TU
+//                                   |                   |send response
+//                                   |1xx from TU        |
+//                                   |send response      |
+//                                   |                   |
+//                Request            V      1xx from TU  |
+//                send response+-----------+send response|
+//                    +--------|           |--------+    |
+//                    |        | Proceeding|        |    |
+//                    +------->|           |<-------+    |
+//             +<--------------|           |             |
+//             |Trnsprt Err    +-----------+             |
+//             |Inform TU            |                   |
+//             |                     |                   |
+//             |                     |200-699 from TU    |
+//             |                     |send response      |
+//             |  Request            V                   |
+//             |  send response+-----------+             |
+//             |      +--------|           |             |
+//             |      |        | Completed |<------------+
+//             |      +------->|           |
+//             +<--------------|           |
+//             |Trnsprt Err    +-----------+
+//             |Inform TU            |
+//             |                     |Timer J fires
+//             |                     |-
+//             |                     |
+//             |                     V
+//             |               +-----------+
+//             |               |           |
+//             +-------------->| Terminated|
+//                             |           |
+//                             +-----------+
+//
+//                 Figure 8: non-INVITE server transaction
+
+// ServerTransaction is an INVITE or a non-INVITE server transaction,it absorbs the retransmissions of its request,
+// sends the responses of the TU again for them and retransmits a non-2xx final response to an INVITE
+type ServerTransaction struct {
+	layer      *TransactionLayer
+	key        string // the branch,sent-by and method of the request,or the RFC 2543 key
+	request    *SipMsg
+	source     *Source
+	trying     *SipMsg // the 100 Trying sent when the TU does not answer an INVITE in 200ms
+	response   *SipMsg // the last response sent,sent again for a retransmission of the request
+	invite     bool
+	reliable   bool
+	state      TransactionState
+	interval   time.Duration // the interval of the next retransmission
+	provide    Timer         // the timer of the 100 Trying
+	retransmit Timer         // Timer G
+	timeout    Timer         // Timer H
+	wait       Timer         // Timer I / Timer J / Timer L
+	mutex      sync.Mutex
+}
+
+func (st *ServerTransaction) GetKey() string {
+	return st.key
+}
+func (st *ServerTransaction) GetRequest() *SipMsg {
+	return st.request
+}
+func (st *ServerTransaction) GetSource() *Source {
+	return st.source
+}
+func (st *ServerTransaction) GetState() TransactionState {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return st.state
+}
+
+func newServerTransaction(layer *TransactionLayer, key string, request *SipMsg, source *Source) *ServerTransaction {
+	invite := strings.EqualFold(request.GetRequestLine().GetMethod(), "INVITE")
+	st := &ServerTransaction{
+		layer:    layer,
+		key:      key,
+		request:  request,
+		source:   source,
+		invite:   invite,
+		reliable: source != nil && transactionReliable(source.GetTransport()),
+		state:    TransactionTrying,
+	}
+	if invite {
+		// the 100 Trying is built before the TU can change the request
+		st.trying = NewResponse(request, 100, "")
+		st.state = TransactionProceeding
+	}
+	return st
+}
+
+// start passes the request to the TU,an INVITE is answered by 100 Trying if the TU has not responded in 200ms
+func (st *ServerTransaction) start() {
+	if st.invite {
+		st.mutex.Lock()
+		st.provide = st.layer.clock.AfterFunc(transactionTrying, st.timerTrying)
+		st.mutex.Unlock()
+	}
+	if handler := st.layer.handler; handler != nil {
+		handler(st.request, st.source, st)
+	}
+}
+
+// Respond sends the response sm of the TU,sm is copied.
+// A StatusError 481 is returned when the transaction is terminated,
+// and a StatusError 500 when a final response is already sent.
+func (st *ServerTransaction) Respond(sm *SipMsg) error {
+	if sm.GetStatusLine() == nil {
+		raw := sm.GetSource()
+		return NewParseError("Status-Line", raw, 0, "a server transaction sends a response")
+	}
+	response, err := sm.Clone()
+	if err != nil {
+		return err
+	}
+	code := response.GetStatusLine().GetStatusCode()
+	clock, t1 := st.layer.clock, st.layer.t1
+	st.mutex.Lock()
+	switch st.state {
+	case TransactionTrying, TransactionProceeding:
+	case TransactionAccepted:
+		// the TU retransmits its 2xx
+		if code < 200 || code >= 300 {
+			st.mutex.Unlock()
+			return NewStatusError(500, "final response already sent")
+		}
+	case TransactionTerminated:
+		st.mutex.Unlock()
+		return NewStatusError(481, "")
+	default:
+		st.mutex.Unlock()
+		return NewStatusError(500, "final response already sent")
+	}
+	transactionStop(st.provide)
+	st.response = response
+	switch {
+	case code < 200:
+		st.state = TransactionProceeding
+	case st.invite && code < 300:
+		if st.state != TransactionAccepted {
+			st.state = TransactionAccepted
+			st.wait = clock.AfterFunc(64*t1, st.timerWait)
+		}
+	case st.invite:
+		st.state = TransactionCompleted
+		if !st.reliable {
+			st.interval = t1
+			st.retransmit = clock.AfterFunc(st.interval, st.timerRetransmit)
+		}
+		st.timeout = clock.AfterFunc(64*t1, st.timerTimeout)
+	default:
+		st.complete(64 * t1)
+	}
+	terminated := st.state == TransactionTerminated
+	st.mutex.Unlock()
+	if terminated {
+		st.layer.removeServer(st)
+	}
+	// the TU gets the transport error of its response from Respond
+	if err := st.send(response); err != nil {
+		st.fail(err, false)
+		return err
+	}
+	return nil
+}
+
+// send sends a response to the source of the request
+func (st *ServerTransaction) send(response *SipMsg) error {
+	return st.layer.transport.Respond(context.Background(), response, st.source)
+}
+
+// receive handles a retransmission of the request or the ACK of an INVITE
+func (st *ServerTransaction) receive(sm *SipMsg) {
+	ack := strings.EqualFold(sm.GetRequestLine().GetMethod(), "ACK")
+	var resend *SipMsg
+	pass := false
+	st.mutex.Lock()
+	switch st.state {
+	case TransactionProceeding, TransactionCompleted:
+		if !ack {
+			resend = st.response
+			break
+		}
+		if st.state == TransactionCompleted && st.invite {
+			transactionStop(st.retransmit, st.timeout)
+			if st.reliable {
+				st.terminate()
+			} else {
+				st.state = TransactionConfirmed
+				st.wait = st.layer.clock.AfterFunc(st.layer.t4, st.timerWait)
+			}
+		}
+	case TransactionAccepted:
+		// the ACK of the 2xx matches by the RFC 2543 key only,it belongs to the TU
+		pass = ack
+	}
+	terminated := st.state == TransactionTerminated
+	st.mutex.Unlock()
+	if terminated {
+		st.layer.removeServer(st)
+	}
+	if resend != nil {
+		if err := st.send(resend); err != nil {
+			st.fail(err, true)
+		}
+	}
+	if handler := st.layer.handler; pass && handler != nil {
+		handler(sm, st.source, nil)
+	}
+}
+
+// timerTrying sends 100 Trying when the TU has not responded to the INVITE
+func (st *ServerTransaction) timerTrying() {
+	st.mutex.Lock()
+	if st.state != TransactionProceeding || st.response != nil {
+		st.mutex.Unlock()
+		return
+	}
+	st.response = st.trying
+	st.mutex.Unlock()
+	if err := st.send(st.trying); err != nil {
+		st.fail(err, true)
+	}
+}
+
+// timerRetransmit is Timer G,doubled up to T2 at each retransmission of the final response
+func (st *ServerTransaction) timerRetransmit() {
+	st.mutex.Lock()
+	if st.state != TransactionCompleted {
+		st.mutex.Unlock()
+		return
+	}
+	st.interval *= 2
+	if st.interval > st.layer.t2 {
+		st.interval = st.layer.t2
+	}
+	st.retransmit = st.layer.clock.AfterFunc(st.interval, st.timerRetransmit)
+	response := st.response
+	st.mutex.Unlock()
+	if err := st.send(response); err != nil {
+		st.fail(err, true)
+	}
+}
+
+// timerTimeout is Timer H,the ACK never came,the TU is given a StatusError 408
+func (st *ServerTransaction) timerTimeout() {
+	st.mutex.Lock()
+	if st.state != TransactionCompleted {
+		st.mutex.Unlock()
+		return
+	}
+	st.terminate()
+	st.mutex.Unlock()
+	st.layer.removeServer(st)
+	st.inform(NewStatusError(408, "ACK not received"))
+}
+
+// timerWait is Timer I,Timer J or Timer L,the retransmissions of the request are no longer expected
+func (st *ServerTransaction) timerWait() {
+	st.mutex.Lock()
+	if st.state != TransactionCompleted && st.state != TransactionConfirmed && st.state != TransactionAccepted {
+		st.mutex.Unlock()
+		return
+	}
+	st.terminate()
+	st.mutex.Unlock()
+	st.layer.removeServer(st)
+}
+
+// fail terminates the transaction on a transport error,the TU is informed unless Respond returns err
+func (st *ServerTransaction) fail(err error, inform bool) {
+	st.mutex.Lock()
+	terminated := st.state == TransactionTerminated
+	st.terminate()
+	st.mutex.Unlock()
+	st.layer.removeServer(st)
+	if inform && !terminated {
+		st.inform(err)
+	}
+}
+
+// inform hands the failure of the transaction to the TU
+func (st *ServerTransaction) inform(err error) {
+	if failed := st.layer.failed; failed != nil {
+		failed(err, st)
+	}
+}
+
+// terminate stops the timers,the caller holds the mutex
+func (st *ServerTransaction) terminate() {
+	st.state = TransactionTerminated
+	transactionStop(st.provide, st.retransmit, st.timeout, st.wait)
+}
+
+// complete moves the transaction to the Completed state for wait over an unreliable transport,
+// to the Terminated state at once over a reliable one. The caller holds the mutex.
+func (st *ServerTransaction) complete(wait time.Duration) {
+	if st.reliable {
+		st.terminate()
+		return
+	}
+	st.state = TransactionCompleted
+	st.wait = st.layer.clock.AfterFunc(wait, st.timerWait)
+}
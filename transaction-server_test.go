@@ -0,0 +1,167 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transactionServer returns a TransactionLayer whose TU records the server transactions it is given
+func transactionServer(t *testing.T, transport string) (*TransactionLayer, *transactionTransport, *ManualClock, *[]*ServerTransaction) {
+	tl, tt, clock := transactionTest(transport)
+	var sts []*ServerTransaction
+	tl.SetHandler(func(sm *SipMsg, source *Source, st *ServerTransaction) {
+		sts = append(sts, st)
+	})
+	return tl, tt, clock, &sts
+}
+
+func TestServerTransaction_NonInvite(t *testing.T) {
+	tl, tt, clock, sts := transactionServer(t, "UDP")
+	source := NewSource("UDP", nil, nil)
+	tl.Handle(transactionParse(t, sipMsgMessage), source)
+	// a retransmission is absorbed
+	tl.Handle(transactionParse(t, sipMsgMessage), source)
+	if len(*sts) != 1 || tl.Len() != 1 || len(tt.take()) != 0 {
+		t.Fatal("request mismatch", len(*sts), tl.Len())
+	}
+	st := (*sts)[0]
+	if st.GetState() != TransactionTrying || st.GetSource() != source {
+		t.Error("state mismatch", st.GetState())
+	}
+	if err := st.Respond(transactionResponse(st.GetRequest(), 100)); err != nil {
+		t.Error(err)
+	}
+	tl.Handle(transactionParse(t, sipMsgMessage), source)
+	if lines := tt.takeLines(); len(lines) != 2 || lines[1] != "SIP/2.0 100 Trying" || st.GetState() != TransactionProceeding {
+		t.Error("provisional response mismatch", lines)
+	}
+	if err := st.Respond(transactionResponse(st.GetRequest(), 200)); err != nil {
+		t.Error(err)
+	}
+	tl.Handle(transactionParse(t, sipMsgMessage), source)
+	lines := tt.takeLines()
+	fmt.Println(lines)
+	if len(lines) != 2 || lines[1] != "SIP/2.0 200 OK" || st.GetState() != TransactionCompleted {
+		t.Error("final response mismatch", lines)
+	}
+	if err, ok := st.Respond(transactionResponse(st.GetRequest(), 500)).(*StatusError); !ok || err.GetStatusCode() != 500 {
+		t.Error("second final response accepted")
+	}
+	// Timer J
+	clock.Advance(64 * T1)
+	if st.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated by Timer J", st.GetState())
+	}
+	if err, ok := st.Respond(transactionResponse(st.GetRequest(), 200)).(*StatusError); !ok || err.GetStatusCode() != 481 {
+		t.Error("response of a terminated transaction accepted")
+	}
+	// Timer J is 0 over a reliable transport
+	tl.Handle(transactionParse(t, sipMsgRegister), NewSource("TCP", nil, nil))
+	st = (*sts)[1]
+	st.Respond(transactionResponse(st.GetRequest(), 200))
+	if st.GetState() != TransactionTerminated || tl.Len() != 0 {
+		t.Error("not terminated over TCP", st.GetState())
+	}
+}
+
+func TestServerTransaction_Invite(t *testing.T) {
+	tl, tt, clock, sts := transactionServer(t, "UDP")
+	source := NewSource("UDP", nil, nil)
+	tl.Handle(transactionParse(t, transactionInvite), source)
+	st := (*sts)[0]
+	if st.GetState() != TransactionProceeding {
+		t.Error("state mismatch", st.GetState())
+	}
+	// 100 Trying is sent when the TU does not answer in 200ms
+	clock.Advance(200 * time.Millisecond)
+	tl.Handle(transactionParse(t, transactionInvite), source)
+	if lines := tt.takeLines(); len(lines) != 2 || lines[0] != "SIP/2.0 100 Trying" || lines[1] != lines[0] {
+		t.Error("100 Trying mismatch", lines)
+	}
+	if err := st.Respond(transactionResponse(st.GetRequest(), 486)); err != nil {
+		t.Error(err)
+	}
+	// Timer G: 500ms,1s
+	clock.Advance(3 * T1)
+	tl.Handle(transactionParse(t, transactionInvite), source)
+	lines := tt.takeLines()
+	fmt.Println(lines)
+	if len(lines) != 4 || lines[0] != "SIP/2.0 486 Busy Here" || st.GetState() != TransactionCompleted {
+		t.Error("final response mismatch", lines)
+	}
+	ack := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "1 ACK", 1))
+	ack.GetRequestLine().SetMethod("ACK")
+	ack.GetTo().SetTag("776")
+	tl.Handle(ack, source)
+	tl.Handle(ack, source)
+	if len(*sts) != 1 || st.GetState() != TransactionConfirmed {
+		t.Error("ACK mismatch", len(*sts), st.GetState())
+	}
+	clock.Advance(time.Minute)
+	if len(tt.take()) != 0 {
+		t.Error("retransmitted after ACK")
+	}
+	// Timer I
+	if st.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated by Timer I", st.GetState())
+	}
+}
+
+func TestServerTransaction_Timeout(t *testing.T) {
+	tl, tt, clock, sts := transactionServer(t, "UDP")
+	var failed []error
+	tl.SetErrorHandler(func(err error, st *ServerTransaction) {
+		failed = append(failed, err)
+	})
+	tl.Handle(transactionParse(t, transactionInvite), NewSource("UDP", nil, nil))
+	st := (*sts)[0]
+	st.Respond(transactionResponse(st.GetRequest(), 404))
+	// Timer H,Timer G doubles up to T2
+	clock.Advance(64 * T1)
+	sent := len(tt.take())
+	fmt.Println(sent, st.GetState())
+	if sent != 11 || st.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated by Timer H", sent, st.GetState())
+	}
+	// the TU is informed of the timeout
+	if statusError, ok := failed[0].(*StatusError); len(failed) != 1 || !ok || statusError.GetStatusCode() != 408 {
+		t.Error("Timer H not passed to the TU", failed)
+	}
+}
+
+func TestServerTransaction_Accepted(t *testing.T) {
+	tl, tt, clock, sts := transactionServer(t, "UDP")
+	source := NewSource("UDP", nil, nil)
+	// RFC 2543,the ACK of the 2xx matches the transaction
+	invite := strings.Replace(transactionInvite, ";branch=z9hG4bK1371463275", "", 1)
+	tl.Handle(transactionParse(t, invite), source)
+	st := (*sts)[0]
+	if err := st.Respond(transactionResponse(st.GetRequest(), 200)); err != nil {
+		t.Error(err)
+	}
+	// the INVITE retransmissions are absorbed,the TU retransmits the 2xx
+	tl.Handle(transactionParse(t, invite), source)
+	if err := st.Respond(transactionResponse(st.GetRequest(), 200)); err != nil {
+		t.Error(err)
+	}
+	if err := st.Respond(transactionResponse(st.GetRequest(), 486)); err == nil {
+		t.Error("non-2xx accepted after 2xx")
+	}
+	if lines := tt.takeLines(); len(lines) != 2 || st.GetState() != TransactionAccepted {
+		t.Error("2xx mismatch", lines, st.GetState())
+	}
+	ack := transactionParse(t, strings.Replace(invite, "1 INVITE", "1 ACK", 1))
+	ack.GetRequestLine().SetMethod("ACK")
+	ack.GetTo().SetTag("776")
+	tl.Handle(ack, source)
+	if len(*sts) != 2 || (*sts)[1] != nil {
+		t.Error("ACK of the 2xx not passed to the TU")
+	}
+	// Timer L
+	clock.Advance(64 * T1)
+	if st.GetState() != TransactionTerminated || tl.Len() != 0 || clock.Len() != 0 {
+		t.Error("not terminated by Timer L", st.GetState())
+	}
+}
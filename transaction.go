@@ -0,0 +1,400 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17
+//
+// 17 Transactions
+//
+// SIP is a transactional protocol: interactions between components take
+// place in a series of independent message exchanges.  Specifically, a
+// SIP transaction consists of a single request and any responses to
+// that request, which include zero or more provisional responses and
+// one or more final responses.  In the case of a transaction where the
+// request was an INVITE (known as an INVITE transaction), the
+// transaction also includes the ACK only if the final response was not
+// a 2xx response.  If the response was a 2xx, the ACK is not considered
+// part of the transaction.
+//
+// Transactions have a client side and a server side.  The client side
+// is known as a client transaction and the server side as a server
+// transaction.  The client transaction sends the request, and the
+// server transaction sends the response.  The client and server
+// transactions are logical functions that are embedded in any number of
+// elements.  Specifically, they exist within user agents and stateful
+// proxy servers.
+//
+// https://www.rfc-editor.org/rfc/rfc6026.html#section-7
+//
+// 7.  Changes to RFC 3261
+//
+// The INVITE client transaction enters the "Accepted" state on a 2xx
+// response instead of terminating,so that the retransmissions of the 2xx
+// are passed to the TU,and the INVITE server transaction enters the
+// "Accepted" state on sending a 2xx,so that the retransmissions of the
+// INVITE are absorbed.  Timer L and Timer M end the "Accepted" state.
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#appendix-A
+//
+// Table 4: Summary of timers
+const (
+	T1 = 500 * time.Millisecond // RTT Estimate
+	T2 = 4 * time.Second        // The maximum retransmit interval for non-INVITE requests and INVITE responses
+	T4 = 5 * time.Second        // Maximum duration a message will remain in the network
+
+	transactionTrying = 200 * time.Millisecond // an INVITE server transaction sends 100 Trying when the TU has not answered for this long
+	transactionTimerD = 32 * time.Second       // Timer D over an unreliable transport,> 32s for UDP,0s for TCP/SCTP
+)
+
+// TransactionState is the state of a client or server transaction
+type TransactionState int
+
+const (
+	TransactionCalling    TransactionState = iota // INVITE client transaction,the request is sent
+	TransactionTrying                             // non-INVITE client or server transaction,the request is sent or received
+	TransactionProceeding                         // a provisional response is received or sent
+	TransactionCompleted                          // a final response is received or sent,the retransmissions are absorbed
+	TransactionConfirmed                          // INVITE server transaction,the ACK of a non-2xx final response is received
+	TransactionAccepted                           // INVITE transaction,a 2xx response is received or sent -- RFC6026
+	TransactionTerminated                         // the transaction is gone
+)
+
+func (ts TransactionState) String() string {
+	switch ts {
+	case TransactionCalling:
+		return "Calling"
+	case TransactionTrying:
+		return "Trying"
+	case TransactionProceeding:
+		return "Proceeding"
+	case TransactionCompleted:
+		return "Completed"
+	case TransactionConfirmed:
+		return "Confirmed"
+	case TransactionAccepted:
+		return "Accepted"
+	case TransactionTerminated:
+		return "Terminated"
+	}
+	return fmt.Sprintf("TransactionState(%d)", int(ts))
+}
+
+// RequestHandler is called by the transaction layer for a request that creates a server transaction,
+// and for an ACK that matches none with st nil,the ACK of a 2xx response belongs to the TU
+type RequestHandler func(sm *SipMsg, source *Source, st *ServerTransaction)
+
+// ResponseHandler is called by a client transaction for each response it passes to the TU,
+// a timeout is passed as a 408 response and a transport error as a 503 response
+type ResponseHandler func(sm *SipMsg, ct *ClientTransaction)
+
+// ErrorHandler is called by the transaction layer when a server transaction fails,
+// err is a StatusError 408 when Timer H fires and the error of the transport otherwise
+type ErrorHandler func(err error, st *ServerTransaction)
+
+// TransactionLayer matches the messages received by the transports to the client and server transactions,
+// set Handle as the Handler of the transports
+type TransactionLayer struct {
+	transport *TransportLayer
+	handler   RequestHandler // the TU of the server transactions
+	stray     Handler        // the responses that match no client transaction
+	failed    ErrorHandler   // the TU of the server transactions that fail
+	clock     Clock
+	t1        time.Duration
+	t2        time.Duration
+	t4        time.Duration
+	timerD    time.Duration // Timer D over an unreliable transport
+	clients   map[string]*ClientTransaction
+	servers   map[string]*ServerTransaction
+	mutex     sync.Mutex
+}
+
+func (tl *TransactionLayer) GetTransport() *TransportLayer {
+	return tl.transport
+}
+func (tl *TransactionLayer) SetHandler(handler RequestHandler) {
+	tl.handler = handler
+}
+func (tl *TransactionLayer) GetHandler() RequestHandler {
+	return tl.handler
+}
+
+// SetStrayHandler sets the handler of the responses that match no client transaction,
+// a stateless proxy forwards them and a UA core acknowledges a retransmitted 2xx
+func (tl *TransactionLayer) SetStrayHandler(stray Handler) {
+	tl.stray = stray
+}
+func (tl *TransactionLayer) GetStrayHandler() Handler {
+	return tl.stray
+}
+
+// SetErrorHandler sets the handler of the server transactions that fail,
+// the TU is informed of a Timer H or a transport error -- RFC 3261 17.2.1,17.2.4
+func (tl *TransactionLayer) SetErrorHandler(failed ErrorHandler) {
+	tl.failed = failed
+}
+func (tl *TransactionLayer) GetErrorHandler() ErrorHandler {
+	return tl.failed
+}
+func (tl *TransactionLayer) SetClock(clock Clock) {
+	tl.clock = clock
+}
+func (tl *TransactionLayer) GetClock() Clock {
+	return tl.clock
+}
+func (tl *TransactionLayer) SetT1(t1 time.Duration) {
+	tl.t1 = t1
+}
+func (tl *TransactionLayer) GetT1() time.Duration {
+	return tl.t1
+}
+func (tl *TransactionLayer) SetT2(t2 time.Duration) {
+	tl.t2 = t2
+}
+func (tl *TransactionLayer) GetT2() time.Duration {
+	return tl.t2
+}
+func (tl *TransactionLayer) SetT4(t4 time.Duration) {
+	tl.t4 = t4
+}
+func (tl *TransactionLayer) GetT4() time.Duration {
+	return tl.t4
+}
+
+// SetTimerD sets the time an INVITE client transaction absorbs the retransmissions of a non-2xx final response
+// over an unreliable transport,Timer D is 0 over a reliable one
+func (tl *TransactionLayer) SetTimerD(timerD time.Duration) {
+	tl.timerD = timerD
+}
+func (tl *TransactionLayer) GetTimerD() time.Duration {
+	return tl.timerD
+}
+
+// NewTransactionLayer returns a TransactionLayer sending on transport,handler is the TU of the server transactions.
+// The timers run on SystemClock with the T1,T2,T4 and Timer D of RFC 3261.
+func NewTransactionLayer(transport *TransportLayer, handler RequestHandler) *TransactionLayer {
+	return &TransactionLayer{
+		transport: transport,
+		handler:   handler,
+		clock:     SystemClock{},
+		t1:        T1,
+		t2:        T2,
+		t4:        T4,
+		timerD:    transactionTimerD,
+		clients:   make(map[string]*ClientTransaction),
+		servers:   make(map[string]*ServerTransaction),
+	}
+}
+
+// Len returns the number of client and server transactions that are not terminated
+func (tl *TransactionLayer) Len() int {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	return len(tl.clients) + len(tl.servers)
+}
+
+// Request sends sm in a new client transaction to target and passes its responses to handler.
+// sm is copied,the copy is given a branch when its top Via has none and it is retransmitted by the transaction.
+func (tl *TransactionLayer) Request(ctx context.Context, sm *SipMsg, target *Target, handler ResponseHandler) (*ClientTransaction, error) {
+	request, err := sm.Clone()
+	if err != nil {
+		return nil, err
+	}
+	raw := request.GetSource()
+	via, cseq := request.GetVia(), request.GetCSeq()
+	switch {
+	case request.GetRequestLine() == nil:
+		return nil, NewParseError("Request-Line", raw, 0, "a client transaction sends a request")
+	case via == nil:
+		return nil, NewParseError("Via", raw, len(raw), "missing Via header field")
+	case cseq == nil:
+		return nil, NewParseError("CSeq", raw, len(raw), "missing CSeq header field")
+	case strings.EqualFold(request.GetRequestLine().GetMethod(), "ACK"):
+		return nil, NewParseError("Request-Line", raw, 0, "an ACK has no client transaction")
+	}
+	if len(strings.TrimSpace(via.GetBranch())) == 0 {
+		via.SetBranch(GenUnixNanoBranch())
+	}
+	ct := newClientTransaction(tl, request, target, handler)
+	tl.mutex.Lock()
+	if _, ok := tl.clients[ct.key]; ok {
+		tl.mutex.Unlock()
+		return nil, NewParseError("Via", raw, strings.Index(raw, via.GetBranch()), "branch of an existing client transaction")
+	}
+	tl.clients[ct.key] = ct
+	tl.mutex.Unlock()
+	if err := ct.start(ctx); err != nil {
+		tl.removeClient(ct)
+		return nil, err
+	}
+	return ct, nil
+}
+
+// Handle passes a response to the client transaction it matches and a request to the server transaction it matches,
+// a request that matches none creates a server transaction and is passed to the TU
+func (tl *TransactionLayer) Handle(sm *SipMsg, source *Source) {
+	if sm.GetStatusLine() != nil {
+		key, ok := transactionClientKey(sm)
+		tl.mutex.Lock()
+		ct := tl.clients[key]
+		tl.mutex.Unlock()
+		switch {
+		case ok && ct != nil:
+			ct.receive(sm)
+		case tl.stray != nil:
+			tl.stray(sm, source)
+		}
+		return
+	}
+	key, ok := transactionServerKey(sm)
+	if !ok {
+		return
+	}
+	ack := strings.EqualFold(sm.GetRequestLine().GetMethod(), "ACK")
+	tl.mutex.Lock()
+	st, found := tl.servers[key]
+	if !found && !ack {
+		st = newServerTransaction(tl, key, sm, source)
+		tl.servers[key] = st
+	}
+	tl.mutex.Unlock()
+	switch {
+	case found:
+		st.receive(sm)
+	case st != nil:
+		st.start()
+	case tl.handler != nil:
+		tl.handler(sm, source, nil)
+	}
+}
+
+// removeClient takes ct out of the layer
+func (tl *TransactionLayer) removeClient(ct *ClientTransaction) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	if tl.clients[ct.key] == ct {
+		delete(tl.clients, ct.key)
+	}
+}
+
+// removeServer takes st out of the layer
+func (tl *TransactionLayer) removeServer(st *ServerTransaction) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	if tl.servers[st.key] == st {
+		delete(tl.servers, st.key)
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.1.3
+//
+// 17.1.3 Matching Responses to Client Transactions
+//
+// A response matches a client transaction under two conditions:
+//
+//    1.  If the response has the same value of the branch parameter in
+//        the top Via header field as the branch parameter in the top
+//        Via header field of the request that created the transaction.
+//
+//    2.  If the method parameter in the CSeq header field matches the
+//        method of the request that created the transaction.  The
+//        method is needed since a CANCEL request constitutes a
+//        different transaction, but shares the same value of the branch
+//        parameter.
+
+// transactionClientKey returns the key of the client transaction a response or a request belongs to
+func transactionClientKey(sm *SipMsg) (string, bool) {
+	via, cseq := sm.GetVia(), sm.GetCSeq()
+	if via == nil || cseq == nil || len(strings.TrimSpace(via.GetBranch())) == 0 {
+		return "", false
+	}
+	return via.GetBranch() + " " + strings.ToUpper(cseq.GetMethod()), true
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-17.2.3
+//
+// 17.2.3 Matching Requests to Server Transactions
+//
+// The branch parameter in the topmost Via header field of the request
+// is examined.  If it is present and begins with the magic cookie
+// "z9hG4bK", the request was generated by a client transaction
+// compliant to this specification.  Therefore, the branch parameter
+// will be unique across all transactions sent by that client.  The
+// request matches a transaction if:
+//
+//    1. the branch parameter in the request is equal to the one in the
+//       top Via header field of the request that created the
+//       transaction, and
+//
+//    2. the sent-by value in the top Via of the request is equal to the
+//       one in the request that created the transaction, and
+//
+//    3. the method of the request matches the one that created the
+//       transaction, except for ACK, where the method of the request
+//       that created the transaction is INVITE.
+//
+// If the branch parameter in the top Via header field is not present,
+// or does not contain the magic cookie, the following procedures are
+// used.  These exist to handle backwards compatibility with RFC 2543
+// compliant implementations.
+//
+// The INVITE request matches a transaction if the Request-URI, To tag,
+// From tag, Call-ID, CSeq, and top Via header field match those of the
+// INVITE request which created the transaction.
+//
+// The To tag is left out of the RFC 2543 key,the INVITE has none and its ACK carries the tag of the response.
+
+// transactionServerKey returns the key of the server transaction a request belongs to
+func transactionServerKey(sm *SipMsg) (string, bool) {
+	if sm.GetRequestLine() == nil {
+		return "", false
+	}
+	method := strings.ToUpper(sm.GetRequestLine().GetMethod())
+	if method == "ACK" {
+		method = "INVITE"
+	}
+	return transactionMethodKey(sm, method)
+}
+
+// transactionMethodKey returns the key of the server transaction of method a request matches,
+// example: the INVITE a CANCEL cancels
+func transactionMethodKey(sm *SipMsg, method string) (string, bool) {
+	via, cseq := sm.GetVia(), sm.GetCSeq()
+	if sm.GetRequestLine() == nil || via == nil || cseq == nil {
+		return "", false
+	}
+	if strings.HasPrefix(via.GetBranch(), "z9hG4bK") {
+		return fmt.Sprintf("%s %s:%d %s", via.GetBranch(), strings.ToLower(via.GetHost()), via.GetPort(), method), true
+	}
+	from, callId := sm.GetFrom(), sm.GetCallID()
+	if from == nil || callId == nil {
+		return "", false
+	}
+	uri := ""
+	if requestUri := sm.GetRequestLine().GetUri(); requestUri != nil {
+		uriRaw := requestUri.Raw()
+		uri = uriRaw.String()
+	}
+	callIdRaw := callId.Raw()
+	return fmt.Sprintf("%s %s %s %d %s %s:%d %s", strings.TrimSpace(uri), from.GetTag(), strings.TrimSpace(callIdRaw.String()), cseq.GetNumber(),
+		method, strings.ToLower(via.GetHost()), via.GetPort(), via.GetBranch()), true
+}
+
+// transactionReliable reports whether transport is reliable,the timers of retransmission only run over an unreliable one
+func transactionReliable(transport string) bool {
+	return !strings.EqualFold(transport, "UDP")
+}
+
+// transactionStop stops the timers that are not nil
+func transactionStop(timers ...Timer) {
+	for _, timer := range timers {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
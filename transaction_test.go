@@ -0,0 +1,209 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transactionInvite is the INVITE of a live view a GB28181 platform sends to a camera
+const transactionInvite = "INVITE sip:34020000001320000001@3402000000 SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 192.168.0.108:5060;rport;branch=z9hG4bK1371463275\r\n" +
+	"From: <sip:34020000002000000001@3402000000>;tag=2043466183\r\n" +
+	"To: <sip:34020000001320000001@3402000000>\r\n" +
+	"Call-ID: 1011047671@192.168.0.108\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"Contact: <sip:34020000002000000001@192.168.0.108:5060>\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+// transactionTransport is a Transport that records the messages sent on it
+type transactionTransport struct {
+	transport string
+	sent      []string
+	err       error
+	mutex     sync.Mutex
+}
+
+func (tt *transactionTransport) GetTransport() string {
+	return tt.transport
+}
+func (tt *transactionTransport) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	return tt.record(sm)
+}
+func (tt *transactionTransport) Respond(ctx context.Context, sm *SipMsg, source *Source) error {
+	return tt.record(sm)
+}
+func (tt *transactionTransport) Serve() error {
+	return nil
+}
+func (tt *transactionTransport) Close() error {
+	return nil
+}
+func (tt *transactionTransport) record(sm *SipMsg) error {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+	if tt.err != nil {
+		return tt.err
+	}
+	raw := sm.Raw()
+	tt.sent = append(tt.sent, raw.String())
+	return nil
+}
+
+// fail makes the next messages fail with err
+func (tt *transactionTransport) fail(err error) {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+	tt.err = err
+}
+
+// take returns the messages sent since the last call
+func (tt *transactionTransport) take() []string {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+	sent := tt.sent
+	tt.sent = nil
+	return sent
+}
+
+// takeLines returns the first lines of the messages sent since the last call
+func (tt *transactionTransport) takeLines() []string {
+	var lines []string
+	for _, raw := range tt.take() {
+		lines = append(lines, raw[:strings.Index(raw, "\r\n")])
+	}
+	return lines
+}
+
+// transactionTest returns a TransactionLayer on a recording transport and a ManualClock
+func transactionTest(transport string) (*TransactionLayer, *transactionTransport, *ManualClock) {
+	tt := &transactionTransport{transport: transport}
+	clock := NewManualClock(time.Unix(0, 0))
+	tl := NewTransactionLayer(NewTransportLayer(tt), nil)
+	tl.SetClock(clock)
+	return tl, tt, clock
+}
+
+// transactionParse parses raw or fails the test
+func transactionParse(t *testing.T, raw string) *SipMsg {
+	sm := new(SipMsg)
+	if err := sm.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+// transactionResponse returns the response of a UAS to request,the To tag is added to a final response
+func transactionResponse(request *SipMsg, statusCode uint) *SipMsg {
+	response := NewResponse(request, statusCode, "")
+	if statusCode >= 200 {
+		response.GetTo().SetTag("776")
+	}
+	return response
+}
+
+func TestTransaction_Key(t *testing.T) {
+	invite := transactionParse(t, transactionInvite)
+	cancel := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "1 CANCEL", 1))
+	cancel.GetRequestLine().SetMethod("CANCEL")
+	ack := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "1 ACK", 1))
+	ack.GetRequestLine().SetMethod("ACK")
+	ack.GetTo().SetTag("776")
+
+	inviteKey, _ := transactionClientKey(invite)
+	cancelKey, _ := transactionClientKey(cancel)
+	fmt.Println(inviteKey, "|", cancelKey)
+	if inviteKey == cancelKey {
+		t.Error("CANCEL matches the client transaction of the INVITE")
+	}
+	inviteKey, _ = transactionServerKey(invite)
+	ackKey, _ := transactionServerKey(ack)
+	cancelKey, _ = transactionServerKey(cancel)
+	fmt.Println(inviteKey, "|", ackKey, "|", cancelKey)
+	if inviteKey != ackKey || inviteKey == cancelKey {
+		t.Error("server key mismatch")
+	}
+	// another sent-by is another transaction
+	other := transactionParse(t, strings.Replace(transactionInvite, "192.168.0.108:5060;", "192.168.0.109:5060;", 1))
+	if otherKey, _ := transactionServerKey(other); otherKey == inviteKey {
+		t.Error("sent-by not matched")
+	}
+
+	// RFC 2543
+	for _, sm := range []*SipMsg{invite, ack, cancel} {
+		sm.GetVia().SetBranch("")
+	}
+	inviteKey, _ = transactionServerKey(invite)
+	ackKey, _ = transactionServerKey(ack)
+	cancelKey, _ = transactionServerKey(cancel)
+	fmt.Println(inviteKey, "|", ackKey)
+	if inviteKey != ackKey || inviteKey == cancelKey {
+		t.Error("RFC 2543 server key mismatch")
+	}
+	if _, ok := transactionClientKey(invite); ok {
+		t.Error("client key without branch")
+	}
+}
+
+func TestTransactionLayer_Request(t *testing.T) {
+	tl, tt, _ := transactionTest("UDP")
+	target := NewTarget("UDP", "", net.IPv4(192, 168, 0, 26), 5060)
+	register := transactionParse(t, sipMsgRegister)
+	register.GetVia().SetBranch("")
+	ct, err := tl.Request(context.Background(), register, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the request is copied and given a branch
+	fmt.Println(ct.GetKey())
+	if register.GetVia().GetBranch() != "" || !strings.HasPrefix(ct.GetRequest().GetVia().GetBranch(), "z9hG4bK") {
+		t.Error("branch mismatch", ct.GetKey())
+	}
+	if len(tt.take()) != 1 || tl.Len() != 1 {
+		t.Error("request not sent")
+	}
+	if _, err := tl.Request(context.Background(), ct.GetRequest(), target, nil); err == nil {
+		t.Error("duplicate branch accepted")
+	}
+	ack := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "1 ACK", 1))
+	ack.GetRequestLine().SetMethod("ACK")
+	response := transactionResponse(register, 200)
+	for _, sm := range []*SipMsg{ack, response} {
+		if _, err := tl.Request(context.Background(), sm, target, nil); err == nil {
+			t.Error("request accepted:", sm.GetSource())
+		}
+	}
+	// a transport error is returned and leaves no transaction
+	tt.fail(&net.AddrError{Err: "unreachable", Addr: "192.168.0.26"})
+	if _, err := tl.Request(context.Background(), transactionParse(t, sipMsgMessage), target, nil); err == nil || tl.Len() != 1 {
+		t.Error("transport error mismatch", err, tl.Len())
+	}
+}
+
+func TestTransactionLayer_Stray(t *testing.T) {
+	tl, _, _ := transactionTest("UDP")
+	var stray []*SipMsg
+	tl.SetStrayHandler(func(sm *SipMsg, source *Source) {
+		stray = append(stray, sm)
+	})
+	var acks []*SipMsg
+	tl.SetHandler(func(sm *SipMsg, source *Source, st *ServerTransaction) {
+		if st != nil {
+			t.Error("ACK given a server transaction")
+		}
+		acks = append(acks, sm)
+	})
+	invite := transactionParse(t, transactionInvite)
+	tl.Handle(transactionResponse(invite, 200), NewSource("UDP", nil, nil))
+	ack := transactionParse(t, strings.Replace(transactionInvite, "1 INVITE", "1 ACK", 1))
+	ack.GetRequestLine().SetMethod("ACK")
+	tl.Handle(ack, NewSource("UDP", nil, nil))
+	if len(stray) != 1 || len(acks) != 1 || tl.Len() != 0 {
+		t.Error("stray mismatch", len(stray), len(acks), tl.Len())
+	}
+}
@@ -0,0 +1,158 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.1.1
+//
+// 18.1.1 Sending Requests
+//
+// If a request is within 200 bytes of the path MTU, or if it is larger
+// than 1300 bytes and the path MTU is unknown, the request MUST be sent
+// using an RFC 2914 [43] congestion controlled transport protocol, such
+// as TCP.  If this causes a change in the transport protocol from the
+// one indicated in the top Via, the value in the top Via MUST be
+// changed.  This prevents fragmentation of messages over UDP and
+// provides congestion control for larger messages.  However,
+// implementations MUST be able to handle messages up to the maximum
+// datagram packet size.  For UDP, this size is 65,535 bytes, including
+// IP and UDP headers.
+//
+// If an element sends a request over TCP because of these message size
+// constraints, and that request would have otherwise been sent over
+// UDP, if the attempt to establish the connection generates either an
+// ICMP Protocol Not Supported, or results in a TCP reset, the element
+// SHOULD retry the request, using UDP.  If this causes a change in the
+// transport protocol from the one indicated in the top Via, the value
+// in the top Via MUST be changed.
+
+const (
+	transportUnknownMTU = 1300           // the largest request sent over UDP when the path MTU is unknown
+	transportMTUMargin  = 200            // a request within this many bytes of the path MTU is sent over TCP
+	transportUDPPayload = 65535 - 8 - 20 // the largest UDP datagram less the UDP and IPv4 headers
+	// the largest UDP datagram less the UDP header,the payload length of IPv6 does not count its fixed header
+	transportUDPPayload6 = 65535 - 8
+)
+
+// TransportLayer sends each message on the transport of its target or source,
+// a request too large for UDP is switched to TCP by RFC 3261 18.1.1
+type TransportLayer struct {
+	transports map[string]Transport // keyed by the upper-case transport,example: "UDP","TCP"
+	pathMTU    int                  // the path MTU,0 when it is unknown
+	mutex      sync.RWMutex
+}
+
+func (tl *TransportLayer) SetPathMTU(pathMTU int) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	tl.pathMTU = pathMTU
+}
+func (tl *TransportLayer) GetPathMTU() int {
+	tl.mutex.RLock()
+	defer tl.mutex.RUnlock()
+	return tl.pathMTU
+}
+
+// NewTransportLayer returns a TransportLayer over transports,a later transport replaces an earlier one of the same name
+func NewTransportLayer(transports ...Transport) *TransportLayer {
+	tl := &TransportLayer{
+		transports: make(map[string]Transport),
+	}
+	for _, transport := range transports {
+		tl.Add(transport)
+	}
+	return tl
+}
+
+// Add adds transport to the layer,it replaces the transport of the same name
+func (tl *TransportLayer) Add(transport Transport) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	tl.transports[strings.ToUpper(transport.GetTransport())] = transport
+}
+
+// Get returns the transport of name,example: "UDP","tcp",nil when the layer has none
+func (tl *TransportLayer) Get(name string) Transport {
+	tl.mutex.RLock()
+	defer tl.mutex.RUnlock()
+	return tl.transports[strings.ToUpper(name)]
+}
+
+// Send sends sm on the transport of target. A request to a UDP target that is within 200 bytes of the path MTU,
+// or larger than 1300 bytes when the path MTU is unknown,is sent over TCP with the transport of its top Via changed,
+// and it is sent over UDP again when the TCP connection is refused or reset.
+// A StatusError 513 is returned when the request is too large and the layer has no TCP transport.
+func (tl *TransportLayer) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	transport := tl.Get(target.GetTransport())
+	if transport == nil {
+		return &net.AddrError{Err: "unsupported transport", Addr: target.GetTransport()}
+	}
+	if sm.GetRequestLine() == nil || !strings.EqualFold(target.GetTransport(), "UDP") {
+		return transport.Send(ctx, sm, target)
+	}
+	raw := sm.Raw()
+	size := raw.Len()
+	if size <= tl.limit() {
+		return transport.Send(ctx, sm, target)
+	}
+	stream := tl.Get("TCP")
+	if stream == nil {
+		return NewStatusError(513, "")
+	}
+	via := sm.GetVia()
+	if via != nil {
+		via.SetTransport("TCP")
+	}
+	err := stream.Send(ctx, sm, NewTarget("TCP", target.GetHost(), target.GetIP(), target.GetPort()))
+	if err == nil || !(errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)) {
+		return err
+	}
+	if via != nil {
+		via.SetTransport("UDP")
+	}
+	return transport.Send(ctx, sm, target)
+}
+
+// limit returns the size of the largest request sent over UDP
+func (tl *TransportLayer) limit() int {
+	if pathMTU := tl.GetPathMTU(); pathMTU > 0 {
+		return pathMTU - transportMTUMargin
+	}
+	return transportUnknownMTU
+}
+
+// Respond sends the response sm on the transport of source,on the transport of its top Via when source is nil.
+// A response never changes its transport.
+func (tl *TransportLayer) Respond(ctx context.Context, sm *SipMsg, source *Source) error {
+	name := ""
+	switch {
+	case source != nil:
+		name = source.GetTransport()
+	case sm.GetVia() != nil:
+		name = sm.GetVia().GetTransport()
+	}
+	transport := tl.Get(name)
+	if transport == nil {
+		return &net.AddrError{Err: "unsupported transport", Addr: name}
+	}
+	return transport.Respond(ctx, sm, source)
+}
+
+// Close closes all transports of the layer,the first error is returned
+func (tl *TransportLayer) Close() error {
+	tl.mutex.RLock()
+	defer tl.mutex.RUnlock()
+	var err error
+	for _, transport := range tl.transports {
+		if closeErr := transport.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
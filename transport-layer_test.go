@@ -0,0 +1,140 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transportCatalog returns the catalog MESSAGE of an NVR with channels channels
+func transportCatalog(t *testing.T, channels int) *SipMsg {
+	var body strings.Builder
+	body.WriteString("<?xml version=\"1.0\" encoding=\"GB2312\"?>\r\n<Response>\r\n<CmdType>Catalog</CmdType>\r\n<SN>1</SN>\r\n")
+	body.WriteString(fmt.Sprintf("<SumNum>%d</SumNum>\r\n<DeviceList Num=\"%d\">\r\n", channels, channels))
+	for index := 0; index < channels; index++ {
+		body.WriteString(fmt.Sprintf("<Item>\r\n<DeviceID>3402000000131%07d</DeviceID>\r\n<Name>Camera %d</Name>\r\n<Status>ON</Status>\r\n</Item>\r\n", index, index))
+	}
+	body.WriteString("</DeviceList>\r\n</Response>\r\n")
+	sm := new(SipMsg)
+	if err := sm.Parse(sipMsgMessage); err != nil {
+		t.Fatal(err)
+	}
+	sm.SetBody([]byte(body.String()))
+	sm.SetContentLength(NewContentLength(uint(body.Len())))
+	return sm
+}
+
+// transportWait returns the transport a request was received on,it fails when the Via transport is not the same
+func transportWait(t *testing.T, received chan string) string {
+	select {
+	case transport := <-received:
+		return transport
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not received")
+	}
+	return ""
+}
+
+func TestTransportLayer_Send(t *testing.T) {
+	received := make(chan string, 1)
+	handler := func(sm *SipMsg, source *Source) {
+		if !strings.EqualFold(sm.GetVia().GetTransport(), source.GetTransport()) {
+			t.Error("Via transport mismatch", sm.GetVia().GetTransport(), source.GetTransport())
+		}
+		received <- source.GetTransport()
+	}
+	udp, err := ListenUDP("127.0.0.1:0", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	go udp.Serve()
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	tcp, err := ListenTCP(fmt.Sprintf("127.0.0.1:%d", port), handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tcp.Serve()
+	client, err := ListenUDP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := NewTransportLayer(client, NewStreamTransport("TCP", nil, nil, nil))
+	defer layer.Close()
+	target := NewTarget("UDP", "", net.IPv4(127, 0, 0, 1), uint16(port))
+
+	cases := []struct {
+		pathMTU   int
+		channels  int
+		transport string
+	}{
+		{0, 1, "UDP"},
+		{0, 200, "TCP"},
+		{1500, 6, "UDP"},
+		{576, 6, "TCP"},
+	}
+	for _, c := range cases {
+		layer.SetPathMTU(c.pathMTU)
+		sm := transportCatalog(t, c.channels)
+		raw := sm.Raw()
+		if err := layer.Send(context.Background(), sm, target); err != nil {
+			t.Fatal(err)
+		}
+		transport := transportWait(t, received)
+		fmt.Println("path MTU", c.pathMTU, ",", raw.Len(), "bytes ->", transport)
+		if transport != c.transport {
+			t.Errorf("%d bytes,path MTU %d: transport mismatch: %s", raw.Len(), c.pathMTU, transport)
+		}
+	}
+
+	// the TCP connection is refused,the request is sent over UDP again
+	tcp.Close()
+	stream := layer.Get("tcp").(*StreamTransport)
+	for deadline := time.Now().Add(2 * time.Second); stream.Len() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	layer.SetPathMTU(0)
+	sm := transportCatalog(t, 200)
+	if err := layer.Send(context.Background(), sm, target); err != nil {
+		t.Fatal(err)
+	}
+	if transport := transportWait(t, received); transport != "UDP" || sm.GetVia().GetTransport() != "UDP" {
+		t.Error("UDP retry mismatch", transport)
+	}
+	// responses never switch
+	response := transportCatalog(t, 200)
+	response.SetRequestLine(nil)
+	response.SetStatusLine(NewStatusLine("SIP", 2.0, 200, Success[200]))
+	if err := layer.Send(context.Background(), response, target); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransportLayer_TooLarge(t *testing.T) {
+	client, err := ListenUDP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := NewTransportLayer(client)
+	defer layer.Close()
+	target := NewTarget("UDP", "", net.IPv4(127, 0, 0, 1), 5060)
+	err = layer.Send(context.Background(), transportCatalog(t, 200), target)
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.GetStatusCode() != 513 {
+		t.Error("expected 513 without a TCP transport,got", err)
+	}
+	if err := layer.Send(context.Background(), transportCatalog(t, 200), NewTarget("TLS", "", net.IPv4(127, 0, 0, 1), 5061)); err == nil {
+		t.Error("expected an unsupported transport error")
+	}
+	// a datagram can not carry more than 65507 bytes
+	err = client.Send(context.Background(), transportCatalog(t, 1000), target)
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.GetStatusCode() != 513 {
+		t.Error("expected 513 for a message larger than a datagram,got", err)
+	}
+	// the fixed IPv6 header is not counted in the payload length
+	if transportUDPLimit(net.IPv4(127, 0, 0, 1)) != 65507 || transportUDPLimit(net.IPv6loopback) != 65527 {
+		t.Error("datagram limit mismatch")
+	}
+}
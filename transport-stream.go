@@ -0,0 +1,337 @@
+package sip
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.1.1
+//
+// 18.1.1 Sending Requests
+//
+// For reliable transports, the response is normally sent on the
+// connection on which the request was received.  Therefore, the client
+// transport MUST be prepared to receive the response on the same
+// connection used to send the request.
+//
+// If the request is sent over a connection-oriented transport, a
+// connection MUST be maintained to the destination for the duration of
+// the transaction.  A client SHOULD keep the connection open until the
+// transaction completes, and MAY reuse it afterwards.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-26.2
+//
+// 26.2 Security Mechanisms
+//
+// TLS is most suited to architectures in which hop-by-hop security is
+// required between hosts with no pre-existing trust association.  A
+// SIPS URI requires mutual TLS when the server is configured to ask the
+// client for its certificate,see tls.Config.ClientAuth.
+
+const transportIdleTimeout = 5 * time.Minute // default idle timeout of a connection
+
+// StreamTransport sends and receives SIP messages over TCP or TLS connections.
+// The connections accepted and dialed are kept in one pool keyed by the transport and the remote address,
+// a request to a target with a connection open reuses it and a response is sent on the connection its request came on.
+type StreamTransport struct {
+	transport   string       // "TCP" / "TLS"
+	listener    net.Listener // nil for a transport that only dials
+	tlsConfig   *tls.Config  // the certificates and the verification of both sides of TLS
+	handler     Handler
+	resolver    Resolver
+	idleTimeout time.Duration // a connection without reads or writes for this long is closed
+	conns       map[string]*streamConn
+	closed      bool
+	mutex       sync.Mutex
+}
+
+// streamConn is a connection of the pool,writes are serialized so that messages do not interleave
+type streamConn struct {
+	conn   net.Conn
+	key    string
+	mutex  sync.Mutex
+	source *Source
+}
+
+func (st *StreamTransport) SetHandler(handler Handler) {
+	st.handler = handler
+}
+func (st *StreamTransport) GetHandler() Handler {
+	return st.handler
+}
+func (st *StreamTransport) SetResolver(resolver Resolver) {
+	st.resolver = resolver
+}
+func (st *StreamTransport) GetResolver() Resolver {
+	return st.resolver
+}
+func (st *StreamTransport) SetIdleTimeout(idleTimeout time.Duration) {
+	st.idleTimeout = idleTimeout
+}
+func (st *StreamTransport) GetIdleTimeout() time.Duration {
+	return st.idleTimeout
+}
+func (st *StreamTransport) GetTLSConfig() *tls.Config {
+	return st.tlsConfig
+}
+
+// NewStreamTransport returns a StreamTransport accepting on listener,listener may be nil for a transport that only dials.
+// transport is "TCP" or "TLS",tlsConfig is used for the connections dialed and it is not applied to listener.
+func NewStreamTransport(transport string, listener net.Listener, tlsConfig *tls.Config, handler Handler) *StreamTransport {
+	return &StreamTransport{
+		transport:   strings.ToUpper(transport),
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+		handler:     handler,
+		resolver:    new(NetResolver),
+		idleTimeout: transportIdleTimeout,
+		conns:       make(map[string]*streamConn),
+	}
+}
+
+// ListenTCP returns a StreamTransport listening for TCP connections on address,example: ":5060"
+func ListenTCP(address string, handler Handler) (*StreamTransport, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamTransport("TCP", listener, nil, handler), nil
+}
+
+// ListenTLS returns a StreamTransport listening for TLS connections on address,example: ":5061",
+// set config.ClientAuth to tls.RequireAndVerifyClientCert for mutual TLS
+func ListenTLS(address string, config *tls.Config, handler Handler) (*StreamTransport, error) {
+	listener, err := tls.Listen("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamTransport("TLS", listener, config, handler), nil
+}
+
+func (st *StreamTransport) GetTransport() string {
+	return st.transport
+}
+
+// LocalAddr returns the address of the listener,nil when there is none
+func (st *StreamTransport) LocalAddr() net.Addr {
+	if st.listener == nil {
+		return nil
+	}
+	return st.listener.Addr()
+}
+
+// Len returns the number of connections in the pool
+func (st *StreamTransport) Len() int {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return len(st.conns)
+}
+
+// Serve accepts connections until the transport is closed,each connection is read on its own goroutine
+// and the handler is called on it
+func (st *StreamTransport) Serve() error {
+	if st.listener == nil {
+		return &net.AddrError{Err: "no listener", Addr: st.transport}
+	}
+	for {
+		conn, err := st.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return err
+		}
+		if sc := st.add(conn); sc != nil {
+			go st.serve(sc)
+		}
+	}
+}
+
+// add puts conn into the pool,a connection already there for the same key is kept and conn is closed
+func (st *StreamTransport) add(conn net.Conn) *streamConn {
+	sc := &streamConn{
+		conn:   conn,
+		key:    streamKey(st.transport, conn.RemoteAddr().String()),
+		source: NewSource(st.transport, conn.LocalAddr(), conn.RemoteAddr()),
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if _, ok := st.conns[sc.key]; ok || st.closed {
+		conn.Close()
+		return nil
+	}
+	st.conns[sc.key] = sc
+	return sc
+}
+
+// remove takes sc out of the pool and closes it
+func (st *StreamTransport) remove(sc *streamConn) {
+	st.mutex.Lock()
+	if st.conns[sc.key] == sc {
+		delete(st.conns, sc.key)
+	}
+	st.mutex.Unlock()
+	sc.conn.Close()
+}
+
+// serve reads the messages of a connection until it fails,is idle for too long or is closed
+func (st *StreamTransport) serve(sc *streamConn) {
+	defer st.remove(sc)
+	framer := NewFramer(sc.conn)
+	// https://www.rfc-editor.org/rfc/rfc5626.html#section-4.4.1
+	// a double-CRLF ping is answered with a single CRLF pong
+	framer.SetPing(func() {
+		sc.write(st, []byte("\r\n"))
+	})
+	for {
+		st.touch(sc)
+		raw, err := framer.ReadRaw()
+		if err != nil {
+			// a message that does not frame leaves the stream out of sync,the connection is closed
+			return
+		}
+		sm := transportReceive([]byte(raw), sc.conn.RemoteAddr())
+		if sm != nil && st.handler != nil {
+			st.handler(sm, sc.source)
+		}
+	}
+}
+
+// touch pushes the idle deadline of sc forward
+func (st *StreamTransport) touch(sc *streamConn) {
+	if st.idleTimeout > 0 {
+		sc.conn.SetReadDeadline(time.Now().Add(st.idleTimeout))
+	}
+}
+
+// write writes data to the connection as one piece
+func (sc *streamConn) write(st *StreamTransport, data []byte) error {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	st.touch(sc)
+	_, err := sc.conn.Write(data)
+	return err
+}
+
+// Send sends sm on the connection to target,a connection is dialed and put into the pool when there is none.
+// The certificate of a TLS server is verified against the host of target unless tlsConfig has a ServerName.
+func (st *StreamTransport) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	sc, err := st.dial(ctx, target)
+	if err != nil {
+		return err
+	}
+	if err := sc.write(st, sm.Bytes()); err != nil {
+		st.remove(sc)
+		return err
+	}
+	return nil
+}
+
+// dial returns the connection of the pool to target or dials a new one
+func (st *StreamTransport) dial(ctx context.Context, target *Target) (*streamConn, error) {
+	address := target.Addr()
+	key := streamKey(st.transport, address)
+	st.mutex.Lock()
+	sc, ok := st.conns[key]
+	closed := st.closed
+	st.mutex.Unlock()
+	if closed {
+		return nil, net.ErrClosed
+	}
+	if ok {
+		return sc, nil
+	}
+	var conn net.Conn
+	var err error
+	if st.transport == "TLS" {
+		config := new(tls.Config)
+		if st.tlsConfig != nil {
+			config = st.tlsConfig.Clone()
+		}
+		if len(config.ServerName) == 0 {
+			config.ServerName = target.GetHost()
+		}
+		dialer := &tls.Dialer{Config: config}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// another goroutine may have dialed the same target meanwhile,its connection is taken
+	if sc := st.add(conn); sc != nil {
+		go st.serve(sc)
+	}
+	st.mutex.Lock()
+	sc, ok = st.conns[key]
+	st.mutex.Unlock()
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return sc, nil
+}
+
+// Respond sends the response sm on the connection its request was received on when it is still open,
+// otherwise a connection is opened to the received parameter and the sent-by port of the top Via
+func (st *StreamTransport) Respond(ctx context.Context, sm *SipMsg, source *Source) error {
+	if source != nil && source.GetRemote() != nil {
+		st.mutex.Lock()
+		sc, ok := st.conns[streamKey(st.transport, source.GetRemote().String())]
+		st.mutex.Unlock()
+		if ok {
+			if err := sc.write(st, sm.Bytes()); err == nil {
+				return nil
+			}
+			st.remove(sc)
+		}
+	}
+	resolver := st.resolver
+	if resolver == nil {
+		resolver = new(NetResolver)
+	}
+	ip, port, err := transportResponseAddr(ctx, sm.GetVia(), resolver, false)
+	if err != nil {
+		return err
+	}
+	host := ""
+	if via := sm.GetVia(); via != nil {
+		host = via.GetHost()
+	}
+	return st.Send(ctx, sm, NewTarget(st.transport, host, ip, port))
+}
+
+// Close closes the listener and all connections of the pool,Serve returns nil
+func (st *StreamTransport) Close() error {
+	st.mutex.Lock()
+	st.closed = true
+	conns := make([]*streamConn, 0, len(st.conns))
+	for _, sc := range st.conns {
+		conns = append(conns, sc)
+	}
+	st.mutex.Unlock()
+	for _, sc := range conns {
+		sc.conn.Close()
+	}
+	if st.listener == nil {
+		return nil
+	}
+	if err := st.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// streamKey is the key of a connection in the pool,example: "TCP 192.168.0.1:5060"
+func streamKey(transport string, address string) string {
+	return transport + " " + address
+}
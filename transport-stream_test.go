@@ -0,0 +1,257 @@
+package sip
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// streamCertificates returns a self-signed CA,a server certificate for localhost and 127.0.0.1 and a client certificate,
+// both signed by the CA
+func streamCertificates(t *testing.T) (*x509.CertPool, tls.Certificate, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sip test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return pool, issue(2, "localhost", x509.ExtKeyUsageServerAuth), issue(3, "34020000001320000001", x509.ExtKeyUsageClientAuth)
+}
+
+// streamEcho answers each request with 200 OK on the connection it came on and then passes it to requests
+func streamEcho(transport Transport, requests chan *SipMsg) Handler {
+	return func(sm *SipMsg, source *Source) {
+		if sm.GetRequestLine() == nil {
+			return
+		}
+		sm.SetRequestLine(nil)
+		sm.SetStatusLine(NewStatusLine("SIP", 2.0, 200, Success[200]))
+		transport.Respond(context.Background(), sm, source)
+		requests <- sm
+	}
+}
+
+func streamWait(t *testing.T, messages chan *SipMsg, what string) *SipMsg {
+	select {
+	case sm := <-messages:
+		return sm
+	case <-time.After(2 * time.Second):
+		t.Fatal(what, "not received")
+	}
+	return nil
+}
+
+func TestStreamTransport_TCP(t *testing.T) {
+	requests := make(chan *SipMsg, 2)
+	server, err := ListenTCP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetHandler(streamEcho(server, requests))
+	server.SetIdleTimeout(300 * time.Millisecond)
+	defer server.Close()
+	go server.Serve()
+	responses := make(chan *SipMsg, 2)
+	client := NewStreamTransport("TCP", nil, nil, func(sm *SipMsg, source *Source) {
+		responses <- sm
+	})
+	defer client.Close()
+
+	addr := server.LocalAddr().(*net.TCPAddr)
+	target := NewTarget("TCP", "", addr.IP, uint16(addr.Port))
+	for index := 0; index < 2; index++ {
+		request := new(SipMsg)
+		request.Parse(sipMsgRegister)
+		if err := client.Send(context.Background(), request, target); err != nil {
+			t.Fatal(err)
+		}
+		sm := streamWait(t, requests, "request")
+		if sm.GetVia().GetReceived() != "127.0.0.1" {
+			t.Error("received mismatch")
+		}
+		response := streamWait(t, responses, "response")
+		result := response.Raw()
+		fmt.Print(result.String())
+		if response.GetStatusLine().GetStatusCode() != 200 {
+			t.Error("response mismatch")
+		}
+	}
+	// the connection dialed for the first request is reused for the second one and for the responses
+	if client.Len() != 1 || server.Len() != 1 {
+		t.Error("connection reuse mismatch", client.Len(), server.Len())
+	}
+	// a ping is answered with a pong
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("\r\n\r\n"))
+	pong := make([]byte, 2)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(pong); err != nil || string(pong[:n]) != "\r\n" {
+		t.Error("pong mismatch", err)
+	}
+	// the idle connections are closed by the server and then by the client
+	for deadline := time.Now().Add(2 * time.Second); (server.Len() > 0 || client.Len() > 0) && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if server.Len() != 0 || client.Len() != 0 {
+		t.Error("idle connections not closed", server.Len(), client.Len())
+	}
+}
+
+func TestStreamTransport_Respond(t *testing.T) {
+	// the connection of the request is gone,the response goes to a new connection to the sent-by port
+	responses := make(chan *SipMsg, 1)
+	client, err := ListenTCP("127.0.0.1:0", func(sm *SipMsg, source *Source) {
+		responses <- sm
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go client.Serve()
+	server := NewStreamTransport("TCP", nil, nil, nil)
+	defer server.Close()
+	sm := new(SipMsg)
+	sm.Parse(sipMsgRegister)
+	sm.SetRequestLine(nil)
+	sm.SetStatusLine(NewStatusLine("SIP", 2.0, 200, Success[200]))
+	sm.GetVia().SetHost("127.0.0.1")
+	sm.GetVia().SetPort(uint16(client.LocalAddr().(*net.TCPAddr).Port))
+	sm.GetVia().SetRport(40000)
+	if err := server.Respond(context.Background(), sm, NewSource("TCP", nil, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})); err != nil {
+		t.Fatal(err)
+	}
+	streamWait(t, responses, "response")
+}
+
+func TestStreamTransport_TLS(t *testing.T) {
+	pool, serverCertificate, clientCertificate := streamCertificates(t)
+	requests := make(chan *SipMsg, 1)
+	server, err := ListenTLS("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetHandler(streamEcho(server, requests))
+	defer server.Close()
+	go server.Serve()
+	addr := server.LocalAddr().(*net.TCPAddr)
+	target := NewTarget("TLS", "localhost", addr.IP, uint16(addr.Port))
+
+	// mutual TLS
+	responses := make(chan *SipMsg, 1)
+	client := NewStreamTransport("TLS", nil, &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCertificate},
+	}, func(sm *SipMsg, source *Source) {
+		responses <- sm
+	})
+	defer client.Close()
+	request := new(SipMsg)
+	request.Parse(sipMsgRegister)
+	if err := client.Send(context.Background(), request, target); err != nil {
+		t.Fatal(err)
+	}
+	streamWait(t, requests, "request")
+	if response := streamWait(t, responses, "response"); response.GetStatusLine().GetStatusCode() != 200 {
+		t.Error("response mismatch")
+	}
+
+	// the server certificate is not trusted
+	untrusted := NewStreamTransport("TLS", nil, &tls.Config{Certificates: []tls.Certificate{clientCertificate}}, nil)
+	defer untrusted.Close()
+	if err := untrusted.Send(context.Background(), request, target); err == nil {
+		t.Error("expected a certificate error")
+	}
+	// the server name does not match the certificate
+	if err := client.Send(context.Background(), request, NewTarget("TLS", "proxy.example.com", net.IPv4(127, 0, 0, 2), uint16(addr.Port))); err == nil {
+		t.Error("expected a server name error")
+	}
+	// the client has no certificate,the server drops the connection before reading the request
+	anonymous := NewStreamTransport("TLS", nil, &tls.Config{RootCAs: pool}, nil)
+	defer anonymous.Close()
+	anonymous.Send(context.Background(), request, target)
+	select {
+	case <-requests:
+		t.Error("request without a client certificate accepted")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestStreamTransport_Close(t *testing.T) {
+	transport, err := ListenTCP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- transport.Serve()
+	}()
+	transport.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve did not return after close")
+	}
+	request := new(SipMsg)
+	request.Parse(sipMsgRegister)
+	if err := transport.Send(context.Background(), request, NewTarget("TCP", "", net.IPv4(127, 0, 0, 1), 5060)); err == nil {
+		t.Error("expected an error after close")
+	}
+}
@@ -0,0 +1,131 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18
+//
+// 18 Transport
+//
+// The transport layer is responsible for the actual transmission of
+// requests and responses over network transports.  This includes
+// determination of the connection to use for a request or response in
+// the case of connection-oriented transports.
+//
+// https://www.rfc-editor.org/rfc/rfc5626.html#section-3.5.1
+//
+// The keep-alive of a UDP flow is a STUN binding request or a CRLF,
+// such a datagram carries no SIP message and is dropped.
+
+const transportUDPSize = 65535 // the largest UDP payload
+
+// UDPTransport sends and receives SIP messages as UDP datagrams on one socket
+type UDPTransport struct {
+	conn     net.PacketConn
+	handler  Handler
+	resolver Resolver // resolves a sent-by hostname when a response is sent
+}
+
+func (ut *UDPTransport) SetHandler(handler Handler) {
+	ut.handler = handler
+}
+func (ut *UDPTransport) GetHandler() Handler {
+	return ut.handler
+}
+func (ut *UDPTransport) SetResolver(resolver Resolver) {
+	ut.resolver = resolver
+}
+func (ut *UDPTransport) GetResolver() Resolver {
+	return ut.resolver
+}
+func (ut *UDPTransport) GetConn() net.PacketConn {
+	return ut.conn
+}
+func NewUDPTransport(conn net.PacketConn, handler Handler) *UDPTransport {
+	return &UDPTransport{
+		conn:     conn,
+		handler:  handler,
+		resolver: new(NetResolver),
+	}
+}
+
+// ListenUDP returns a UDPTransport listening on address,example: "192.168.0.1:5060",":5060"
+func ListenUDP(address string, handler Handler) (*UDPTransport, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewUDPTransport(conn, handler), nil
+}
+
+func (ut *UDPTransport) LocalAddr() net.Addr {
+	return ut.conn.LocalAddr()
+}
+
+// Serve reads datagrams until the transport is closed and hands each SIP message to the handler,
+// a datagram that does not parse is dropped. The handler is called on the reading goroutine.
+func (ut *UDPTransport) Serve() error {
+	buffer := make([]byte, transportUDPSize)
+	for {
+		n, remote, err := ut.conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return err
+		}
+		if sm := transportReceive(buffer[:n], remote); sm != nil && ut.handler != nil {
+			ut.handler(sm, NewSource("UDP", ut.conn.LocalAddr(), remote))
+		}
+	}
+}
+
+func (ut *UDPTransport) GetTransport() string {
+	return "UDP"
+}
+
+// Send writes sm as one datagram to the address of target,a StatusError 513 is returned when sm does not fit in a datagram
+func (ut *UDPTransport) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	return ut.send(sm, &net.UDPAddr{IP: target.GetIP(), Port: int(target.GetPort())})
+}
+func (ut *UDPTransport) send(sm *SipMsg, addr *net.UDPAddr) error {
+	data := sm.Bytes()
+	if len(data) > transportUDPLimit(addr.IP) {
+		return NewStatusError(513, "")
+	}
+	_, err := ut.conn.WriteTo(data, addr)
+	return err
+}
+
+// transportUDPLimit returns the largest payload of a UDP datagram to ip by its address family
+func transportUDPLimit(ip net.IP) int {
+	if ip.To4() == nil {
+		return transportUDPPayload6
+	}
+	return transportUDPPayload
+}
+
+// Respond sends the response sm to the address of its top Via by RFC 3261 18.2.2 and RFC 3581,
+// it is sent from the socket the request was received on whatever source is
+func (ut *UDPTransport) Respond(ctx context.Context, sm *SipMsg, source *Source) error {
+	resolver := ut.resolver
+	if resolver == nil {
+		resolver = new(NetResolver)
+	}
+	ip, port, err := transportResponseAddr(ctx, sm.GetVia(), resolver, true)
+	if err != nil {
+		return err
+	}
+	return ut.send(sm, &net.UDPAddr{IP: ip, Port: int(port)})
+}
+
+// Close closes the socket,Serve returns nil
+func (ut *UDPTransport) Close() error {
+	return ut.conn.Close()
+}
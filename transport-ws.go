@@ -0,0 +1,664 @@
+package sip
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// https://www.rfc-editor.org/rfc/rfc7118.html#section-4
+//
+// 4.  The WebSocket SIP Subprotocol
+//
+// The term WebSocket subprotocol refers to an application-level
+// protocol layered on top of a WebSocket connection.  This document
+// specifies the WebSocket SIP subprotocol for carrying SIP requests and
+// responses through a WebSocket connection.
+//
+// The WebSocket client and server need to agree on the WebSocket SIP
+// subprotocol during the WebSocket handshake procedure.  The WebSocket
+// client MUST include the value "sip" in the Sec-WebSocket-Protocol
+// header in its handshake request.  The 101 reply from the server MUST
+// contain "sip" in its corresponding Sec-WebSocket-Protocol header.
+//
+// Each SIP message MUST be carried within a single WebSocket message,
+// and a WebSocket message MUST NOT contain more than one SIP message.
+// Because the data framing in WebSocket indicates the message length,
+// SIP messages sent via WebSocket do not require a Content-Length
+// header field.
+//
+// SIP messages might be carried in either text or binary WebSocket
+// frames.  A SIP message whose content is not valid UTF-8 is sent in
+// binary frames.
+
+const (
+	wsGUID             = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11" // RFC 6455 1.3,appended to Sec-WebSocket-Key
+	wsMaxMessage       = 1 << 20                                // the largest message accepted,a larger one closes the connection
+	wsHandshakeTimeout = 10 * time.Second                       // the opening handshake of a connection dialed without a context deadline
+)
+
+// https://www.rfc-editor.org/rfc/rfc6455.html#section-5.2
+//
+// opcode
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// https://www.rfc-editor.org/rfc/rfc6455.html#section-7.4.1
+//
+// close status code
+const (
+	wsCloseGoingAway     = 1001
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+)
+
+// WSTransport sends and receives SIP messages over WebSocket connections by RFC 7118,
+// the transport is "WS" or "WSS" for WebSocket over TLS. It accepts connections as an http.Handler,
+// so it can be mounted on any HTTP server,and keeps the connections accepted and dialed in one pool like StreamTransport.
+type WSTransport struct {
+	transport   string       // "WS" / "WSS"
+	listener    net.Listener // nil for a transport that is mounted on an HTTP server or only dials
+	tlsConfig   *tls.Config  // the certificates and the verification of both sides of WSS
+	path        string       // the resource name of the connections dialed,default "/"
+	handler     Handler
+	resolver    Resolver
+	idleTimeout time.Duration // a connection without reads or writes for this long is closed
+	conns       map[string]*wsConn
+	closed      bool
+	mutex       sync.Mutex
+}
+
+// wsConn is a WebSocket connection of the pool,writes are serialized so that frames do not interleave
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader // the bytes of the connection after the opening handshake
+	client bool          // the frames of a client are masked
+	key    string
+	mutex  sync.Mutex
+	source *Source
+}
+
+// wsCloseError is a WebSocket protocol error,the connection is closed with code
+type wsCloseError struct {
+	code   uint16
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return "websocket: " + e.reason
+}
+
+func (wt *WSTransport) SetHandler(handler Handler) {
+	wt.handler = handler
+}
+func (wt *WSTransport) GetHandler() Handler {
+	return wt.handler
+}
+func (wt *WSTransport) SetResolver(resolver Resolver) {
+	wt.resolver = resolver
+}
+func (wt *WSTransport) GetResolver() Resolver {
+	return wt.resolver
+}
+func (wt *WSTransport) SetIdleTimeout(idleTimeout time.Duration) {
+	wt.idleTimeout = idleTimeout
+}
+func (wt *WSTransport) GetIdleTimeout() time.Duration {
+	return wt.idleTimeout
+}
+func (wt *WSTransport) SetPath(path string) {
+	wt.path = path
+}
+func (wt *WSTransport) GetPath() string {
+	return wt.path
+}
+func (wt *WSTransport) GetTLSConfig() *tls.Config {
+	return wt.tlsConfig
+}
+
+// NewWSTransport returns a WSTransport serving HTTP on listener,listener may be nil for a transport that is mounted
+// on an HTTP server or only dials. transport is "WS" or "WSS",tlsConfig is used for the connections dialed
+// and it is not applied to listener.
+func NewWSTransport(transport string, listener net.Listener, tlsConfig *tls.Config, handler Handler) *WSTransport {
+	return &WSTransport{
+		transport:   strings.ToUpper(transport),
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+		path:        "/",
+		handler:     handler,
+		resolver:    new(NetResolver),
+		idleTimeout: transportIdleTimeout,
+		conns:       make(map[string]*wsConn),
+	}
+}
+
+// ListenWS returns a WSTransport listening for WebSocket connections on address,example: ":80"
+func ListenWS(address string, handler Handler) (*WSTransport, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewWSTransport("WS", listener, nil, handler), nil
+}
+
+// ListenWSS returns a WSTransport listening for WebSocket connections over TLS on address,example: ":443"
+func ListenWSS(address string, config *tls.Config, handler Handler) (*WSTransport, error) {
+	listener, err := tls.Listen("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewWSTransport("WSS", listener, config, handler), nil
+}
+
+func (wt *WSTransport) GetTransport() string {
+	return wt.transport
+}
+
+// LocalAddr returns the address of the listener,nil when there is none
+func (wt *WSTransport) LocalAddr() net.Addr {
+	if wt.listener == nil {
+		return nil
+	}
+	return wt.listener.Addr()
+}
+
+// Len returns the number of connections in the pool
+func (wt *WSTransport) Len() int {
+	wt.mutex.Lock()
+	defer wt.mutex.Unlock()
+	return len(wt.conns)
+}
+
+// Serve serves HTTP on the listener until the transport is closed,each WebSocket connection is read on its own goroutine
+func (wt *WSTransport) Serve() error {
+	if wt.listener == nil {
+		return &net.AddrError{Err: "no listener", Addr: wt.transport}
+	}
+	if err := http.Serve(wt.listener, wt); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP upgrades a request to a WebSocket connection speaking the sip subprotocol and reads it until it is closed,
+// a request that is not a WebSocket handshake or does not offer the sip subprotocol is refused
+func (wt *WSTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet || !wsHeaderHas(r.Header, "Connection", "upgrade") || !wsHeaderHas(r.Header, "Upgrade", "websocket") || len(key) == 0:
+		http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+		return
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket version 13 expected", http.StatusUpgradeRequired)
+		return
+	case !wsHeaderHas(r.Header, "Sec-WebSocket-Protocol", "sip"):
+		http.Error(w, "sip subprotocol expected", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	// the deadlines of the HTTP server are replaced by the idle timeout
+	conn.SetDeadline(time.Time{})
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n")
+	rw.WriteString("Sec-WebSocket-Protocol: sip\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	if wc := wt.add(conn, rw.Reader, false); wc != nil {
+		wt.serve(wc)
+	}
+}
+
+// add puts conn into the pool,a connection already there for the same key is kept and conn is closed
+func (wt *WSTransport) add(conn net.Conn, reader *bufio.Reader, client bool) *wsConn {
+	wc := &wsConn{
+		conn:   conn,
+		reader: reader,
+		client: client,
+		key:    streamKey(wt.transport, conn.RemoteAddr().String()),
+		source: NewSource(wt.transport, conn.LocalAddr(), conn.RemoteAddr()),
+	}
+	wt.mutex.Lock()
+	defer wt.mutex.Unlock()
+	if _, ok := wt.conns[wc.key]; ok || wt.closed {
+		conn.Close()
+		return nil
+	}
+	wt.conns[wc.key] = wc
+	return wc
+}
+
+// remove takes wc out of the pool and closes it
+func (wt *WSTransport) remove(wc *wsConn) {
+	wt.mutex.Lock()
+	if wt.conns[wc.key] == wc {
+		delete(wt.conns, wc.key)
+	}
+	wt.mutex.Unlock()
+	wc.conn.Close()
+}
+
+// serve reads the messages of a connection until it fails,is idle for too long or is closed,
+// a protocol error is answered with a Close frame
+func (wt *WSTransport) serve(wc *wsConn) {
+	defer wt.remove(wc)
+	for {
+		data, err := wt.read(wc)
+		if err != nil {
+			if closeErr, ok := err.(*wsCloseError); ok {
+				wc.write(wt, wsClose, wsClosePayload(closeErr.code))
+			}
+			return
+		}
+		sm := transportReceive(data, wc.conn.RemoteAddr())
+		if sm != nil && wt.handler != nil {
+			wt.handler(sm, wc.source)
+		}
+	}
+}
+
+// touch pushes the idle deadline of wc forward
+func (wt *WSTransport) touch(wc *wsConn) {
+	if wt.idleTimeout > 0 {
+		wc.conn.SetReadDeadline(time.Now().Add(wt.idleTimeout))
+	}
+}
+
+// read returns the next text or binary message of wc,the fragments of a message are joined.
+// A Ping is answered with a Pong,a Close is echoed and ends the connection with io.EOF.
+func (wt *WSTransport) read(wc *wsConn) ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		wt.touch(wc)
+		fin, opcode, payload, err := wc.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			wc.write(wt, wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			if len(payload) >= 2 {
+				payload = payload[:2]
+			}
+			wc.write(wt, wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if fragmented {
+				return nil, &wsCloseError{code: wsCloseProtocolError, reason: "data frame inside a fragmented message"}
+			}
+			message = payload
+		case wsContinuation:
+			if !fragmented {
+				return nil, &wsCloseError{code: wsCloseProtocolError, reason: "continuation frame without a message"}
+			}
+			if len(message)+len(payload) > wsMaxMessage {
+				return nil, &wsCloseError{code: wsCloseTooBig, reason: "message too big"}
+			}
+			message = append(message, payload...)
+		default:
+			return nil, &wsCloseError{code: wsCloseProtocolError, reason: "unknown opcode " + strconv.Itoa(int(opcode))}
+		}
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc6455.html#section-5.2
+//
+//  0                   1                   2                   3
+//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-------+-+-------------+-------------------------------+
+// |F|R|R|R| opcode|M| Payload len |    Extended payload length    |
+// |I|S|S|S|  (4)  |A|     (7)     |             (16/64)           |
+// |N|V|V|V|       |S|             |   (if payload len==126/127)   |
+// | |1|2|3|       |K|             |                               |
+// +-+-+-+-+-------+-+-------------+ - - - - - - - - - - - - - - - +
+// |     Extended payload length continued, if payload len == 127  |
+// + - - - - - - - - - - - - - - - +-------------------------------+
+// |                               |Masking-key, if MASK set to 1  |
+// +-------------------------------+-------------------------------+
+// | Masking-key (continued)       |          Payload Data         |
+// +-------------------------------- - - - - - - - - - - - - - - - +
+//
+// A client MUST mask all frames that it sends to the server,a server MUST NOT mask any frames that it sends to the client.
+
+// readFrame reads one frame of wc and unmasks its payload
+func (wc *wsConn) readFrame() (bool, byte, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(wc.reader, header[:2]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode, masked := header[0]&0x80 != 0, header[0]&0x0f, header[1]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: "no extension negotiated"}
+	}
+	if masked == wc.client {
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: "frame masking mismatch"}
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(wc.reader, header[:2]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(wc.reader, header); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(header)
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: "control frame too big or fragmented"}
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, &wsCloseError{code: wsCloseTooBig, reason: "message too big"}
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(wc.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(wc.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		wsMask(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// write writes payload to the connection as one frame,the payload of a client is masked with a random key
+func (wc *wsConn) write(wt *WSTransport, opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	var maskBit byte
+	if wc.client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+	if wc.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		wsMask(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	wt.touch(wc)
+	_, err := wc.conn.Write(frame)
+	return err
+}
+
+// writeMessage writes sm as one WebSocket message,a text message unless its content is not valid UTF-8
+func (wc *wsConn) writeMessage(wt *WSTransport, sm *SipMsg) error {
+	data := sm.Bytes()
+	if utf8.Valid(data) {
+		return wc.write(wt, wsText, data)
+	}
+	return wc.write(wt, wsBinary, data)
+}
+
+// Send sends sm on the connection to target,a connection is dialed and put into the pool when there is none.
+// The certificate of a WSS server is verified against the host of target unless tlsConfig has a ServerName.
+func (wt *WSTransport) Send(ctx context.Context, sm *SipMsg, target *Target) error {
+	wc, err := wt.dial(ctx, target)
+	if err != nil {
+		return err
+	}
+	if err := wc.writeMessage(wt, sm); err != nil {
+		wt.remove(wc)
+		return err
+	}
+	return nil
+}
+
+// dial returns the connection of the pool to target or dials a new one and performs the opening handshake
+func (wt *WSTransport) dial(ctx context.Context, target *Target) (*wsConn, error) {
+	address := target.Addr()
+	key := streamKey(wt.transport, address)
+	wt.mutex.Lock()
+	wc, ok := wt.conns[key]
+	closed := wt.closed
+	wt.mutex.Unlock()
+	if closed {
+		return nil, net.ErrClosed
+	}
+	if ok {
+		return wc, nil
+	}
+	var conn net.Conn
+	var err error
+	if wt.transport == "WSS" {
+		config := new(tls.Config)
+		if wt.tlsConfig != nil {
+			config = wt.tlsConfig.Clone()
+		}
+		if len(config.ServerName) == 0 {
+			config.ServerName = target.GetHost()
+		}
+		dialer := &tls.Dialer{Config: config}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reader, err := wt.handshake(ctx, conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// another goroutine may have dialed the same target meanwhile,its connection is taken
+	if wc := wt.add(conn, reader, true); wc != nil {
+		go wt.serve(wc)
+	}
+	wt.mutex.Lock()
+	wc, ok = wt.conns[key]
+	wt.mutex.Unlock()
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return wc, nil
+}
+
+// handshake sends the opening handshake of a client on conn and checks the answer of the server,
+// the reader returned holds the bytes of conn after the handshake
+func (wt *WSTransport) handshake(ctx context.Context, conn net.Conn, target *Target) (*bufio.Reader, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(wsHandshakeTimeout)
+	}
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	host := target.GetHost()
+	if len(host) == 0 {
+		host = target.GetIP().String()
+	}
+	scheme := "http"
+	if wt.transport == "WSS" {
+		scheme = "https"
+	}
+	host = net.JoinHostPort(host, strconv.Itoa(int(target.GetPort())))
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Scheme: scheme, Host: host, Path: wt.path},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-WebSocket-Key":      {key},
+			"Sec-WebSocket-Version":  {"13"},
+			"Sec-WebSocket-Protocol": {"sip"},
+		},
+		Host: host,
+	}
+	if err := request.Write(conn); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case response.StatusCode != http.StatusSwitchingProtocols:
+		return nil, &net.AddrError{Err: "websocket handshake refused: " + response.Status, Addr: host}
+	case !wsHeaderHas(response.Header, "Upgrade", "websocket") || response.Header.Get("Sec-WebSocket-Accept") != wsAccept(key):
+		return nil, &net.AddrError{Err: "websocket handshake mismatch", Addr: host}
+	case response.Header.Get("Sec-WebSocket-Protocol") != "sip":
+		return nil, &net.AddrError{Err: "sip subprotocol not accepted", Addr: host}
+	}
+	return reader, nil
+}
+
+// Respond sends the response sm on the connection its request was received on when it is still open,
+// otherwise a connection is opened to the received parameter and the sent-by port of the top Via.
+// A browser can not be connected to,the response is lost when its connection is gone.
+func (wt *WSTransport) Respond(ctx context.Context, sm *SipMsg, source *Source) error {
+	if source != nil && source.GetRemote() != nil {
+		wt.mutex.Lock()
+		wc, ok := wt.conns[streamKey(wt.transport, source.GetRemote().String())]
+		wt.mutex.Unlock()
+		if ok {
+			if err := wc.writeMessage(wt, sm); err == nil {
+				return nil
+			}
+			wt.remove(wc)
+		}
+	}
+	resolver := wt.resolver
+	if resolver == nil {
+		resolver = new(NetResolver)
+	}
+	ip, port, err := transportResponseAddr(ctx, sm.GetVia(), resolver, false)
+	if err != nil {
+		return err
+	}
+	host := ""
+	if via := sm.GetVia(); via != nil {
+		host = via.GetHost()
+	}
+	return wt.Send(ctx, sm, NewTarget(wt.transport, host, ip, port))
+}
+
+// Close sends a Close frame on all connections of the pool and closes them and the listener,Serve returns nil
+func (wt *WSTransport) Close() error {
+	wt.mutex.Lock()
+	wt.closed = true
+	conns := make([]*wsConn, 0, len(wt.conns))
+	for _, wc := range wt.conns {
+		conns = append(conns, wc)
+	}
+	wt.mutex.Unlock()
+	for _, wc := range conns {
+		wc.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		wc.write(wt, wsClose, wsClosePayload(wsCloseGoingAway))
+		wc.conn.Close()
+	}
+	if wt.listener == nil {
+		return nil
+	}
+	if err := wt.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// wsAccept returns the Sec-WebSocket-Accept of key
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsMask masks or unmasks payload in place
+func wsMask(mask [4]byte, payload []byte) {
+	for index := range payload {
+		payload[index] ^= mask[index%4]
+	}
+}
+
+// wsClosePayload returns the body of a Close frame with code
+func wsClosePayload(code uint16) []byte {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+	return payload
+}
+
+// wsHeaderHas reports whether the comma separated values of the header field name contain token,ignoring case
+func wsHeaderHas(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
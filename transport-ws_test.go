@@ -0,0 +1,232 @@
+package sip
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWSTransport_Send(t *testing.T) {
+	requests := make(chan *SipMsg, 2)
+	server := NewWSTransport("WS", nil, nil, nil)
+	server.SetHandler(streamEcho(server, requests))
+	defer server.Close()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	responses := make(chan *SipMsg, 2)
+	client := NewWSTransport("WS", nil, nil, func(sm *SipMsg, source *Source) {
+		if source.GetTransport() != "WS" {
+			t.Error("source mismatch")
+		}
+		responses <- sm
+	})
+	defer client.Close()
+
+	addr := httpServer.Listener.Addr().(*net.TCPAddr)
+	target := NewTarget("WS", "", addr.IP, uint16(addr.Port))
+	for index := 0; index < 2; index++ {
+		request := new(SipMsg)
+		request.Parse(sipMsgRegister)
+		request.GetVia().SetTransport("WS")
+		request.GetVia().SetHost("df7jal23ls0d.invalid")
+		request.GetVia().SetPort(0)
+		if err := client.Send(context.Background(), request, target); err != nil {
+			t.Fatal(err)
+		}
+		sm := streamWait(t, requests, "request")
+		if sm.GetVia().GetReceived() != "127.0.0.1" {
+			t.Error("received mismatch")
+		}
+		response := streamWait(t, responses, "response")
+		result := response.Raw()
+		fmt.Print(result.String())
+		if response.GetStatusLine().GetStatusCode() != 200 {
+			t.Error("response mismatch")
+		}
+	}
+	if client.Len() != 1 || server.Len() != 1 {
+		t.Error("connection reuse mismatch", client.Len(), server.Len())
+	}
+
+	// a handshake without the sip subprotocol is refused
+	request, _ := http.NewRequest(http.MethodGet, httpServer.URL, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Error("handshake without sip subprotocol accepted", response.Status)
+	}
+	// a client refuses a server that does not speak WebSocket
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	plainAddr := plain.Listener.Addr().(*net.TCPAddr)
+	sm := new(SipMsg)
+	sm.Parse(sipMsgRegister)
+	if err := client.Send(context.Background(), sm, NewTarget("WS", "", plainAddr.IP, uint16(plainAddr.Port))); err == nil {
+		t.Error("expected a handshake error")
+	}
+}
+
+func TestWSTransport_TLS(t *testing.T) {
+	pool, serverCertificate, _ := streamCertificates(t)
+	requests := make(chan *SipMsg, 1)
+	server := NewWSTransport("WSS", nil, nil, nil)
+	server.SetHandler(streamEcho(server, requests))
+	defer server.Close()
+	httpServer := httptest.NewUnstartedServer(server)
+	httpServer.TLS = &tls.Config{Certificates: []tls.Certificate{serverCertificate}}
+	// the handshake of the untrusted client fails on purpose
+	httpServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	responses := make(chan *SipMsg, 1)
+	client := NewWSTransport("WSS", nil, &tls.Config{RootCAs: pool}, func(sm *SipMsg, source *Source) {
+		responses <- sm
+	})
+	defer client.Close()
+	addr := httpServer.Listener.Addr().(*net.TCPAddr)
+	request := new(SipMsg)
+	request.Parse(sipMsgRegister)
+	if err := client.Send(context.Background(), request, NewTarget("WSS", "localhost", addr.IP, uint16(addr.Port))); err != nil {
+		t.Fatal(err)
+	}
+	streamWait(t, requests, "request")
+	if response := streamWait(t, responses, "response"); response.GetStatusLine().GetStatusCode() != 200 {
+		t.Error("response mismatch")
+	}
+	untrusted := NewWSTransport("WSS", nil, nil, nil)
+	defer untrusted.Close()
+	if err := untrusted.Send(context.Background(), request, NewTarget("WSS", "localhost", addr.IP, uint16(addr.Port))); err == nil {
+		t.Error("expected a certificate error")
+	}
+}
+
+// wsTestClient opens a WebSocket connection to server by hand,the frames are written and read raw
+func wsTestClient(t *testing.T, address string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: sip\r\n\r\n", address, key)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("handshake mismatch", response.Status)
+	}
+	return conn, reader
+}
+
+// wsTestFrame returns a masked frame of a client
+func wsTestFrame(fin bool, opcode byte, payload string) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	if len(payload) > 125 {
+		frame = []byte{first, 0x80 | 126, byte(len(payload) >> 8), byte(len(payload))}
+	}
+	frame = append(frame, 1, 2, 3, 4)
+	masked := []byte(payload)
+	wsMask([4]byte{1, 2, 3, 4}, masked)
+	return append(frame, masked...)
+}
+
+func TestWSTransport_Frames(t *testing.T) {
+	requests := make(chan *SipMsg, 1)
+	server := NewWSTransport("WS", nil, nil, func(sm *SipMsg, source *Source) {
+		requests <- sm
+	})
+	defer server.Close()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	conn, reader := wsTestClient(t, httpServer.Listener.Addr().String())
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// a ping is answered with a pong carrying its payload
+	conn.Write(wsTestFrame(true, wsPing, "hello"))
+	frame := make([]byte, 7)
+	if _, err := io.ReadFull(reader, frame); err != nil || frame[0] != 0x80|wsPong || string(frame[2:]) != "hello" {
+		t.Error("pong mismatch", frame, err)
+	}
+	// a message in fragments without Content-Length,its body ends with the message
+	message := "MESSAGE sip:34020000002000000001@3402000000 SIP/2.0\r\n" +
+		"Via: SIP/2.0/WS df7jal23ls0d.invalid;branch=z9hG4bK56sdasks\r\n" +
+		"From: <sip:34020000001320000001@3402000000>;tag=1\r\n" +
+		"To: <sip:34020000002000000001@3402000000>\r\n" +
+		"Call-ID: 1@df7jal23ls0d.invalid\r\n" +
+		"CSeq: 1 MESSAGE\r\n" +
+		"Content-Type: text/plain\r\n\r\n" +
+		"keepalive"
+	conn.Write(wsTestFrame(false, wsText, message[:100]))
+	conn.Write(wsTestFrame(true, wsPing, ""))
+	conn.Write(wsTestFrame(true, wsContinuation, message[100:]))
+	io.ReadFull(reader, frame[:2])
+	sm := streamWait(t, requests, "request")
+	if string(sm.GetBody()) != "keepalive" || sm.GetVia().GetReceived() != "127.0.0.1" {
+		t.Errorf("message mismatch: %q", sm.GetBody())
+	}
+	// an unmasked frame is a protocol error,the server closes with 1002
+	conn.Write([]byte{0x80 | wsText, 2, 'h', 'i'})
+	if _, err := io.ReadFull(reader, frame[:4]); err != nil || frame[0] != 0x80|wsClose || binary.BigEndian.Uint16(frame[2:4]) != wsCloseProtocolError {
+		t.Error("close mismatch", frame[:4], err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); server.Len() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.Len() != 0 {
+		t.Error("connection not removed")
+	}
+}
+
+func TestWSTransport_Close(t *testing.T) {
+	transport, err := ListenWS("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- transport.Serve()
+	}()
+	conn, reader := wsTestClient(t, transport.LocalAddr().String())
+	defer conn.Close()
+	for deadline := time.Now().Add(2 * time.Second); transport.Len() == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	transport.Close()
+	// the connections are closed with 1001
+	frame := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(reader, frame); err != nil || binary.BigEndian.Uint16(frame[2:]) != wsCloseGoingAway {
+		t.Error("close mismatch", frame, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve did not return after close")
+	}
+}
@@ -0,0 +1,179 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.2.1
+//
+// 18.2.1 Receiving Requests
+//
+// When the server transport receives a request over any transport, it
+// MUST examine the value of the "sent-by" parameter in the top Via
+// header field value.  If the host portion of the "sent-by" parameter
+// contains a domain name, or if it contains an IP address that differs
+// from the packet source address, the server MUST add a "received"
+// parameter to that Via header field value.  This parameter MUST
+// contain the source address from which the packet was received.  This
+// is to assist the server transport layer in sending the response,
+// since it must be sent to the source IP address from which the request
+// came.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-18.2.2
+//
+// 18.2.2 Sending Responses
+//
+// The server transport uses the value of the top Via header field in
+// order to determine where to send a response.  It MUST follow the
+// following process:
+//
+//    o  If the "sent-protocol" is a reliable transport protocol such as
+//       TCP or SCTP, or TLS over those, the response MUST be sent using
+//       the existing connection to the source of the original request
+//       that created the transaction, if that connection is still open.
+//
+//    o  Otherwise, if the Via header field value contains a "maddr"
+//       parameter, the response MUST be forwarded to the address listed
+//       there, using the port indicated in "sent-by", or port 5060 if
+//       none is present.
+//
+//    o  Otherwise (for unreliable unicast transports), if the top Via
+//       has a "received" parameter, the response MUST be sent to the
+//       address in the "received" parameter, using the port indicated in
+//       the "sent-by" value, or using port 5060 if none is specified
+//       explicitly.
+//
+//    o  Otherwise, if it is not receiver-tagged, the response MUST be
+//       sent to the address indicated by the "sent-by" value, using the
+//       procedures in Section 5 of [4].
+
+// Source is where a message was received from,the responses to a request are sent back along it
+type Source struct {
+	transport string   // "UDP" / "TCP" / "TLS" / "SCTP" / "WS" / "WSS"
+	local     net.Addr // the address the message was received on
+	remote    net.Addr // the address the message was received from
+}
+
+func (s *Source) GetTransport() string {
+	return s.transport
+}
+func (s *Source) GetLocal() net.Addr {
+	return s.local
+}
+func (s *Source) GetRemote() net.Addr {
+	return s.remote
+}
+func NewSource(transport string, local net.Addr, remote net.Addr) *Source {
+	return &Source{
+		transport: transport,
+		local:     local,
+		remote:    remote,
+	}
+}
+
+// Handler is called by a transport for each message it receives,source is where the message came from
+type Handler func(sm *SipMsg, source *Source)
+
+// Transport is the transport layer of one transport protocol,example: UDPTransport,StreamTransport
+type Transport interface {
+	// GetTransport returns the transport of the Via header field,example: "UDP","TLS"
+	GetTransport() string
+	// Send sends the request or response sm to target
+	Send(ctx context.Context, sm *SipMsg, target *Target) error
+	// Respond sends the response sm back along source by RFC 3261 18.2.2
+	Respond(ctx context.Context, sm *SipMsg, source *Source) error
+	// Serve receives messages until the transport is closed
+	Serve() error
+	Close() error
+}
+
+// transportReceive parses a message received from remote,the top Via of a request is stamped with the source address.
+// A keep-alive,a message that does not parse and a request without a Via are dropped.
+func transportReceive(data []byte, remote net.Addr) *SipMsg {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	sm := new(SipMsg)
+	if err := sm.ParseBytes(data); err != nil {
+		return nil
+	}
+	if sm.GetRequestLine() != nil {
+		via := sm.GetVia()
+		if via == nil {
+			return nil
+		}
+		transportReceived(via, remote)
+	}
+	return sm
+}
+
+// transportReceived stamps the top Via of a request with the address it was received from,
+// the rport parameter without a value is set to the source port by RFC 3581
+func transportReceived(via *Via, remote net.Addr) {
+	ip, port := transportAddr(remote)
+	if via == nil || ip == nil {
+		return
+	}
+	if via.GetRport() != 0 {
+		via.SetRport(port)
+		via.SetReceived(ip.String())
+		return
+	}
+	if sentBy := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(via.GetHost(), "["), "]")); sentBy == nil || !sentBy.Equal(ip) {
+		via.SetReceived(ip.String())
+	}
+}
+
+// transportResponseAddr returns the address a response is sent to when there is no connection to the source of the request,
+// the received parameter of the top Via is taken before the sent-by and the rport parameter of RFC 3581 only for an unreliable transport
+func transportResponseAddr(ctx context.Context, via *Via, resolver Resolver, rport bool) (net.IP, uint16, error) {
+	if via == nil {
+		return nil, 0, &net.AddrError{Err: "missing Via header field"}
+	}
+	host, port := via.GetHost(), via.GetPort()
+	if port == 0 {
+		port = 5060
+		if strings.EqualFold(via.GetTransport(), "TLS") {
+			port = 5061
+		}
+	}
+	switch {
+	case len(strings.TrimSpace(via.GetMaddr())) > 0:
+		host = via.GetMaddr()
+	case len(strings.TrimSpace(via.GetReceived())) > 0:
+		host = via.GetReceived()
+		if rport && via.GetRport() > 1 {
+			port = via.GetRport()
+		}
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, port, nil
+	}
+	ips, err := resolver.LookupIP(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ips[0], port, nil
+}
+
+// transportAddr returns the IP address and port of addr
+func transportAddr(addr net.Addr) (net.IP, uint16) {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP, uint16(addr.Port)
+	case *net.TCPAddr:
+		return addr.IP, uint16(addr.Port)
+	case nil:
+		return nil, 0
+	}
+	host, ports, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0
+	}
+	port, _ := strconv.Atoi(ports)
+	return net.ParseIP(host), uint16(port)
+}
@@ -0,0 +1,150 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTransport_Received(t *testing.T) {
+	remote := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 26), Port: 5070}
+	cases := []struct {
+		via string
+		raw string
+	}{
+		{"Via: SIP/2.0/UDP 192.168.0.26:5070;branch=z9hG4bK1\r\n", "Via: SIP/2.0/UDP 192.168.0.26:5070;branch=z9hG4bK1\r\n"},
+		{"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK1\r\n", "Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK1;received=192.168.0.26\r\n"},
+		{"Via: SIP/2.0/UDP ipc.example.com;branch=z9hG4bK1\r\n", "Via: SIP/2.0/UDP ipc.example.com;branch=z9hG4bK1;received=192.168.0.26\r\n"},
+		{"Via: SIP/2.0/UDP 192.168.0.26:5070;rport;branch=z9hG4bK1\r\n", "Via: SIP/2.0/UDP 192.168.0.26:5070;rport=5070;branch=z9hG4bK1;received=192.168.0.26\r\n"},
+	}
+	for _, c := range cases {
+		via := new(Via)
+		if err := via.Parse(c.via); err != nil {
+			t.Error(err)
+			continue
+		}
+		transportReceived(via, remote)
+		result := via.Raw()
+		fmt.Print(result.String())
+		if result.String() != c.raw {
+			t.Errorf("received mismatch: %q", result.String())
+		}
+	}
+}
+
+func TestTransport_ResponseAddr(t *testing.T) {
+	resolver := NewStaticResolver()
+	resolver.AddHost("ipc.example.com", net.IPv4(192, 168, 0, 30))
+	cases := []struct {
+		via  string
+		addr string
+	}{
+		{"Via: SIP/2.0/UDP 192.168.0.26;branch=z9hG4bK1\r\n", "192.168.0.26:5060"},
+		{"Via: SIP/2.0/UDP ipc.example.com:5070;branch=z9hG4bK1\r\n", "192.168.0.30:5070"},
+		{"Via: SIP/2.0/UDP 10.0.0.1:5070;branch=z9hG4bK1;received=192.168.0.26\r\n", "192.168.0.26:5070"},
+		{"Via: SIP/2.0/UDP 10.0.0.1:5070;rport=40001;branch=z9hG4bK1;received=192.168.0.26\r\n", "192.168.0.26:40001"},
+		{"Via: SIP/2.0/UDP 10.0.0.1:5070;maddr=239.255.255.1;received=192.168.0.26\r\n", "239.255.255.1:5070"},
+		{"Via: SIP/2.0/TLS [2001:db8::1];branch=z9hG4bK1\r\n", "[2001:db8::1]:5061"},
+	}
+	for _, c := range cases {
+		via := new(Via)
+		if err := via.Parse(c.via); err != nil {
+			t.Error(err)
+			continue
+		}
+		ip, port, err := transportResponseAddr(context.Background(), via, resolver, true)
+		addr := net.JoinHostPort(ip.String(), fmt.Sprint(port))
+		fmt.Println(addr, err)
+		if err != nil || addr != c.addr {
+			t.Errorf("response address mismatch: %s,%v", addr, err)
+		}
+	}
+	if _, _, err := transportResponseAddr(context.Background(), nil, resolver, true); err == nil {
+		t.Error("expected an error without a Via")
+	}
+}
+
+func TestUDPTransport_Serve(t *testing.T) {
+	received := make(chan *SipMsg, 1)
+	server, err := ListenUDP("127.0.0.1:0", func(sm *SipMsg, source *Source) {
+		if source.GetTransport() != "UDP" || source.GetRemote() == nil {
+			t.Error("source mismatch")
+		}
+		received <- sm
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	responses := make(chan *SipMsg, 1)
+	client, err := ListenUDP("127.0.0.1:0", func(sm *SipMsg, source *Source) {
+		responses <- sm
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go server.Serve()
+	go client.Serve()
+
+	// a keep-alive and a datagram that does not parse are dropped
+	client.GetConn().WriteTo([]byte("\r\n\r\n"), server.LocalAddr())
+	client.GetConn().WriteTo([]byte("hello\r\n\r\n"), server.LocalAddr())
+	// the sent-by is behind a NAT,the response goes to the source address by rport
+	request := new(SipMsg)
+	if err := request.Parse(sipMsgRegister); err != nil {
+		t.Fatal(err)
+	}
+	request.GetVia().SetRport(1)
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+	if err := client.Send(context.Background(), request, NewTarget("UDP", "", serverAddr.IP, uint16(serverAddr.Port))); err != nil {
+		t.Fatal(err)
+	}
+	var sm *SipMsg
+	select {
+	case sm = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not received")
+	}
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	if sm.GetVia().GetReceived() != "127.0.0.1" || int(sm.GetVia().GetRport()) != clientAddr.Port {
+		t.Error("received or rport mismatch", sm.GetVia().GetReceived(), sm.GetVia().GetRport())
+	}
+	sm.SetRequestLine(nil)
+	sm.SetStatusLine(NewStatusLine("SIP", 2.0, 401, ClientError[401]))
+	if err := server.Respond(context.Background(), sm, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case response := <-responses:
+		result := response.Raw()
+		fmt.Print(result.String())
+		if response.GetStatusLine().GetStatusCode() != 401 {
+			t.Error("response mismatch")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("response not received")
+	}
+}
+
+func TestUDPTransport_Close(t *testing.T) {
+	transport, err := ListenUDP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- transport.Serve()
+	}()
+	transport.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve did not return after close")
+	}
+}
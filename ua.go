@@ -0,0 +1,229 @@
+package sip
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-8.1.1
+//
+// 8.1.1 Generating the Request
+//
+// A valid SIP request formulated by a UAC MUST, at a minimum, contain
+// the following header fields: To, From, CSeq, Call-ID, Max-Forwards,
+// and Via; all of these header fields are mandatory in all SIP
+// requests.  These six header fields are the fundamental building
+// blocks of a SIP message, as they jointly provide for most of the
+// critical message routing services including the addressing of
+// messages, the routing of responses, limiting message propagation,
+// ordering of messages, and the unique identification of transactions.
+// These header fields are in addition to the mandatory request line,
+// which contains the method, Request-URI, and SIP version.
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-10.2
+//
+// 10.2 Constructing the REGISTER Request
+//
+// To: The To header field contains the address of record whose
+//    registration is to be created, queried, or modified.  The To
+//    header field and the Request-URI field typically differ, as
+//    the former contains a user name.
+//
+// Call-ID: All registrations from a UAC SHOULD use the same Call-ID
+//    header field value for registrations sent to a particular
+//    registrar.
+//
+// CSeq: The CSeq value guarantees proper ordering of REGISTER
+//    requests.  A UA MUST increment the CSeq value by one for each
+//    REGISTER request with the same Call-ID.
+
+// UA is the core of a user agent outside of a dialog,the UAC core builds the requests and the UAS core the responses
+type UA struct {
+	from      *From    // the identity of the UA,the From of its requests without a tag
+	transport string   // the transport of the top Via
+	host      string   // the sent-by host of the top Via and the host of the Contact
+	port      uint16   // the sent-by port of the top Via and the port of the Contact,0 for none
+	userAgent []string // the User-Agent of the requests and responses,nil for none
+	callId    *CallID  // the Call-ID of the REGISTER requests,the same for all registrations of the UA
+	cseq      uint32   // the CSeq number of the last REGISTER,the other requests start a Call-ID of their own at 1
+	secret    string   // makes the To tags of the UAS core unpredictable
+	mutex     sync.Mutex
+}
+
+func (ua *UA) GetFrom() *From {
+	return ua.from
+}
+func (ua *UA) SetTransport(transport string) {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	ua.transport = transport
+}
+func (ua *UA) GetTransport() string {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	return ua.transport
+}
+func (ua *UA) SetHost(host string) {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	ua.host = host
+}
+func (ua *UA) GetHost() string {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	return ua.host
+}
+
+// SetPort sets the sent-by port,example: the port a transport listening on port 0 gets
+func (ua *UA) SetPort(port uint16) {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	ua.port = port
+}
+func (ua *UA) GetPort() uint16 {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	return ua.port
+}
+func (ua *UA) SetUserAgent(userAgent ...string) {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	ua.userAgent = userAgent
+}
+func (ua *UA) GetUserAgent() []string {
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	return ua.userAgent
+}
+
+// NewUA returns the UA of the identity from,its requests are sent by transport from host:port
+func NewUA(from *From, transport string, host string, port uint16) *UA {
+	return &UA{
+		from:      from,
+		transport: transport,
+		host:      host,
+		port:      port,
+		secret:    genRandomHex(16),
+	}
+}
+
+// NewRequest returns a request of method to target outside of a dialog with a Via of a new branch,Max-Forwards 70,
+// the From of the UA with a new tag,a To of target,a new Call-ID,CSeq 1,the Contact of the UA and Content-Length 0.
+// The To of a REGISTER is the address of record of the UA,its Call-ID is the same for all registrations and its CSeq the next number.
+func (ua *UA) NewRequest(method string, target *RequestUri) *SipMsg {
+	method = strings.ToUpper(method)
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	requestUri := new(RequestUri)
+	sipMsgCopy(target, requestUri)
+	requestUriRaw := requestUri.Raw()
+	sm := new(SipMsg)
+	sm.SetRequestLine(NewRequestLine(method, requestUri, "SIP", 2.0))
+	sm.SetVia(NewVia("SIP", 2.0, ua.transport, ua.host, ua.port, 0, "", "", GenUnixNanoBranch(), 1, "", nil))
+	sm.SetMaxForwards(NewMaxForwards(70))
+	from := dialogFrom(ua.from)
+	from.SetTag(GenTag())
+	sm.SetFrom(from)
+	to := new(To)
+	if method == "REGISTER" {
+		to = NewTo(from.GetName(), from.GetSpec(), from.GetSchema(), from.GetUser(), from.GetHost(), from.GetPort(), "", from.GetParameter().Clone())
+	} else if err := to.Parse(fmt.Sprintf("To: <%s>", requestUriRaw.String())); err != nil {
+		to = nil
+	}
+	sm.SetTo(to)
+	callId := GenCallID(ua.host)
+	if method == "REGISTER" {
+		if ua.callId == nil {
+			ua.callId = callId
+		}
+		callId = new(CallID)
+		sipMsgCopy(ua.callId, callId)
+	}
+	sm.SetCallID(callId)
+	// the CSeq numbers are ordered per Call-ID
+	cseq := uint32(1)
+	if method == "REGISTER" {
+		ua.cseq++
+		cseq = ua.cseq
+	}
+	sm.SetCSeq(NewCSeq(cseq, method))
+	sm.SetContact(ua.contact())
+	if ua.userAgent != nil {
+		sm.SetUserAgent(NewUserAgent(ua.userAgent...))
+	}
+	sm.SetContentLength(NewContentLength(0))
+	return sm
+}
+
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-8.2.6.2
+//
+// If a request contained a To tag in the request, the To header field
+// in the response MUST equal that of the request.  However, if the To
+// header field in the request did not contain a tag, the URI in the To
+// header field in the response MUST equal the URI in the To header
+// field; additionally, the UAS MUST add a tag to the To header field in
+// the response (with the exception of the 100 (Trying) response, in
+// which a tag MAY be present).  This serves to identify the UAS that is
+// responding, possibly resulting in a component of a dialog ID.  The
+// same tag MUST be used for all responses to that request, both final
+// and provisional (again excepting the 100 (Trying)).
+//
+// https://www.rfc-editor.org/rfc/rfc3261.html#section-12.1.1
+//
+// When a UAS responds to a request with a response that establishes a
+// dialog (such as a 2xx to INVITE), the UAS MUST copy all Record-Route
+// header field values from the request into the response (including the
+// URIs, URI parameters, and any Record-Route header field parameters,
+// whether they are known or unknown to the UAS) and MUST maintain the
+// order of those values.  The UAS MUST add a Contact header field to
+// the response.
+
+// NewResponse returns the response of the UAS to request by RFC 3261 8.2.6,
+// a To without a tag is given the tag of the request,the same for every response to it except 100 Trying.
+// A 101-299 response to an INVITE or a SUBSCRIBE gets the Record-Route of the request and the Contact of the UA.
+func (ua *UA) NewResponse(request *SipMsg, statusCode uint, reasonPhrase string) *SipMsg {
+	response := NewResponse(request, statusCode, reasonPhrase)
+	if to := response.GetTo(); to != nil && statusCode != 100 && len(strings.TrimSpace(to.GetTag())) == 0 {
+		to.SetTag(ua.tag(request))
+	}
+	method := ""
+	if request.GetRequestLine() != nil {
+		method = strings.ToUpper(request.GetRequestLine().GetMethod())
+	}
+	ua.mutex.Lock()
+	defer ua.mutex.Unlock()
+	if statusCode > 100 && statusCode < 300 && (method == "INVITE" || method == "SUBSCRIBE") {
+		recordRoutes := make([]*RecordRoute, 0, len(request.GetRecordRoutes()))
+		for _, recordRoute := range request.GetRecordRoutes() {
+			if clone := new(RecordRoute); sipMsgCopy(recordRoute, clone) {
+				recordRoutes = append(recordRoutes, clone)
+			}
+		}
+		if len(recordRoutes) > 0 {
+			response.SetRecordRoutes(recordRoutes)
+		}
+		response.SetContact(ua.contact())
+	}
+	if ua.userAgent != nil {
+		response.SetUserAgent(NewUserAgent(ua.userAgent...))
+	}
+	return response
+}
+
+// tag returns the To tag of the responses to request,a hash of the transaction of the request and the secret of the UA
+func (ua *UA) tag(request *SipMsg) string {
+	key, _ := transactionServerKey(request)
+	return fmt.Sprintf("%x", md5.Sum([]byte(ua.secret+key)))[:16]
+}
+
+// contact returns the Contact of the UA,the caller holds the mutex.
+// The Contact of a From without a user has none either,example: <sip:192.168.0.26:5060>
+func (ua *UA) contact() *Contact {
+	schema := ua.from.GetSchema()
+	if len(strings.TrimSpace(schema)) == 0 {
+		schema = "sip"
+	}
+	return NewContact("", "<", schema, strings.TrimSpace(ua.from.GetUser()), ua.host, ua.port, "", -1, nil)
+}
@@ -0,0 +1,87 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func uaTest() *UA {
+	ua := NewUA(NewFrom("", "<", "sip", "34020000001320000001", "3402000000", 0, "", nil), "UDP", "192.168.0.26", 5060)
+	ua.SetUserAgent("SIP", "UAC-IPC", "com.kokutas", "V1.0.0")
+	return ua
+}
+
+func TestUA_NewRequest(t *testing.T) {
+	ua := uaTest()
+	target := NewRequestUri(NewSipUri(NewUserInfo("34020000002000000001", "", ""), NewHostPort("", nil, nil, 0), nil, nil))
+	target.GetSipUri().GetHostPort().SetName("3402000000")
+	register := ua.NewRequest("REGISTER", target)
+	result := register.Raw()
+	fmt.Print(result.String())
+	if _, ok := transactionClientKey(register); !ok {
+		t.Error("REGISTER without a transaction key")
+	}
+	if len(register.GetFrom().GetTag()) != 16 || register.GetTo().GetTag() != "" || register.GetTo().GetUser() != "34020000001320000001" {
+		t.Error("REGISTER From or To mismatch")
+	}
+	if register.GetCSeq().GetNumber() != 1 || register.GetMaxForwards().GetForwards() != 70 || !strings.HasPrefix(register.GetVia().GetBranch(), "z9hG4bK") {
+		t.Error("REGISTER header mismatch")
+	}
+	// the registrations of the UA share the Call-ID,each gets the next CSeq number
+	again := ua.NewRequest("REGISTER", target)
+	callId, callIdAgain := register.GetCallID().Raw(), again.GetCallID().Raw()
+	if callId.String() != callIdAgain.String() || again.GetCSeq().GetNumber() != 2 || again.GetFrom().GetTag() == register.GetFrom().GetTag() {
+		t.Error("REGISTER refresh mismatch", callIdAgain.String())
+	}
+	message := ua.NewRequest("message", target)
+	callIdMessage := message.GetCallID().Raw()
+	to, requestUri := message.GetTo().Raw(), message.GetRequestLine().GetUri().Raw()
+	fmt.Print(to.String())
+	if to.String() != "To: <"+requestUri.String()+">\r\n" || callIdMessage.String() == callId.String() || message.GetCSeq().GetMethod() != "MESSAGE" {
+		t.Error("MESSAGE mismatch")
+	}
+	// the CSeq numbers are counted per Call-ID,a MESSAGE does not skip a number of the registrations
+	if message.GetCSeq().GetNumber() != 1 || ua.NewRequest("REGISTER", target).GetCSeq().GetNumber() != 3 {
+		t.Error("CSeq mismatch", message.GetCSeq().GetNumber())
+	}
+	// the Contact of a UA without a user
+	anonymous := NewUA(NewFrom("", "<", "sip", "", "3402000000", 0, "", nil), "UDP", "192.168.0.26", 5060)
+	contact := anonymous.NewRequest("OPTIONS", target).GetContact().Raw()
+	fmt.Print(contact.String())
+	if contact.String() != "Contact: <sip:192.168.0.26:5060>\r\n" {
+		t.Error("Contact without a user mismatch")
+	}
+}
+
+func TestUA_NewResponse(t *testing.T) {
+	ua := uaTest()
+	invite := transactionParse(t, strings.Replace(transactionInvite, "To: ", "Record-Route: <sip:p1.example.com;lr>\r\nTo: ", 1))
+	trying := ua.NewResponse(invite, 100, "")
+	ringing := ua.NewResponse(invite, 180, "")
+	ok := ua.NewResponse(invite, 200, "")
+	result := ok.Raw()
+	fmt.Print(result.String())
+	if trying.GetRequestLine() != nil || trying.GetTo().GetTag() != "" || trying.GetContact() != nil {
+		t.Error("100 Trying mismatch")
+	}
+	// the same tag for every response to the request
+	if len(ok.GetTo().GetTag()) == 0 || ringing.GetTo().GetTag() != ok.GetTo().GetTag() {
+		t.Error("To tag mismatch", ringing.GetTo().GetTag(), ok.GetTo().GetTag())
+	}
+	if ok.GetContact() == nil || len(ok.GetRecordRoutes()) != 1 {
+		t.Error("2xx to INVITE without Contact or Record-Route")
+	}
+	if busy := ua.NewResponse(invite, 486, ""); busy.GetContact() != nil || len(busy.GetRecordRoutes()) != 0 {
+		t.Error("486 with Contact or Record-Route")
+	}
+	other := transactionParse(t, strings.Replace(transactionInvite, "z9hG4bK1371463275", "z9hG4bK1371463276", 1))
+	if ua.NewResponse(other, 200, "").GetTo().GetTag() == ok.GetTo().GetTag() {
+		t.Error("the same tag for another request")
+	}
+	// a To tag of the request is kept
+	bye := transactionParse(t, strings.Replace(strings.Replace(transactionInvite, "1 INVITE", "2 BYE", 1), "3402000000>\r\n", "3402000000>;tag=776\r\n", 1))
+	if ua.NewResponse(bye, 200, "").GetTo().GetTag() != "776" {
+		t.Error("To tag of the request replaced")
+	}
+}
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -35,7 +34,7 @@ type UserAgent struct {
 }
 
 func (ua *UserAgent) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(user-agent)$`).MatchString(field) {
+	if scanFieldIs(field, "user-agent") {
 		ua.field = field
 	} else {
 		ua.field = "User-Agent"
@@ -60,10 +59,11 @@ func NewUserAgent(server ...string) *UserAgent {
 	}
 }
 func (ua *UserAgent) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(ua.field)) == 0 {
-		ua.field = "User-Agent"
+	field := ua.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "User-Agent"
 	}
-	result.WriteString(fmt.Sprintf("%s:", ua.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 	if ua.server != nil {
 		for _, sv := range ua.server {
 			result.WriteString(fmt.Sprintf(" %s", sv))
@@ -72,25 +72,19 @@ func (ua *UserAgent) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return
 }
-func (ua *UserAgent) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (ua *UserAgent) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("User-Agent", raw, 0, `User-Agent  =  "User-Agent" HCOLON server-val *(LWS server-val)`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(user-agent)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "user-agent")
+	if !ok {
+		return NewParseError("User-Agent", raw, 0, `User-Agent  =  "User-Agent" HCOLON server-val *(LWS server-val)`)
 	}
-	field := regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	ua.field = field
+	ua.field = stringTrimPrefixAndTrimSuffix(field, " ")
 	ua.source = raw
 	ua.server = make([]string, 0)
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
 	if len(strings.TrimSpace(raw)) > 0 {
 		rawSlice := strings.Fields(raw)
 		for _, raws := range rawSlice {
@@ -101,4 +95,8 @@ func (ua *UserAgent) Parse(raw string) {
 			ua.server = append(ua.server, raws)
 		}
 	}
+	if len(ua.server) == 0 {
+		return NewParseError("User-Agent", ua.source, len(ua.source), `User-Agent  =  "User-Agent" HCOLON server-val *(LWS server-val)`)
+	}
+	return nil
 }
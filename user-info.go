@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -87,34 +86,24 @@ func (ui *UserInfo) Raw() (result strings.Builder) {
 	}
 	return result
 }
-func (ui *UserInfo) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (ui *UserInfo) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return nil
 	}
 	ui.source = raw
-	// password regexp
-	passwordRegexp := regexp.MustCompile(`:.*(@)*?(;)*?(\?)*?`)
-	if passwordRegexp.MatchString(raw) {
-		password := regexp.MustCompile(`:`).ReplaceAllString(passwordRegexp.FindString(raw), "")
-		password = regexp.MustCompile(`@.*`).ReplaceAllString(password, "")
-		password = regexp.MustCompile(`;.*`).ReplaceAllString(password, "")
-		password = regexp.MustCompile(`\?.*`).ReplaceAllString(password, "")
-		ui.password = password
-		raw = passwordRegexp.ReplaceAllString(raw, "")
+	// password
+	if index := strings.IndexByte(raw, ':'); index >= 0 {
+		ui.password = scanUntil(raw[index+1:], "@;?")
+		raw = raw[:index]
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// telephone-subscriber regexp
-	// 1.global-phone-number
-	// 2.local-phone-number
-	telephoneSubscribeRegexp := regexp.MustCompile(`(^(\+)?(\d{1,3}\-)?\d+\-\d+(\-\d+)?)$|(^\+\d+)|(^\d{11}$)`)
 	if len(strings.TrimSpace(raw)) > 0 {
-		if telephoneSubscribeRegexp.MatchString(raw) {
-			ui.telephoneSubscriber = telephoneSubscribeRegexp.FindString(raw)
+		if telephoneSubscriber := scanTelephoneSubscriber(raw); len(telephoneSubscriber) > 0 {
+			ui.telephoneSubscriber = telephoneSubscriber
 		} else {
 			ui.user = raw
 		}
 	}
+	return nil
 }
@@ -2,11 +2,9 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
+	"net"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261.html#section-8.1.1.7
@@ -122,6 +120,15 @@ import (
 // sent-by           =  host [ COLON port ]
 // ttl               =  1*3DIGIT ; 0 to 255
 
+// https://www.rfc-editor.org/rfc/rfc7118.html#section-5.1
+//
+// transport         =/  "WS" / "WSS"
+//
+// The "WS" transport is used for SIP over plain WebSocket connections
+// and "WSS" for SIP over secure WebSocket connections.  A browser does
+// not know its address,its sent-by is an invalid domain such as
+// "df7jal23ls0d.invalid" and the response goes back on the connection.
+
 // https://www.rfc-editor.org/rfc/rfc3581.html
 //
 // 3.  Client Behavior
@@ -219,27 +226,26 @@ import (
 // gen-value      =  token / host / quoted-string
 
 type Via struct {
-	field     string      // "Via" / "v"
-	schema    string      // sip,sips,tel etc.
-	version   float64     // 2.0
-	transport string      // "UDP" / "TCP" / "TLS" / "SCTP"/ other-transport
-	host      string      // host part,sent-by =  host [ COLON port ]
-	port      uint16      // port part,sent-by =  host [ COLON port ]
-	ttl       uint8       // via-ttl  =  "ttl" EQUAL ttl,ttl =  1*3DIGIT ; 0 to 255
-	maddr     string      // via-maddr =  "maddr" EQUAL host
-	received  string      // via-received =  "received" EQUAL (IPv4address / IPv6address)
-	branch    string      // via-branch =  "branch" EQUAL token
-	rport     uint16      // response port -- RFC3581
-	trans     string      // parameter transport,transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls"/ other-transport),other-transport   =  token
-	parameter sync.Map    // key:string,value:interface{}-basic data type, via-extension = generic-param,generic-param = token [ EQUAL gen-value ], gen-value = token / host / quoted-string
-	isOrder   bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order     chan string // It is convenient to record the order of the original parameter fields when parsing
-	source    string      // source string
+	field     string   // "Via" / "v"
+	schema    string   // sip,sips,tel etc.
+	version   float64  // 2.0
+	transport string   // "UDP" / "TCP" / "TLS" / "SCTP" / "WS" / "WSS" / other-transport
+	host      string   // host part,sent-by =  host [ COLON port ]
+	port      uint16   // port part,sent-by =  host [ COLON port ]
+	ttl       uint8    // via-ttl  =  "ttl" EQUAL ttl,ttl =  1*3DIGIT ; 0 to 255
+	maddr     string   // via-maddr =  "maddr" EQUAL host
+	received  string   // via-received =  "received" EQUAL (IPv4address / IPv6address)
+	branch    string   // via-branch =  "branch" EQUAL token
+	rport     uint16   // response port -- RFC3581
+	trans     string   // parameter transport,transport-param = "transport="( "udp" / "tcp" / "sctp" / "tls"/ other-transport),other-transport   =  token
+	parameter *Params  // via-extension = generic-param,generic-param = token [ EQUAL gen-value ], gen-value = token / host / quoted-string
+	order     []string // parameter names in the parsed order,the typed parameters included
+	source    string   // source string
 }
 
 func (v *Via) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(via|v)$`).MatchString(field) {
-		v.field = strings.Title(field)
+	if scanFieldIs(field, "via", "v") {
+		v.field = headerFieldTitle(field)
 	} else {
 		v.field = "Via"
 	}
@@ -314,16 +320,16 @@ func (v *Via) GetTrans() string {
 	return v.trans
 }
 
-func (v *Via) SetParameter(parameter sync.Map) {
+func (v *Via) SetParameter(parameter *Params) {
 	v.parameter = parameter
 }
-func (v *Via) GetParameter() sync.Map {
+func (v *Via) GetParameter() *Params {
 	return v.parameter
 }
 func (v *Via) GetSource() string {
 	return v.source
 }
-func NewVia(schema string, version float64, transport string, host string, port uint16, ttl uint8, maddr string, received string, branch string, rport uint16, trans string, parameter sync.Map) *Via {
+func NewVia(schema string, version float64, transport string, host string, port uint16, ttl uint8, maddr string, received string, branch string, rport uint16, trans string, parameter *Params) *Via {
 	return &Via{
 		schema:    schema,
 		version:   version,
@@ -337,7 +343,6 @@ func NewVia(schema string, version float64, transport string, host string, port
 		rport:     rport,
 		trans:     trans,
 		parameter: parameter,
-		isOrder:   false,
 	}
 }
 
@@ -368,186 +373,86 @@ func (v *Via) Raw() (result strings.Builder) {
 		}
 	}
 
-	if v.isOrder {
-		v.isOrder = false
-		for orders := range v.order {
-
-			if regexp.MustCompile(`(?i)(rport)( )*`).MatchString(orders) {
-				if v.rport == 1 {
-					result.WriteString(";rport")
-				} else if v.rport > 1 {
-					result.WriteString(fmt.Sprintf(";rport=%d", v.rport))
-				}
-				continue
-			}
-			if regexp.MustCompile(`(?i)(transport)( )*=`).MatchString(orders) {
-				if len(strings.TrimSpace(v.trans)) > 0 {
-					result.WriteString(fmt.Sprintf(";transport=%v", v.trans))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`(?i)(ttl)( )*=`).MatchString(orders) {
-				if v.ttl > 0 {
-					result.WriteString(fmt.Sprintf(";ttl=%d", v.ttl))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`(?i)(maddr)( )*=`).MatchString(orders) {
-				if len(strings.TrimSpace(v.maddr)) > 0 {
-					result.WriteString(fmt.Sprintf(";maddr=%s", v.maddr))
-				}
-				continue
-			}
-			if regexp.MustCompile(`(?i)(branch)( )*=`).MatchString(orders) {
-				if len(strings.TrimSpace(v.branch)) > 0 {
-					result.WriteString(fmt.Sprintf(";branch=%s", v.branch))
-				}
-				continue
-			}
-			if regexp.MustCompile(`(?i)(received)( )*=`).MatchString(orders) {
-				if len(strings.TrimSpace(v.received)) > 0 {
-					result.WriteString(fmt.Sprintf(";received=%s", v.received))
-				}
-				continue
-			}
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := v.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-
-				} else {
-					result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := v.parameter.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(";%v", ordersSlice[0]))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(";%v=%v", ordersSlice[0], ordersSlice[1]))
-				}
-			}
-		}
-
-	} else {
-		if v.rport == 1 {
-			result.WriteString(fmt.Sprintf(";%s", "rport"))
-		} else if v.rport > 1 {
-			result.WriteString(fmt.Sprintf(";rport=%d", v.rport))
-		}
-		if len(strings.TrimSpace(v.trans)) > 0 {
-			result.WriteString(fmt.Sprintf(";transport=%s", v.trans))
-		}
-		if v.ttl > 0 {
-			result.WriteString(fmt.Sprintf(";ttl=%d", v.ttl))
-		}
-		if len(strings.TrimSpace(v.maddr)) > 0 {
-			result.WriteString(fmt.Sprintf(";maddr=%s", v.maddr))
-		}
-		if len(strings.TrimSpace(v.branch)) > 0 {
-			result.WriteString(fmt.Sprintf(";branch=%s", v.branch))
-		}
-		if len(strings.TrimSpace(v.received)) > 0 {
-			result.WriteString(fmt.Sprintf(";received=%s", v.received))
-		}
+	// via-params  =  via-ttl / via-maddr / via-received / via-branch / via-extension
+	typed := NewParams()
+	if v.rport == 1 {
+		typed.SetFlag("rport")
+	} else if v.rport > 1 {
+		typed.Set("rport", strconv.Itoa(int(v.rport)))
 	}
-
-	v.parameter.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(";%v", key))
-				return true
-			}
-			result.WriteString(fmt.Sprintf(";%v=%v", key, value))
-			return true
-		}
-		result.WriteString(fmt.Sprintf(";%v", key))
-		return true
-	})
+	if len(strings.TrimSpace(v.trans)) > 0 {
+		typed.Set("transport", v.trans)
+	}
+	if v.ttl > 0 {
+		typed.Set("ttl", strconv.Itoa(int(v.ttl)))
+	}
+	if len(strings.TrimSpace(v.maddr)) > 0 {
+		typed.Set("maddr", v.maddr)
+	}
+	if len(strings.TrimSpace(v.branch)) > 0 {
+		typed.Set("branch", v.branch)
+	}
+	if len(strings.TrimSpace(v.received)) > 0 {
+		typed.Set("received", v.received)
+	}
+	parameter := paramsMerge(v.order, typed, v.parameter).Raw()
+	result.WriteString(parameter.String())
 	result.WriteString("\r\n")
 	return
 }
-func (v *Via) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (v *Via) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Via", raw, 0, `Via  =  ( "Via" / "v" ) HCOLON via-parm *(COMMA via-parm)`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(via|v)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "via", "v")
+	if !ok {
+		return NewParseError("Via", raw, 0, `Via  =  ( "Via" / "v" ) HCOLON via-parm *(COMMA via-parm)`)
 	}
-	v.field = regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
+	v.field = field
 	v.source = raw
-	v.parameter = sync.Map{}
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-
-	// schema regexp
-	schemasRegexpStr := `(?i)(`
-	for _, v := range schemas {
-		schemasRegexpStr += v + "|"
-	}
-	schemasRegexpStr = strings.TrimSuffix(schemasRegexpStr, "|")
-	schemasRegexpStr += ")( )?"
-	schemaRegexp := regexp.MustCompile(schemasRegexpStr)
-	if schemaRegexp.MatchString(raw) {
-		schema := schemaRegexp.FindString(raw)
-		raw = regexp.MustCompile(`.*`+schema).ReplaceAllString(raw, "")
-		schema = stringTrimPrefixAndTrimSuffix(schema, " ")
-		v.schema = schema
+	v.parameter = NewParams()
+	v.order = nil
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+
+	// sent-protocol  =  protocol-name SLASH protocol-version SLASH transport
+	// schema
+	if index := strings.IndexByte(raw, '/'); index > 0 && scanIsSchema(stringTrimPrefixAndTrimSuffix(raw[:index], " ")) {
+		v.schema = stringTrimPrefixAndTrimSuffix(raw[:index], " ")
+		raw = stringTrimPrefixAndTrimSuffix(raw[index+1:], " ")
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// version regexp
-	versionRegexp := regexp.MustCompile(`/( )*\d+\.\d+`)
-	if versionRegexp.MatchString(raw) {
-		versionByte := versionRegexp.Find([]byte(raw))
-		versions := string(versionByte)
-		raw = regexp.MustCompile(`.*`+versions).ReplaceAllString(raw, "")
-		versions = regexp.MustCompile(`.*/`).ReplaceAllString(versions, "")
-		versions = stringTrimPrefixAndTrimSuffix(versions, " ")
-		if len(versions) > 0 {
-			version, _ := strconv.ParseFloat(versions, 64)
+	// version
+	if major := scanDigits(raw); major > 0 && major < len(raw) && raw[major] == '.' {
+		if minor := scanDigits(raw[major+1:]); minor > 0 {
+			version, _ := strconv.ParseFloat(raw[:major+1+minor], 64)
 			v.version = version
+			raw = stringTrimPrefixAndTrimSuffix(raw[major+1+minor:], " ")
 		}
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// transport regexp : "UDP" / "TCP" / "TLS" / "SCTP"/ other-transport
-	transportRegexp := regexp.MustCompile(`/(?i)(udp|tcp|tls|sctp)`)
-	if transportRegexp.MatchString(raw) {
-		transport := transportRegexp.FindString(raw)
-		raw = regexp.MustCompile(`.*`+transport).ReplaceAllString(raw, "")
-		transport = regexp.MustCompile(`.*/`).ReplaceAllString(transport, "")
-		transport = stringTrimPrefixAndTrimSuffix(transport, " ")
-		if len(transport) > 0 {
-			v.transport = transport
+	// transport : "UDP" / "TCP" / "TLS" / "SCTP"/ other-transport
+	if strings.HasPrefix(raw, "/") {
+		transport := stringTrimPrefixAndTrimSuffix(raw[1:], " ")
+		if length := scanToken(transport); length > 0 {
+			v.transport = transport[:length]
+			raw = stringTrimPrefixAndTrimSuffix(transport[length:], " ")
 		}
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// parameter regexp
-	parameterRegexp := regexp.MustCompile(`(?:;.*)`)
-	hostportStr := parameterRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, hostportStr)
+	if len(v.schema) == 0 || v.version == 0 || len(v.transport) == 0 {
+		return NewParseError("Via", v.source, parseErrorOffset(v.source, raw), `sent-protocol  =  protocol-name SLASH protocol-version SLASH transport`)
+	}
+	// sent-by  =  host [ COLON port ]
+	hostportStr := scanUntil(raw, ";")
+	raw = raw[len(hostportStr):]
 	hostportStr = stringTrimPrefixAndTrimSuffix(hostportStr, " ")
-	// port regexp
-	portRegexp := regexp.MustCompile(`:( )*\d+`)
-	if portRegexp.MatchString(hostportStr) {
-		ports := portRegexp.FindString(hostportStr)
-		hostportStr = portRegexp.ReplaceAllString(hostportStr, "")
-		hostportStr = stringTrimPrefixAndTrimSuffix(hostportStr, " ")
-		ports = regexp.MustCompile(`\d+`).FindString(ports)
-		if len(strings.TrimSpace(ports)) > 0 {
+	// port,after the RSQUOT of an IPv6reference
+	if index := strings.LastIndexByte(hostportStr, ':'); index >= 0 && index > strings.LastIndexByte(hostportStr, ']') {
+		ports := stringTrimPrefixAndTrimSuffix(hostportStr[index+1:], " ")
+		if scanIsDigits(ports) {
+			hostportStr = stringTrimPrefixAndTrimSuffix(hostportStr[:index], " ")
 			port, _ := strconv.Atoi(ports)
+			if port > 65535 {
+				return NewParseError("Via", v.source, parseErrorOffset(v.source, ports), `sent-by  =  host [ COLON port ]`)
+			}
 			if port > 0 {
 				v.port = uint16(port)
 			}
@@ -557,110 +462,50 @@ func (v *Via) Parse(raw string) {
 	if len(strings.TrimSpace(hostportStr)) > 0 {
 		v.host = hostportStr
 	}
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-
-	// parameters
-	// parameters order
-	v.parameterOrder(raw)
-	// ttl parameter regexp
-	ttlRegexp := regexp.MustCompile(`(?i)(ttl).*`)
-	// maddr parameter regexp
-	maddrRegexp := regexp.MustCompile(`(?i)(maddr).*`)
-	// received parameter regexp
-	receivedRegexp := regexp.MustCompile(`(?i)(received).*`)
-	// branch parameter regexp
-	branchRegexp := regexp.MustCompile(`(?i)(branch).*`)
-	// rport parameter regexp
-	rportRegexp := regexp.MustCompile(`(?i)(rport).*`)
-	// tranport parameter regexp
-	transRegexp := regexp.MustCompile(`(?i)(transport).*`)
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		switch {
-		case ttlRegexp.MatchString(raws):
-			ttls := regexp.MustCompile(`(?i)(ttl)`).ReplaceAllString(raws, "")
-			ttls = regexp.MustCompile(`.*=`).ReplaceAllString(ttls, "")
-			ttls = stringTrimPrefixAndTrimSuffix(ttls, " ")
-			if len(ttls) > 0 {
-				ttl, _ := strconv.Atoi(ttls)
-				if ttl > 0 {
-					v.ttl = uint8(ttl)
-				}
-			}
-		case maddrRegexp.MatchString(raws):
-			maddr := regexp.MustCompile(`(?i)(maddr)`).ReplaceAllString(raws, "")
-			maddr = regexp.MustCompile(`.*=`).ReplaceAllString(maddr, "")
-			maddr = stringTrimPrefixAndTrimSuffix(maddr, " ")
-			if len(maddr) > 0 {
-				v.maddr = maddr
-			}
-		case receivedRegexp.MatchString(raws):
-			received := regexp.MustCompile(`(?i)(received)`).ReplaceAllString(raws, "")
-			received = regexp.MustCompile(`.*=`).ReplaceAllString(received, "")
-			received = stringTrimPrefixAndTrimSuffix(received, " ")
-			if len(received) > 0 {
-				v.received = received
+	if len(v.host) == 0 || strings.ContainsAny(v.host, " /,") {
+		return NewParseError("Via", v.source, parseErrorOffset(v.source, hostportStr), `sent-by  =  host [ COLON port ]`)
+	}
+	// via-params
+	parameter := NewParams()
+	if err := parameter.Parse(raw); err != nil {
+		return parseErrorWrap(err, v.source, raw)
+	}
+	for _, p := range parameter.list() {
+		v.order = append(v.order, p.name)
+		switch strings.ToLower(p.name) {
+		case "ttl":
+			// via-ttl  =  "ttl" EQUAL ttl
+			ttl, err := strconv.Atoi(p.value)
+			if err != nil || ttl < 0 || ttl > 255 {
+				return NewParseError("Via", v.source, parseErrorOffset(v.source, p.source), `via-ttl  =  "ttl" EQUAL ttl`)
 			}
-		case branchRegexp.MatchString(raws):
-			branch := regexp.MustCompile(`(?i)(branch)`).ReplaceAllString(raws, "")
-			branch = regexp.MustCompile(`.*=`).ReplaceAllString(branch, "")
-			branch = stringTrimPrefixAndTrimSuffix(branch, " ")
-			if len(branch) > 0 {
-				v.branch = branch
+			v.ttl = uint8(ttl)
+		case "maddr":
+			// via-maddr  =  "maddr" EQUAL host
+			v.maddr = p.value
+		case "received":
+			// via-received  =  "received" EQUAL (IPv4address / IPv6address)
+			if net.ParseIP(strings.Trim(p.value, "[]")) == nil {
+				return NewParseError("Via", v.source, parseErrorOffset(v.source, p.source), `via-received  =  "received" EQUAL (IPv4address / IPv6address)`)
 			}
-		case rportRegexp.MatchString(raws):
-			rports := regexp.MustCompile(`(?i)(rport)`).ReplaceAllString(raws, "")
-			rports = regexp.MustCompile(`.*=`).ReplaceAllString(rports, "")
-			rports = stringTrimPrefixAndTrimSuffix(rports, " ")
-			if len(rports) > 0 {
-				if regexp.MustCompile(`\d+`).MatchString(rports) {
-					rport, _ := strconv.Atoi(regexp.MustCompile(`\d+`).FindString(rports))
-					if rport > 0 {
-						v.rport = uint16(rport)
-					} else {
-						v.rport = 1
-					}
-				}
-				v.rport = 1
-			} else {
-				v.rport = 1
+			v.received = p.value
+		case "branch":
+			// via-branch  =  "branch" EQUAL token
+			if len(p.value) == 0 {
+				return NewParseError("Via", v.source, parseErrorOffset(v.source, p.source), `via-branch  =  "branch" EQUAL token`)
 			}
-		case transRegexp.MatchString(raws):
-			transport := regexp.MustCompile(`(?i)(transport)`).ReplaceAllString(raws, "")
-			transport = regexp.MustCompile(`.*=`).ReplaceAllString(transport, "")
-			transport = stringTrimPrefixAndTrimSuffix(transport, " ")
-			if len(transport) > 0 {
-				v.trans = transport
+			v.branch = p.value
+		case "rport":
+			// response-port  =  "rport" [EQUAL 1*DIGIT]
+			v.rport = 1
+			if rport, err := strconv.Atoi(p.value); err == nil && rport > 0 && rport <= 65535 {
+				v.rport = uint16(rport)
 			}
+		case "transport":
+			v.trans = p.value
 		default:
-			if len(strings.TrimSpace(raws)) > 0 {
-				if strings.Contains(raws, "=") {
-					gs := strings.Split(raws, "=")
-					if len(gs) > 1 {
-						v.parameter.Store(gs[0], gs[1])
-					} else {
-						v.parameter.Store(gs[0], "")
-					}
-				} else {
-					v.parameter.Store(raws, "")
-				}
-			}
+			v.parameter.set(p)
 		}
-
-	}
-
-}
-
-func (v *Via) parameterOrder(raw string) {
-	v.isOrder = true
-	v.order = make(chan string, 1024)
-	defer close(v.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ";")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, ";")
-	for _, raws := range rawSlice {
-		v.order <- raws
 	}
+	return nil
 }
@@ -2,16 +2,15 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestVia_Raw(t *testing.T) {
-	var generic sync.Map
-	generic.Store("hello", "")
-	generic.Store("zz", "xx")
-	generic.Store("hi", nil)
-	generic.Store("heihei", 123)
+	generic := NewParams()
+	generic.SetFlag("hello")
+	generic.Set("zz", "xx")
+	generic.SetFlag("hi")
+	generic.Set("heihei", "123")
 	v := NewVia("sip", 2.0, "udp", "192.168.0.1", 5060, 5, "192.168.0.108", "192.168.0.26", "z9hG4bK-branch", 1, "udp", generic)
 	result := v.Raw()
 	fmt.Print(result.String())
@@ -24,6 +23,7 @@ func TestVia_Parse(t *testing.T) {
 		"Via: SIP/2.0/UDP baidu.com;rport;transport=udp;ttl=5;maddr=192.168.0.108;branch=z9hG4bK-branch;received=192.168.0.26\r\n",
 		"Via: SIP/2.0/UDP 192.168.0.1:5060;rport;transport=udp;branch=z9hG4bK-branch;received=192.168.0.26;ttl=5;maddr=192.168.0.108;\r\n",
 		"Via: SIP/2.0/udp 192.168.0.1;rport;transport=udp;branch=z9hG4bK-branch;received=www.baidu.com;ttl=5;maddr=192.168.0.108;he;hello=word;hap\r\n",
+		"Via: SIP/2.0/WSS df7jal23ls0d.invalid;branch=z9hG4bK56sdasks;received=192.168.0.26\r\n",
 	}
 	for index, raw := range raws {
 		v := new(Via)
@@ -39,3 +39,15 @@ func TestVia_Parse(t *testing.T) {
 
 	}
 }
+
+func TestVia_WebSocket(t *testing.T) {
+	v := new(Via)
+	if err := v.Parse("Via: SIP/2.0/wss df7jal23ls0d.invalid;branch=z9hG4bK56sdasks\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	result := v.Raw()
+	fmt.Print(result.String())
+	if v.GetTransport() != "wss" || result.String() != "Via: SIP/2.0/WSS df7jal23ls0d.invalid;branch=z9hG4bK56sdasks\r\n" {
+		t.Error("WSS transport mismatch")
+	}
+}
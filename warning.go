@@ -2,7 +2,6 @@ package sip
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -106,7 +105,7 @@ type Warning struct {
 }
 
 func (w *Warning) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(warning)$`).MatchString(field) {
+	if scanFieldIs(field, "warning") {
 		w.field = field
 	} else {
 		w.field = "Warning"
@@ -145,10 +144,11 @@ func NewWarning(warnCode uint, warnAgent string, warnText string) *Warning {
 	}
 }
 func (w *Warning) Raw() (result strings.Builder) {
-	if len(strings.TrimSpace(w.field)) == 0 {
-		w.field = "Warning"
+	field := w.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "Warning"
 	}
-	result.WriteString(fmt.Sprintf("%s:", w.field))
+	result.WriteString(fmt.Sprintf("%s:", field))
 	if w.warnCode > 0 {
 		result.WriteString(fmt.Sprintf(" %03d", w.warnCode))
 	}
@@ -161,50 +161,36 @@ func (w *Warning) Raw() (result strings.Builder) {
 	result.WriteString("\r\n")
 	return
 }
-func (w *Warning) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (w *Warning) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("Warning", raw, 0, `Warning  =  "Warning" HCOLON warning-value *(COMMA warning-value)`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`^(?i)(warning)( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "warning")
+	if !ok {
+		return NewParseError("Warning", raw, 0, `Warning  =  "Warning" HCOLON warning-value *(COMMA warning-value)`)
 	}
-	field := regexp.MustCompile(`:`).ReplaceAllString(fieldRegexp.FindString(raw), "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	w.field = field
+	w.field = stringTrimPrefixAndTrimSuffix(field, " ")
 	w.source = raw
-	if len(strings.TrimSpace(raw)) == 0 {
-		return
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// warn-code  =  3DIGIT
+	if scanDigits(raw) != 3 || (len(raw) > 3 && raw[3] != ' ') {
+		return NewParseError("Warning", w.source, parseErrorOffset(w.source, raw), `warning-value  =  warn-code SP warn-agent SP warn-text`)
 	}
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// warn code regexp
-	warnCodeRegexp := regexp.MustCompile(`^\d+`)
-	// warn agent regexp
-	warnAgentRegexp := regexp.MustCompile(`^((\d+\.\d+\.\d+\.\d+)(:\d+)?)|(\w+\.\w+(\w+\.)?)`)
-
-	if warnCodeRegexp.MatchString(raw) {
-		codes := warnCodeRegexp.FindString(raw)
-		raw = strings.TrimPrefix(raw, codes)
-		raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-		code, _ := strconv.Atoi(codes)
-		if code > 0 {
-			w.warnCode = uint(code)
-		}
+	code, _ := strconv.Atoi(raw[:3])
+	if code > 0 {
+		w.warnCode = uint(code)
 	}
-	if warnAgentRegexp.MatchString(raw) {
-		w.warnAgent = warnAgentRegexp.FindString(raw)
-		raw = strings.TrimPrefix(raw, warnAgentRegexp.FindString(raw))
-		raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+	raw = stringTrimPrefixAndTrimSuffix(raw[3:], " ")
+	// warn-agent  =  hostport / pseudonym
+	if !strings.HasPrefix(raw, "\"") {
+		w.warnAgent = scanUntil(raw, " ")
+		raw = stringTrimPrefixAndTrimSuffix(raw[len(w.warnAgent):], " ")
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, "\"")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	if len(strings.TrimSpace(raw)) > 0 {
 		w.warnText = raw
 	}
-
+	return nil
 }
@@ -2,10 +2,7 @@ package sip
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 )
 
 // https://www.rfc-editor.org/rfc/rfc3261.html#section-20.44
@@ -169,24 +166,23 @@ import (
 //      concatenated with the data.
 
 type WWWAuthenticate struct {
-	field      string      // "WWW-Authenticate"
-	authSchema string      // auth-schema: Basic / Digest
-	realm      string      // realm =  "realm" EQUAL realm-value,realm-value =  quoted-string
-	domain     string      // domain =  "domain" EQUAL LDQUOT URI,*( 1*SP URI ) RDQUOT, URI =  absoluteURI / abs-path
-	nonce      string      // nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-	opaque     string      // opaque =  "opaque" EQUAL quoted-string
-	stale      bool        // stale =  "stale" EQUAL ( "true" / "false" )
-	algorithm  string      // algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-	qop        string      // qop-options =  "qop" EQUAL LDQUOT qop-value,*("," qop-value) RDQUOT,qop-value =  "auth" / "auth-int" / token
-	authParam  sync.Map    // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-	isOrder    bool        // Determine whether the analysis is the result of the analysis and whether it is sorted during the analysis
-	order      chan string // It is convenient to record the order of the original parameter fields when parsing
-	source     string      // source string
+	field      string   // "WWW-Authenticate"
+	authSchema string   // auth-schema: Basic / Digest
+	realm      string   // realm =  "realm" EQUAL realm-value,realm-value =  quoted-string
+	domain     string   // domain =  "domain" EQUAL LDQUOT URI,*( 1*SP URI ) RDQUOT, URI =  absoluteURI / abs-path
+	nonce      string   // nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
+	opaque     string   // opaque =  "opaque" EQUAL quoted-string
+	stale      bool     // stale =  "stale" EQUAL ( "true" / "false" )
+	algorithm  string   // algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
+	qop        string   // qop-options =  "qop" EQUAL LDQUOT qop-value,*("," qop-value) RDQUOT,qop-value =  "auth" / "auth-int" / token
+	authParam  *Params  // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
+	order      []string // parameter names in the parsed order,the typed parameters included
+	source     string   // source string
 }
 
 // "WWW-Authenticate"
 func (wa *WWWAuthenticate) SetField(field string) {
-	if regexp.MustCompile(`^(?i)(www-authenticate)$`).MatchString(field) {
+	if scanFieldIs(field, "www-authenticate") {
 		wa.field = strings.Title(field)
 	} else {
 		wa.field = "WWW-Authenticate"
@@ -198,7 +194,7 @@ func (wa *WWWAuthenticate) GetField() string {
 
 // auth-schema: Basic / Digest
 func (wa *WWWAuthenticate) SetAuthSchema(authSchema string) {
-	if regexp.MustCompile(`(?i)(basic|digest)`).MatchString(authSchema) {
+	if scanFieldIs(authSchema, "basic", "digest") {
 		wa.authSchema = strings.Title(authSchema)
 	}
 	wa.authSchema = "Digest"
@@ -264,10 +260,10 @@ func (wa *WWWAuthenticate) GetQop() string {
 }
 
 // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-func (wa *WWWAuthenticate) SetAuthParam(authParam sync.Map) {
+func (wa *WWWAuthenticate) SetAuthParam(authParam *Params) {
 	wa.authParam = authParam
 }
-func (wa *WWWAuthenticate) GetAuthParam() sync.Map {
+func (wa *WWWAuthenticate) GetAuthParam() *Params {
 	return wa.authParam
 }
 
@@ -275,7 +271,7 @@ func (wa *WWWAuthenticate) GetAuthParam() sync.Map {
 func (wa *WWWAuthenticate) GetSource() string {
 	return wa.source
 }
-func NewWWWAuthenticate(realm string, domain string, nonce string, opaque string, stale bool, algorithm string, qop string, authParam sync.Map) *WWWAuthenticate {
+func NewWWWAuthenticate(realm string, domain string, nonce string, opaque string, stale bool, algorithm string, qop string, authParam *Params) *WWWAuthenticate {
 	return &WWWAuthenticate{
 		field:      "WWW-Authenticate",
 		authSchema: "Digest",
@@ -287,264 +283,112 @@ func NewWWWAuthenticate(realm string, domain string, nonce string, opaque string
 		algorithm:  algorithm,
 		qop:        qop,
 		authParam:  authParam,
-		isOrder:    false,
 	}
 }
 func (wa *WWWAuthenticate) Raw() (result strings.Builder) {
 
 	//  "WWW-Authenticate"
-	if len(strings.TrimSpace(wa.field)) == 0 {
-		wa.field = "WWW-Authenticate"
-		result.WriteString(fmt.Sprintf("%s:", strings.Title(wa.field)))
+	field := wa.field
+	if len(strings.TrimSpace(field)) == 0 {
+		field = "WWW-Authenticate"
+		result.WriteString(fmt.Sprintf("%s:", strings.Title(field)))
 	} else {
-		result.WriteString(fmt.Sprintf("%s:", wa.field))
+		result.WriteString(fmt.Sprintf("%s:", field))
 	}
 	// auth-schema: Basic / Digest
-	if len(strings.TrimSpace(wa.authSchema)) == 0 {
-		wa.authSchema = "Digest"
-		result.WriteString(fmt.Sprintf(" %s", strings.Title(wa.authSchema)))
+	authSchema := wa.authSchema
+	if len(strings.TrimSpace(authSchema)) == 0 {
+		authSchema = "Digest"
+		result.WriteString(fmt.Sprintf(" %s", strings.Title(authSchema)))
 	} else {
-		result.WriteString(fmt.Sprintf(" %s", wa.authSchema))
+		result.WriteString(fmt.Sprintf(" %s", authSchema))
 	}
-	if wa.isOrder {
-		wa.isOrder = false
-		for orders := range wa.order {
-			if regexp.MustCompile(`((?i)(realm))( )*=`).MatchString(orders) {
-				// realm = "realm" EQUAL realm-value,realm-value = quoted-string
-				if len(strings.TrimSpace(wa.realm)) > 0 {
-					result.WriteString(fmt.Sprintf(" realm=\"%s\",", wa.realm))
-					continue
-				}
-			}
-			if regexp.MustCompile(`((?i)(domain))( )*=`).MatchString(orders) {
-				// domain =  "domain" EQUAL LDQUOT URI,*( 1*SP URI ) RDQUOT, URI =  absoluteURI / abs-path
-				if len(strings.TrimSpace(wa.domain)) > 0 {
-					result.WriteString(fmt.Sprintf(" domain=\"%s\",", wa.domain))
-					continue
-				}
-			}
-			if regexp.MustCompile(`((?i)(nonce))( )*=`).MatchString(orders) {
-				// nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-				if len(strings.TrimSpace(wa.nonce)) > 0 {
-					result.WriteString(fmt.Sprintf(" nonce=\"%s\",", wa.nonce))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(opaque))( )*=`).MatchString(orders) {
-				// opaque =  "opaque" EQUAL quoted-string
-				if len(strings.TrimSpace(wa.opaque)) > 0 {
-					result.WriteString(fmt.Sprintf(" opaque=\"%s\",", wa.opaque))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(stale))( )*=`).MatchString(orders) {
-				// stale =  "stale" EQUAL ( "true" / "false" )
-				if wa.stale {
-					result.WriteString(fmt.Sprintf(" stale=\"%v\",", wa.stale))
-				}
-				continue
-			}
-
-			if regexp.MustCompile(`((?i)(algorithm))( )*=`).MatchString(orders) {
-				// algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-				if len(strings.TrimSpace(wa.algorithm)) > 0 {
-					result.WriteString(fmt.Sprintf(" algorithm=%s,", wa.algorithm))
-				}
-				continue
-			}
-			if regexp.MustCompile(`((?i)(qop))( )*=`).MatchString(orders) {
-				// qop-options =  "qop" EQUAL LDQUOT qop-value,*("," qop-value) RDQUOT,qop-value =  "auth" / "auth-int" / token
-				if len(strings.TrimSpace(wa.qop)) > 0 {
-					result.WriteString(fmt.Sprintf(" qop=\"%s\",", wa.qop))
-				}
-				continue
-			}
-			ordersSlice := strings.Split(orders, "=")
-			if len(ordersSlice) == 1 {
-				if val, ok := wa.authParam.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf("  %v=\"%v\",", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-					}
-				} else {
-					result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-				}
-			} else {
-				if val, ok := wa.authParam.LoadAndDelete(ordersSlice[0]); ok {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", val))) > 0 {
-						result.WriteString(fmt.Sprintf(" %v=\"%v\",", ordersSlice[0], val))
-					} else {
-						result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-					}
-
-				} else {
-					if len(strings.TrimSpace(fmt.Sprintf("%v", ordersSlice[1]))) > 0 {
-						result.WriteString(fmt.Sprintf("  %v=\"%v\",", ordersSlice[0], ordersSlice[1]))
-					} else {
-						result.WriteString(fmt.Sprintf(" %v,", ordersSlice[0]))
-					}
-				}
-			}
-		}
-
-	} else {
-		// realm = "realm" EQUAL realm-value,realm-value = quoted-string
-		if len(strings.TrimSpace(wa.realm)) > 0 {
-			result.WriteString(fmt.Sprintf(" realm=\"%s\",", wa.realm))
-		}
-		// domain =  "domain" EQUAL LDQUOT URI,*( 1*SP URI ) RDQUOT, URI =  absoluteURI / abs-path
-		if len(strings.TrimSpace(wa.domain)) > 0 {
-			result.WriteString(fmt.Sprintf(" domain=\"%s\",", wa.domain))
-		}
-		// nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-		if len(strings.TrimSpace(wa.nonce)) > 0 {
-			result.WriteString(fmt.Sprintf(" nonce=\"%s\",", wa.nonce))
-		}
-		// opaque =  "opaque" EQUAL quoted-string
-		if len(strings.TrimSpace(wa.opaque)) > 0 {
-			result.WriteString(fmt.Sprintf(" opaque=\"%s\",", wa.opaque))
-		}
-		// stale =  "stale" EQUAL ( "true" / "false" )
-		if wa.stale {
-			result.WriteString(fmt.Sprintf(" stale=\"%v\",", wa.stale))
-		}
-		// algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-		if len(strings.TrimSpace(wa.algorithm)) > 0 {
-			result.WriteString(fmt.Sprintf(" algorithm=%s,", wa.algorithm))
-		}
-		// qop-options =  "qop" EQUAL LDQUOT qop-value,*("," qop-value) RDQUOT,qop-value =  "auth" / "auth-int" / token
-		if len(strings.TrimSpace(wa.qop)) > 0 {
-			result.WriteString(fmt.Sprintf(" qop=\"%s\",", wa.qop))
-		}
+	typed := NewParams()
+	// realm = "realm" EQUAL realm-value,realm-value = quoted-string
+	if len(strings.TrimSpace(wa.realm)) > 0 {
+		typed.SetQuoted("realm", wa.realm)
+	}
+	// domain =  "domain" EQUAL LDQUOT URI,*( 1*SP URI ) RDQUOT, URI =  absoluteURI / abs-path
+	if len(strings.TrimSpace(wa.domain)) > 0 {
+		typed.SetQuoted("domain", wa.domain)
+	}
+	// nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
+	if len(strings.TrimSpace(wa.nonce)) > 0 {
+		typed.SetQuoted("nonce", wa.nonce)
+	}
+	// opaque =  "opaque" EQUAL quoted-string
+	if len(strings.TrimSpace(wa.opaque)) > 0 {
+		typed.SetQuoted("opaque", wa.opaque)
+	}
+	// stale =  "stale" EQUAL ( "true" / "false" )
+	if wa.stale {
+		typed.SetQuoted("stale", "true")
+	}
+	// algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
+	if len(strings.TrimSpace(wa.algorithm)) > 0 {
+		typed.Set("algorithm", wa.algorithm)
+	}
+	// qop-options =  "qop" EQUAL LDQUOT qop-value,*("," qop-value) RDQUOT,qop-value =  "auth" / "auth-int" / token
+	if len(strings.TrimSpace(wa.qop)) > 0 {
+		typed.SetQuoted("qop", wa.qop)
 	}
 	// auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-	wa.authParam.Range(func(key, value interface{}) bool {
-		if reflect.ValueOf(value).IsValid() {
-			if reflect.ValueOf(value).IsZero() {
-				result.WriteString(fmt.Sprintf(" %v,", key))
-				return true
-			}
-			result.WriteString(fmt.Sprintf(" %v=\"%v\",", key, value))
-			return true
-		}
-		result.WriteString(fmt.Sprintf(" %v,", key))
-		return true
-	})
-	temp := result.String()
-	temp = strings.TrimSuffix(temp, ",")
-	result.Reset()
-	result.WriteString(temp)
+	result.WriteString(paramsMerge(wa.order, typed, wa.authParam).raw(" ", ", ", true))
 	result.WriteString("\r\n")
 	return
 }
-func (wa *WWWAuthenticate) Parse(raw string) {
-	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
+func (wa *WWWAuthenticate) Parse(raw string) error {
+	raw = scanLine(raw)
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("WWW-Authenticate", raw, 0, `WWW-Authenticate  =  "WWW-Authenticate" HCOLON challenge`)
 	}
-	// field regexp
-	fieldRegexp := regexp.MustCompile(`((?i)(?:^www-authenticate))( )*:`)
-	if !fieldRegexp.MatchString(raw) {
-		return
+	field, value, ok := scanField(raw, "www-authenticate")
+	if !ok {
+		return NewParseError("WWW-Authenticate", raw, 0, `WWW-Authenticate  =  "WWW-Authenticate" HCOLON challenge`)
 	}
 	wa.source = raw
-	wa.authParam = sync.Map{}
+	wa.authParam = NewParams()
+	wa.order = nil
 	wa.algorithm = "MD5"
-	field := fieldRegexp.FindString(raw)
-	field = regexp.MustCompile(`:`).ReplaceAllString(field, "")
-	field = stringTrimPrefixAndTrimSuffix(field, " ")
-	wa.field = field
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	// auth-schema regexp
-	authschemaRegexp := regexp.MustCompile(`(?i)(basic|digest)`)
-	if authschemaRegexp.MatchString(raw) {
-		authschema := authschemaRegexp.FindString(raw)
-		wa.authSchema = authschema
-		raw = authschemaRegexp.ReplaceAllString(raw, "")
+	wa.field = stringTrimPrefixAndTrimSuffix(field, " ")
+	raw = stringTrimPrefixAndTrimSuffix(value, " ")
+	// auth-schema
+	if authSchema := scanUntil(raw, " "); scanFieldIs(authSchema, "basic", "digest") {
+		wa.authSchema = authSchema
+		raw = raw[len(authSchema):]
 	}
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	raw = stringTrimPrefixAndTrimSuffix(raw, ",")
 	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
 	if len(strings.TrimSpace(raw)) == 0 {
-		return
+		return NewParseError("WWW-Authenticate", wa.source, len(wa.source), `challenge  =  ("Digest" LWS digest-cln *(COMMA digest-cln)) / other-challenge`)
 	}
 
-	// www-authenticate order
-	wa.wwwAuthenticateOrder(raw)
-
-	// realm regexp : realm = "realm" EQUAL realm-value,realm-value = quoted-string
-	realmRegexp := regexp.MustCompile(`((?i)(?:^realm))( )*=`)
-	// domain regexp ：domain =  "domain" EQUAL LDQUOT URI,*( 1*SP URI ) RDQUOT, URI =  absoluteURI / abs-path
-	domainRegexp := regexp.MustCompile(`((?i)(?:^domain))( )*=`)
-	// nonce regexp : nonce = "nonce" EQUAL nonce-value,nonce-value = quoted-string
-	nonceRegexp := regexp.MustCompile(`((?i)(?:^nonce))( )*=`)
-	// opaque     regexp opaque =  "opaque" EQUAL quoted-string
-	opaqueRegexp := regexp.MustCompile(`((?i)(?:^opaque))( )*=`)
-	// stale =  "stale" EQUAL ( "true" / "false" )
-	staleRegexp := regexp.MustCompile(`((?i)(?:^stale))( )*=`)
-	// algorithm regexp algorithm = "algorithm" EQUAL ( "MD5" / "MD5-sess"/ token )
-	algorithmRegexp := regexp.MustCompile(`((?i)(?:^algorithm))( )*=`)
-	// qop        regexp message-qop = "qop" EQUAL qop-value,qop-value = "auth" / "auth-int" / token
-	qopRegexp := regexp.MustCompile(`((?i)(?:^qop))( )*=`)
-
-	rawSlice := strings.Split(raw, ",")
-	for _, raws := range rawSlice {
-		raws = stringTrimPrefixAndTrimSuffix(raws, " ")
-		switch {
-		case realmRegexp.MatchString(raws):
-			realm := realmRegexp.ReplaceAllString(raws, "")
-			realm = regexp.MustCompile(`"`).ReplaceAllString(realm, "")
-			wa.realm = realm
-		case domainRegexp.MatchString(raws):
-			domain := domainRegexp.ReplaceAllString(raw, "")
-			domain = regexp.MustCompile(`"`).ReplaceAllString(domain, "")
-			wa.domain = domain
-		case nonceRegexp.MatchString(raws):
-			nonce := nonceRegexp.ReplaceAllString(raws, "")
-			nonce = regexp.MustCompile(`"`).ReplaceAllString(nonce, "")
-			wa.nonce = nonce
-		case opaqueRegexp.MatchString(raws):
-			opaque := opaqueRegexp.ReplaceAllString(raws, "")
-			opaque = regexp.MustCompile(`"`).ReplaceAllString(opaque, "")
-			wa.opaque = opaque
-		case staleRegexp.MatchString(raws):
-			stale := opaqueRegexp.ReplaceAllString(raws, "")
-			stale = regexp.MustCompile(`"`).ReplaceAllString(stale, "")
-			if regexp.MustCompile(`(?i)(true)`).MatchString(stale) {
-				wa.stale = true
-			}
-		case algorithmRegexp.MatchString(raws):
-			algorithm := algorithmRegexp.ReplaceAllString(raws, "")
-			algorithm = regexp.MustCompile(`"`).ReplaceAllString(algorithm, "")
-			wa.algorithm = algorithm
-		case qopRegexp.MatchString(raws):
-			qop := qopRegexp.ReplaceAllString(raws, "")
-			qop = regexp.MustCompile(`"`).ReplaceAllString(qop, "")
-			wa.qop = qop
+	// digest-cln  =  realm / domain / nonce / opaque / stale / algorithm / qop-options / auth-param
+	parameter := NewParams()
+	if err := parameter.parse(raw, ','); err != nil {
+		return parseErrorWrap(err, wa.source, raw)
+	}
+	for _, p := range parameter.list() {
+		wa.order = append(wa.order, p.name)
+		switch strings.ToLower(p.name) {
+		case "realm":
+			wa.realm = p.value
+		case "domain":
+			wa.domain = p.value
+		case "nonce":
+			wa.nonce = p.value
+		case "opaque":
+			wa.opaque = p.value
+		case "stale":
+			wa.stale = strings.EqualFold(p.value, "true")
+		case "algorithm":
+			wa.algorithm = p.value
+		case "qop":
+			wa.qop = p.value
 		default:
-			// authParam  sync.Map    // auth-param = auth-param-name EQUAL ( token / quoted-string ),auth-param-name = token
-			kvs := strings.Split(raws, "=")
-			if len(kvs) == 1 {
-				wa.authParam.Store(kvs[0], "")
-			} else {
-				wa.authParam.Store(kvs[0], kvs[1])
-			}
+			wa.authParam.set(p)
 		}
 	}
-
-}
-func (wa *WWWAuthenticate) wwwAuthenticateOrder(raw string) {
-	wa.isOrder = true
-	wa.order = make(chan string, 1024)
-	defer close(wa.order)
-	raw = stringTrimPrefixAndTrimSuffix(raw, ",")
-	raw = stringTrimPrefixAndTrimSuffix(raw, " ")
-	rawSlice := strings.Split(raw, ",")
-	for _, raws := range rawSlice {
-		wa.order <- raws
-	}
+	return nil
 }
@@ -2,17 +2,16 @@ package sip
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 )
 
 func TestWWWAuthenticate_Raw(t *testing.T) {
 	was := []*WWWAuthenticate{
-		NewWWWAuthenticate("3402000001", "", "69c1ad64c2e5323a883be2469838589ce", "", false, "MD5", "auth", sync.Map{}),
-		NewWWWAuthenticate("3402000001", "", "f9e3df022ed622c0f886b9e2d0dad507", "", false, "MD5", "auth", sync.Map{}),
-		NewWWWAuthenticate("3402000001", "", GetNonce("192.168.124.29", "ZRJOgEycUtwwPBSncBTPgElUUemRsiIJ"), "", false, "MD5", "auth", sync.Map{}),
-		NewWWWAuthenticate("3402000000", "", GetNonce("192.168.0.1", "call-id"), "", false, "MD5", "auth", sync.Map{}),
-		NewWWWAuthenticate("3402000000", "", GetNonce("192.168.0.1", "call-id"), "", false, "MD5", "auth", sync.Map{}),
+		NewWWWAuthenticate("3402000001", "", "69c1ad64c2e5323a883be2469838589ce", "", false, "MD5", "auth", nil),
+		NewWWWAuthenticate("3402000001", "", "f9e3df022ed622c0f886b9e2d0dad507", "", false, "MD5", "auth", nil),
+		NewWWWAuthenticate("3402000001", "", GenNonce("192.168.124.29", "ZRJOgEycUtwwPBSncBTPgElUUemRsiIJ"), "", false, "MD5", "auth", nil),
+		NewWWWAuthenticate("3402000000", "", GenNonce("192.168.0.1", "call-id"), "", false, "MD5", "auth", nil),
+		NewWWWAuthenticate("3402000000", "", GenNonce("192.168.0.1", "call-id"), "", false, "MD5", "auth", nil),
 	}
 	for _, wa := range was {
 